@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+// validateCheckConfig validates the configs of the /api/check endpoint against the instantiated providers.
+func validateCheckConfig(conf config.Config, providers []oauth.Provider) error {
+	// The precedence between the session cookie and the bearer token must be known.
+	if precedence := conf.Check.TokenPrecedence; precedence != "" && precedence != "cookie" && precedence != "header" {
+		return fmt.Errorf("unknown token precedence: %q", precedence)
+	}
+
+	forwardConf := conf.Check.ForwardAuth
+	if !forwardConf.Enabled {
+		return nil
+	}
+
+	// The sign-in needs a provider to redirect to.
+	if !slices.ContainsFunc(providers, func(p oauth.Provider) bool { return p.Name() == forwardConf.Provider }) {
+		return fmt.Errorf("forward-auth provider %q is not configured", forwardConf.Provider)
+	}
+
+	if forwardConf.Status != 0 && forwardConf.Status != http.StatusFound &&
+		forwardConf.Status != http.StatusUnauthorized {
+		return fmt.Errorf("forward-auth status must be 302 or 401, got %d", forwardConf.Status)
+	}
+
+	// Without the hosts, the original URLs can never be returned to.
+	if len(forwardConf.AllowedHosts) == 0 {
+		return fmt.Errorf("forward-auth allowed hosts are required")
+	}
+
+	return nil
+}
@@ -14,22 +14,19 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 
 	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/grpc"
 	"github.com/shivanshkc/authorizer/internal/handler"
 	"github.com/shivanshkc/authorizer/internal/http"
 	"github.com/shivanshkc/authorizer/internal/logger"
 	"github.com/shivanshkc/authorizer/internal/middleware"
+	"github.com/shivanshkc/authorizer/internal/policy"
 	"github.com/shivanshkc/authorizer/internal/repository"
-	"github.com/shivanshkc/authorizer/pkg/oauth"
 
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
-// googleScopes for OAuth with Google.
-const googleScopes = "https://www.googleapis.com/auth/userinfo.email " +
-	"https://www.googleapis.com/auth/userinfo.profile"
-
 func main() {
 	// Root application context.
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -45,16 +42,60 @@ func main() {
 		panic("failed to connect database and run migrations: " + err.Error())
 	}
 
-	// Instantiate the OAuth client for Google.
-	gCallback := fmt.Sprintf("%s/api/auth/google/callback", conf.Application.BaseURL)
-	gProvider, err := oauth.NewGoogle(ctx, conf.Google.ClientID, conf.Google.ClientSecret, gCallback, googleScopes)
+	// Instantiate all the configured OAuth providers.
+	providers, err := buildProviders(ctx, conf)
+	if err != nil {
+		cleanup(database, nil, nil)
+		panic("failed to initialize providers: " + err.Error())
+	}
+
+	repo := repository.NewRepository(database)
+
+	// Instantiate the store of the OAuth flow states, or the state cookies.
+	states, stateCookies, err := buildStateStore(ctx, conf, repo)
+	if err != nil {
+		cleanup(database, nil, nil)
+		panic("failed to initialize state store: " + err.Error())
+	}
+
+	// Instantiate the session manager that issues Authorizer's own tokens.
+	sessions, err := buildSessionManager(ctx, conf, repo)
+	if err != nil {
+		cleanup(database, nil, nil)
+		panic("failed to initialize session manager: " + err.Error())
+	}
+
+	// Instantiate the cipher for the providers' refresh tokens.
+	refreshTokens, err := buildRefreshTokenCipher(ctx, conf)
 	if err != nil {
-		cleanup(database, nil)
-		panic("failed to initialize google provider: " + err.Error())
+		cleanup(database, nil, nil)
+		panic("failed to initialize refresh token cipher: " + err.Error())
 	}
 
+	// Validate the configs of the check endpoint, which depend upon the providers.
+	if err := validateCheckConfig(conf, providers); err != nil {
+		cleanup(database, nil, nil)
+		panic("invalid check configs: " + err.Error())
+	}
+
+	// Instantiate the policies of the check endpoint.
+	policies, err := policy.NewEngine(conf.Policies)
+	if err != nil {
+		cleanup(database, nil, nil)
+		panic("invalid policies: " + err.Error())
+	}
+
+	// The policies are reloaded when the configs file changes. Invalid ones are rejected, and the current ones stay.
+	config.Watch(func(reloaded config.Config) {
+		if err := policies.Update(reloaded.Policies); err != nil {
+			slog.Error("failed to reload policies", "error", err)
+			return
+		}
+		slog.Info("Reloaded policies", "rules", len(reloaded.Policies.Rules), "dry_run", reloaded.Policies.DryRun)
+	})
+
 	// Initialize the HTTP server.
-	handlers := handler.NewHandler(conf, gProvider, nil, repository.NewRepository(database))
+	handlers := handler.NewHandler(conf, providers, states, stateCookies, sessions, refreshTokens, policies, repo)
 	server := &http.Server{Config: conf, Middleware: middleware.Middleware{}, Handler: handlers}
 
 	// Start the server and unblock the main thread if it returns.
@@ -65,8 +106,20 @@ func main() {
 		cancel()
 	}()
 
+	// Start the gRPC server for Envoy's ext_authz, if configured. It also unblocks the main thread if it returns.
+	var grpcServer *grpc.Server
+	if conf.GRPCServer.Addr != "" {
+		grpcServer = &grpc.Server{Config: conf, Handler: handlers}
+		go func() {
+			if err := grpcServer.Start(); err != nil {
+				slog.Error("Error in grpcServer.Start call:", "error", err)
+			}
+			cancel()
+		}()
+	}
+
 	<-ctx.Done()
-	cleanup(database, server)
+	cleanup(database, server, grpcServer)
 }
 
 func connectDatabaseAndRunMigrations(ctx context.Context, conf config.Config) (*sql.DB, error) {
@@ -108,7 +161,7 @@ func connectDatabaseAndRunMigrations(ctx context.Context, conf config.Config) (*
 	return database, nil
 }
 
-func cleanup(database *sql.DB, server *http.Server) {
+func cleanup(database *sql.DB, server *http.Server, grpcServer *grpc.Server) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -119,4 +172,8 @@ func cleanup(database *sql.DB, server *http.Server) {
 	if server != nil {
 		server.Shutdown(ctx)
 	}
+
+	if grpcServer != nil {
+		grpcServer.Shutdown(ctx)
+	}
 }
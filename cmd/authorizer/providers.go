@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+const (
+	// googleScopes for OAuth with Google.
+	googleScopes = "https://www.googleapis.com/auth/userinfo.email " +
+		"https://www.googleapis.com/auth/userinfo.profile"
+	// githubScopes for OAuth with GitHub.
+	githubScopes = "read:user user:email"
+	// discordScopes for OAuth with Discord.
+	discordScopes = "identify email"
+	// microsoftScopes for OAuth with Microsoft Entra ID.
+	microsoftScopes = "openid email profile"
+	// appleScopes for OAuth with Apple.
+	appleScopes = "name email"
+	// oidcScopes for OAuth with a generic OpenID Connect provider.
+	oidcScopes = "openid email profile"
+)
+
+// buildProviders instantiates all the OAuth providers listed in the configs.
+func buildProviders(ctx context.Context, conf config.Config) ([]oauth.Provider, error) {
+	providers := make([]oauth.Provider, 0, len(conf.Providers))
+	// To detect duplicate names, as they would make the routes ambiguous.
+	names := map[string]struct{}{}
+
+	for _, pConf := range conf.Providers {
+		provider, err := buildProvider(ctx, conf, pConf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build provider %q: %w", pConf.Type, err)
+		}
+
+		if _, exists := names[provider.Name()]; exists {
+			return nil, fmt.Errorf("provider %q is configured more than once", provider.Name())
+		}
+
+		names[provider.Name()] = struct{}{}
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
+// buildProvider instantiates a single OAuth provider as per its type.
+func buildProvider(ctx context.Context, conf config.Config, pConf config.Provider) (oauth.Provider, error) {
+	// Provider name defaults to its type.
+	name := pConf.Name
+	if name == "" {
+		name = pConf.Type
+	}
+
+	// Only the generic types can be given custom names.
+	if pConf.Type != "oidc" && name != pConf.Type {
+		return nil, fmt.Errorf("provider of type %q can not be renamed", pConf.Type)
+	}
+
+	// The provider calls back on this URL after authentication.
+	callbackURL := fmt.Sprintf("%s/api/auth/%s/callback", conf.Application.BaseURL, name)
+
+	switch pConf.Type {
+	case "google":
+		scopes := withDefault(pConf.Scopes, googleScopes)
+		// Refresh tokens are stored only if they can be encrypted, so they are not asked for otherwise.
+		offlineAccess := conf.Session.EncryptionKey != ""
+		return oauth.NewGoogle(ctx, pConf.ClientID, pConf.ClientSecret, callbackURL, scopes, offlineAccess)
+	case "github":
+		scopes := withDefault(pConf.Scopes, githubScopes)
+		return oauth.NewGitHub(pConf.ClientID, pConf.ClientSecret, callbackURL, scopes), nil
+	case "discord":
+		scopes := withDefault(pConf.Scopes, discordScopes)
+		return oauth.NewDiscord(pConf.ClientID, pConf.ClientSecret, callbackURL, scopes), nil
+	case "microsoft":
+		scopes := withDefault(pConf.Scopes, microsoftScopes)
+		return oauth.NewMicrosoft(ctx, pConf.Tenant, pConf.AllowedTenants,
+			pConf.ClientID, pConf.ClientSecret, callbackURL, scopes)
+	case "apple":
+		if pConf.TeamID == "" || pConf.KeyID == "" || pConf.PrivateKeyPath == "" {
+			return nil, fmt.Errorf("team_id, key_id and private_key_path are required for apple providers")
+		}
+		privateKey, err := os.ReadFile(pConf.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		scopes := withDefault(pConf.Scopes, appleScopes)
+		return oauth.NewApple(ctx, pConf.ClientID, pConf.TeamID, pConf.KeyID, privateKey, callbackURL, scopes)
+	case "oidc":
+		if pConf.IssuerURL == "" {
+			return nil, fmt.Errorf("issuer_url is required for oidc providers")
+		}
+		scopes := withDefault(pConf.Scopes, oidcScopes)
+		return oauth.NewOIDC(ctx, name, pConf.IssuerURL, pConf.ClientID, pConf.ClientSecret, callbackURL, scopes)
+	default:
+		return nil, fmt.Errorf("unknown provider type: %q", pConf.Type)
+	}
+}
+
+// withDefault returns the given value if it is not empty, otherwise the default value.
+func withDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
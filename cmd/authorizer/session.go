@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/internal/utils/cryptoutils"
+)
+
+const (
+	// defaultKeyRotationInterval is the default age after which a signing key is rotated.
+	defaultKeyRotationInterval = time.Hour * 24 * 30
+	// defaultKeyRefreshInterval is the default interval at which the signing keys are reloaded.
+	defaultKeyRefreshInterval = time.Minute
+	// sessionSweepInterval is the interval at which the expired sessions are deleted.
+	sessionSweepInterval = time.Hour
+)
+
+// buildSessionManager instantiates the session manager along with its keyring, as per the configs. It also starts
+// sweeping the expired sessions until the given context is cancelled.
+func buildSessionManager(ctx context.Context, conf config.Config, repo repository.Repository,
+) (*session.Manager, error) {
+	keysConf := conf.Session.Keys
+
+	// Assertions are signed by the same keys, so they must not be mistaken for session tokens.
+	if assertionConf := conf.Check.Assertion; assertionConf.Enabled &&
+		(assertionConf.Audience == "" || assertionConf.Audience == conf.Application.BaseURL) {
+		return nil, fmt.Errorf("assertion audience is required and must differ from the base URL")
+	}
+
+	// Tokens live for the idle timeout at most.
+	idleTimeout := conf.Session.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = session.DefaultIdleTimeout
+	}
+
+	refreshInterval := keysConf.RefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = defaultKeyRefreshInterval
+	}
+
+	var source session.KeySource
+	switch keysConf.Source {
+	case "", "postgres":
+		rotationInterval := keysConf.RotationInterval
+		if rotationInterval <= 0 {
+			rotationInterval = defaultKeyRotationInterval
+		}
+
+		// Retired keys must stay published for as long as the sessions signed by them are valid.
+		gracePeriod := keysConf.GracePeriod
+		if gracePeriod <= 0 {
+			gracePeriod = idleTimeout
+		}
+		if gracePeriod < idleTimeout {
+			slog.WarnContext(ctx, "key grace period is shorter than the session idle timeout, "+
+				"some sessions will be invalidated upon rotation", "grace_period", gracePeriod,
+				"idle_timeout", idleTimeout)
+		}
+
+		// New keys activate after a refresh interval, so that all replicas know them before they are used.
+		source = session.NewDatabaseKeySource(repo, rotationInterval, refreshInterval, gracePeriod)
+	case "files":
+		if len(keysConf.Files) == 0 {
+			return nil, fmt.Errorf("files are required for the files key source")
+		}
+		source = session.NewFileKeySource(keysConf.Files...)
+	case "ephemeral":
+		slog.WarnContext(ctx, "using an ephemeral session key, sessions will not survive restarts")
+		ephemeral, err := session.NewEphemeralKeySource()
+		if err != nil {
+			return nil, fmt.Errorf("error in session.NewEphemeralKeySource call: %w", err)
+		}
+		source = ephemeral
+	default:
+		return nil, fmt.Errorf("unknown key source: %q", keysConf.Source)
+	}
+
+	keyring, err := session.NewKeyring(ctx, source, refreshInterval)
+	if err != nil {
+		return nil, fmt.Errorf("error in session.NewKeyring call: %w", err)
+	}
+
+	session.NewSweeper(ctx, repo, sessionSweepInterval)
+	return session.NewManager(conf.Application.BaseURL, idleTimeout, conf.Session.AbsoluteTimeout, keyring), nil
+}
+
+// buildRefreshTokenCipher instantiates the cipher that encrypts the providers' refresh tokens, as per the configs.
+// It returns nil if no encryption key is configured, in which case the refresh tokens are not stored.
+func buildRefreshTokenCipher(ctx context.Context, conf config.Config) (*cryptoutils.AEAD, error) {
+	if conf.Session.EncryptionKey == "" {
+		slog.WarnContext(ctx, "no session encryption key configured, refresh tokens will not be stored")
+		return nil, nil
+	}
+
+	cipher, err := cryptoutils.NewAEADFromBase64(conf.Session.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("error in cryptoutils.NewAEADFromBase64 call: %w", err)
+	}
+
+	return cipher, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/statestore"
+	"github.com/shivanshkc/authorizer/internal/utils/cryptoutils"
+)
+
+const (
+	// defaultStateTTL is the default max allowed time for a provider to invoke the callback API.
+	defaultStateTTL = time.Minute
+	// defaultMaxStates is the default cap on the number of outstanding states of the memory and postgres stores.
+	defaultMaxStates = 10000
+)
+
+// buildStateStore instantiates the store of the OAuth flow states, as per the configs. For the "cookie" type, it
+// instantiates the state cookies instead, and the store is nil.
+//
+// The stores sweep the expired states until the given context is cancelled.
+func buildStateStore(ctx context.Context, conf config.Config, repo repository.Repository,
+) (statestore.StateStore, *statestore.CookieStore, error) {
+	ttl := conf.StateStore.TTL
+	if ttl <= 0 {
+		ttl = defaultStateTTL
+	}
+
+	maxStates := conf.StateStore.MaxStates
+	if maxStates == 0 {
+		maxStates = defaultMaxStates
+	}
+
+	switch conf.StateStore.Type {
+	case "", "memory":
+		return statestore.NewMemoryStore(ctx, ttl, maxStates), nil, nil
+	case "postgres":
+		return statestore.NewDatabaseStore(ctx, repo, ttl, maxStates), nil, nil
+	case "cookie":
+		if conf.StateStore.EncryptionKey == "" {
+			return nil, nil, fmt.Errorf("the cookie state store requires an encryption key")
+		}
+
+		aead, err := cryptoutils.NewAEADFromBase64(conf.StateStore.EncryptionKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error in cryptoutils.NewAEADFromBase64 call: %w", err)
+		}
+
+		return nil, statestore.NewCookieStore(aead, ttl), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown state store type: %q", conf.StateStore.Type)
+	}
+}
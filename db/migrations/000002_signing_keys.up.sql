@@ -0,0 +1,5 @@
+CREATE TABLE signing_keys (
+   id VARCHAR(100) PRIMARY KEY,
+   private_key TEXT NOT NULL,
+   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,9 @@
+CREATE TABLE sessions (
+   id UUID PRIMARY KEY,
+   user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+   provider VARCHAR(100) NOT NULL,
+   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,2 @@
+-- The refresh token is encrypted by the application. It is empty if the provider did not issue one.
+ALTER TABLE sessions ADD COLUMN refresh_token TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+CREATE TABLE oauth_states (
+   key VARCHAR(100) PRIMARY KEY,
+   value JSONB NOT NULL,
+   expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX oauth_states_expires_at_idx ON oauth_states (expires_at);
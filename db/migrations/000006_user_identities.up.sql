@@ -0,0 +1,19 @@
+CREATE TABLE user_identities (
+   provider VARCHAR(100) NOT NULL,
+   subject VARCHAR(255) NOT NULL,
+   user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+   email VARCHAR(255) NOT NULL,
+   given_name VARCHAR(100) NOT NULL DEFAULT '',
+   family_name VARCHAR(100) NOT NULL DEFAULT '',
+   picture_url VARCHAR(2048) NOT NULL DEFAULT '',
+   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+CREATE TRIGGER update_user_identities_updated_at
+    BEFORE UPDATE ON user_identities
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,21 @@
+CREATE TABLE roles (
+   name VARCHAR(100) PRIMARY KEY,
+   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Permissions granted to the roles.
+CREATE TABLE permissions (
+   role VARCHAR(100) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+   name VARCHAR(255) NOT NULL,
+   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   PRIMARY KEY (role, name)
+);
+
+CREATE TABLE user_roles (
+   user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+   role VARCHAR(100) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX user_roles_role_idx ON user_roles (role);
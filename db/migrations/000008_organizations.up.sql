@@ -0,0 +1,27 @@
+CREATE TABLE organizations (
+   id VARCHAR(100) PRIMARY KEY,
+   name VARCHAR(255) NOT NULL,
+   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Members of the organizations, with their role in each.
+CREATE TABLE org_memberships (
+   org_id VARCHAR(100) NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+   user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+   role VARCHAR(100) NOT NULL,
+   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX org_memberships_user_id_idx ON org_memberships (user_id);
+
+-- Pending invitations, keyed by the lowercase email. An invitation becomes a membership upon the invited user's
+-- sign-in to the organization.
+CREATE TABLE org_invitations (
+   org_id VARCHAR(100) NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+   email VARCHAR(255) NOT NULL,
+   role VARCHAR(100) NOT NULL,
+   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+   PRIMARY KEY (org_id, email)
+);
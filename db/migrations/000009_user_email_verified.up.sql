@@ -0,0 +1,2 @@
+-- Users created before this migration may have unverified emails, so they are not merged with new identities.
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- The provider's subject of the identity that started the session. It is empty for the sessions started before.
+ALTER TABLE sessions ADD COLUMN subject VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- For the periodic deletion of the expired sessions.
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
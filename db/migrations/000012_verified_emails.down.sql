@@ -0,0 +1,3 @@
+-- The backfilled identities and verifications are kept.
+DROP INDEX IF EXISTS users_verified_email_idx;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
@@ -0,0 +1,17 @@
+-- Users that signed in before the identities were tracked have none linked. Back then, the email was the account, so
+-- it is taken as verified, and these users keep being found by their email.
+UPDATE users SET email_verified = TRUE
+WHERE NOT EXISTS (SELECT 1 FROM user_identities WHERE user_identities.user_id = users.id);
+
+-- Link the identities that are known from the sessions. The sessions older than their subjects have none.
+INSERT INTO user_identities (provider, subject, user_id, email, given_name, family_name, picture_url)
+SELECT DISTINCT ON (sessions.provider, sessions.subject) sessions.provider, sessions.subject, users.id, users.email,
+    users.given_name, users.family_name, COALESCE(users.picture_url, '')
+FROM sessions JOIN users ON users.id = sessions.user_id
+WHERE sessions.subject <> ''
+ORDER BY sessions.provider, sessions.subject, sessions.created_at DESC
+ON CONFLICT (provider, subject) DO NOTHING;
+
+-- Only a verified email belongs to a single user, so that an unverified one can not squat the email of its owner.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX users_verified_email_idx ON users (email) WHERE email_verified;
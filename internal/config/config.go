@@ -1,5 +1,9 @@
 package config
 
+import (
+	"time"
+)
+
 // Config represents the configs model.
 type Config struct {
 	// Application is the model of application configs.
@@ -24,6 +28,13 @@ type Config struct {
 		Addr string `yaml:"addr"`
 	} `yaml:"http_server"`
 
+	// GRPCServer is the model of the gRPC Server configs.
+	GRPCServer struct {
+		// Addr is the address of the gRPC server, which serves Envoy's external authorization (ext_authz) service.
+		// The server is not started if it is empty.
+		Addr string `yaml:"addr"`
+	} `yaml:"grpc_server"`
+
 	// Logger is the model of the application logger configs.
 	Logger struct {
 		// Level of the logger.
@@ -32,14 +43,224 @@ type Config struct {
 		Pretty bool `yaml:"pretty"`
 	} `yaml:"logger"`
 
+	// Session is the model of the configs of Authorizer-issued sessions.
+	Session struct {
+		// IdleTimeout is the lifetime of a session token. The token is renewed when used in the second half of its
+		// lifetime, so the session ends only if it is not used for this long. It defaults to 24 hours.
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
+		// AbsoluteTimeout is the max lifetime of a session, irrespective of renewals. It defaults to 7 days.
+		AbsoluteTimeout time.Duration `yaml:"absolute_timeout"`
+		// EncryptionKey is the base64 encoded AES key (16, 24 or 32 bytes) that encrypts the providers' refresh tokens.
+		// If it is not set, the refresh tokens are not stored, and sessions are renewed without consulting the provider.
+		EncryptionKey string `yaml:"encryption_key"`
+		// CookieDomain is the domain of the session cookie. It is required when the cookie must reach the other
+		// subdomains, for example, "example.com" when Authorizer guards "app.example.com" in the forward-auth mode.
+		// Defaults to the host of Authorizer.
+		CookieDomain string `yaml:"cookie_domain"`
+
+		// Keys is the model of the configs of the keys that sign the session tokens.
+		Keys struct {
+			// Source of the keys. Supported values are "postgres" (default), "files" and "ephemeral".
+			//
+			// The "postgres" source generates and rotates the keys automatically. The "files" source reads them from
+			// the Files, and the "ephemeral" source generates a key upon startup that is lost upon restart.
+			Source string `yaml:"source"`
+			// Files are the paths to the PEM encoded EC (P-256) private keys for the "files" source.
+			// The first one signs the tokens, and the others are kept only for verification.
+			Files []string `yaml:"files"`
+			// RotationInterval is the age after which a key is rotated by the "postgres" source. Defaults to 30 days.
+			RotationInterval time.Duration `yaml:"rotation_interval"`
+			// GracePeriod is the time for which a retired key is still published by the "postgres" source.
+			// It defaults to the session idle timeout, and should not be less than it.
+			GracePeriod time.Duration `yaml:"grace_period"`
+			// RefreshInterval is the interval at which the keys are reloaded from the source. Defaults to 1 minute.
+			RefreshInterval time.Duration `yaml:"refresh_interval"`
+		} `yaml:"keys"`
+	} `yaml:"session"`
+
+	// StateStore is the model of the configs of the store of the OAuth flow states.
+	StateStore struct {
+		// Type of the store. Supported values are "memory" (default), "postgres" and "cookie".
+		//
+		// The "memory" store is local to the process, so it works only with a single replica. With multiple replicas,
+		// the "postgres" or the "cookie" store must be used, as the provider's callback may land on any of them.
+		// The "cookie" store keeps the states encrypted in the browser's cookies, which also binds the flow to it.
+		Type string `yaml:"type"`
+		// TTL is the max allowed time for a provider to invoke the callback API. Defaults to 1 minute.
+		TTL time.Duration `yaml:"ttl"`
+		// MaxStates caps the number of outstanding states of the "memory" and "postgres" stores. Sign-in attempts
+		// beyond it are rejected until some states are taken or expire. Defaults to 10000, and a negative value removes
+		// the cap. The "cookie" store keeps no states on the server, so it needs no cap.
+		MaxStates int `yaml:"max_states"`
+		// EncryptionKey is the base64 encoded AES key (16, 24 or 32 bytes) that seals the states of the "cookie" store.
+		// It is required by the "cookie" store, and must be the same across all replicas.
+		EncryptionKey string `yaml:"encryption_key"`
+	} `yaml:"state_store"`
+
+	// Check is the model of the configs of the /api/check response.
+	Check struct {
+		// TokenPrecedence decides the token to verify when a request carries both the session cookie and a bearer
+		// token in the Authorization header. Supported values are "cookie" (default) and "header".
+		TokenPrecedence string `yaml:"token_precedence"`
+
+		// HeaderPrefix is prepended to the names of the mapped headers, for example, "X-Forwarded-".
+		HeaderPrefix string `yaml:"header_prefix"`
+		// Headers maps the claims of the session to the response headers. If empty, the user ID, email, name,
+		// picture, roles, org ID and org role are set as X-Auth-User-Id, X-Auth-Email, X-Auth-Name, X-Auth-Picture,
+		// X-Auth-Roles, X-Auth-Org-Id and X-Auth-Org-Role.
+		Headers []HeaderMapping `yaml:"headers"`
+
+		// ForwardAuth is the model of the configs of the forward-auth mode, in which Authorizer sits behind a proxy's
+		// auth request, like nginx auth_request or Traefik forwardAuth.
+		ForwardAuth struct {
+			// Enabled is a flag that dictates whether an unauthenticated check is answered with a redirect to the
+			// sign-in, which returns to the original URL, as told by the X-Forwarded-Proto, X-Forwarded-Host and
+			// X-Forwarded-Uri headers.
+			Enabled bool `yaml:"enabled"`
+			// Provider is the name of the provider to sign in with. It is required.
+			Provider string `yaml:"provider"`
+			// Status of the redirect. It defaults to 302, which Traefik and Caddy pass on to the client. nginx does
+			// not accept a 302 from the auth request, so it must be 401, and the Location header must be used with
+			// an error_page.
+			Status int `yaml:"status"`
+			// AllowedHosts are the hosts whose URLs are allowed as the redirect_url, in addition to the
+			// AllowedRedirectURLs. A host that starts with "*." allows all its subdomains.
+			AllowedHosts []string `yaml:"allowed_hosts"`
+		} `yaml:"forward_auth"`
+
+		// Assertion is the model of the configs of the signed identity assertion, a short-lived JWT that carries
+		// the user's claims, so that the upstream services need not trust the plain headers.
+		Assertion struct {
+			// Enabled is a flag that dictates whether the assertion is added to the response.
+			Enabled bool `yaml:"enabled"`
+			// Header is the name of the header that holds the assertion. Defaults to X-Auth-Assertion.
+			Header string `yaml:"header"`
+			// Audience is the "aud" claim of the assertion, which the upstream services must verify. It is required,
+			// and must differ from the base URL, so that an assertion can not pass as a session token.
+			Audience string `yaml:"audience"`
+			// TTL is the lifetime of the assertion. Defaults to 1 minute.
+			TTL time.Duration `yaml:"ttl"`
+		} `yaml:"assertion"`
+	} `yaml:"check"`
+
+	// SignIn is the model of the rules of who may sign in. They are enforced upon the provider's callback.
+	SignIn struct {
+		// RequireVerifiedEmail rejects the users whose email is not verified by the provider.
+		RequireVerifiedEmail bool `yaml:"require_verified_email"`
+		// AllowedDomains are the email domains that may sign in. Users of a Google Workspace are also matched by its
+		// domain (the "hd" claim). If both AllowedDomains and AllowedEmails are empty, all users may sign in.
+		AllowedDomains []string `yaml:"allowed_domains"`
+		// AllowedEmails are the emails that may sign in, irrespective of their domain.
+		AllowedEmails []string `yaml:"allowed_emails"`
+		// DeniedEmails are the emails that may never sign in, even if they are allowed otherwise.
+		DeniedEmails []string `yaml:"denied_emails"`
+	} `yaml:"sign_in"`
+
+	// RBAC is the model of the configs of the roles and permissions, which are stored in the database.
+	RBAC struct {
+		// Bootstrap grants the first admin, who can then manage the roles of the others.
+		Bootstrap struct {
+			// AdminEmail is the email of the user who is assigned the AdminRole upon sign-in, as long as no user has
+			// that role. The role is assigned only if the provider verified the email.
+			AdminEmail string `yaml:"admin_email"`
+			// AdminRole is the name of the admin role. Defaults to "admin".
+			AdminRole string `yaml:"admin_role"`
+		} `yaml:"bootstrap"`
+	} `yaml:"rbac"`
+
+	// Policies are the authorization policies of the /api/check endpoint. Unlike the other configs, they are reloaded
+	// when the configs file changes.
+	Policies Policies `yaml:"policies"`
+
 	// AllowedRedirectURLs is the list of URLs that Authorizer may redirect to after th OAuth flow is complete.
 	AllowedRedirectURLs []string `yaml:"allowed_redirect_urls"`
 
-	// Google OAuth related configs.
-	Google struct {
-		ClientID     string `yaml:"client_id"`
-		ClientSecret string `yaml:"client_secret"`
-	} `yaml:"google"`
+	// Providers is the list of OAuth providers that users can sign in with.
+	Providers []Provider `yaml:"providers"`
+}
+
+// HeaderMapping maps a claim of the session to a header of the /api/check response.
+type HeaderMapping struct {
+	// Header is the name of the header, after the Check.HeaderPrefix.
+	Header string `yaml:"header"`
+	// Claim is the name of the claim. The user's details are available as "user_id", "email", "given_name",
+	// "family_name", "name", "picture" and "provider", and the roles assigned in Authorizer as "user_roles". Any other
+	// name refers to a claim of the provider's identity token, like "groups" or "roles", which is then forwarded with
+	// the session.
+	//
+	// Multi-valued claims are comma-joined. The header is empty if the claim is absent.
+	Claim string `yaml:"claim"`
+}
+
+// Policies are the rules that authorize the authenticated requests by their host, path and method.
+//
+// The rules are evaluated in order, and the first one that matches the request decides. A request that matches no
+// rule is decided by the Default.
+type Policies struct {
+	// DryRun is a flag that dictates whether the decisions are only logged, and not enforced.
+	DryRun bool `yaml:"dry_run"`
+	// Default decides the requests that match no rule. Supported values are "allow" (default) and "deny".
+	Default string `yaml:"default"`
+	// GroupsClaim and RolesClaim are the claims of the provider's identity token that hold the user's groups and
+	// roles. They default to "groups" and "roles". The claims are forwarded with the session, just like the ones
+	// mapped to the headers, so a change applies only to the sessions that start after it.
+	GroupsClaim string `yaml:"groups_claim"`
+	RolesClaim  string `yaml:"roles_claim"`
+	// Rules are the policy rules.
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule allows the users that satisfy any of its conditions to make the requests that it matches.
+// A rule without any conditions allows all authenticated users.
+type PolicyRule struct {
+	// Name of the rule, which is logged with the decisions.
+	Name string `yaml:"name"`
+
+	// Hosts, Paths and Methods match the request. An empty list matches all. A host that starts with "*." matches
+	// all its subdomains, and a path that ends with "*" matches all paths with that prefix. Paths are matched
+	// case-insensitively, against the unescaped and cleaned path of the request.
+	Hosts   []string `yaml:"hosts"`
+	Paths   []string `yaml:"paths"`
+	Methods []string `yaml:"methods"`
+
+	// EmailDomains are the domains of the allowed emails, like "example.com".
+	EmailDomains []string `yaml:"email_domains"`
+	// Users are the emails or the user IDs of the allowed users.
+	Users []string `yaml:"users"`
+	// Groups and Roles are the allowed groups and roles, as per the GroupsClaim and the RolesClaim. The Roles also
+	// match the roles assigned in Authorizer.
+	Groups []string `yaml:"groups"`
+	Roles  []string `yaml:"roles"`
+}
+
+// Provider represents the configs of a single OAuth provider.
+type Provider struct {
+	// Name of the provider. It is used in the "/api/auth/{provider}" routes.
+	// It is optional for all types except "oidc" and defaults to the provider type.
+	Name string `yaml:"name"`
+	// Type of the provider. Supported values are "google", "github", "discord", "microsoft", "apple" and "oidc".
+	Type string `yaml:"type"`
+
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// Scopes is a space separated list of OAuth scopes. It is optional, and every type has sensible defaults.
+	Scopes string `yaml:"scopes"`
+
+	// IssuerURL is the URL of the OpenID Connect issuer. It is required for the "oidc" type.
+	// The discovery document is fetched from "{issuer_url}/.well-known/openid-configuration".
+	IssuerURL string `yaml:"issuer_url"`
+
+	// Tenant is the Entra ID authority for the "microsoft" type. It can be "common", "organizations" or a tenant ID.
+	// It defaults to "common".
+	Tenant string `yaml:"tenant"`
+	// AllowedTenants optionally restricts the "microsoft" type to users of these tenant IDs.
+	AllowedTenants []string `yaml:"allowed_tenants"`
+
+	// TeamID, KeyID and PrivateKeyPath are required for the "apple" type. They are used to generate the client secret,
+	// so the ClientSecret is not required. The PrivateKeyPath is the path to the .p8 file issued by Apple.
+	TeamID         string `yaml:"team_id"`
+	KeyID          string `yaml:"key_id"`
+	PrivateKeyPath string `yaml:"private_key_path"`
 }
 
 // Load loads and returns the config value.
@@ -47,12 +268,19 @@ func Load() Config {
 	return loadWithViper()
 }
 
+// Watch calls the given function with the reloaded configs whenever the configs file changes.
+// It must be called after Load.
+func Watch(onChange func(Config)) {
+	watchWithViper(onChange)
+}
+
 // LoadMock provides a mock instance of the config for testing purposes.
 func LoadMock() Config {
 	cfg := Config{}
 
 	cfg.Application.Name = "example-application"
 	cfg.HTTPServer.Addr = "localhost:8080"
+	cfg.GRPCServer.Addr = "localhost:9090"
 
 	cfg.Logger.Level = "debug"
 	cfg.Logger.Pretty = true
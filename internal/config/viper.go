@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
@@ -32,11 +34,35 @@ func loadWithViper() Config {
 		panic(fmt.Errorf("error in ReadInConfig: %w", err))
 	}
 
+	model, err := unmarshalWithViper()
+	if err != nil {
+		panic(err)
+	}
+
+	return model
+}
+
+// watchWithViper watches the configs file using spf13/viper, and calls the given function with the reloaded configs
+// upon every change. The configs that fail to load are logged and skipped.
+func watchWithViper(onChange func(Config)) {
+	viper.OnConfigChange(func(event fsnotify.Event) {
+		model, err := unmarshalWithViper()
+		if err != nil {
+			slog.Error("failed to reload configs", "file", event.Name, "error", err)
+			return
+		}
+		onChange(model)
+	})
+	viper.WatchConfig()
+}
+
+// unmarshalWithViper unmarshals the configs read by viper into the model.
+func unmarshalWithViper() (Config, error) {
 	model := Config{}
 	// Unmarshalling into the model instance.
 	if err := viper.Unmarshal(&model, func(c *mapstructure.DecoderConfig) { c.TagName = configType }); err != nil {
-		panic(fmt.Errorf("error in Unmarshal: %w", err))
+		return Config{}, fmt.Errorf("error in Unmarshal: %w", err)
 	}
 
-	return model
+	return model, nil
 }
@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"google.golang.org/grpc"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/handler"
+)
+
+// Server is the gRPC server of this application. It serves Envoy's external authorization service.
+type Server struct {
+	Config  config.Config
+	Handler *handler.Handler
+
+	grpcServer *grpc.Server
+}
+
+// Start sets up the services on the server, and calls Serve on it.
+func (s *Server) Start() error {
+	addr := s.Config.GRPCServer.Addr
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error in net.Listen call: %w", err)
+	}
+
+	// Create the gRPC server.
+	s.grpcServer = grpc.NewServer()
+	authv3.RegisterAuthorizationServer(s.grpcServer, s.Handler.ExtAuthz())
+
+	slog.Info("Starting gRPC server", "name", s.Config.Application.Name, "addr", addr)
+	// Start the gRPC server.
+	if err := s.grpcServer.Serve(listener); !errors.Is(err, grpc.ErrServerStopped) && err != nil {
+		return fmt.Errorf("error in Serve call: %w", err)
+	}
+
+	return nil
+}
+
+// Shutdown initiates a graceful shutdown of the gRPC server. If the context is done before all the pending calls
+// finish, the server is stopped forcefully.
+//
+// It does not return any errors, only logs them.
+func (s *Server) Shutdown(ctx context.Context) {
+	// In case the application initiates a shutdown before the server is even initialized.
+	if s.grpcServer == nil {
+		slog.Info("gRPC server found nil")
+		return
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		slog.Info("gRPC server shutdown successful")
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		slog.Error("gRPC server stopped forcefully", "err", ctx.Err())
+	}
+}
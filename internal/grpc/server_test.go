@@ -0,0 +1,70 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/handler"
+	"github.com/shivanshkc/authorizer/internal/logger"
+)
+
+// TestServer_Start checks if the gRPC server starts correctly with all the valid parameters.
+func TestServer_Start(t *testing.T) {
+	// Start the server with mock dependencies.
+	server := mockServerStart()
+	defer server.Shutdown(context.Background())
+
+	// Server dependencies.
+	cfg := config.LoadMock()
+
+	conn, err := grpc.NewClient(cfg.GRPCServer.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Errorf("unexpected error in grpc.NewClient call: %v", err)
+		return
+	}
+
+	// Cleanup.
+	defer func() { _ = conn.Close() }()
+
+	// Dummy request without any credentials. We will expect it to be denied.
+	resp, err := authv3.NewAuthorizationClient(conn).Check(context.Background(), &authv3.CheckRequest{})
+	if err != nil {
+		t.Errorf("unexpected error in Check call: %v", err)
+		return
+	}
+
+	// Verify status code.
+	if resp.GetStatus().GetCode() != int32(code.Code_UNAUTHENTICATED) {
+		t.Errorf("expected status code to be: %d, but got: %d", code.Code_UNAUTHENTICATED, resp.GetStatus().GetCode())
+		return
+	}
+}
+
+// mockServerStart creates a *Server instance using a mock logger.
+// It sleeps for a second to give the server some time to boot up.
+func mockServerStart() *Server {
+	// Server dependencies.
+	conf := config.LoadMock()
+	logger.Init(io.Discard, conf.Logger.Level, conf.Logger.Pretty)
+
+	// Instantiate the server to be tested.
+	server := &Server{
+		Config:  conf,
+		Handler: handler.NewHandler(conf, nil, nil, nil, nil, nil, nil, nil),
+	}
+
+	// Start the server without blocking.
+	go func() { _ = server.Start() }()
+
+	// Wait for the server to start.
+	time.Sleep(time.Second)
+	return server
+}
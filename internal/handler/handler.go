@@ -2,12 +2,13 @@ package handler
 
 import (
 	"net/http"
-	"slices"
-	"sync"
-	"time"
 
 	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/policy"
 	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/internal/statestore"
+	"github.com/shivanshkc/authorizer/internal/utils/cryptoutils"
 	"github.com/shivanshkc/authorizer/internal/utils/errutils"
 	"github.com/shivanshkc/authorizer/internal/utils/httputils"
 	"github.com/shivanshkc/authorizer/pkg/oauth"
@@ -17,32 +18,61 @@ import (
 type Handler struct {
 	config config.Config
 
-	// stateMap maps state keys to state values.
+	// states persists the states of the OAuth flows.
 	// Its role is to defend against CSRF attacks as well as persist an OAuth flow's contextual info.
-	stateMap *sync.Map
+	states statestore.StateStore
+	// stateCookies, if not nil, seals the states into cookies instead, and the states store is not used.
+	stateCookies *statestore.CookieStore
 
-	// stateKeyExpiry is the max allowed time for a provider to invoke the callback API.
-	// If the provider is too late, the state key will be removed from the memory and the flow will fail.
-	//
-	// This is here as a struct field so it can be modified for testing purposes.
-	stateKeyExpiry time.Duration
+	// providers maps provider names to their instances.
+	providers map[string]oauth.Provider
+	// issuers maps token issuers ("iss" claim values) to their providers.
+	issuers map[string]oauth.Provider
+	// issuerMatchers are the providers whose issuers can not be listed upfront, like multi-tenant providers.
+	// They are consulted, in order, only if the issuer is not found in the issuers map.
+	issuerMatchers []oauth.Provider
 
-	googleProvider  oauth.Provider
-	discordProvider oauth.Provider
+	// sessions issues and verifies Authorizer's own session tokens.
+	sessions *session.Manager
+	// refreshTokens encrypts the providers' refresh tokens. If it is nil, the refresh tokens are not stored.
+	refreshTokens *cryptoutils.AEAD
+	// policies authorize the authenticated requests of the check endpoint. If it is nil, all of them are allowed.
+	policies *policy.Engine
 
 	repo repository.Repository
 }
 
 // NewHandler creates a new Handler instance.
-func NewHandler(config config.Config, google, discord oauth.Provider, repo repository.Repository) *Handler {
-	return &Handler{
-		config:          config,
-		stateMap:        &sync.Map{},
-		stateKeyExpiry:  time.Minute,
-		googleProvider:  google,
-		discordProvider: discord,
-		repo:            repo,
+//
+// The given providers are registered by their names and issuers. If two providers share a name or an issuer,
+// the latter takes precedence.
+func NewHandler(config config.Config, providers []oauth.Provider, states statestore.StateStore,
+	stateCookies *statestore.CookieStore, sessions *session.Manager, refreshTokens *cryptoutils.AEAD,
+	policies *policy.Engine, repo repository.Repository,
+) *Handler {
+	h := &Handler{
+		config:        config,
+		states:        states,
+		stateCookies:  stateCookies,
+		providers:     map[string]oauth.Provider{},
+		issuers:       map[string]oauth.Provider{},
+		sessions:      sessions,
+		refreshTokens: refreshTokens,
+		policies:      policies,
+		repo:          repo,
 	}
+
+	for _, provider := range providers {
+		h.providers[provider.Name()] = provider
+		for _, issuer := range provider.Issuers() {
+			h.issuers[issuer] = provider
+		}
+		if _, ok := provider.(oauth.IssuerMatcher); ok {
+			h.issuerMatchers = append(h.issuerMatchers, provider)
+		}
+	}
+
+	return h
 }
 
 // NotFound handler can be used to serve any unrecognized routes.
@@ -56,22 +86,22 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 	httputils.Write(w, http.StatusOK, nil, info)
 }
 
-// providerByName returns the provider for the given name.
+// providerByName returns the provider for the given name, or nil if there's none.
 func (h *Handler) providerByName(providerName string) oauth.Provider {
-	switch providerName {
-	case h.googleProvider.Name():
-		return h.googleProvider
-	// More cases would come here as more providers are implemented.
-	default:
-		return nil
-	}
+	return h.providers[providerName]
 }
 
-// providerByIssuer returns the provider for the given token issuer.
+// providerByIssuer returns the provider for the given token issuer, or nil if there's none.
 func (h *Handler) providerByIssuer(issuer string) oauth.Provider {
-	if slices.Contains(h.googleProvider.Issuers(), issuer) {
-		return h.googleProvider
+	if provider, exists := h.issuers[issuer]; exists {
+		return provider
 	}
-	// More cases would come here as more providers are implemented.
+
+	for _, provider := range h.issuerMatchers {
+		if provider.(oauth.IssuerMatcher).MatchIssuer(issuer) {
+			return provider
+		}
+	}
+
 	return nil
 }
@@ -1,19 +1,18 @@
 package handler
 
 import (
-	"context"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"slices"
 	"strings"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+	"github.com/shivanshkc/authorizer/internal/statestore"
 	"github.com/shivanshkc/authorizer/internal/utils/errutils"
 	"github.com/shivanshkc/authorizer/internal/utils/httputils"
 )
@@ -24,7 +23,16 @@ var (
 )
 
 // Auth starts the OAuth flow by redirecting the caller to the specified provider's authentication page.
+//
+// With the "org" query parameter, the user signs in to that organization, which they must be a member of, or be
+// invited to.
 func (h *Handler) Auth(w http.ResponseWriter, r *http.Request) {
+	h.startFlow(w, r, 0)
+}
+
+// startFlow starts the OAuth flow for the provider in the path. If linkUserID is not zero, the flow links the
+// provider's identity to that user, instead of signing in.
+func (h *Handler) startFlow(w http.ResponseWriter, r *http.Request, linkUserID int) {
 	ctx := r.Context()
 
 	// Provider is a path parameter and so it will always be present.
@@ -60,54 +68,70 @@ func (h *Handler) Auth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Client callback URL must be one of the allowed ones.
-	if !slices.Contains(h.config.AllowedRedirectURLs, clientCallbackURL) {
+	if !h.isAllowedRedirectURL(clientCallbackURL) {
 		slog.ErrorContext(ctx, "request contains unknown redirect_url")
 		httputils.WriteErr(w, errUnknownRedirectURL)
 		return
 	}
 
+	// The organization to sign in to, if any. A link flow does not sign in, so it ignores the organization.
+	var orgID string
+	if linkUserID == 0 {
+		orgID = r.URL.Query().Get("org")
+	}
+	if orgID != "" {
+		if err := h.checkOrg(ctx, orgID); err != nil {
+			slog.ErrorContext(ctx, "error in checkOrg call", "org", orgID, "error", err)
+			httputils.WriteErr(w, err)
+			return
+		}
+	}
+
 	// Generate a state key for CSRF protection.
 	stateKey := uuid.NewString()
 	// Generate code verifier and challenge for PKCE (Proof Key for Code Exchange).
 	codeVerifier, codeChallenge := getPKCE()
+	// Generate a nonce to bind the identity token to this flow, so that a token can not be replayed into a callback.
+	nonce := uuid.NewString()
+	// A link flow is bound to the browser that started it, so that it can not be completed by another one.
+	var linkBinding string
+	if linkUserID != 0 {
+		linkBinding = uuid.NewString()
+	}
 	// Persist contextual info. This will be required upon callback.
-	h.stateMap.Store(stateKey, stateValue{
+	// The state expires if the provider does not call back in time.
+	if err := h.putState(ctx, w, provider, stateKey, statestore.Value{
 		CodeVerifier:      codeVerifier,
 		ClientCallbackURL: clientCallbackURL,
-	})
-
-	// Expire the state key after some time.
-	go func() {
-		// Don't use the HTTP request's context here.
-		ctx := context.Background()
-		// Allow the provider some time to invoke the callback API before timing out the flow.
-		time.Sleep(h.stateKeyExpiry)
-
-		// Expire the state key with apt logs.
-		slog.InfoContext(ctx, "expiring state key", "stateKey", stateKey)
-		if _, present := h.stateMap.LoadAndDelete(stateKey); !present {
-			slog.InfoContext(ctx, "state key utilized before expiry", "stateKey", stateKey)
+		Nonce:             nonce,
+		LinkUserID:        linkUserID,
+		LinkBinding:       linkBinding,
+		OrgID:             orgID,
+	}); err != nil {
+		// Too many sign-ins are in progress, which is likely a flood.
+		if errors.Is(err, statestore.ErrTooManyStates) {
+			slog.WarnContext(ctx, "state store is at its capacity")
+			httputils.WriteErr(w, errutils.ServiceUnavailable())
 			return
 		}
-		slog.WarnContext(ctx, "state key expired", "stateKey", stateKey)
-	}()
+		slog.ErrorContext(ctx, "error in putState call", "error", err)
+		httputils.WriteErr(w, errutils.InternalServerError())
+		return
+	}
+
+	// The browser holds the link binding in a cookie.
+	if linkBinding != "" {
+		http.SetCookie(w, h.linkBindingCookie(stateKey, linkBinding, 0))
+	}
 
 	// Get the Auth URL of the provider.
-	authURL := provider.GetAuthURL(ctx, stateKey, codeChallenge)
+	authURL := provider.GetAuthURL(ctx, stateKey, codeChallenge, nonce)
 	// Response headers.
 	headers := map[string]string{"Location": authURL}
 	// Redirect.
 	httputils.Write(w, http.StatusFound, headers, nil)
 }
 
-// stateValue holds all contextual info for an OAuth flow.
-type stateValue struct {
-	// CodeVerifier is for PKCE (Proof Key for Code Exchange).
-	CodeVerifier string
-	// ClientCallbackURL is the URL where the OAuth flow is supposed to end.
-	ClientCallbackURL string
-}
-
 // getPKCE returns the code verifier and the code challenge for PKCE (Proof Key for Code Exchange).
 func getPKCE() (string, string) {
 	codeVerifier := fmt.Sprintf("%s-%s", uuid.New().String(), uuid.New().String())
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -13,6 +15,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/statestore"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
 )
 
 func TestHandler_Auth_Validations(t *testing.T) {
@@ -29,8 +33,7 @@ func TestHandler_Auth_Validations(t *testing.T) {
 		inputProviderName string
 		inputRedirectURL  string
 		// Expectations.
-		expectProviderCall bool
-		errSubstring       string
+		errSubstring string
 	}{
 		{
 			name:              "Too long provider length",
@@ -43,32 +46,28 @@ func TestHandler_Auth_Validations(t *testing.T) {
 			errSubstring:      errInvalidProvider.Error(),
 		},
 		{
-			name:               "Too long redirect_url",
-			inputProviderName:  correctProviderName,
-			inputRedirectURL:   strings.Repeat("a", 201),
-			expectProviderCall: true,
-			errSubstring:       errInvalidCCU.Error(),
+			name:              "Too long redirect_url",
+			inputProviderName: correctProviderName,
+			inputRedirectURL:  strings.Repeat("a", 201),
+			errSubstring:      errInvalidCCU.Error(),
 		},
 		{
-			name:               "redirect_url is not a valid URL",
-			inputProviderName:  correctProviderName,
-			inputRedirectURL:   "invalid-url@@",
-			expectProviderCall: true,
-			errSubstring:       errInvalidCCU.Error(),
+			name:              "redirect_url is not a valid URL",
+			inputProviderName: correctProviderName,
+			inputRedirectURL:  "invalid-url@@",
+			errSubstring:      errInvalidCCU.Error(),
 		},
 		{
-			name:               "Allow list does not contain the redirect_url",
-			inputProviderName:  correctProviderName,
-			inputRedirectURL:   allowedRedirectURL + "-random",
-			expectProviderCall: true,
-			errSubstring:       errUnknownRedirectURL.Error(),
+			name:              "Allow list does not contain the redirect_url",
+			inputProviderName: correctProviderName,
+			inputRedirectURL:  allowedRedirectURL + "-random",
+			errSubstring:      errUnknownRedirectURL.Error(),
 		},
 		{
-			name:               "Unknown provider",
-			inputProviderName:  correctProviderName + "-random",
-			inputRedirectURL:   allowedRedirectURL,
-			expectProviderCall: true,
-			errSubstring:       errUnsupportedProvider.Error(),
+			name:              "Unknown provider",
+			inputProviderName: correctProviderName + "-random",
+			inputRedirectURL:  allowedRedirectURL,
+			errSubstring:      errUnsupportedProvider.Error(),
 		},
 	} {
 		tc := tc
@@ -76,14 +75,12 @@ func TestHandler_Auth_Validations(t *testing.T) {
 			// Create mock response writer and request.
 			w, r := createMockAuthWR(tc.inputProviderName, tc.inputRedirectURL)
 
-			// Prepare the mock provider instance.
+			// Prepare the mock provider instance. None of its methods should be called.
 			mProvider := &mockProvider{}
-			if tc.expectProviderCall {
-				mProvider.On("Name").Return(correctProviderName).Once()
-			}
+			providers := map[string]oauth.Provider{correctProviderName: mProvider}
 
 			// Prepare and call the method to test.
-			mHandler := &Handler{config: mConfig, googleProvider: mProvider}
+			mHandler := &Handler{config: mConfig, providers: providers}
 			mHandler.Auth(w, r)
 
 			// Verifications.
@@ -119,25 +116,23 @@ func TestHandler_Auth_DefaultRedirectURL(t *testing.T) {
 			// Create mock response writer and request.
 			w, r := createMockAuthWR(providerName, tc.inputRedirectURL)
 
-			// Setup mock provider.
+			// Setup mock provider. The state key is captured to look up the state.
+			var stateKey string
 			mProvider := &mockProvider{}
 			mProvider.On("Name").Return(providerName).Once()
-			mProvider.On("GetAuthURL", r.Context(), mock.Anything, mock.Anything).Return(mProviderAuthURL).Once()
+			mProvider.On("Issuers").Return([]string{}).Once()
+			mProvider.On("GetAuthURL", r.Context(), mock.Anything, mock.Anything, mock.Anything).Return(mProviderAuthURL).Once().
+				Run(func(args mock.Arguments) { stateKey = args.String(1) })
 
 			// Create the mock handler.
-			mHandler := NewHandler(mConfig, mProvider, nil, nil)
+			states := statestore.NewMemoryStore(context.Background(), time.Minute, 0)
+			mHandler := NewHandler(mConfig, []oauth.Provider{mProvider}, states, nil, nil, nil, nil, nil)
 			// Invoke the method to test.
 			mHandler.Auth(w, r)
 
-			// Verify the state map contains the default redirect URL.
-			var insertedStateValueAny any
-			mHandler.stateMap.Range(func(key, value any) bool {
-				insertedStateValueAny = value
-				return true
-			})
-
-			insertedStateValue, ok := insertedStateValueAny.(stateValue)
-			require.True(t, ok, "State value inserted in the State Map is of unexpected type")
+			// Verify the state store contains the default redirect URL.
+			insertedStateValue, err := states.Take(context.Background(), stateKey)
+			require.NoError(t, err, "State was not inserted in the state store")
 			require.Equal(t, allowedRedirectURL, insertedStateValue.ClientCallbackURL, "Expected default redirect URL")
 
 			// Verify response.
@@ -160,53 +155,34 @@ func TestHandler_Auth(t *testing.T) {
 	// Create mock response writer and request.
 	w, r := createMockAuthWR(providerName, allowedRedirectURL)
 
-	// Setup mock provider.
+	// Setup mock provider. The state key and the nonce are captured to verify the state.
+	var insertedStateKey, sentNonce string
 	mProvider := &mockProvider{}
 	mProvider.On("Name").Return(providerName).Once()
-	mProvider.On("GetAuthURL", r.Context(), mock.Anything, mock.Anything).Return(mProviderAuthURL).Once()
+	mProvider.On("Issuers").Return([]string{}).Once()
+	mProvider.On("GetAuthURL", r.Context(), mock.Anything, mock.Anything, mock.Anything).Return(mProviderAuthURL).Once().
+		Run(func(args mock.Arguments) { insertedStateKey, sentNonce = args.String(1), args.String(3) })
 
 	// Create the mock handler.
-	mHandler := NewHandler(mConfig, mProvider, nil, nil)
-
-	// Changing the state key expiry time to a shorter time so the test doesn't take too long.
-	mHandler.stateKeyExpiry = time.Second
+	states := statestore.NewMemoryStore(context.Background(), time.Minute, 0)
+	mHandler := NewHandler(mConfig, []oauth.Provider{mProvider}, states, nil, nil, nil, nil, nil)
 
 	// Invoke the method to test.
 	mHandler.Auth(w, r)
 
-	// Quantities to verify about the state map.
-	var insertedStateKeyAny, insertedStateValueAny any
-	var mapSize int
-	// Loop over the state map to populate the testable quantities.
-	mHandler.stateMap.Range(func(key, value any) bool {
-		mapSize++
-		insertedStateKeyAny, insertedStateValueAny = key, value
-		return true
-	})
-
-	// The state map must have only one entry.
-	require.Equal(t, 1, mapSize, "State map has more than 1 entries")
-
-	// The state key must be a string.
-	insertedStateKey, ok := insertedStateKeyAny.(string)
-	require.True(t, ok, "State key inserted in the State Map is not a string")
-
-	// The state value must be of correct type.
-	insertedStateValue, ok := insertedStateValueAny.(stateValue)
-	require.True(t, ok, "State value inserted in the State Map is of unexpected type")
-
 	// State key must be a UUID.
 	_, errUUID := uuid.Parse(insertedStateKey)
 	require.NoError(t, errUUID, "State key is not a valid UUID")
 
 	// State value verification.
+	insertedStateValue, err := states.Take(context.Background(), insertedStateKey)
+	require.NoError(t, err, "State was not inserted in the state store")
 	require.NotEmpty(t, insertedStateValue.CodeVerifier, "Code verifier is empty")
 	require.Equal(t, allowedRedirectURL, insertedStateValue.ClientCallbackURL, "CCU does not match")
 
-	// State key must be deleted after expiry.
-	time.Sleep(mHandler.stateKeyExpiry + 500*time.Millisecond)
-	_, found := mHandler.stateMap.Load(insertedStateKeyAny)
-	require.False(t, found, "State key was not deleted after expiry")
+	// The nonce sent to the provider must be stored for the callback.
+	require.NotEmpty(t, sentNonce, "Nonce is empty")
+	require.Equal(t, sentNonce, insertedStateValue.Nonce, "Nonce does not match")
 
 	// Verify response.
 	require.Equal(t, http.StatusFound, w.Code)
@@ -214,6 +190,51 @@ func TestHandler_Auth(t *testing.T) {
 	mProvider.AssertExpectations(t)
 }
 
+func TestHandler_Auth_StateStoreError(t *testing.T) {
+	const allowedRedirectURL = "https://allowed.com"
+	mConfig := config.Config{AllowedRedirectURLs: []string{allowedRedirectURL}}
+
+	for _, tc := range []struct {
+		name           string
+		putErr         error
+		expectedStatus int
+	}{
+		{
+			name:           "State store fails, 500 expected",
+			putErr:         errors.New("mock error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "State store at capacity, 503 expected",
+			putErr:         statestore.ErrTooManyStates,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, r := createMockAuthWR("google", allowedRedirectURL)
+
+			// Setup mock provider.
+			mProvider := &mockProvider{}
+			mProvider.On("Name").Return("google").Once()
+			mProvider.On("Issuers").Return([]string{}).Once()
+
+			// The state can not be stored.
+			mStates := &mockStateStore{}
+			mStates.On("Put", r.Context(), mock.Anything, mock.Anything).Return(tc.putErr).Once()
+
+			mHandler := NewHandler(mConfig, []oauth.Provider{mProvider}, mStates, nil, nil, nil, nil, nil)
+			mHandler.Auth(w, r)
+
+			// The flow must not begin without a stored state.
+			require.Equal(t, tc.expectedStatus, w.Code)
+			require.Empty(t, w.Header().Get("Location"), "Expected no redirect")
+			mProvider.AssertExpectations(t)
+			mStates.AssertExpectations(t)
+		})
+	}
+}
+
 // createMockAuthWR creates a mock ResponseWriter and Request to test the Auth handler.
 func createMockAuthWR(provider, redirectURL string) (*httptest.ResponseRecorder, *http.Request) {
 	// Mock HTTP request.
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shivanshkc/authorizer/internal/utils/errutils"
+	"github.com/shivanshkc/authorizer/internal/utils/httputils"
+)
+
+// Precedences between the session cookie and the bearer token, when a request carries both.
+const (
+	tokenPrecedenceCookie = "cookie"
+	tokenPrecedenceHeader = "header"
+)
+
+// Error codes of the bearer token challenge, as per RFC 6750.
+//
+// See this: https://datatracker.ietf.org/doc/html/rfc6750#section-3.1
+const (
+	bearerErrInvalidRequest = "invalid_request"
+	bearerErrInvalidToken   = "invalid_token"
+)
+
+// errMalformedAuthorization is the error when the Authorization header does not hold a bearer token.
+var errMalformedAuthorization = errutils.BadRequest().WithReasonStr("authorization header must be a bearer token")
+
+// requestToken returns the token of the request, from the session cookie or the Authorization header, whichever takes
+// precedence as per the configs. It also tells whether the token is a bearer token. The token is empty if the request
+// carries neither.
+func (h *Handler) requestToken(r *http.Request) (string, bool, error) {
+	var cookieToken string
+	if cookie, err := r.Cookie(accessTokenCookieName); err == nil {
+		cookieToken = cookie.Value
+	}
+
+	// A malformed header is an error, even if there's a cookie, so that the client learns about it.
+	var bearerToken string
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		scheme, token, found := strings.Cut(authorization, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			return "", false, errMalformedAuthorization
+		}
+		bearerToken = strings.TrimSpace(token)
+	}
+
+	if bearerToken != "" && (cookieToken == "" || h.config.Check.TokenPrecedence == tokenPrecedenceHeader) {
+		return bearerToken, true, nil
+	}
+	return cookieToken, false, nil
+}
+
+// writeChallenge writes the given error along with the WWW-Authenticate challenge for bearer tokens.
+// The errCode may be empty, which is the case when the request carries no credentials at all.
+func (h *Handler) writeChallenge(w http.ResponseWriter, err *errutils.HTTPError, errCode string) {
+	w.Header().Set("WWW-Authenticate", h.challenge(err, errCode))
+	httputils.WriteErr(w, err)
+}
+
+// challenge returns the value of the WWW-Authenticate header for the given error, as per RFC 6750.
+func (h *Handler) challenge(err *errutils.HTTPError, errCode string) string {
+	params := []string{}
+	if h.config.Application.Name != "" {
+		params = append(params, fmt.Sprintf("realm=%q", h.config.Application.Name))
+	}
+	if errCode != "" {
+		params = append(params, fmt.Sprintf("error=%q", errCode))
+		if err.Reason != "" {
+			params = append(params, fmt.Sprintf("error_description=%q", err.Reason))
+		}
+	}
+
+	challenge := "Bearer"
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	return challenge
+}
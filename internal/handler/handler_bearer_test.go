@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+func TestHandler_RequestToken(t *testing.T) {
+	const cookieToken, bearerToken = "cookie.token.value", "bearer.token.value"
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inCookie        string // Empty value means no cookie.
+		inAuthorization string // Empty value means no header.
+		inPrecedence    string
+		// Expectations.
+		expectedToken  string
+		expectedBearer bool
+		errExpected    bool
+	}{
+		{
+			name:          "Neither cookie nor header",
+			expectedToken: "",
+		},
+		{
+			name:          "Cookie only",
+			inCookie:      cookieToken,
+			expectedToken: cookieToken,
+		},
+		{
+			name:            "Header only",
+			inAuthorization: "Bearer " + bearerToken,
+			expectedToken:   bearerToken,
+			expectedBearer:  true,
+		},
+		{
+			name:            "Header only, scheme is case-insensitive",
+			inAuthorization: "bearer " + bearerToken,
+			expectedToken:   bearerToken,
+			expectedBearer:  true,
+		},
+		{
+			name:            "Both, cookie takes precedence by default",
+			inCookie:        cookieToken,
+			inAuthorization: "Bearer " + bearerToken,
+			expectedToken:   cookieToken,
+		},
+		{
+			name:            "Both, header takes precedence",
+			inCookie:        cookieToken,
+			inAuthorization: "Bearer " + bearerToken,
+			inPrecedence:    tokenPrecedenceHeader,
+			expectedToken:   bearerToken,
+			expectedBearer:  true,
+		},
+		{
+			name:            "Header with another scheme, error expected",
+			inCookie:        cookieToken,
+			inAuthorization: "Basic dXNlcjpwYXNz",
+			errExpected:     true,
+		},
+		{
+			name:            "Header without token, error expected",
+			inAuthorization: "Bearer ",
+			errExpected:     true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/mock", nil)
+			if tc.inCookie != "" {
+				r.AddCookie(&http.Cookie{Name: accessTokenCookieName, Value: tc.inCookie})
+			}
+			if tc.inAuthorization != "" {
+				r.Header.Set("Authorization", tc.inAuthorization)
+			}
+
+			mHandler := &Handler{}
+			mHandler.config.Check.TokenPrecedence = tc.inPrecedence
+
+			token, bearer, err := mHandler.requestToken(r)
+			if tc.errExpected {
+				require.ErrorIs(t, err, errMalformedAuthorization, "Expected malformed authorization error")
+				return
+			}
+
+			require.NoError(t, err, "Expected no error in requestToken")
+			require.Equal(t, tc.expectedToken, token, "Token does not match")
+			require.Equal(t, tc.expectedBearer, bearer, "Bearer flag does not match")
+		})
+	}
+}
+
+func TestHandler_Check_Bearer(t *testing.T) {
+	sessions := newMockSessions(t, "https://application.com")
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com"}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inAuthorization string // Empty value means no header.
+		// Expectations.
+		expectGetSessionCall bool
+		expectedResponseCode int
+		expectedChallenge    string
+	}{
+		{
+			name:                 "No credentials, challenge without error",
+			expectedResponseCode: http.StatusUnauthorized,
+			expectedChallenge:    `Bearer realm="authorizer"`,
+		},
+		{
+			name:                 "Malformed header, invalid request",
+			inAuthorization:      "Basic dXNlcjpwYXNz",
+			expectedResponseCode: http.StatusBadRequest,
+			expectedChallenge: `Bearer realm="authorizer", error="invalid_request", ` +
+				`error_description="authorization header must be a bearer token"`,
+		},
+		{
+			name:                 "Invalid token, invalid token",
+			inAuthorization:      "Bearer header.payload.signature",
+			expectedResponseCode: http.StatusUnauthorized,
+			expectedChallenge:    `Bearer realm="authorizer", error="invalid_token"`,
+		},
+		{
+			name:                 "Valid session token, no challenge",
+			inAuthorization:      "Bearer " + sessionToken,
+			expectGetSessionCall: true,
+			expectedResponseCode: http.StatusOK,
+			expectedChallenge:    "",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/mock", nil)
+			if tc.inAuthorization != "" {
+				r.Header.Set("Authorization", tc.inAuthorization)
+			}
+			w := httptest.NewRecorder()
+
+			mRepo := &mockRepository{}
+			if tc.expectGetSessionCall {
+				mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).
+					Return(repository.Session{ID: sessionClaims.SessionID}, nil).Once()
+			}
+
+			mHandler := &Handler{sessions: sessions, repo: mRepo}
+			mHandler.config.Application.Name = "authorizer"
+
+			// Invoke the method to be tested.
+			mHandler.Check(w, r)
+
+			require.Equal(t, tc.expectedResponseCode, w.Code, "Wrong response code")
+			require.Equal(t, tc.expectedChallenge, w.Header().Get("WWW-Authenticate"), "Wrong challenge")
+			mRepo.AssertExpectations(t)
+
+			// A bearer token is never answered with a cookie.
+			require.Empty(t, w.Result().Cookies(), "Expected no cookie")
+			if tc.expectedResponseCode == http.StatusOK {
+				require.Equal(t, sessionClaims.Email, w.Header().Get(xAuthEmailHeader))
+			}
+		})
+	}
+}
+
+func TestHandler_Check_Bearer_SignInRules(t *testing.T) {
+	const issuer = "accounts.google.com"
+	claims := oauth.Claims{Iss: issuer, Exp: time.Now().Add(time.Hour), Sub: "mockSubject", Email: "fired@hey.com",
+		EmailVerified: true}
+
+	// The provider's ID token, sent as a bearer token.
+	claimBytes, err := json.Marshal(claims)
+	require.NoError(t, err, "Failed to marshal claims")
+	token := "headers." + base64.RawURLEncoding.EncodeToString(claimBytes) + ".signature"
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		deniedEmails []string
+		// Expectations.
+		expectedResponseCode int
+	}{
+		{
+			name:                 "Email allowed, no error",
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Email denied, error expected",
+			deniedEmails:         []string{"Fired@hey.com"},
+			expectedResponseCode: http.StatusForbidden,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/mock", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+
+			mProvider, mRepo := &mockProvider{}, &mockRepository{}
+			mProvider.On("DecodeToken", r.Context(), token, "").Return(claims, nil).Once()
+			mProvider.On("Name").Return("google").Once()
+			if tc.expectedResponseCode == http.StatusOK {
+				mRepo.On("GetIdentityUserID", r.Context(), "google", claims.Sub).
+					Return(0, repository.ErrNotFound).Once()
+			}
+
+			mHandler := &Handler{sessions: newMockSessions(t, "https://application.com"), repo: mRepo,
+				issuers: map[string]oauth.Provider{issuer: mProvider}}
+			mHandler.config.SignIn.DeniedEmails = tc.deniedEmails
+
+			// Invoke the method to be tested.
+			mHandler.Check(w, r)
+
+			require.Equal(t, tc.expectedResponseCode, w.Code, "Wrong response code")
+			mProvider.AssertExpectations(t)
+			mRepo.AssertExpectations(t)
+
+			// A rejected user is not challenged, as a new token would not help, and gets no identity headers.
+			if tc.expectedResponseCode != http.StatusOK {
+				require.Empty(t, w.Header().Get("WWW-Authenticate"), "Expected no challenge")
+				require.Empty(t, w.Header().Get(xAuthEmailHeader), "Expected no identity headers")
+				return
+			}
+			require.Equal(t, claims.Email, w.Header().Get(xAuthEmailHeader))
+		})
+	}
+}
@@ -10,51 +10,59 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
 	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/internal/statestore"
 	"github.com/shivanshkc/authorizer/internal/utils/errutils"
 	"github.com/shivanshkc/authorizer/internal/utils/httputils"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
 )
 
-// accessTokenCookieName is the name of the cookie that holds the access token (or the ID token).
+// accessTokenCookieName is the name of the cookie that holds the session token.
 const accessTokenCookieName = "session"
 
+// errEmailTaken is the error when the unverified email of a new identity belongs to a verified user, so it can not be
+// linked to them. The user has to sign in to their account, and link the identity explicitly.
+var errEmailTaken = errutils.Conflict().WithReasonStr("email belongs to another user, sign in and link the provider")
+
 // Callback handles the provider's OAuth callback.
+//
+// Most providers call back with a GET request and query parameters, but some, like Apple, use an HTTP POST with a
+// form body (response_mode=form_post). Both are supported.
 func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// Obtain params from the request.
+	// Obtain params from the request. FormValue reads both the query and the form body.
 	providerName := mux.Vars(r)["provider"]
-	stateKey, errAuth, code := r.URL.Query().Get("state"),
-		r.URL.Query().Get("error"),
-		r.URL.Query().Get("code")
+	stateKey, errAuth, code := r.FormValue("state"),
+		r.FormValue("error"),
+		r.FormValue("code")
 
 	// State key validation.
 	if err := validateState(stateKey); err != nil {
 		slog.ErrorContext(ctx, "invalid state from provider", "value", stateKey, "error", err)
-		// Since the state key is invalid, the state map can not be accessed, and so the redirect URL is unknown.
+		// Since the state key is invalid, the state store can not be accessed, and so the redirect URL is unknown.
 		// Therefore, we have to fall back to the first allowed redirect URL.
 		errorRedirect(w, errInvalidState, h.config.AllowedRedirectURLs[0])
 		return
 	}
 
-	// If the state value is found in the state map, it guarantees that it is not a CSRF attack.
-	// Otherwise, it could be that the provider took too long to callback and the state key got expired and cleaned up
-	// from the map, or it could be that it is a malicious request and someone is trying to impersonate the provider.
-	sValueAny, present := h.stateMap.LoadAndDelete(stateKey)
-	if !present {
-		slog.ErrorContext(ctx, "state key not found in the map, failing request", "stateKey", stateKey)
-		// Since the state key is expired, the redirect URL is gone,
-		// and so we fall back to the first allowed redirect URL.
-		errorRedirect(w, errutils.RequestTimeout(), h.config.AllowedRedirectURLs[0])
-		return
-	}
-
-	// Assert to the stateValue type to access fields.
-	sValue, ok := sValueAny.(stateValue)
-	if !ok {
-		slog.ErrorContext(ctx, "failed to assert to stateValue type", "stateValue", sValueAny)
+	// If the state value is found in the store, it guarantees that it is not a CSRF attack.
+	// Otherwise, it could be that the provider took too long to callback and the state key got expired,
+	// or it could be that it is a malicious request and someone is trying to impersonate the provider.
+	// The provider is looked up early, as the state cookie depends upon it. It is nil if the name is unknown.
+	sValue, err := h.takeState(w, r, h.providerByName(providerName), stateKey)
+	if err != nil {
+		// Since the state is gone, the redirect URL is unknown, and so we fall back to the first allowed redirect URL.
+		if errors.Is(err, statestore.ErrNotFound) {
+			slog.ErrorContext(ctx, "state key not found, failing request", "stateKey", stateKey, "error", err)
+			errorRedirect(w, errutils.RequestTimeout(), h.config.AllowedRedirectURLs[0])
+			return
+		}
+		slog.ErrorContext(ctx, "error in takeState call", "error", err)
 		errorRedirect(w, errutils.InternalServerError(), h.config.AllowedRedirectURLs[0])
 		return
 	}
@@ -88,65 +96,208 @@ func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert the code sent by the provider to an access token.
-	token, err := provider.TokenFromCode(ctx, code, sValue.CodeVerifier)
+	// Convert the code sent by the provider to tokens.
+	tokens, err := h.tokensFromCode(ctx, provider, code, sValue.CodeVerifier)
 	if err != nil {
-		slog.ErrorContext(ctx, "error in TokenFromCode call", "error", err)
+		slog.ErrorContext(ctx, "error in tokensFromCode call", "error", err)
 		errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
 		return
 	}
 
-	// Decode token to obtain claims. This also verifies the token.
-	claims, err := provider.DecodeToken(ctx, token)
+	// Decode token to obtain claims. This also verifies the token, including its nonce.
+	claims, err := provider.DecodeToken(ctx, tokens.IDToken, sValue.Nonce)
 	if err != nil {
 		slog.ErrorContext(ctx, "error in DecodeToken call", "error", err)
 		errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
 		return
 	}
 
-	// Upsert user in the database asynchronously.
-	go func() {
-		// Do not use the request's context for this operation.
-		ctx := context.Background()
-		// The user record to store.
-		user := repository.User{
-			Email:      claims.Email,
-			GivenName:  claims.GivenName,
-			FamilyName: claims.FamilyName,
-			PictureURL: claims.Picture,
+	// Some providers send a part of the user data in the callback request instead of the token.
+	if ccProvider, ok := provider.(oauth.CallbackClaimsProvider); ok {
+		claims = ccProvider.ClaimsFromCallback(claims, r.Form)
+	}
+
+	// The identity is keyed by the provider's subject, so it can not be stored without one.
+	if claims.Sub == "" {
+		slog.ErrorContext(ctx, "token of the provider has no subject", "provider", providerName)
+		errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
+		return
+	}
+
+	// Users that may not sign in are rejected before they are stored.
+	if err := h.checkSignIn(providerName, claims); err != nil {
+		slog.WarnContext(ctx, "sign-in rejected", "provider", providerName, "email", claims.Email, "error", err)
+		errorRedirect(w, err, sValue.ClientCallbackURL)
+		return
+	}
+
+	identity := repository.Identity{
+		Provider:   providerName,
+		Subject:    claims.Sub,
+		Email:      claims.Email,
+		GivenName:  claims.GivenName,
+		FamilyName: claims.FamilyName,
+		PictureURL: claims.Picture,
+		// The identity is linked to the user with the same email only if the provider verified it.
+		EmailVerified: claims.EmailVerified,
+	}
+
+	// A link flow attaches the identity to the signed-in user, and does not start a new session.
+	if sValue.LinkUserID != 0 {
+		h.linkIdentity(w, r, identity, stateKey, sValue)
+		return
+	}
+
+	// Upsert the user to obtain its stable ID. Stored values are kept for the fields that the provider did not send.
+	user, err := h.repo.UpsertUserByIdentity(ctx, identity)
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			slog.WarnContext(ctx, "email belongs to another user", "provider", providerName, "email", claims.Email)
+			errorRedirect(w, errEmailTaken, sValue.ClientCallbackURL)
+			return
+		}
+		slog.ErrorContext(ctx, "error in UpsertUserByIdentity call", "error", err)
+		errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
+		return
+	}
+
+	// The roles are carried by the session, and reloaded upon renewal.
+	roles, err := h.userRoles(ctx, user, claims)
+	if err != nil {
+		slog.ErrorContext(ctx, "error in userRoles call", "error", err)
+		errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
+		return
+	}
+
+	// Upon a sign-in to an organization, the user must be its member, or be invited to it.
+	var membership repository.Membership
+	if sValue.OrgID != "" {
+		if membership, err = h.orgMembership(ctx, sValue.OrgID, user.ID, claims); err != nil {
+			if errors.Is(err, errNotOrgMember) {
+				slog.WarnContext(ctx, "sign-in of a non-member rejected", "org", sValue.OrgID, "user_id", user.ID)
+				errorRedirect(w, errNotOrgMember, sValue.ClientCallbackURL)
+				return
+			}
+			slog.ErrorContext(ctx, "error in orgMembership call", "error", err)
+			errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
+			return
+		}
+	}
+
+	// Issue Authorizer's own session token. The provider's token is not needed anymore.
+	sessionID, authTime := uuid.NewString(), time.Now()
+	sessionToken, sessionExpiry, err := h.sessions.Issue(session.Claims{
+		UserID:        user.ID,
+		SessionID:     sessionID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		GivenName:     user.GivenName,
+		FamilyName:    user.FamilyName,
+		Picture:       user.PictureURL,
+		Provider:      providerName,
+		Roles:         roles,
+		OrgID:         membership.OrgID,
+		OrgRole:       membership.Role,
+		Extra:         h.forwardedClaims(providerExtra(claims)),
+		AuthTime:      authTime,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error in sessions.Issue call", "error", err)
+		errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
+		return
+	}
+
+	// The refresh token is stored encrypted, and bound to the session.
+	var sealedRefreshToken string
+	if tokens.RefreshToken != "" {
+		if sealedRefreshToken, err = h.refreshTokens.Seal([]byte(tokens.RefreshToken), []byte(sessionID)); err != nil {
+			slog.ErrorContext(ctx, "error in refreshTokens.Seal call", "error", err)
+			errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
+			return
 		}
+	}
+
+	// Persist the session, so that it can be revoked and renewed.
+	if err := h.repo.InsertSession(ctx, repository.Session{
+		ID:           sessionID,
+		UserID:       user.ID,
+		Provider:     providerName,
+		Subject:      claims.Sub,
+		RefreshToken: sealedRefreshToken,
+		CreatedAt:    authTime,
+		ExpiresAt:    h.sessions.SessionExpiry(authTime),
+	}); err != nil {
+		slog.ErrorContext(ctx, "error in InsertSession call", "error", err)
+		errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
+		return
+	}
+
+	// Set the cookie. It expires at the same time as the session.
+	http.SetCookie(w, h.sessionCookie(sessionToken, int(time.Until(sessionExpiry).Seconds())))
+
+	// Success redirect URL.
+	redirectURL := withQuery(sValue.ClientCallbackURL, url.Values{"provider": {providerName}})
+	headers := map[string]string{"Location": redirectURL}
+	httputils.Write(w, http.StatusFound, headers, nil)
+}
 
-		// Database call.
-		if err := h.repo.UpsertUser(ctx, user); err != nil {
-			slog.ErrorContext(ctx, "error in UpsertUser call", "error", err)
+// tokensFromCode converts the auth code to the provider's tokens.
+//
+// The refresh token is obtained only if the provider issues them, and they can be stored.
+func (h *Handler) tokensFromCode(ctx context.Context, provider oauth.Provider, code, codeVerifier string,
+) (oauth.Tokens, error) {
+	if refresher, ok := provider.(oauth.Refresher); ok && h.refreshTokens != nil {
+		tokens, err := refresher.TokensFromCode(ctx, code, codeVerifier)
+		if err != nil {
+			return oauth.Tokens{}, fmt.Errorf("error in TokensFromCode call: %w", err)
 		}
-	}()
+		return tokens, nil
+	}
+
+	token, err := provider.TokenFromCode(ctx, code, codeVerifier)
+	if err != nil {
+		return oauth.Tokens{}, fmt.Errorf("error in TokenFromCode call: %w", err)
+	}
+	return oauth.Tokens{IDToken: token}, nil
+}
 
-	// Set the cookie.
-	http.SetCookie(w, &http.Cookie{
+// sessionCookie returns the cookie that holds the given session token. A negative maxAge deletes the cookie.
+func (h *Handler) sessionCookie(token string, maxAge int) *http.Cookie {
+	return &http.Cookie{
 		Name:  accessTokenCookieName,
 		Value: token,
 		Path:  "/",
-		// This will be required if Authorizer needs to be used with multiple subdomains.
-		Domain: "",
-		// The cookie expires at the same time as the token.
-		MaxAge: int(time.Until(claims.Exp).Seconds()),
+		// This is required if Authorizer needs to be used with multiple subdomains, like in the forward-auth mode.
+		Domain: h.config.Session.CookieDomain,
+		MaxAge: maxAge,
 		// Use secure mode when the application is running over HTTPS.
 		Secure:   strings.HasPrefix(h.config.Application.BaseURL, "https://"),
 		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-	})
-
-	// Success redirect URL.
-	redirectURL := fmt.Sprintf("%s?provider=%s", sValue.ClientCallbackURL, providerName)
-	headers := map[string]string{"Location": redirectURL}
-	httputils.Write(w, http.StatusFound, headers, nil)
+		// Lax cookies are sent upon the provider's redirect back to Authorizer, which a link flow requires. They are
+		// still not sent with cross-site POSTs, like a forged logout.
+		SameSite: http.SameSiteLaxMode,
+	}
 }
 
 // errorRedirect redirects the caller (by writing 302 and the Location header to the response) and attaches
 // the given error information as a query parameter.
 func errorRedirect(w http.ResponseWriter, err error, targetURL string) {
-	redirectURL := fmt.Sprintf("%s?error=%s", targetURL, url.QueryEscape(err.Error()))
+	redirectURL := withQuery(targetURL, url.Values{"error": {err.Error()}})
 	headers := map[string]string{"Location": redirectURL}
 	httputils.Write(w, http.StatusFound, headers, nil)
 }
+
+// withQuery returns the given URL with the given query parameters appended to its existing ones.
+func withQuery(targetURL string, params url.Values) string {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return targetURL + "?" + params.Encode()
+	}
+
+	if parsed.RawQuery == "" {
+		parsed.RawQuery = params.Encode()
+	} else {
+		parsed.RawQuery += "&" + params.Encode()
+	}
+	return parsed.String()
+}
@@ -7,16 +7,17 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
 	"github.com/shivanshkc/authorizer/internal/config"
 	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/statestore"
 	"github.com/shivanshkc/authorizer/internal/utils/errutils"
 	"github.com/shivanshkc/authorizer/pkg/oauth"
 )
@@ -45,7 +46,7 @@ func TestHandler_Callback_StateValidation(t *testing.T) {
 			errSubstring:  errInvalidState.Error(),
 		},
 		{
-			name:          "State key not present in the state map",
+			name:          "State key not present in the state store",
 			inputStateKey: uuid.NewString(),
 			errSubstring:  errutils.RequestTimeout().Error(),
 		},
@@ -56,7 +57,7 @@ func TestHandler_Callback_StateValidation(t *testing.T) {
 			w, r := createMockCallbackWR("anything", tc.inputStateKey, "anything", "")
 
 			// Invoke the method to test.
-			mHandler := &Handler{config: mConfig, stateMap: &sync.Map{}}
+			mHandler := &Handler{config: mConfig, states: statestore.NewMemoryStore(context.Background(), time.Minute, 0)}
 			mHandler.Callback(w, r)
 
 			// Verify response code and headers.
@@ -75,6 +76,28 @@ func TestHandler_Callback_StateValidation(t *testing.T) {
 	}
 }
 
+func TestHandler_Callback_StateStoreError(t *testing.T) {
+	allowedURLs := []string{"https://first.com", "https://second.com"}
+	stateKey := uuid.NewString()
+
+	w, r := createMockCallbackWR("google", stateKey, "anything", "")
+
+	// The store fails for a reason other than the absence of the state.
+	mStates := &mockStateStore{}
+	mStates.On("Take", r.Context(), stateKey).Return(statestore.Value{}, errors.New("mock error")).Once()
+
+	mHandler := &Handler{config: config.Config{AllowedRedirectURLs: allowedURLs}, states: mStates}
+	mHandler.Callback(w, r)
+
+	// Verify redirect to the first allowed URL with an internal error.
+	require.Equal(t, http.StatusFound, w.Code)
+	parsed, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err, "Expected Location header to be a valid URL")
+	require.Equal(t, allowedURLs[0], parsed.Scheme+"://"+parsed.Host)
+	require.Contains(t, parsed.Query().Get("error"), errutils.InternalServerError().Error())
+	mStates.AssertExpectations(t)
+}
+
 func TestHandler_Callback_Validations(t *testing.T) {
 	// State key to use in all tests.
 	var stateKey = uuid.NewString()
@@ -95,24 +118,16 @@ func TestHandler_Callback_Validations(t *testing.T) {
 		inputProvider   string
 		inputCode       string
 		inputError      string
-		inputStateValue any // It is not received through the HTTP request but still is effectively an input.
+		inputStateValue statestore.Value // It is not received through the HTTP request but still is effectively an input.
 		// Expectations.
 		expectedLocation string
 		errSubstring     string
 	}{
-		{
-			name:             "State value of unknown type, Location should be first allowed redirect URL",
-			inputProvider:    correctProvider,
-			inputCode:        correctCode,
-			inputStateValue:  "incompatible type",
-			expectedLocation: allowedURLs[0],
-			errSubstring:     errutils.InternalServerError().Error(),
-		},
 		{
 			name:             "Too long provider length, Location should be as specified in the stateValue",
 			inputProvider:    strings.Repeat("a", 21),
 			inputCode:        correctCode,
-			inputStateValue:  stateValue{ClientCallbackURL: allowedURLs[1]},
+			inputStateValue:  statestore.Value{ClientCallbackURL: allowedURLs[1]},
 			expectedLocation: allowedURLs[1],
 			errSubstring:     errutils.InternalServerError().Error(),
 		},
@@ -120,7 +135,7 @@ func TestHandler_Callback_Validations(t *testing.T) {
 			name:             "Invalid provider character",
 			inputProvider:    correctProvider + "$$",
 			inputCode:        correctCode,
-			inputStateValue:  stateValue{ClientCallbackURL: allowedURLs[1]},
+			inputStateValue:  statestore.Value{ClientCallbackURL: allowedURLs[1]},
 			expectedLocation: allowedURLs[1],
 			errSubstring:     errutils.InternalServerError().Error(),
 		},
@@ -128,15 +143,15 @@ func TestHandler_Callback_Validations(t *testing.T) {
 			name:             "Absent auth code",
 			inputProvider:    correctProvider,
 			inputCode:        "",
-			inputStateValue:  stateValue{ClientCallbackURL: allowedURLs[1]},
+			inputStateValue:  statestore.Value{ClientCallbackURL: allowedURLs[1]},
 			expectedLocation: allowedURLs[1],
 			errSubstring:     errutils.InternalServerError().Error(),
 		},
 		{
 			name:             "Too long auth code",
 			inputProvider:    correctProvider,
-			inputCode:        strings.Repeat("a", 401),
-			inputStateValue:  stateValue{ClientCallbackURL: allowedURLs[1]},
+			inputCode:        strings.Repeat("a", 2049),
+			inputStateValue:  statestore.Value{ClientCallbackURL: allowedURLs[1]},
 			expectedLocation: allowedURLs[1],
 			errSubstring:     errutils.InternalServerError().Error(),
 		},
@@ -144,7 +159,7 @@ func TestHandler_Callback_Validations(t *testing.T) {
 			name:             "Invalid characters in auth code",
 			inputProvider:    correctProvider,
 			inputCode:        correctCode + "$$",
-			inputStateValue:  stateValue{ClientCallbackURL: allowedURLs[1]},
+			inputStateValue:  statestore.Value{ClientCallbackURL: allowedURLs[1]},
 			expectedLocation: allowedURLs[1],
 			errSubstring:     errutils.InternalServerError().Error(),
 		},
@@ -153,16 +168,16 @@ func TestHandler_Callback_Validations(t *testing.T) {
 			inputProvider:    correctProvider,
 			inputCode:        correctCode,
 			inputError:       "access_denied",
-			inputStateValue:  stateValue{ClientCallbackURL: allowedURLs[1]},
+			inputStateValue:  statestore.Value{ClientCallbackURL: allowedURLs[1]},
 			expectedLocation: allowedURLs[1],
 			errSubstring:     "access_denied",
 		},
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			// Populate the state map. This must be empty by the end.
-			mHandler := &Handler{config: mConfig, stateMap: &sync.Map{}}
-			mHandler.stateMap.Store(stateKey, tc.inputStateValue)
+			// Populate the state store. This must be empty by the end.
+			mHandler := &Handler{config: mConfig, states: statestore.NewMemoryStore(context.Background(), time.Minute, 0)}
+			require.NoError(t, mHandler.states.Put(context.Background(), stateKey, tc.inputStateValue))
 
 			// Create mock response writer and request.
 			w, r := createMockCallbackWR(tc.inputProvider, stateKey, tc.inputCode, tc.inputError)
@@ -170,9 +185,9 @@ func TestHandler_Callback_Validations(t *testing.T) {
 			// Invoke the method to test.
 			mHandler.Callback(w, r)
 
-			// Check if the state key was deleted from the state map.
-			_, found := mHandler.stateMap.LoadAndDelete(stateKey)
-			require.False(t, found, "Expected state key to have been deleted but it was not")
+			// Check if the state key was deleted from the state store.
+			_, errTake := mHandler.states.Take(context.Background(), stateKey)
+			require.ErrorIs(t, errTake, statestore.ErrNotFound, "Expected state key to have been deleted but it was not")
 
 			// Verify response code and headers.
 			require.Equal(t, http.StatusFound, w.Code)
@@ -197,7 +212,8 @@ func TestHandler_Callback(t *testing.T) {
 
 	// State key and value for all requests.
 	var stateKey = uuid.NewString()
-	var stateVal = stateValue{CodeVerifier: "anything", ClientCallbackURL: allowedURLs[1]}
+	var stateVal = statestore.Value{CodeVerifier: "anything", ClientCallbackURL: allowedURLs[1],
+		Nonce: "mockNonce"}
 
 	// Code for all requests.
 	const code = "4/0ASVgi3Iwlq42Bl8wh6-XUEpdSNFremRaxzXPWpRZxqYWW-xGo54-DAV94ZbLKx033sG5qA"
@@ -207,17 +223,30 @@ func TestHandler_Callback(t *testing.T) {
 	var claims = oauth.Claims{
 		Iss:        "mockIssuer",
 		Exp:        time.Now().Add(time.Hour),
+		Sub:        "mockSubject",
 		Email:      "mock@mock.com",
 		GivenName:  "mockGivenName",
 		FamilyName: "mockFamilyName",
 		Picture:    "mockPicture",
 	}
 
+	// User returned by the UpsertUserByIdentity method in case of no errors.
+	var user = repository.User{
+		ID:         42,
+		Email:      claims.Email,
+		GivenName:  claims.GivenName,
+		FamilyName: claims.FamilyName,
+		PictureURL: claims.Picture,
+	}
+
 	// Common error for reuse.
 	errMock := errors.New("mock error")
 	// For brevity.
 	mConfig := config.Config{AllowedRedirectURLs: allowedURLs}
 
+	// Session manager to issue and verify the session tokens.
+	sessions := newMockSessions(t, "https://application.com")
+
 	for _, tc := range []struct {
 		name string
 		// Mock inputs.
@@ -225,6 +254,9 @@ func TestHandler_Callback(t *testing.T) {
 		inputHTTPS        bool  // Flag to control the protocol of the request. This affects the returned cookie.
 		errTokenFromCode  error // Parameter to control if the TokenFromCode method should fail.
 		errDecodeToken    error // Parameter to control if the DecodeToken method should fail.
+		errUpsertUser     error // Parameter to control if the UpsertUserByIdentity method should fail.
+		errGetUserRoles   error // Parameter to control if the GetUserRoles method should fail.
+		errInsertSession  error // Parameter to control if the InsertSession method should fail.
 		// Expectations.
 		errSubstring string
 	}{
@@ -268,11 +300,32 @@ func TestHandler_Callback(t *testing.T) {
 			errDecodeToken:    errMock,
 			errSubstring:      errutils.InternalServerError().Error(),
 		},
+		{
+			name:              "UpsertUserByIdentity method returns error",
+			inputProviderName: knownProviderName,
+			inputHTTPS:        false,
+			errUpsertUser:     errMock,
+			errSubstring:      errutils.InternalServerError().Error(),
+		},
+		{
+			name:              "GetUserRoles method returns error",
+			inputProviderName: knownProviderName,
+			inputHTTPS:        false,
+			errGetUserRoles:   errMock,
+			errSubstring:      errutils.InternalServerError().Error(),
+		},
+		{
+			name:              "InsertSession method returns error",
+			inputProviderName: knownProviderName,
+			inputHTTPS:        false,
+			errInsertSession:  errMock,
+			errSubstring:      errutils.InternalServerError().Error(),
+		},
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			// Create mock handler for each test.
-			mHandler := &Handler{config: mConfig, stateMap: &sync.Map{}}
+			mHandler := &Handler{config: mConfig, states: statestore.NewMemoryStore(context.Background(), time.Minute, 0), sessions: sessions}
 
 			// Create mock response writer and request.
 			w, r := createMockCallbackWR(tc.inputProviderName, stateKey, code, "")
@@ -285,8 +338,8 @@ func TestHandler_Callback(t *testing.T) {
 				mHandler.config.Application.BaseURL = "http://application.com"
 			}
 
-			// Populate the state map. This must be empty by the end.
-			mHandler.stateMap.Store(stateKey, stateVal)
+			// Populate the state store. This must be empty by the end.
+			require.NoError(t, mHandler.states.Put(context.Background(), stateKey, stateVal))
 
 			// Attach new mock repository instance for each run.
 			mRepo := &mockRepository{}
@@ -294,17 +347,18 @@ func TestHandler_Callback(t *testing.T) {
 
 			// Setup provider call expectations.
 			mProvider := &mockProvider{}
-			mHandler.googleProvider = mProvider
-
-			// Always expect the Name call.
-			mProvider.On("Name").Return(knownProviderName).Once()
+			mHandler.providers = map[string]oauth.Provider{knownProviderName: mProvider}
 
 			// If provider name id correct, expect a TokenFromCode call.
 			expectTokenFromCode := tc.inputProviderName == knownProviderName
 			// If TokenFromCode is supposed to succeed, expect a DecodeToken call.
 			expectDecodeToken := expectTokenFromCode && tc.errTokenFromCode == nil
-			// If DecodeToken is supposed to succeed, expect an UpsertUser call.
+			// If DecodeToken is supposed to succeed, expect an UpsertUserByIdentity call.
 			expectUpsertUser := expectDecodeToken && tc.errDecodeToken == nil
+			// If UpsertUserByIdentity is supposed to succeed, expect a GetUserRoles call.
+			expectGetUserRoles := expectUpsertUser && tc.errUpsertUser == nil
+			// If GetUserRoles is supposed to succeed, expect an InsertSession call.
+			expectInsertSession := expectGetUserRoles && tc.errGetUserRoles == nil
 
 			// Set call expectations.
 			if expectTokenFromCode {
@@ -312,30 +366,40 @@ func TestHandler_Callback(t *testing.T) {
 					Return(token, tc.errTokenFromCode).Once()
 			}
 			if expectDecodeToken {
-				mProvider.On("DecodeToken", r.Context(), token).
+				mProvider.On("DecodeToken", r.Context(), token, stateVal.Nonce).
 					Return(claims, tc.errDecodeToken).Once()
 			}
 			if expectUpsertUser {
-				mRepo.On("UpsertUser", context.Background(), repository.User{
+				mRepo.On("UpsertUserByIdentity", r.Context(), repository.Identity{
+					Provider:   knownProviderName,
+					Subject:    claims.Sub,
 					Email:      claims.Email,
 					GivenName:  claims.GivenName,
 					FamilyName: claims.FamilyName,
 					PictureURL: claims.Picture,
-				}).Return(nil).Once()
+				}).Return(user, tc.errUpsertUser).Once()
+			}
+			if expectGetUserRoles {
+				mRepo.On("GetUserRoles", r.Context(), user.ID).Return([]string{"admin"}, tc.errGetUserRoles).Once()
+			}
+
+			// The inserted session is captured to compare it with the issued token.
+			var insertedSession repository.Session
+			if expectInsertSession {
+				mRepo.On("InsertSession", r.Context(), mock.AnythingOfType("repository.Session")).
+					Run(func(args mock.Arguments) { insertedSession = args.Get(1).(repository.Session) }).
+					Return(tc.errInsertSession).Once()
 			}
 
 			// Invoke the method to test.
 			mHandler.Callback(w, r)
 
-			// Check if the state key was deleted from the state map
-			_, found := mHandler.stateMap.LoadAndDelete(stateKey)
-			require.False(t, found, "Expected state key to be deleted but it was not")
+			// Check if the state key was deleted from the state store
+			_, errTake := mHandler.states.Take(context.Background(), stateKey)
+			require.ErrorIs(t, errTake, statestore.ErrNotFound, "Expected state key to be deleted but it was not")
 
-			// Verify provider calls.
+			// Verify provider and repository calls.
 			mProvider.AssertExpectations(t)
-
-			// Sleep for some time for the database operation to complete.
-			time.Sleep(time.Millisecond * 100)
 			mRepo.AssertExpectations(t)
 
 			// Verify response code.
@@ -356,17 +420,198 @@ func TestHandler_Callback(t *testing.T) {
 			require.Equal(t, parsed.Query().Get("provider"), knownProviderName)
 			// Get the cookie from the response.
 			cookie := w.Result().Cookies()[0]
+			// The cookie must hold a valid session token of the upserted user.
+			sessionClaims, err := sessions.Verify(cookie.Value)
+			require.NoError(t, err, "Expected cookie to hold a valid session token")
+			require.Equal(t, user.ID, sessionClaims.UserID, "Session user ID does not match")
+			require.Equal(t, user.Email, sessionClaims.Email, "Session email does not match")
+			require.Equal(t, knownProviderName, sessionClaims.Provider, "Session provider does not match")
+			require.Equal(t, []string{"admin"}, sessionClaims.Roles, "Session roles do not match")
+			// The token must belong to the inserted session.
+			require.Equal(t, insertedSession.ID, sessionClaims.SessionID, "Session ID does not match")
+			require.Equal(t, user.ID, insertedSession.UserID, "Inserted session user ID does not match")
+			require.Equal(t, knownProviderName, insertedSession.Provider, "Inserted session provider does not match")
+			require.WithinDuration(t, sessionClaims.AuthTime, insertedSession.CreatedAt, time.Second,
+				"Inserted session creation time does not match")
+			require.WithinDuration(t, sessions.SessionExpiry(sessionClaims.AuthTime), insertedSession.ExpiresAt,
+				time.Second, "Inserted session expiry does not match")
+			require.Empty(t, insertedSession.RefreshToken, "Expected no refresh token")
 			// Verify cookie fields.
-			require.Equal(t, token, cookie.Value, "Cookie value does not match")
 			require.Equal(t, "/", cookie.Path, "Cookie path does not match")
 			require.NotEqual(t, 0, cookie.MaxAge, "Cookie max age does not match")
 			require.Equal(t, tc.inputHTTPS, cookie.Secure, "Cookie secure does not match")
 			require.True(t, cookie.HttpOnly, "Cookie httpOnly is not true")
-			require.Equal(t, http.SameSiteStrictMode, cookie.SameSite, "Cookie SameSite does not match")
+			require.Equal(t, http.SameSiteLaxMode, cookie.SameSite, "Cookie SameSite does not match")
 		})
 	}
 }
 
+func TestHandler_Callback_FormPost(t *testing.T) {
+	// State key and value for the request.
+	var stateKey = uuid.NewString()
+	var stateVal = statestore.Value{CodeVerifier: "anything", ClientCallbackURL: "https://first.com",
+		Nonce: "mockNonce"}
+
+	const code, token = "c1a2b3.0.abc-def", "header.payload.signature"
+	const userJSON = `{"name":{"firstName":"mockGivenName","lastName":"mockFamilyName"}}`
+
+	// Claims in the token, and after adding the callback data.
+	tokenClaims := oauth.Claims{Iss: "mockIssuer", Exp: time.Now().Add(time.Hour), Sub: "mockSubject",
+		Email: "mock@mock.com"}
+	callbackClaims := tokenClaims
+	callbackClaims.GivenName, callbackClaims.FamilyName = "mockGivenName", "mockFamilyName"
+
+	// The provider calls back with a POST form, like Apple.
+	form := url.Values{"state": {stateKey}, "code": {code}, "user": {userJSON}}
+	r := httptest.NewRequest(http.MethodPost, "/mock", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = mux.SetURLVars(r, map[string]string{"provider": "apple"})
+	w := httptest.NewRecorder()
+
+	// Setup mocks.
+	mProvider, mRepo := &mockCallbackClaimsProvider{}, &mockRepository{}
+	mProvider.On("TokenFromCode", r.Context(), code, stateVal.CodeVerifier).Return(token, nil).Once()
+	mProvider.On("DecodeToken", r.Context(), token, stateVal.Nonce).Return(tokenClaims, nil).Once()
+	mProvider.On("ClaimsFromCallback", tokenClaims, form).Return(callbackClaims).Once()
+	mRepo.On("UpsertUserByIdentity", r.Context(), repository.Identity{
+		Provider:   "apple",
+		Subject:    callbackClaims.Sub,
+		Email:      callbackClaims.Email,
+		GivenName:  callbackClaims.GivenName,
+		FamilyName: callbackClaims.FamilyName,
+	}).Return(repository.User{ID: 1, Email: callbackClaims.Email}, nil).Once()
+	mRepo.On("GetUserRoles", r.Context(), 1).Return([]string(nil), nil).Once()
+	mRepo.On("InsertSession", r.Context(), mock.AnythingOfType("repository.Session")).Return(nil).Once()
+
+	// Session manager to issue the session token.
+	sessions := newMockSessions(t, "https://application.com")
+
+	mHandler := &Handler{
+		config:    config.Config{AllowedRedirectURLs: []string{stateVal.ClientCallbackURL}},
+		states:    statestore.NewMemoryStore(context.Background(), time.Minute, 0),
+		providers: map[string]oauth.Provider{"apple": mProvider},
+		sessions:  sessions,
+		repo:      mRepo,
+	}
+	require.NoError(t, mHandler.states.Put(context.Background(), stateKey, stateVal))
+
+	// Invoke the method to test.
+	mHandler.Callback(w, r)
+
+	// Verify provider and repository calls.
+	mProvider.AssertExpectations(t)
+	mRepo.AssertExpectations(t)
+
+	// Verify success redirect.
+	require.Equal(t, http.StatusFound, w.Code)
+	parsed, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err, "Expected Location header to be a valid URL")
+	require.Empty(t, parsed.Query().Get("error"), "Expected no error in the redirect")
+	require.Equal(t, "apple", parsed.Query().Get("provider"))
+}
+
+func TestHandler_Callback_RefreshToken(t *testing.T) {
+	// State key and value for the request.
+	var stateKey = uuid.NewString()
+	var stateVal = statestore.Value{CodeVerifier: "anything", ClientCallbackURL: "https://first.com",
+		Nonce: "mockNonce"}
+
+	const code = "c1a2b3.0.abc-def"
+	tokens := oauth.Tokens{IDToken: "header.payload.signature", RefreshToken: "mockRefreshToken"}
+	claims := oauth.Claims{Iss: "mockIssuer", Exp: time.Now().Add(time.Hour), Sub: "mockSubject",
+		Email: "mock@mock.com"}
+
+	w, r := createMockCallbackWR("google", stateKey, code, "")
+
+	// Setup mocks. The provider issues refresh tokens.
+	mProvider, mRepo := &mockRefresherProvider{}, &mockRepository{}
+	mProvider.On("TokensFromCode", r.Context(), code, stateVal.CodeVerifier).Return(tokens, nil).Once()
+	mProvider.On("DecodeToken", r.Context(), tokens.IDToken, stateVal.Nonce).Return(claims, nil).Once()
+	mRepo.On("UpsertUserByIdentity", r.Context(),
+		repository.Identity{Provider: "google", Subject: claims.Sub, Email: claims.Email}).
+		Return(repository.User{ID: 1, Email: claims.Email}, nil).Once()
+	mRepo.On("GetUserRoles", r.Context(), 1).Return([]string(nil), nil).Once()
+
+	// The inserted session is captured to verify the refresh token.
+	var insertedSession repository.Session
+	mRepo.On("InsertSession", r.Context(), mock.AnythingOfType("repository.Session")).
+		Run(func(args mock.Arguments) { insertedSession = args.Get(1).(repository.Session) }).
+		Return(nil).Once()
+
+	aead := newMockAEAD(t)
+	mHandler := &Handler{
+		config:        config.Config{AllowedRedirectURLs: []string{stateVal.ClientCallbackURL}},
+		states:        statestore.NewMemoryStore(context.Background(), time.Minute, 0),
+		providers:     map[string]oauth.Provider{"google": mProvider},
+		sessions:      newMockSessions(t, "https://application.com"),
+		refreshTokens: aead,
+		repo:          mRepo,
+	}
+	require.NoError(t, mHandler.states.Put(context.Background(), stateKey, stateVal))
+
+	// Invoke the method to test.
+	mHandler.Callback(w, r)
+
+	// Verify provider and repository calls.
+	mProvider.AssertExpectations(t)
+	mRepo.AssertExpectations(t)
+	require.Equal(t, http.StatusFound, w.Code)
+
+	// The refresh token must be stored encrypted, and bound to the session.
+	require.NotEmpty(t, insertedSession.RefreshToken, "Expected refresh token to be stored")
+	require.NotEqual(t, tokens.RefreshToken, insertedSession.RefreshToken, "Expected refresh token to be encrypted")
+	opened, err := aead.Open(insertedSession.RefreshToken, []byte(insertedSession.ID))
+	require.NoError(t, err, "Expected refresh token to be bound to the session")
+	require.Equal(t, tokens.RefreshToken, string(opened), "Refresh token does not match")
+
+	// The refreshed tokens are matched to the identity by its subject.
+	require.Equal(t, claims.Sub, insertedSession.Subject, "Subject does not match")
+}
+
+func TestHandler_Callback_EmailTaken(t *testing.T) {
+	// State key and value for the request.
+	var stateKey = uuid.NewString()
+	var stateVal = statestore.Value{CodeVerifier: "anything", ClientCallbackURL: "https://first.com",
+		Nonce: "mockNonce"}
+
+	// The email of an existing user, which the provider did not verify.
+	const code, token = "c1a2b3.0.abc-def", "header.payload.signature"
+	claims := oauth.Claims{Iss: "mockIssuer", Exp: time.Now().Add(time.Hour), Sub: "mockSubject",
+		Email: "victim@mock.com", EmailVerified: false}
+
+	w, r := createMockCallbackWR("microsoft", stateKey, code, "")
+
+	// Setup mocks. The repository refuses to link the identity to the user with the same email.
+	mProvider, mRepo := &mockProvider{}, &mockRepository{}
+	mProvider.On("TokenFromCode", r.Context(), code, stateVal.CodeVerifier).Return(token, nil).Once()
+	mProvider.On("DecodeToken", r.Context(), token, stateVal.Nonce).Return(claims, nil).Once()
+	mRepo.On("UpsertUserByIdentity", r.Context(),
+		repository.Identity{Provider: "microsoft", Subject: claims.Sub, Email: claims.Email}).
+		Return(repository.User{}, repository.ErrConflict).Once()
+
+	mHandler := &Handler{
+		config:    config.Config{AllowedRedirectURLs: []string{stateVal.ClientCallbackURL}},
+		states:    statestore.NewMemoryStore(context.Background(), time.Minute, 0),
+		providers: map[string]oauth.Provider{"microsoft": mProvider},
+		sessions:  newMockSessions(t, "https://application.com"),
+		repo:      mRepo,
+	}
+	require.NoError(t, mHandler.states.Put(context.Background(), stateKey, stateVal))
+
+	// Invoke the method to test.
+	mHandler.Callback(w, r)
+
+	// No roles are loaded, and no session is started.
+	mProvider.AssertExpectations(t)
+	mRepo.AssertExpectations(t)
+
+	require.Equal(t, http.StatusFound, w.Code)
+	parsed, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err, "Expected Location header to be a valid URL")
+	require.Equal(t, errEmailTaken.Error(), parsed.Query().Get("error"), "Error does not match")
+	require.Empty(t, w.Result().Cookies(), "Expected no cookie")
+}
+
 // createMockCallbackWR creates a mock ResponseWriter and Request to test the Callback handler.
 func createMockCallbackWR(provider, stateKey, code, e string) (*httptest.ResponseRecorder, *http.Request) {
 	// Mock HTTP request.
@@ -383,3 +628,24 @@ func createMockCallbackWR(provider, stateKey, code, e string) (*httptest.Respons
 
 	return httptest.NewRecorder(), req
 }
+
+func TestWithQuery(t *testing.T) {
+	params := url.Values{"provider": {"google"}}
+
+	for _, tc := range []struct {
+		name      string
+		targetURL string
+		expected  string
+	}{
+		{name: "URL without query", targetURL: "https://app.com/", expected: "https://app.com/?provider=google"},
+		{name: "URL with query", targetURL: "https://app.com/page?tab=1",
+			expected: "https://app.com/page?tab=1&provider=google"},
+		{name: "URL with fragment", targetURL: "https://app.com/page#top",
+			expected: "https://app.com/page?provider=google#top"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, withQuery(tc.targetURL, params))
+		})
+	}
+}
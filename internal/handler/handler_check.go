@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -8,68 +9,324 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
 	"github.com/shivanshkc/authorizer/internal/utils/errutils"
 	"github.com/shivanshkc/authorizer/internal/utils/httputils"
 	"github.com/shivanshkc/authorizer/pkg/oauth"
 )
 
 const (
+	xAuthUserIDHeader  = "X-Auth-User-Id"
 	xAuthEmailHeader   = "X-Auth-Email"
 	xAuthNameHeader    = "X-Auth-Name"
 	xAuthPictureHeader = "X-Auth-Picture"
+	xAuthRolesHeader   = "X-Auth-Roles"
+	xAuthOrgIDHeader   = "X-Auth-Org-Id"
+	xAuthOrgRoleHeader = "X-Auth-Org-Role"
+
+	// xAuthAssertionHeader is the default name of the header that holds the identity assertion.
+	xAuthAssertionHeader = "X-Auth-Assertion"
 )
 
 // Check performs an authentication check on the given request.
+//
+// The token is taken from the session cookie, or from the Authorization header as a bearer token. Upon failure, the
+// response carries a WWW-Authenticate challenge as per RFC 6750.
 func (h *Handler) Check(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// Get cookie for authentication.
-	cookie, err := r.Cookie(accessTokenCookieName)
+	// Get the token from the cookie or the Authorization header.
+	token, bearer, err := h.requestToken(r)
 	if err != nil {
-		// Known error.
-		if errors.Is(err, http.ErrNoCookie) {
-			slog.ErrorContext(ctx, "No cookie in the request")
-			httputils.WriteErr(w, errutils.Unauthorized())
-			return
+		slog.ErrorContext(ctx, "error in requestToken call", "error", err)
+		h.writeChallenge(w, errutils.ToHTTPError(err), bearerErrInvalidRequest)
+		return
+	}
+	if token == "" {
+		slog.ErrorContext(ctx, "No token in the request")
+		// In the forward-auth mode, the user is sent to the sign-in instead.
+		if !h.loginRedirect(w, r) {
+			h.writeChallenge(w, errutils.Unauthorized(), "")
 		}
-		// Unexpected error.
-		slog.ErrorContext(ctx, "Failed to get cookie from request", "error", err)
-		httputils.WriteErr(w, errutils.InternalServerError())
 		return
 	}
 
-	// Get token issuer. This is necessary to decide which provider to use to verify the token.
-	issuer, err := issuerFromToken(cookie.Value)
+	// Verify the token.
+	claims, err := h.authenticate(ctx, token)
 	if err != nil {
-		slog.ErrorContext(ctx, "error in issuerFromToken call", "error", err)
-		httputils.WriteErr(w, errutils.Unauthorized())
+		slog.ErrorContext(ctx, "error in authenticate call", "error", err)
+		// Only the failures caused by the token are challenged, and the users of the browser are sent to the sign-in
+		// in the forward-auth mode.
+		if errHTTP := authError(err); errHTTP.StatusCode == http.StatusUnauthorized {
+			if bearer || !h.loginRedirect(w, r) {
+				h.writeChallenge(w, errHTTP, bearerErrInvalidToken)
+			}
+		} else {
+			httputils.WriteErr(w, errHTTP)
+		}
 		return
 	}
 
-	// Get the provider to use.
-	provider := h.providerByIssuer(issuer)
-	if provider == nil {
-		slog.ErrorContext(ctx, "no providers for issuer", "issuer", issuer)
-		httputils.WriteErr(w, errutils.Unauthorized())
+	// The user is authenticated, but may not be allowed to make the original request.
+	if err := h.authorize(ctx, policyRequest(r), claims); err != nil {
+		httputils.WriteErr(w, err)
 		return
 	}
 
-	// Decode token for verification and claims.
-	claims, err := provider.DecodeToken(ctx, cookie.Value)
+	// Renew the session token if it is near its expiry. Bearer tokens are not renewed, as the renewed token is set
+	// as a cookie.
+	if !bearer {
+		var cookie *http.Cookie
+		if claims, cookie = h.renewCookie(ctx, claims); cookie != nil {
+			http.SetCookie(w, cookie)
+		}
+	}
+
+	headers, err := h.identityHeaders(claims)
 	if err != nil {
-		slog.ErrorContext(ctx, "Failed to decode token", "error", err)
-		httputils.WriteErr(w, errutils.Unauthorized())
+		slog.ErrorContext(ctx, "error in identityHeaders call", "error", err)
+		httputils.WriteErr(w, errutils.InternalServerError())
 		return
 	}
 
-	headers := map[string]string{
-		xAuthEmailHeader:   claims.Email,
-		xAuthNameHeader:    claims.GivenName + " " + claims.FamilyName,
-		xAuthPictureHeader: claims.Picture,
+	httputils.Write(w, http.StatusOK, headers, nil)
+}
+
+// renewCookie renews the session token of the given claims if it is near its expiry, and returns the renewed claims
+// along with the session cookie to set. The cookie is nil if the token was not renewed, in which case the claims are
+// returned as is. Upon failure, the current token remains valid till its expiry.
+func (h *Handler) renewCookie(ctx context.Context, claims session.Claims) (session.Claims, *http.Cookie) {
+	if claims.SessionID == "" || !h.sessions.ShouldRenew(claims) {
+		return claims, nil
+	}
+
+	token, renewedClaims, err := h.renew(ctx, claims)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to renew session", "sid", claims.SessionID, "error", err)
+		return claims, nil
 	}
 
-	httputils.Write(w, http.StatusOK, headers, nil)
+	return renewedClaims, h.sessionCookie(token, int(time.Until(renewedClaims.Exp).Seconds()))
+}
+
+// identityHeaders returns the headers that carry the identity of the given claims to the upstream services, that is,
+// the mapped headers, and the assertion if it is enabled.
+func (h *Handler) identityHeaders(claims session.Claims) (map[string]string, error) {
+	headers := h.authHeaders(claims)
+
+	// The assertion lets the upstream services verify the identity, instead of trusting the plain headers.
+	if assertionConf := h.config.Check.Assertion; assertionConf.Enabled {
+		assertion, err := h.sessions.IssueAssertion(claims, assertionConf.Audience, assertionConf.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("error in sessions.IssueAssertion call: %w", err)
+		}
+
+		headerName := assertionConf.Header
+		if headerName == "" {
+			headerName = xAuthAssertionHeader
+		}
+		headers[headerName] = assertion
+	}
+
+	return headers, nil
+}
+
+// authenticate verifies the given token and returns the claims of the session.
+//
+// Authorizer's own session tokens are verified locally, their sessions must not be revoked, and their users must still
+// be members of their organization. Tokens of any other issuer are verified by the provider that issued them, in which
+// case the user ID is looked up by the identity, and it is zero if the identity is not linked to any user. Those
+// tokens are subject to the sign-in rules as well.
+//
+// Failures that are not caused by the token, like database errors, are returned as an errutils.HTTPError.
+func (h *Handler) authenticate(ctx context.Context, token string) (session.Claims, error) {
+	// Get token issuer. This is necessary to decide how to verify the token.
+	issuer, err := issuerFromToken(token)
+	if err != nil {
+		return session.Claims{}, fmt.Errorf("error in issuerFromToken call: %w", err)
+	}
+
+	// Authorizer's own session token.
+	if issuer == h.sessions.Issuer() {
+		claims, err := h.sessions.Verify(token)
+		if err != nil {
+			return session.Claims{}, fmt.Errorf("error in sessions.Verify call: %w", err)
+		}
+
+		// The session is revoked if it does not exist anymore.
+		if _, err := h.repo.GetSession(ctx, claims.SessionID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return session.Claims{}, fmt.Errorf("session revoked: %s", claims.SessionID)
+			}
+			return session.Claims{}, errutils.InternalServerError().
+				WithReasonErr(fmt.Errorf("error in GetSession call: %w", err))
+		}
+
+		// The user must still be a member of the organization that they signed in to.
+		if claims, err = h.checkMembership(ctx, claims); err != nil {
+			return session.Claims{}, fmt.Errorf("error in checkMembership call: %w", err)
+		}
+
+		return claims, nil
+	}
+
+	// Make sure a provider was found.
+	provider := h.providerByIssuer(issuer)
+	if provider == nil {
+		return session.Claims{}, fmt.Errorf("no provider found for issuer: %s", issuer)
+	}
+
+	// Decode token for verification and claims. The nonce is verified only upon callback.
+	claims, err := provider.DecodeToken(ctx, token, "")
+	if err != nil {
+		return session.Claims{}, fmt.Errorf("error in DecodeToken call: %w", err)
+	}
+
+	providerName := provider.Name()
+
+	// The provider's tokens do not pass through the callback, so the sign-in rules are applied here as well.
+	if err := h.checkSignIn(providerName, claims); err != nil {
+		return session.Claims{}, fmt.Errorf("error in checkSignIn call: %w", err)
+	}
+
+	var userID int
+	if claims.Sub != "" {
+		if userID, err = h.repo.GetIdentityUserID(ctx, providerName, claims.Sub); err != nil &&
+			!errors.Is(err, repository.ErrNotFound) {
+			return session.Claims{}, errutils.InternalServerError().
+				WithReasonErr(fmt.Errorf("error in GetIdentityUserID call: %w", err))
+		}
+	}
+
+	// Only the users have roles.
+	var roles []string
+	if userID != 0 {
+		if roles, err = h.repo.GetUserRoles(ctx, userID); err != nil {
+			return session.Claims{}, errutils.InternalServerError().
+				WithReasonErr(fmt.Errorf("error in GetUserRoles call: %w", err))
+		}
+	}
+
+	return session.Claims{
+		UserID:        userID,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+		Picture:       claims.Picture,
+		Provider:      providerName,
+		Roles:         roles,
+		Extra:         h.forwardedClaims(providerExtra(claims)),
+		Exp:           claims.Exp,
+	}, nil
+}
+
+// renew issues a new session token for the given claims, and returns it along with its claims.
+//
+// If the session holds a refresh token, the provider is asked for a new identity token first. This makes sure that
+// the user still has access, and updates the user's details in the claims. If that fails, the session is not renewed.
+// The user's roles are reloaded, so that the changes to them apply upon renewal.
+func (h *Handler) renew(ctx context.Context, claims session.Claims) (string, session.Claims, error) {
+	sess, err := h.repo.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		return "", session.Claims{}, fmt.Errorf("error in GetSession call: %w", err)
+	}
+
+	if claims.Roles, err = h.repo.GetUserRoles(ctx, claims.UserID); err != nil {
+		return "", session.Claims{}, fmt.Errorf("error in GetUserRoles call: %w", err)
+	}
+
+	if sess.RefreshToken != "" && h.refreshTokens != nil {
+		if claims, err = h.refreshClaims(ctx, sess, claims); err != nil {
+			return "", session.Claims{}, fmt.Errorf("error in refreshClaims call: %w", err)
+		}
+	}
+
+	token, expiry, err := h.sessions.Issue(claims)
+	if err != nil {
+		return "", session.Claims{}, fmt.Errorf("error in sessions.Issue call: %w", err)
+	}
+
+	claims.Exp = expiry
+	return token, claims, nil
+}
+
+// refreshClaims obtains a new identity token from the provider of the given session with its refresh token, and
+// updates the user's details in the claims as per the new identity token.
+//
+// If the provider can not refresh tokens anymore, for example, because it was removed from the configs, the claims
+// are returned as is.
+func (h *Handler) refreshClaims(ctx context.Context, sess repository.Session, claims session.Claims,
+) (session.Claims, error) {
+	provider := h.providerByName(sess.Provider)
+	refresher, ok := provider.(oauth.Refresher)
+	if !ok {
+		return claims, nil
+	}
+
+	// The refresh token is bound to the session.
+	refreshToken, err := h.refreshTokens.Open(sess.RefreshToken, []byte(sess.ID))
+	if err != nil {
+		return session.Claims{}, fmt.Errorf("error in refreshTokens.Open call: %w", err)
+	}
+
+	tokens, err := refresher.Refresh(ctx, string(refreshToken))
+	if err != nil {
+		return session.Claims{}, fmt.Errorf("error in Refresh call: %w", err)
+	}
+
+	// Refreshed tokens are not bound to a flow, so they carry no nonce.
+	providerClaims, err := provider.DecodeToken(ctx, tokens.IDToken, "")
+	if err != nil {
+		return session.Claims{}, fmt.Errorf("error in DecodeToken call: %w", err)
+	}
+
+	// The refresh token must belong to the same identity. The email can not tell, as the user's email, which the
+	// claims hold, may differ from the one of the identity.
+	if providerClaims.Sub != sess.Subject {
+		return session.Claims{}, fmt.Errorf("refreshed token belongs to another subject: %s", providerClaims.Sub)
+	}
+
+	// Providers may omit some details upon refresh, in which case the current ones are kept.
+	for dst, src := range map[*string]string{
+		&claims.GivenName:  providerClaims.GivenName,
+		&claims.FamilyName: providerClaims.FamilyName,
+		&claims.Picture:    providerClaims.Picture,
+	} {
+		if src != "" {
+			*dst = src
+		}
+	}
+
+	// The forwarded claims, like groups, are replaced, so that the revoked ones do not outlive the renewal.
+	claims.Extra = h.forwardedClaims(providerExtra(providerClaims))
+
+	// Store the refresh token if the provider rotated it.
+	if tokens.RefreshToken != "" {
+		sealed, err := h.refreshTokens.Seal([]byte(tokens.RefreshToken), []byte(sess.ID))
+		if err != nil {
+			return session.Claims{}, fmt.Errorf("error in refreshTokens.Seal call: %w", err)
+		}
+		if err := h.repo.UpdateSessionRefreshToken(ctx, sess.ID, sealed); err != nil {
+			return session.Claims{}, fmt.Errorf("error in UpdateSessionRefreshToken call: %w", err)
+		}
+	}
+
+	return claims, nil
+}
+
+// authError converts an error of the authenticate call to the error to respond with.
+//
+// It is an HTTPError for failures that are not caused by the token, and Unauthorized otherwise.
+func authError(err error) *errutils.HTTPError {
+	var errHTTP *errutils.HTTPError
+	if errors.As(err, &errHTTP) {
+		return errHTTP
+	}
+	return errutils.Unauthorized()
 }
 
 // issuerFromToken decodes the base64 encoded payload of the token and returns the value of the "iss" claim.
@@ -88,8 +345,10 @@ func issuerFromToken(token string) (string, error) {
 		return "", fmt.Errorf("failed to decode token payload: %w", err)
 	}
 
-	// Unmarshal claims to struct to finally get the "iss" value.
-	var claims oauth.Claims
+	// Unmarshal only the "iss" claim. The others, like the numeric "exp", are of no use here.
+	var claims struct {
+		Iss string `json:"iss"`
+	}
 	if err := json.Unmarshal(payload, &claims); err != nil {
 		return "", fmt.Errorf("failed to unmarshal token claims: %w", err)
 	}
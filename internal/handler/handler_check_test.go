@@ -9,19 +9,26 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
 	"github.com/shivanshkc/authorizer/pkg/oauth"
 )
 
 func TestHandler_Check(t *testing.T) {
 	// Requests containing the token with this issuer will pass the issuer recognition check.
 	const correctIssuer = "accounts.google.com"
+	// Issuer of Authorizer's own session tokens.
+	const sessionIssuer = "https://application.com"
 
 	// Correct claims to be returned by the DecodeToken call in case of no errors.
 	claims := oauth.Claims{
 		Iss:        correctIssuer,
 		Exp:        time.Now().Add(time.Hour),
+		Sub:        "mockSubject",
 		Email:      "hey@hey.com",
 		GivenName:  "Gi",
 		FamilyName: "Hun",
@@ -40,15 +47,34 @@ func TestHandler_Check(t *testing.T) {
 	badIssuerPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + correctIssuer + `-random"}`))
 	correctPayload := base64.RawURLEncoding.EncodeToString(claimBytes)
 
+	// Session manager of the handler, and a valid session token issued by it.
+	sessions := newMockSessions(t, sessionIssuer)
+
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com", GivenName: "Ses", FamilyName: "Sion",
+		Picture: "mockSessionPicture", Provider: "github", Roles: []string{"admin"}}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	// Session token with the same issuer but signed by another key.
+	foreignSessions := newMockSessions(t, sessionIssuer)
+	foreignSessionToken, _, err := foreignSessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue foreign session token")
+
 	for _, tc := range []struct {
 		name string
 		// Mock inputs.
 		inCookieName   string
 		inCookieValue  string
 		errDecodeToken error // Parameter to control if the DecodeToken method should fail.
+		errGetSession  error // Parameter to control if the GetSession method should fail.
+		identityUserID int   // User ID returned by the GetIdentityUserID method.
+		errGetIdentity error // Parameter to control if the GetIdentityUserID method should fail.
+		errGetRoles    error // Parameter to control if the GetUserRoles method should fail.
+		deniedEmails   []string
 		// Expectations
-		expectIssuersCall     bool
 		expectDecodeTokenCall bool
+		expectGetSessionCall  bool
+		expectGetIdentityCall bool
 		expectedResponseCode  int
 		expectedHeaders       map[string]string
 	}{
@@ -57,7 +83,6 @@ func TestHandler_Check(t *testing.T) {
 			inCookieName:          accessTokenCookieName + "-random",
 			inCookieValue:         "",
 			errDecodeToken:        nil,
-			expectIssuersCall:     false,
 			expectDecodeTokenCall: false,
 			expectedResponseCode:  http.StatusUnauthorized,
 			expectedHeaders:       map[string]string{},
@@ -67,7 +92,6 @@ func TestHandler_Check(t *testing.T) {
 			inCookieName:          accessTokenCookieName,
 			inCookieValue:         "headers.payload",
 			errDecodeToken:        nil,
-			expectIssuersCall:     false,
 			expectDecodeTokenCall: false,
 			expectedResponseCode:  http.StatusUnauthorized,
 			expectedHeaders:       map[string]string{},
@@ -77,7 +101,6 @@ func TestHandler_Check(t *testing.T) {
 			inCookieName:          accessTokenCookieName,
 			inCookieValue:         "headers.invalidBase64.signature",
 			errDecodeToken:        nil,
-			expectIssuersCall:     false,
 			expectDecodeTokenCall: false,
 			expectedResponseCode:  http.StatusUnauthorized,
 			expectedHeaders:       map[string]string{},
@@ -87,7 +110,6 @@ func TestHandler_Check(t *testing.T) {
 			inCookieName:          accessTokenCookieName,
 			inCookieValue:         "headers." + badJSONPayload + ".signature",
 			errDecodeToken:        nil,
-			expectIssuersCall:     false,
 			expectDecodeTokenCall: false,
 			expectedResponseCode:  http.StatusUnauthorized,
 			expectedHeaders:       map[string]string{},
@@ -97,7 +119,6 @@ func TestHandler_Check(t *testing.T) {
 			inCookieName:          accessTokenCookieName,
 			inCookieValue:         "headers." + badIssuerPayload + ".signature",
 			errDecodeToken:        errMock,
-			expectIssuersCall:     true,
 			expectDecodeTokenCall: false,
 			expectedResponseCode:  http.StatusUnauthorized,
 			expectedHeaders:       map[string]string{},
@@ -107,7 +128,6 @@ func TestHandler_Check(t *testing.T) {
 			inCookieName:          accessTokenCookieName,
 			inCookieValue:         "headers." + correctPayload + ".signature",
 			errDecodeToken:        errMock,
-			expectIssuersCall:     true,
 			expectDecodeTokenCall: true,
 			expectedResponseCode:  http.StatusUnauthorized,
 			expectedHeaders:       map[string]string{},
@@ -117,8 +137,45 @@ func TestHandler_Check(t *testing.T) {
 			inCookieName:          accessTokenCookieName,
 			inCookieValue:         "headers." + correctPayload + ".signature",
 			errDecodeToken:        nil,
-			expectIssuersCall:     true,
+			identityUserID:        3,
+			expectDecodeTokenCall: true,
+			expectGetIdentityCall: true,
+			expectedResponseCode:  http.StatusOK,
+			expectedHeaders: map[string]string{
+				xAuthUserIDHeader:  "3",
+				xAuthEmailHeader:   claims.Email,
+				xAuthNameHeader:    claims.GivenName + " " + claims.FamilyName,
+				xAuthPictureHeader: claims.Picture,
+				xAuthRolesHeader:   "admin,auditor",
+			},
+		},
+		{
+			name:                  "Email denied sign-in, error expected",
+			inCookieName:          accessTokenCookieName,
+			inCookieValue:         "headers." + correctPayload + ".signature",
+			deniedEmails:          []string{claims.Email},
+			expectDecodeTokenCall: true,
+			expectedResponseCode:  http.StatusForbidden,
+			expectedHeaders:       map[string]string{},
+		},
+		{
+			name:                  "Roles lookup fails, error expected",
+			inCookieName:          accessTokenCookieName,
+			inCookieValue:         "headers." + correctPayload + ".signature",
+			identityUserID:        3,
+			errGetRoles:           errMock,
+			expectDecodeTokenCall: true,
+			expectGetIdentityCall: true,
+			expectedResponseCode:  http.StatusInternalServerError,
+			expectedHeaders:       map[string]string{},
+		},
+		{
+			name:                  "Identity not linked, no user ID",
+			inCookieName:          accessTokenCookieName,
+			inCookieValue:         "headers." + correctPayload + ".signature",
+			errGetIdentity:        repository.ErrNotFound,
 			expectDecodeTokenCall: true,
+			expectGetIdentityCall: true,
 			expectedResponseCode:  http.StatusOK,
 			expectedHeaders: map[string]string{
 				xAuthEmailHeader:   claims.Email,
@@ -126,10 +183,65 @@ func TestHandler_Check(t *testing.T) {
 				xAuthPictureHeader: claims.Picture,
 			},
 		},
+		{
+			name:                  "Identity lookup fails, error expected",
+			inCookieName:          accessTokenCookieName,
+			inCookieValue:         "headers." + correctPayload + ".signature",
+			errGetIdentity:        errMock,
+			expectDecodeTokenCall: true,
+			expectGetIdentityCall: true,
+			expectedResponseCode:  http.StatusInternalServerError,
+			expectedHeaders:       map[string]string{},
+		},
+		{
+			name:                  "Session token with invalid signature, error expected",
+			inCookieName:          accessTokenCookieName,
+			inCookieValue:         foreignSessionToken,
+			expectDecodeTokenCall: false,
+			expectedResponseCode:  http.StatusUnauthorized,
+			expectedHeaders:       map[string]string{},
+		},
+		{
+			name:                  "Session revoked, error expected",
+			inCookieName:          accessTokenCookieName,
+			inCookieValue:         sessionToken,
+			errGetSession:         repository.ErrNotFound,
+			expectDecodeTokenCall: false,
+			expectGetSessionCall:  true,
+			expectedResponseCode:  http.StatusUnauthorized,
+			expectedHeaders:       map[string]string{},
+		},
+		{
+			name:                  "Session lookup fails, error expected",
+			inCookieName:          accessTokenCookieName,
+			inCookieValue:         sessionToken,
+			errGetSession:         errMock,
+			expectDecodeTokenCall: false,
+			expectGetSessionCall:  true,
+			expectedResponseCode:  http.StatusInternalServerError,
+			expectedHeaders:       map[string]string{},
+		},
+		{
+			name:                  "Session token, everything good",
+			inCookieName:          accessTokenCookieName,
+			inCookieValue:         sessionToken,
+			expectDecodeTokenCall: false,
+			expectGetSessionCall:  true,
+			expectedResponseCode:  http.StatusOK,
+			expectedHeaders: map[string]string{
+				xAuthUserIDHeader:  "7",
+				xAuthEmailHeader:   sessionClaims.Email,
+				xAuthNameHeader:    sessionClaims.GivenName + " " + sessionClaims.FamilyName,
+				xAuthPictureHeader: sessionClaims.Picture,
+				xAuthRolesHeader:   "admin",
+			},
+		},
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			mHandler := &Handler{}
+			mRepo := &mockRepository{}
+			mHandler := &Handler{sessions: sessions, repo: mRepo}
+			mHandler.config.SignIn.DeniedEmails = tc.deniedEmails
 			// Create the cookie that's supposed to hold the access token.
 			cookie := &http.Cookie{Name: tc.inCookieName, Value: tc.inCookieValue}
 			// Create mock response writer and request.
@@ -137,14 +249,30 @@ func TestHandler_Check(t *testing.T) {
 
 			// Setup provider call expectations.
 			mProvider := &mockProvider{}
-			mHandler.googleProvider = mProvider
+			mHandler.issuers = map[string]oauth.Provider{correctIssuer: mProvider}
 
-			if tc.expectIssuersCall {
-				mProvider.On("Issuers").Return([]string{correctIssuer}).Once()
-			}
 			if tc.expectDecodeTokenCall {
-				mProvider.On("DecodeToken", r.Context(), tc.inCookieValue).
+				mProvider.On("DecodeToken", r.Context(), tc.inCookieValue, "").
 					Return(claims, tc.errDecodeToken).Once()
+				// The provider's name is required for the claims upon successful verification.
+				if tc.errDecodeToken == nil {
+					mProvider.On("Name").Return("google").Once()
+				}
+			}
+
+			// Setup repository call expectations.
+			if tc.expectGetSessionCall {
+				mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).
+					Return(repository.Session{ID: sessionClaims.SessionID}, tc.errGetSession).Once()
+			}
+			if tc.expectGetIdentityCall {
+				mRepo.On("GetIdentityUserID", r.Context(), "google", claims.Sub).
+					Return(tc.identityUserID, tc.errGetIdentity).Once()
+			}
+			// Only the linked identities have roles.
+			if tc.identityUserID != 0 {
+				mRepo.On("GetUserRoles", r.Context(), tc.identityUserID).
+					Return([]string{"admin", "auditor"}, tc.errGetRoles).Once()
 			}
 
 			// Invoke the method to be tested.
@@ -154,6 +282,9 @@ func TestHandler_Check(t *testing.T) {
 
 			// Form the actual headers to compare against the expected ones.
 			actualHeaders := map[string]string{}
+			if userID := w.Header().Get(xAuthUserIDHeader); userID != "" {
+				actualHeaders[xAuthUserIDHeader] = userID
+			}
 			if email := w.Header().Get(xAuthEmailHeader); email != "" {
 				actualHeaders[xAuthEmailHeader] = email
 			}
@@ -163,11 +294,15 @@ func TestHandler_Check(t *testing.T) {
 			if picture := w.Header().Get(xAuthPictureHeader); picture != "" {
 				actualHeaders[xAuthPictureHeader] = picture
 			}
+			if roles := w.Header().Get(xAuthRolesHeader); roles != "" {
+				actualHeaders[xAuthRolesHeader] = roles
+			}
 
 			// Verify headers.
 			require.Equal(t, tc.expectedHeaders, actualHeaders, "Wrong response headers")
-			// Verify provider calls.
+			// Verify provider and repository calls.
 			mProvider.AssertExpectations(t)
+			mRepo.AssertExpectations(t)
 		})
 	}
 }
@@ -178,3 +313,220 @@ func createMockCheckWR(cookie *http.Cookie) (*httptest.ResponseRecorder, *http.R
 	req.AddCookie(cookie)
 	return httptest.NewRecorder(), req
 }
+
+func TestHandler_Check_Renewal(t *testing.T) {
+	const sessionIssuer = "https://application.com"
+	// Common error for reuse.
+	errMock := errors.New("mock error")
+
+	// The handler's session manager has a one hour idle timeout. Tokens issued with a shorter idle timeout by the
+	// same keys are near their expiry for the handler.
+	keyring := newMockKeyring(t)
+	sessions := session.NewManager(sessionIssuer, time.Hour, 0, keyring)
+	shortSessions := session.NewManager(sessionIssuer, time.Minute*20, 0, keyring)
+
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com", GivenName: "Ses",
+		Picture: "mockPicture", Provider: "google"}
+	token, _, err := shortSessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	// The stored session, with and without a refresh token.
+	aead := newMockAEAD(t)
+	sealedRefreshToken, err := aead.Seal([]byte("mockRefreshToken"), []byte(sessionClaims.SessionID))
+	require.NoError(t, err, "Failed to seal refresh token")
+
+	plainSession := repository.Session{ID: sessionClaims.SessionID, UserID: 7, Provider: "google",
+		Subject: "mockSubject"}
+	refreshSession := plainSession
+	refreshSession.RefreshToken = sealedRefreshToken
+
+	// Claims of the refreshed identity token.
+	refreshedClaims := oauth.Claims{Sub: "mockSubject", Email: sessionClaims.Email, Picture: "mockNewPicture"}
+	// The identity is told by its subject. Its email may differ from the user's, after linking.
+	linkedClaims := oauth.Claims{Sub: "mockSubject", Email: "linked@identity.com", Picture: "mockNewPicture"}
+	otherUserClaims := oauth.Claims{Sub: "otherSubject", Email: sessionClaims.Email}
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		storedSession   repository.Session
+		errRefresh      error
+		refreshedTokens oauth.Tokens
+		refreshedClaims oauth.Claims
+		// Expectations.
+		expectRenewal  bool
+		expectRotation bool
+		expectedHeader string // Expected picture header.
+	}{
+		{
+			name:           "No refresh token, renewed locally",
+			storedSession:  plainSession,
+			expectRenewal:  true,
+			expectedHeader: sessionClaims.Picture,
+		},
+		{
+			name:            "Refresh token, renewed with new details",
+			storedSession:   refreshSession,
+			refreshedTokens: oauth.Tokens{IDToken: "mockIDToken"},
+			refreshedClaims: refreshedClaims,
+			expectRenewal:   true,
+			expectedHeader:  refreshedClaims.Picture,
+		},
+		{
+			name:            "Refresh token of an identity with another email, renewed",
+			storedSession:   refreshSession,
+			refreshedTokens: oauth.Tokens{IDToken: "mockIDToken"},
+			refreshedClaims: linkedClaims,
+			expectRenewal:   true,
+			expectedHeader:  linkedClaims.Picture,
+		},
+		{
+			name:            "Refresh token rotated, renewed and rotation stored",
+			storedSession:   refreshSession,
+			refreshedTokens: oauth.Tokens{IDToken: "mockIDToken", RefreshToken: "mockNewRefreshToken"},
+			refreshedClaims: refreshedClaims,
+			expectRenewal:   true,
+			expectRotation:  true,
+			expectedHeader:  refreshedClaims.Picture,
+		},
+		{
+			name:           "Refresh fails, not renewed",
+			storedSession:  refreshSession,
+			errRefresh:     errMock,
+			expectRenewal:  false,
+			expectedHeader: sessionClaims.Picture,
+		},
+		{
+			name:            "Refreshed token of another user, not renewed",
+			storedSession:   refreshSession,
+			refreshedTokens: oauth.Tokens{IDToken: "mockIDToken"},
+			refreshedClaims: otherUserClaims,
+			expectRenewal:   false,
+			expectedHeader:  sessionClaims.Picture,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mRepo, mProvider := &mockRepository{}, &mockRefresherProvider{}
+			mHandler := &Handler{
+				sessions:      sessions,
+				refreshTokens: aead,
+				providers:     map[string]oauth.Provider{"google": mProvider},
+				repo:          mRepo,
+			}
+
+			w, r := createMockCheckWR(&http.Cookie{Name: accessTokenCookieName, Value: token})
+
+			// Setup call expectations.
+			mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).Return(tc.storedSession, nil)
+			mRepo.On("GetUserRoles", r.Context(), sessionClaims.UserID).Return([]string{"auditor"}, nil).Once()
+			if tc.storedSession.RefreshToken != "" {
+				mProvider.On("Refresh", r.Context(), "mockRefreshToken").Return(tc.refreshedTokens, tc.errRefresh).
+					Once()
+				if tc.errRefresh == nil {
+					mProvider.On("DecodeToken", r.Context(), tc.refreshedTokens.IDToken, "").
+						Return(tc.refreshedClaims, nil).Once()
+				}
+			}
+			if tc.expectRotation {
+				mRepo.On("UpdateSessionRefreshToken", r.Context(), sessionClaims.SessionID,
+					mock.AnythingOfType("string")).Return(nil).Once()
+			}
+
+			// Invoke the method to be tested.
+			mHandler.Check(w, r)
+
+			// The check succeeds irrespective of the renewal.
+			require.Equal(t, http.StatusOK, w.Code, "Wrong response code")
+			require.Equal(t, tc.expectedHeader, w.Header().Get(xAuthPictureHeader), "Wrong picture header")
+			mRepo.AssertExpectations(t)
+			mProvider.AssertExpectations(t)
+
+			cookies := w.Result().Cookies()
+			if !tc.expectRenewal {
+				require.Empty(t, cookies, "Expected no cookie")
+				return
+			}
+
+			// The renewed token must be valid for the full idle timeout, and keep the session.
+			require.Len(t, cookies, 1, "Expected the renewed cookie")
+			renewed, err := sessions.Verify(cookies[0].Value)
+			require.NoError(t, err, "Expected renewed token to be valid")
+			require.WithinDuration(t, time.Now().Add(time.Hour), renewed.Exp, time.Second, "Unexpected renewed expiry")
+			require.Equal(t, sessionClaims.SessionID, renewed.SessionID, "Session ID does not match")
+			require.Equal(t, tc.expectedHeader, renewed.Picture, "Picture does not match")
+			require.Equal(t, []string{"auditor"}, renewed.Roles, "Roles do not match")
+		})
+	}
+}
+
+func TestHandler_Check_Assertion(t *testing.T) {
+	const sessionIssuer, audience = "https://application.com", "https://upstream.com"
+
+	sessions := newMockSessions(t, sessionIssuer)
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com"}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inHeader   string
+		inAudience string
+		// Expectations.
+		expectedHeader       string
+		expectedResponseCode int
+	}{
+		{
+			name:                 "Default header",
+			inAudience:           audience,
+			expectedHeader:       xAuthAssertionHeader,
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Custom header",
+			inHeader:             "X-Forwarded-Assertion",
+			inAudience:           audience,
+			expectedHeader:       "X-Forwarded-Assertion",
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Audience is the issuer, error expected",
+			inAudience:           sessionIssuer,
+			expectedResponseCode: http.StatusInternalServerError,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, r := createMockCheckWR(&http.Cookie{Name: accessTokenCookieName, Value: sessionToken})
+
+			mRepo := &mockRepository{}
+			mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).
+				Return(repository.Session{ID: sessionClaims.SessionID}, nil).Once()
+
+			mHandler := &Handler{sessions: sessions, repo: mRepo}
+			mHandler.config.Check.Assertion.Enabled = true
+			mHandler.config.Check.Assertion.Header = tc.inHeader
+			mHandler.config.Check.Assertion.Audience = tc.inAudience
+
+			// Invoke the method to be tested.
+			mHandler.Check(w, r)
+
+			require.Equal(t, tc.expectedResponseCode, w.Code, "Wrong response code")
+			mRepo.AssertExpectations(t)
+			if tc.expectedResponseCode != http.StatusOK {
+				return
+			}
+
+			// The assertion must be verifiable with the published keys, and carry the user's claims.
+			parsed, err := jwt.Parse([]byte(w.Header().Get(tc.expectedHeader)), jwt.WithKeySet(sessions.PublicKeys()),
+				jwt.WithValidate(true), jwt.WithIssuer(sessionIssuer), jwt.WithAudience(audience))
+			require.NoError(t, err, "Expected a valid assertion")
+			subject, _ := parsed.Subject()
+			require.Equal(t, "7", subject, "Assertion subject does not match")
+
+			// The plain headers are still present.
+			require.Equal(t, sessionClaims.Email, w.Header().Get(xAuthEmailHeader))
+		})
+	}
+}
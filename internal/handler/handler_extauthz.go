@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/status"
+
+	"github.com/shivanshkc/authorizer/internal/policy"
+	"github.com/shivanshkc/authorizer/internal/utils/errutils"
+)
+
+// extAuthz implements Envoy's envoy.service.auth.v3.Authorization service with the same checks as the Check handler.
+type extAuthz struct {
+	h *Handler
+}
+
+// ExtAuthz returns the Envoy external authorization service of this Handler.
+//
+// An authenticated request is allowed with the identity headers added to it. Any other request is denied with a
+// WWW-Authenticate challenge, as done by the Check handler.
+func (h *Handler) ExtAuthz() authv3.AuthorizationServer {
+	return &extAuthz{h: h}
+}
+
+// Check is invoked by Envoy for every request that must be authorized.
+//
+// Failures are reported in the response, so that Envoy denies the request. An error is never returned, as Envoy
+// may be configured to allow the requests upon errors.
+func (e *extAuthz) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	r := requestFromCheck(ctx, req)
+
+	// Get the token from the cookie or the Authorization header.
+	token, bearer, err := e.h.requestToken(r)
+	if err != nil {
+		slog.ErrorContext(ctx, "error in requestToken call", "error", err)
+		return e.denied(errutils.ToHTTPError(err), bearerErrInvalidRequest), nil
+	}
+	if token == "" {
+		slog.ErrorContext(ctx, "No token in the request")
+		return e.denied(errutils.Unauthorized(), ""), nil
+	}
+
+	// Verify the token.
+	claims, err := e.h.authenticate(ctx, token)
+	if err != nil {
+		slog.ErrorContext(ctx, "error in authenticate call", "error", err)
+		return e.denied(authError(err), bearerErrInvalidToken), nil
+	}
+
+	// The user is authenticated, but may not be allowed to make the request.
+	if err := e.h.authorize(ctx, policyFromCheck(req), claims); err != nil {
+		return e.denied(errutils.ToHTTPError(err), ""), nil
+	}
+
+	// The renewed token is set as a cookie on the response to the client.
+	var responseHeaders []*corev3.HeaderValueOption
+	if !bearer {
+		var cookie *http.Cookie
+		if claims, cookie = e.h.renewCookie(ctx, claims); cookie != nil {
+			responseHeaders = append(responseHeaders, headerOption("Set-Cookie", cookie.String(), true))
+		}
+	}
+
+	headers, err := e.h.identityHeaders(claims)
+	if err != nil {
+		slog.ErrorContext(ctx, "error in identityHeaders call", "error", err)
+		return e.denied(errutils.InternalServerError(), ""), nil
+	}
+
+	// The identity headers overwrite the ones sent by the client, so that they can not be forged.
+	upstreamHeaders := make([]*corev3.HeaderValueOption, 0, len(headers))
+	for name, value := range headers {
+		upstreamHeaders = append(upstreamHeaders, headerOption(name, value, false))
+	}
+
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(code.Code_OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: &authv3.OkHttpResponse{
+			Headers:              upstreamHeaders,
+			ResponseHeadersToAdd: responseHeaders,
+		}},
+	}, nil
+}
+
+// denied returns the response that denies the request with the given error. The error is challenged as per RFC 6750
+// if it is caused by the credentials.
+func (e *extAuthz) denied(err *errutils.HTTPError, errCode string) *authv3.CheckResponse {
+	headers := []*corev3.HeaderValueOption{headerOption("Content-Type", "application/json", false)}
+	if err.StatusCode == http.StatusUnauthorized || err.StatusCode == http.StatusBadRequest {
+		headers = append(headers, headerOption("WWW-Authenticate", e.h.challenge(err, errCode), false))
+	}
+
+	body, errMarshal := json.Marshal(err)
+	if errMarshal != nil {
+		slog.Error("failed to marshal body", "err", errMarshal)
+	}
+
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(rpcCode(err.StatusCode)), Message: err.Error()},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: &authv3.DeniedHttpResponse{
+			Status:  &typev3.HttpStatus{Code: typev3.StatusCode(err.StatusCode)},
+			Headers: headers,
+			Body:    string(body),
+		}},
+	}
+}
+
+// requestFromCheck builds an HTTP request out of the headers of the given CheckRequest, so that the token is read
+// from it just like from the requests of the Check handler.
+func requestFromCheck(ctx context.Context, req *authv3.CheckRequest) *http.Request {
+	r := (&http.Request{Header: http.Header{}}).WithContext(ctx)
+
+	// Envoy sends the header names in lowercase, which are canonicalized here.
+	for name, value := range req.GetAttributes().GetRequest().GetHttp().GetHeaders() {
+		r.Header.Set(name, value)
+	}
+
+	return r
+}
+
+// policyFromCheck returns the request of the given CheckRequest to be evaluated by the policies.
+func policyFromCheck(req *authv3.CheckRequest) policy.Request {
+	httpRequest := req.GetAttributes().GetRequest().GetHttp()
+	return policy.Request{Host: httpRequest.GetHost(), Path: policyPath(httpRequest.GetPath()),
+		Method: httpRequest.GetMethod()}
+}
+
+// headerOption returns a header for the CheckResponse. The header is appended if asked, otherwise it overwrites
+// any existing header of the same name.
+func headerOption(name, value string, appendValue bool) *corev3.HeaderValueOption {
+	action := corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD
+	if appendValue {
+		action = corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD
+	}
+	return &corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: name, Value: value}, AppendAction: action}
+}
+
+// rpcCode returns the gRPC status code that corresponds to the given HTTP status code.
+func rpcCode(statusCode int) code.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return code.Code_INVALID_ARGUMENT
+	case http.StatusUnauthorized:
+		return code.Code_UNAUTHENTICATED
+	case http.StatusForbidden:
+		return code.Code_PERMISSION_DENIED
+	default:
+		return code.Code_INTERNAL
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/shivanshkc/authorizer/internal/utils/httputils"
+)
+
+// Headers set by the proxies to tell the original URL of the request being authenticated.
+const (
+	xForwardedProtoHeader = "X-Forwarded-Proto"
+	xForwardedHostHeader  = "X-Forwarded-Host"
+	xForwardedURIHeader   = "X-Forwarded-Uri"
+)
+
+// maxRedirectURLLength is the max length of a redirect_url, as per validateClientCallbackURL.
+const maxRedirectURLLength = 200
+
+// loginRedirect answers an unauthenticated check with a redirect to the sign-in, as per the forward-auth mode.
+// The sign-in returns to the original URL of the request.
+//
+// It tells whether the response was written, which is not the case if the forward-auth mode is disabled, or if the
+// original URL is unknown or not allowed.
+func (h *Handler) loginRedirect(w http.ResponseWriter, r *http.Request) bool {
+	forwardConf := h.config.Check.ForwardAuth
+	if !forwardConf.Enabled {
+		return false
+	}
+
+	originalURL, ok := h.forwardedURL(r)
+	if !ok {
+		return false
+	}
+
+	loginURL := withQuery(h.config.Application.BaseURL+"/api/auth/"+url.PathEscape(forwardConf.Provider),
+		url.Values{"redirect_url": {originalURL}})
+	headers := map[string]string{"Location": loginURL}
+
+	// nginx passes only a 401 on to the client, which must still carry a challenge.
+	status := http.StatusFound
+	if forwardConf.Status == http.StatusUnauthorized {
+		status = http.StatusUnauthorized
+		headers["WWW-Authenticate"] = "Bearer"
+	}
+
+	httputils.Write(w, status, headers, nil)
+	return true
+}
+
+// forwardedURL returns the original URL of the request, as told by the proxy's X-Forwarded-* headers. It is not ok
+// if the URL is unknown, or if its host is not one of the forward-auth hosts.
+//
+// A URL that is too long to be a redirect_url is cut down to its root, so that the user can still sign in.
+func (h *Handler) forwardedURL(r *http.Request) (string, bool) {
+	proto, host, uri := firstHeaderValue(r, xForwardedProtoHeader), firstHeaderValue(r, xForwardedHostHeader),
+		r.Header.Get(xForwardedURIHeader)
+	if host == "" || !h.isForwardAuthHost(host) {
+		return "", false
+	}
+	if proto != "http" {
+		proto = "https"
+	}
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/"
+	}
+
+	originalURL := proto + "://" + host + uri
+	if len(originalURL) > maxRedirectURLLength {
+		originalURL = proto + "://" + host + "/"
+	}
+
+	return originalURL, true
+}
+
+// firstHeaderValue returns the first of the comma-separated values of the given header. Chained proxies may append
+// their values, in which case the first one is of the client-facing proxy.
+func firstHeaderValue(r *http.Request, header string) string {
+	value, _, _ := strings.Cut(r.Header.Get(header), ",")
+	return strings.TrimSpace(value)
+}
+
+// isAllowedRedirectURL tells whether the given URL is allowed as the redirect_url. It must be one of the allowed
+// redirect URLs, or a URL of a forward-auth host.
+func (h *Handler) isAllowedRedirectURL(redirectURL string) bool {
+	if slices.Contains(h.config.AllowedRedirectURLs, redirectURL) {
+		return true
+	}
+
+	if !h.config.Check.ForwardAuth.Enabled {
+		return false
+	}
+
+	parsed, err := url.Parse(redirectURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.User != nil {
+		return false
+	}
+	return h.isForwardAuthHost(parsed.Host)
+}
+
+// isForwardAuthHost tells whether the given host, with an optional port, is one of the forward-auth hosts.
+func (h *Handler) isForwardAuthHost(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(host)
+
+	for _, allowed := range h.config.Check.ForwardAuth.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		// A wildcard matches the subdomains, but not the domain itself.
+		if suffix, isWildcard := strings.CutPrefix(allowed, "*"); isWildcard {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
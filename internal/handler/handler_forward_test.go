@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_IsForwardAuthHost(t *testing.T) {
+	mHandler := &Handler{}
+	mHandler.config.Check.ForwardAuth.AllowedHosts = []string{"app.example.com", "*.internal.example.com"}
+
+	for _, tc := range []struct {
+		host     string
+		expected bool
+	}{
+		{host: "app.example.com", expected: true},
+		{host: "APP.example.com", expected: true},
+		{host: "app.example.com:8443", expected: true},
+		{host: "grafana.internal.example.com", expected: true},
+		{host: "internal.example.com", expected: false},
+		{host: "evilinternal.example.com", expected: false},
+		{host: "app.example.com.evil.com", expected: false},
+		{host: "example.com", expected: false},
+	} {
+		tc := tc
+		t.Run(tc.host, func(t *testing.T) {
+			require.Equal(t, tc.expected, mHandler.isForwardAuthHost(tc.host))
+		})
+	}
+}
+
+func TestHandler_IsAllowedRedirectURL(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		forwardAuth bool
+		redirectURL string
+		expected    bool
+	}{
+		{name: "Allowed redirect URL", redirectURL: "https://allowed.com", expected: true},
+		{name: "Forward-auth host, mode disabled", redirectURL: "https://app.example.com/page", expected: false},
+		{name: "Forward-auth host", forwardAuth: true, redirectURL: "https://app.example.com/page?x=1", expected: true},
+		{name: "Unknown host", forwardAuth: true, redirectURL: "https://evil.com/page", expected: false},
+		{name: "Non-HTTP scheme", forwardAuth: true, redirectURL: "javascript://app.example.com/%0aalert(1)",
+			expected: false},
+		{name: "URL with user info", forwardAuth: true, redirectURL: "https://app.example.com@evil.com/",
+			expected: false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mHandler := &Handler{}
+			mHandler.config.AllowedRedirectURLs = []string{"https://allowed.com"}
+			mHandler.config.Check.ForwardAuth.Enabled = tc.forwardAuth
+			mHandler.config.Check.ForwardAuth.AllowedHosts = []string{"app.example.com"}
+
+			require.Equal(t, tc.expected, mHandler.isAllowedRedirectURL(tc.redirectURL))
+		})
+	}
+}
+
+func TestHandler_Check_ForwardAuth(t *testing.T) {
+	const baseURL = "https://auth.example.com"
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inStatus        int
+		inHeaders       map[string]string
+		inAuthorization string
+		// Expectations.
+		expectedResponseCode int
+		expectedRedirectURL  string // Empty means no redirect.
+	}{
+		{
+			name: "Original URL is preserved",
+			inHeaders: map[string]string{xForwardedProtoHeader: "https", xForwardedHostHeader: "app.example.com",
+				xForwardedURIHeader: "/dashboard?tab=1"},
+			expectedResponseCode: http.StatusFound,
+			expectedRedirectURL:  "https://app.example.com/dashboard?tab=1",
+		},
+		{
+			name:     "Status for nginx, chained proxies",
+			inStatus: http.StatusUnauthorized,
+			inHeaders: map[string]string{xForwardedProtoHeader: "http, https",
+				xForwardedHostHeader: "app.example.com, proxy.local", xForwardedURIHeader: "/"},
+			expectedResponseCode: http.StatusUnauthorized,
+			expectedRedirectURL:  "http://app.example.com/",
+		},
+		{
+			name: "Too long original URL, root is used",
+			inHeaders: map[string]string{xForwardedHostHeader: "app.example.com",
+				xForwardedURIHeader: "/" + strings.Repeat("a", maxRedirectURLLength)},
+			expectedResponseCode: http.StatusFound,
+			expectedRedirectURL:  "https://app.example.com/",
+		},
+		{
+			name:                 "Host not allowed, no redirect",
+			inHeaders:            map[string]string{xForwardedHostHeader: "evil.com", xForwardedURIHeader: "/"},
+			expectedResponseCode: http.StatusUnauthorized,
+		},
+		{
+			name:                 "No forwarded headers, no redirect",
+			expectedResponseCode: http.StatusUnauthorized,
+		},
+		{
+			name:                 "Invalid bearer token, no redirect",
+			inHeaders:            map[string]string{xForwardedHostHeader: "app.example.com"},
+			inAuthorization:      "Bearer header.payload.signature",
+			expectedResponseCode: http.StatusUnauthorized,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/check", nil)
+			for name, value := range tc.inHeaders {
+				r.Header.Set(name, value)
+			}
+			if tc.inAuthorization != "" {
+				r.Header.Set("Authorization", tc.inAuthorization)
+			}
+			w := httptest.NewRecorder()
+
+			mHandler := &Handler{sessions: newMockSessions(t, baseURL)}
+			mHandler.config.Application.BaseURL = baseURL
+			mHandler.config.Check.ForwardAuth.Enabled = true
+			mHandler.config.Check.ForwardAuth.Provider = "google"
+			mHandler.config.Check.ForwardAuth.Status = tc.inStatus
+			mHandler.config.Check.ForwardAuth.AllowedHosts = []string{"app.example.com"}
+
+			// Invoke the method to be tested.
+			mHandler.Check(w, r)
+
+			require.Equal(t, tc.expectedResponseCode, w.Code, "Wrong response code")
+			if tc.expectedRedirectURL == "" {
+				require.Empty(t, w.Header().Get("Location"), "Expected no redirect")
+				return
+			}
+
+			// The user must be sent to the sign-in, which returns to the original URL.
+			location, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err, "Expected Location header to be a valid URL")
+			require.Equal(t, baseURL+"/api/auth/google", location.Scheme+"://"+location.Host+location.Path)
+			require.Equal(t, tc.expectedRedirectURL, location.Query().Get("redirect_url"))
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/shivanshkc/authorizer/internal/utils/httputils"
+)
+
+// JWKS serves the public keys that verify Authorizer's session tokens, as a JSON Web Key Set.
+//
+// Downstream services can use it to verify the sessions offline. It includes the keys that are about to start signing,
+// and the retired keys that are still within their grace period.
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	httputils.Write(w, http.StatusOK, nil, h.sessions.PublicKeys())
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/session"
+)
+
+func TestHandler_JWKS(t *testing.T) {
+	sessions := newMockSessions(t, "https://application.com")
+	mHandler := &Handler{sessions: sessions}
+
+	// Create mock response writer and request.
+	w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+
+	// Invoke the method to test.
+	mHandler.JWKS(w, r)
+	require.Equal(t, http.StatusOK, w.Code, "Wrong response code")
+
+	// The response must be a valid key set.
+	set, err := jwk.Parse(w.Body.Bytes())
+	require.NoError(t, err, "Expected response to be a valid JWKS")
+	require.Equal(t, 1, set.Len(), "Expected exactly one key")
+
+	// Private parts must never be published.
+	key, _ := set.Key(0)
+	_, isPrivate := key.(jwk.ECDSAPrivateKey)
+	require.False(t, isPrivate, "Expected only public keys")
+
+	// The published keys must verify the session tokens.
+	token, _, err := sessions.Issue(session.Claims{UserID: 1})
+	require.NoError(t, err, "Failed to issue session token")
+	_, err = jwt.Parse([]byte(token), jwt.WithKeySet(set))
+	require.NoError(t, err, "Expected published keys to verify the session token")
+}
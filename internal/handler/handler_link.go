@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/statestore"
+	"github.com/shivanshkc/authorizer/internal/utils/errutils"
+	"github.com/shivanshkc/authorizer/internal/utils/httputils"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+// linkBindingCookiePrefix prefixes the state key in the name of the cookie that binds a link flow to the browser that
+// started it. Like the state cookies, it is limited to the auth routes, which include the callback.
+const linkBindingCookiePrefix = "oauth_link_"
+
+// errIdentityLinked is the error when the provider's identity is already linked to another user.
+var errIdentityLinked = errutils.Conflict().WithReasonStr("identity is linked to another user")
+
+// errLinkUnsupported is the error when the provider calls back with a cross-site POST, which carries no session cookie,
+// so its identities can not be linked.
+var errLinkUnsupported = errutils.BadRequest().WithReasonStr("provider does not support linking")
+
+// errLinkNotBound is the error when a link flow is completed by a browser other than the one that started it, or
+// without the session of the user who started it. Otherwise, an attacker could start a link flow, and make the victim
+// complete it, linking the victim's identity to the attacker's user.
+var errLinkNotBound = errutils.Forbidden().WithReasonStr("link flow was not started by this session")
+
+// Link starts the OAuth flow that links the specified provider's identity to the signed-in user, so that the user
+// can sign in with either provider afterward.
+//
+// It accepts the same query parameters as Auth, but the caller must have an Authorizer session.
+func (h *Handler) Link(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get cookie for authentication.
+	cookie, err := r.Cookie(accessTokenCookieName)
+	if err != nil {
+		slog.ErrorContext(ctx, "link request without a session cookie", "error", err)
+		httputils.WriteErr(w, errutils.Unauthorized())
+		return
+	}
+
+	claims, err := h.authenticate(ctx, cookie.Value)
+	if err != nil {
+		slog.ErrorContext(ctx, "error in authenticate call", "error", err)
+		httputils.WriteErr(w, authError(err))
+		return
+	}
+
+	// Only Authorizer's own sessions can link identities, as the provider's tokens may not identify a user.
+	if claims.SessionID == "" || claims.UserID == 0 {
+		slog.ErrorContext(ctx, "link request without an Authorizer session")
+		httputils.WriteErr(w, errutils.Unauthorized())
+		return
+	}
+
+	// The callback of a link flow must carry the session cookie, which a cross-site POST does not.
+	provider := h.providerByName(mux.Vars(r)["provider"])
+	if fp, ok := provider.(oauth.FormPoster); ok && fp.FormPost() {
+		slog.ErrorContext(ctx, "link request for a provider that calls back with a POST")
+		httputils.WriteErr(w, errLinkUnsupported)
+		return
+	}
+
+	h.startFlow(w, r, claims.UserID)
+}
+
+// linkIdentity completes a link flow by attaching the given identity to the user who started the flow.
+//
+// The flow must be completed by the browser that started it, with the session of the same user.
+func (h *Handler) linkIdentity(w http.ResponseWriter, r *http.Request, identity repository.Identity,
+	stateKey string, sValue statestore.Value,
+) {
+	ctx := r.Context()
+
+	// The binding cookie is of no use after the callback.
+	http.SetCookie(w, h.linkBindingCookie(stateKey, "", -1))
+	if err := h.checkLinkBinding(r, stateKey, sValue); err != nil {
+		slog.ErrorContext(ctx, "error in checkLinkBinding call", "error", err)
+		errorRedirect(w, errLinkNotBound, sValue.ClientCallbackURL)
+		return
+	}
+
+	identity.UserID = sValue.LinkUserID
+	if err := h.repo.LinkIdentity(ctx, identity); err != nil {
+		slog.ErrorContext(ctx, "error in LinkIdentity call", "error", err)
+		if errors.Is(err, repository.ErrConflict) {
+			errorRedirect(w, errIdentityLinked, sValue.ClientCallbackURL)
+			return
+		}
+		errorRedirect(w, errutils.InternalServerError(), sValue.ClientCallbackURL)
+		return
+	}
+
+	// Success redirect URL.
+	redirectURL := withQuery(sValue.ClientCallbackURL, url.Values{"provider": {identity.Provider}, "linked": {"true"}})
+	headers := map[string]string{"Location": redirectURL}
+	httputils.Write(w, http.StatusFound, headers, nil)
+}
+
+// checkLinkBinding verifies that the request comes from the browser that started the given link flow, and that it
+// still carries the session of the user who started it.
+func (h *Handler) checkLinkBinding(r *http.Request, stateKey string, sValue statestore.Value) error {
+	cookie, err := r.Cookie(linkBindingCookiePrefix + stateKey)
+	if err != nil {
+		return fmt.Errorf("link binding cookie is absent: %w", err)
+	}
+	if sValue.LinkBinding == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(sValue.LinkBinding)) != 1 {
+		return errors.New("link binding does not match")
+	}
+
+	sessionCookie, err := r.Cookie(accessTokenCookieName)
+	if err != nil {
+		return fmt.Errorf("session cookie is absent: %w", err)
+	}
+
+	claims, err := h.authenticate(r.Context(), sessionCookie.Value)
+	if err != nil {
+		return fmt.Errorf("error in authenticate call: %w", err)
+	}
+	if claims.SessionID == "" || claims.UserID != sValue.LinkUserID {
+		return fmt.Errorf("session belongs to user %d, not %d", claims.UserID, sValue.LinkUserID)
+	}
+
+	return nil
+}
+
+// linkBindingCookie returns the cookie that binds the link flow of the given state key to the browser. A negative
+// maxAge deletes the cookie, and zero keeps it until the browser closes.
+func (h *Handler) linkBindingCookie(stateKey, binding string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     linkBindingCookiePrefix + stateKey,
+		Value:    binding,
+		Path:     stateCookiePath,
+		MaxAge:   maxAge,
+		Secure:   strings.HasPrefix(h.config.Application.BaseURL, "https://"),
+		HttpOnly: true,
+		// Lax cookies are sent upon the provider's redirect back to Authorizer.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
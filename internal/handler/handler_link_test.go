@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/internal/statestore"
+	"github.com/shivanshkc/authorizer/internal/utils/errutils"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+func TestHandler_Link(t *testing.T) {
+	const providerName = "github"
+	const mProviderAuthURL = "https://github.com/login/oauth/authorize"
+	const allowedRedirectURL = "https://allowed.com"
+
+	// Session manager of the handler, and a valid session token issued by it.
+	sessions := newMockSessions(t, "https://application.com")
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com"}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inCookieValue string // Empty value means no cookie.
+		errGetSession error  // Parameter to control if the session is revoked.
+		// Expectations.
+		expectGetSession     bool
+		expectedResponseCode int
+	}{
+		{
+			name:                 "No cookie, error expected",
+			inCookieValue:        "",
+			expectedResponseCode: http.StatusUnauthorized,
+		},
+		{
+			name:                 "Invalid token, error expected",
+			inCookieValue:        "header.payload.signature",
+			expectedResponseCode: http.StatusUnauthorized,
+		},
+		{
+			name:                 "Revoked session, error expected",
+			inCookieValue:        sessionToken,
+			errGetSession:        repository.ErrNotFound,
+			expectGetSession:     true,
+			expectedResponseCode: http.StatusUnauthorized,
+		},
+		{
+			name:                 "Valid session, flow starts",
+			inCookieValue:        sessionToken,
+			expectGetSession:     true,
+			expectedResponseCode: http.StatusFound,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, r := createMockAuthWR(providerName, allowedRedirectURL)
+			if tc.inCookieValue != "" {
+				r.AddCookie(&http.Cookie{Name: accessTokenCookieName, Value: tc.inCookieValue})
+			}
+
+			mRepo := &mockRepository{}
+			if tc.expectGetSession {
+				mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).
+					Return(repository.Session{}, tc.errGetSession).Once()
+			}
+
+			// The provider is asked for the auth URL only when the flow starts.
+			var stateKey string
+			mProvider := &mockProvider{}
+			mProvider.On("Name").Return(providerName).Once()
+			mProvider.On("Issuers").Return([]string{}).Once()
+			if tc.expectedResponseCode == http.StatusFound {
+				mProvider.On("GetAuthURL", r.Context(), mock.Anything, mock.Anything, mock.Anything).
+					Return(mProviderAuthURL).Once().
+					Run(func(args mock.Arguments) { stateKey = args.String(1) })
+			}
+
+			states := statestore.NewMemoryStore(context.Background(), time.Minute, 0)
+			mHandler := NewHandler(config.Config{AllowedRedirectURLs: []string{allowedRedirectURL}},
+				[]oauth.Provider{mProvider}, states, nil, sessions, nil, nil, mRepo)
+
+			// Invoke the method to test.
+			mHandler.Link(w, r)
+
+			mProvider.AssertExpectations(t)
+			mRepo.AssertExpectations(t)
+			require.Equal(t, tc.expectedResponseCode, w.Code)
+			if tc.expectedResponseCode != http.StatusFound {
+				return
+			}
+
+			// The state must carry the signed-in user, so that the callback links instead of signing in.
+			stateValue, err := states.Take(context.Background(), stateKey)
+			require.NoError(t, err, "State was not inserted in the state store")
+			require.Equal(t, sessionClaims.UserID, stateValue.LinkUserID, "Link user ID does not match")
+			require.Equal(t, mProviderAuthURL, w.Header().Get("Location"))
+
+			// The browser must hold the binding of the flow.
+			cookies := w.Result().Cookies()
+			require.Len(t, cookies, 1, "Expected the link binding cookie")
+			require.Equal(t, linkBindingCookiePrefix+stateKey, cookies[0].Name, "Unexpected cookie name")
+			require.Equal(t, stateValue.LinkBinding, cookies[0].Value, "Link binding does not match")
+			require.NotEmpty(t, stateValue.LinkBinding, "Expected a link binding")
+			require.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite, "Expected Lax cookie")
+		})
+	}
+}
+
+func TestHandler_Link_FormPost(t *testing.T) {
+	sessions := newMockSessions(t, "https://application.com")
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com"}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	w, r := createMockAuthWR("apple", "https://allowed.com")
+	r.AddCookie(&http.Cookie{Name: accessTokenCookieName, Value: sessionToken})
+
+	mRepo := &mockRepository{}
+	mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).Return(repository.Session{}, nil).Once()
+
+	// The callback of a POST would carry no session cookie, so the flow does not start.
+	mHandler := &Handler{sessions: sessions, repo: mRepo,
+		providers: map[string]oauth.Provider{"apple": &mockFormPostProvider{}}}
+	mHandler.Link(w, r)
+
+	mRepo.AssertExpectations(t)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Empty(t, w.Result().Cookies(), "Expected no cookie")
+}
+
+func TestHandler_Callback_Link(t *testing.T) {
+	const providerName, code, token = "github", "mockCode", "header.payload.signature"
+	const binding = "mockBinding"
+
+	// The flow was started by the user with this ID, in a browser that holds the binding.
+	stateVal := statestore.Value{CodeVerifier: "anything", ClientCallbackURL: "https://first.com", LinkUserID: 7,
+		LinkBinding: binding}
+	claims := oauth.Claims{Sub: "1", Email: "mock@mock.com", GivenName: "mockGivenName"}
+
+	// Session tokens of the user who started the flow, and of another one.
+	sessions := newMockSessions(t, "https://application.com")
+	sessionToken, _, err := sessions.Issue(session.Claims{UserID: 7, SessionID: "mockSessionID"})
+	require.NoError(t, err, "Failed to issue session token")
+	otherSessionToken, _, err := sessions.Issue(session.Claims{UserID: 8, SessionID: "otherSessionID"})
+	require.NoError(t, err, "Failed to issue session token")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inBinding       string // Empty value means no binding cookie.
+		inSessionToken  string // Empty value means no session cookie.
+		errLinkIdentity error
+		// Expectations.
+		expectLinkCall bool
+		errSubstring   string
+	}{
+		{
+			name:           "Identity linked, no errors",
+			inBinding:      binding,
+			inSessionToken: sessionToken,
+			expectLinkCall: true,
+			errSubstring:   "",
+		},
+		{
+			name:            "Identity linked to another user",
+			inBinding:       binding,
+			inSessionToken:  sessionToken,
+			errLinkIdentity: fmt.Errorf("mock error: %w", repository.ErrConflict),
+			expectLinkCall:  true,
+			errSubstring:    errIdentityLinked.Error(),
+		},
+		{
+			name:            "LinkIdentity method returns error",
+			inBinding:       binding,
+			inSessionToken:  sessionToken,
+			errLinkIdentity: errors.New("mock error"),
+			expectLinkCall:  true,
+			errSubstring:    errutils.InternalServerError().Error(),
+		},
+		{
+			name:           "No binding cookie, as in another browser, rejected",
+			inSessionToken: sessionToken,
+			errSubstring:   errLinkNotBound.Error(),
+		},
+		{
+			name:           "Binding of another flow, rejected",
+			inBinding:      "otherBinding",
+			inSessionToken: sessionToken,
+			errSubstring:   errLinkNotBound.Error(),
+		},
+		{
+			name:         "No session cookie, rejected",
+			inBinding:    binding,
+			errSubstring: errLinkNotBound.Error(),
+		},
+		{
+			name:           "Session of another user, rejected",
+			inBinding:      binding,
+			inSessionToken: otherSessionToken,
+			errSubstring:   errLinkNotBound.Error(),
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			stateKey := uuid.NewString()
+			w, r := createMockCallbackWR(providerName, stateKey, code, "")
+			if tc.inBinding != "" {
+				r.AddCookie(&http.Cookie{Name: linkBindingCookiePrefix + stateKey, Value: tc.inBinding})
+			}
+			if tc.inSessionToken != "" {
+				r.AddCookie(&http.Cookie{Name: accessTokenCookieName, Value: tc.inSessionToken})
+			}
+
+			mProvider, mRepo := &mockProvider{}, &mockRepository{}
+			mProvider.On("TokenFromCode", r.Context(), code, stateVal.CodeVerifier).Return(token, nil).Once()
+			mProvider.On("DecodeToken", r.Context(), token, stateVal.Nonce).Return(claims, nil).Once()
+			mRepo.On("GetSession", r.Context(), mock.Anything).Return(repository.Session{}, nil).Maybe()
+			if tc.expectLinkCall {
+				mRepo.On("LinkIdentity", r.Context(), repository.Identity{
+					Provider:  providerName,
+					Subject:   claims.Sub,
+					UserID:    stateVal.LinkUserID,
+					Email:     claims.Email,
+					GivenName: claims.GivenName,
+				}).Return(tc.errLinkIdentity).Once()
+			}
+
+			mHandler := &Handler{
+				config:    config.Config{AllowedRedirectURLs: []string{stateVal.ClientCallbackURL}},
+				states:    statestore.NewMemoryStore(context.Background(), time.Minute, 0),
+				providers: map[string]oauth.Provider{providerName: mProvider},
+				sessions:  sessions,
+				repo:      mRepo,
+			}
+			require.NoError(t, mHandler.states.Put(context.Background(), stateKey, stateVal))
+
+			// Invoke the method to test.
+			mHandler.Callback(w, r)
+
+			// No user is upserted, and no session is started. Only the binding cookie is cleared.
+			mProvider.AssertExpectations(t)
+			mRepo.AssertExpectations(t)
+			cookies := w.Result().Cookies()
+			require.Len(t, cookies, 1, "Expected only the binding cookie to be cleared")
+			require.Equal(t, linkBindingCookiePrefix+stateKey, cookies[0].Name, "Unexpected cookie name")
+			require.Negative(t, cookies[0].MaxAge, "Expected the binding cookie to be cleared")
+
+			require.Equal(t, http.StatusFound, w.Code)
+			parsed, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err, "Expected Location header to be a valid URL")
+
+			if tc.errSubstring != "" {
+				require.Contains(t, parsed.Query().Get("error"), tc.errSubstring)
+				return
+			}
+
+			require.Equal(t, providerName, parsed.Query().Get("provider"))
+			require.Equal(t, "true", parsed.Query().Get("linked"))
+		})
+	}
+}
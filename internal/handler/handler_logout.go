@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/utils/errutils"
+	"github.com/shivanshkc/authorizer/internal/utils/httputils"
+)
+
+// Logout ends the caller's session and clears the session cookie.
+//
+// If the "all" query parameter is "true", all sessions of the user are ended, that is, the user is logged out of all
+// devices. This requires the caller's session to still exist, so that a revoked token can not end the user's other
+// sessions. Otherwise, a request without a valid session only clears the cookie.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	all := r.URL.Query().Get("all") == "true"
+
+	// The cookie is cleared irrespective of the outcome.
+	http.SetCookie(w, h.sessionCookie("", -1))
+
+	// Only Authorizer's own sessions can be ended. An absent or invalid token means there's no session.
+	var token string
+	if cookie, err := r.Cookie(accessTokenCookieName); err == nil {
+		token = cookie.Value
+	}
+
+	claims, err := h.sessions.Verify(token)
+	if err != nil {
+		slog.InfoContext(ctx, "logout without a valid session", "error", err)
+		// The user is unknown, so their sessions can not be ended.
+		if all {
+			httputils.WriteErr(w, errutils.Unauthorized())
+			return
+		}
+		httputils.Write(w, http.StatusOK, nil, nil)
+		return
+	}
+
+	if all {
+		// The token outlives its session, so the session must be checked before the token is trusted any further.
+		if _, err := h.repo.GetSession(ctx, claims.SessionID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				slog.InfoContext(ctx, "logout of a revoked session", "session_id", claims.SessionID)
+				httputils.WriteErr(w, errutils.Unauthorized())
+				return
+			}
+			slog.ErrorContext(ctx, "error in GetSession call", "error", err)
+			httputils.WriteErr(w, errutils.InternalServerError())
+			return
+		}
+		err = h.repo.DeleteUserSessions(ctx, claims.UserID)
+	} else {
+		err = h.repo.DeleteSession(ctx, claims.SessionID)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to delete session", "all", all, "error", err)
+		httputils.WriteErr(w, errutils.InternalServerError())
+		return
+	}
+
+	httputils.Write(w, http.StatusOK, nil, nil)
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+)
+
+func TestHandler_Logout(t *testing.T) {
+	// Session manager of the handler, and a valid session token issued by it.
+	sessions := newMockSessions(t, "https://application.com")
+
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com"}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	// Common error for reuse.
+	errMock := errors.New("mock error")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inCookieValue string // Empty value means no cookie.
+		inAll         bool
+		errGetSession error // Parameter to control if the GetSession method should fail.
+		errDelete     error // Parameter to control if the delete method should fail.
+		// Expectations.
+		expectGetSession         bool
+		expectDeleteSession      bool
+		expectDeleteUserSessions bool
+		expectedResponseCode     int
+	}{
+		{
+			name:                 "No cookie, only cookie cleared",
+			inCookieValue:        "",
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Invalid token, only cookie cleared",
+			inCookieValue:        "header.payload.signature",
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Invalid token with all, error expected",
+			inCookieValue:        "header.payload.signature",
+			inAll:                true,
+			expectedResponseCode: http.StatusUnauthorized,
+		},
+		{
+			name:                 "Delete session fails, error expected",
+			inCookieValue:        sessionToken,
+			errDelete:            errMock,
+			expectDeleteSession:  true,
+			expectedResponseCode: http.StatusInternalServerError,
+		},
+		{
+			name:                 "Session deleted, no errors",
+			inCookieValue:        sessionToken,
+			expectDeleteSession:  true,
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Revoked session with all, error expected",
+			inCookieValue:        sessionToken,
+			inAll:                true,
+			errGetSession:        repository.ErrNotFound,
+			expectGetSession:     true,
+			expectedResponseCode: http.StatusUnauthorized,
+		},
+		{
+			name:                 "Get session fails with all, error expected",
+			inCookieValue:        sessionToken,
+			inAll:                true,
+			errGetSession:        errMock,
+			expectGetSession:     true,
+			expectedResponseCode: http.StatusInternalServerError,
+		},
+		{
+			name:                     "Delete user sessions fails, error expected",
+			inCookieValue:            sessionToken,
+			inAll:                    true,
+			errDelete:                errMock,
+			expectGetSession:         true,
+			expectDeleteUserSessions: true,
+			expectedResponseCode:     http.StatusInternalServerError,
+		},
+		{
+			name:                     "All user sessions deleted, no errors",
+			inCookieValue:            sessionToken,
+			inAll:                    true,
+			expectGetSession:         true,
+			expectDeleteUserSessions: true,
+			expectedResponseCode:     http.StatusOK,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mRepo := &mockRepository{}
+			mHandler := &Handler{sessions: sessions, repo: mRepo}
+
+			// Create mock response writer and request.
+			target := "/api/logout"
+			if tc.inAll {
+				target += "?all=true"
+			}
+			r := httptest.NewRequest(http.MethodPost, target, nil)
+			if tc.inCookieValue != "" {
+				r.AddCookie(&http.Cookie{Name: accessTokenCookieName, Value: tc.inCookieValue})
+			}
+			w := httptest.NewRecorder()
+
+			// Setup repository call expectations.
+			if tc.expectGetSession {
+				mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).
+					Return(repository.Session{ID: sessionClaims.SessionID}, tc.errGetSession).Once()
+			}
+			if tc.expectDeleteSession {
+				mRepo.On("DeleteSession", r.Context(), sessionClaims.SessionID).Return(tc.errDelete).Once()
+			}
+			if tc.expectDeleteUserSessions {
+				mRepo.On("DeleteUserSessions", r.Context(), sessionClaims.UserID).Return(tc.errDelete).Once()
+			}
+
+			// Invoke the method to be tested.
+			mHandler.Logout(w, r)
+
+			// Verify response.
+			require.Equal(t, tc.expectedResponseCode, w.Code, "Wrong response code")
+			mRepo.AssertExpectations(t)
+
+			// The cookie must be cleared in all cases.
+			cookies := w.Result().Cookies()
+			require.Len(t, cookies, 1, "Expected one cookie")
+			require.Equal(t, accessTokenCookieName, cookies[0].Name, "Cookie name does not match")
+			require.Empty(t, cookies[0].Value, "Expected cookie value to be empty")
+			require.Negative(t, cookies[0].MaxAge, "Expected cookie to be deleted")
+		})
+	}
+}
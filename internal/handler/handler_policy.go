@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/shivanshkc/authorizer/internal/policy"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/internal/utils/errutils"
+)
+
+// xForwardedMethodHeader is set by the proxies to tell the method of the request being authenticated.
+const xForwardedMethodHeader = "X-Forwarded-Method"
+
+// errPolicyDenied is the error when the user is authenticated, but the policies deny the request.
+var errPolicyDenied = errutils.Forbidden().WithReasonStr("access denied by policy")
+
+// authorize evaluates the policies for the given request of the user of the given claims. It returns
+// errPolicyDenied if the policies deny the request, unless they are in the dry-run mode, where the decisions are
+// only logged.
+func (h *Handler) authorize(ctx context.Context, request policy.Request, claims session.Claims) error {
+	if h.policies == nil {
+		return nil
+	}
+
+	decision := h.policies.Evaluate(request, claims)
+	logArgs := []any{"allowed", decision.Allowed, "rule", decision.Rule, "host", request.Host,
+		"path", request.Path, "method", request.Method, "user_id", claims.UserID, "email", claims.Email}
+
+	if decision.DryRun {
+		slog.InfoContext(ctx, "policy decision (dry-run)", logArgs...)
+		return nil
+	}
+
+	if !decision.Allowed {
+		slog.WarnContext(ctx, "policy denied request", logArgs...)
+		return errPolicyDenied
+	}
+
+	return nil
+}
+
+// policyRequest returns the original request of the check, as told by the proxy's X-Forwarded-* headers.
+func policyRequest(r *http.Request) policy.Request {
+	return policy.Request{
+		Host:   firstHeaderValue(r, xForwardedHostHeader),
+		Path:   policyPath(r.Header.Get(xForwardedURIHeader)),
+		Method: firstHeaderValue(r, xForwardedMethodHeader),
+	}
+}
+
+// policyPath returns the path of the given request URI as the upstream would resolve it, so that the request can not
+// dodge the rules by encoding its path differently, like "//admin", "/%61dmin" or "/./admin".
+//
+// The query is dropped, the path is unescaped, and the dot segments and the repeated slashes are removed. The trailing
+// slash is kept, so that "/admin/" still matches "/admin/*".
+func policyPath(uri string) string {
+	rawPath, _, _ := strings.Cut(uri, "?")
+	rawPath, _, _ = strings.Cut(rawPath, "#")
+	rawPath = unescapePath(rawPath)
+
+	cleaned := path.Clean("/" + rawPath)
+	if strings.HasSuffix(rawPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// unescapePath decodes the percent-encoded bytes of the given path. Unlike url.PathUnescape, it keeps the invalid
+// escapes as they are, instead of failing, so that one of them can not keep the rest of the path encoded.
+func unescapePath(p string) string {
+	var builder strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '%' && i+2 < len(p) {
+			if decoded, err := hex.DecodeString(p[i+1 : i+3]); err == nil {
+				builder.Write(decoded)
+				i += 2
+				continue
+			}
+		}
+		builder.WriteByte(p[i])
+	}
+	return builder.String()
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/policy"
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+)
+
+func TestHandler_Check_Policy(t *testing.T) {
+	// Session manager of the handler, and a valid session token issued by it.
+	sessions := newMockSessions(t, "https://application.com")
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com",
+		Extra: map[string]any{"groups": []any{"devs"}}}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	// Only the admins may access the admin host.
+	rules := []config.PolicyRule{{Name: "admin", Hosts: []string{"admin.example.com"}, Groups: []string{"admins"}}}
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inHost   string
+		inDryRun bool
+		// Expectations.
+		expectedResponseCode int
+	}{
+		{
+			name:                 "No rule matches, allowed by default",
+			inHost:               "app.example.com",
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Rule denies, forbidden",
+			inHost:               "admin.example.com",
+			expectedResponseCode: http.StatusForbidden,
+		},
+		{
+			name:                 "Rule denies in dry-run, allowed",
+			inHost:               "admin.example.com",
+			inDryRun:             true,
+			expectedResponseCode: http.StatusOK,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, r := createMockCheckWR(&http.Cookie{Name: accessTokenCookieName, Value: sessionToken})
+			r.Header.Set(xForwardedHostHeader, tc.inHost)
+			r.Header.Set(xForwardedURIHeader, "/users?page=2")
+			r.Header.Set(xForwardedMethodHeader, http.MethodGet)
+
+			mRepo := &mockRepository{}
+			mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).Return(repository.Session{}, nil).Once()
+
+			policies, err := policy.NewEngine(config.Policies{DryRun: tc.inDryRun, Rules: rules})
+			require.NoError(t, err, "Failed to create policy engine")
+
+			mHandler := NewHandler(config.Config{}, nil, nil, nil, sessions, nil, policies, mRepo)
+
+			// Invoke the method to test.
+			mHandler.Check(w, r)
+
+			mRepo.AssertExpectations(t)
+			require.Equal(t, tc.expectedResponseCode, w.Code)
+
+			// The identity is not disclosed for a forbidden request.
+			if tc.expectedResponseCode == http.StatusForbidden {
+				require.Empty(t, w.Header().Get(xAuthUserIDHeader), "Expected no identity headers")
+				require.Contains(t, w.Body.String(), errPolicyDenied.Reason)
+				return
+			}
+			require.Equal(t, "7", w.Header().Get(xAuthUserIDHeader), "User ID header does not match")
+		})
+	}
+}
+
+func TestHandler_Check_Policy_PathBypass(t *testing.T) {
+	sessions := newMockSessions(t, "https://application.com")
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com"}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	// Only the admins may access the admin paths, and everything else is allowed.
+	policies, err := policy.NewEngine(config.Policies{Rules: []config.PolicyRule{
+		{Name: "admin", Paths: []string{"/admin/*"}, Roles: []string{"admin"}},
+	}})
+	require.NoError(t, err, "Failed to create policy engine")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inURI string
+		// Expectations.
+		expectedResponseCode int
+	}{
+		{name: "Other path, allowed", inURI: "/users?page=2", expectedResponseCode: http.StatusOK},
+		{name: "Admin path, forbidden", inURI: "/admin/x", expectedResponseCode: http.StatusForbidden},
+		{name: "Repeated slash, forbidden", inURI: "//admin/x", expectedResponseCode: http.StatusForbidden},
+		{name: "Encoded letter, forbidden", inURI: "/%61dmin/x", expectedResponseCode: http.StatusForbidden},
+		{name: "Encoded slash, forbidden", inURI: "/admin%2Fx", expectedResponseCode: http.StatusForbidden},
+		{name: "Invalid escape, forbidden", inURI: "/%61dmin/%zz", expectedResponseCode: http.StatusForbidden},
+		{name: "Dot segment, forbidden", inURI: "/./admin/x", expectedResponseCode: http.StatusForbidden},
+		{name: "Parent segment, forbidden", inURI: "/public/../admin/x", expectedResponseCode: http.StatusForbidden},
+		{name: "Upper case, forbidden", inURI: "/Admin/x", expectedResponseCode: http.StatusForbidden},
+		{name: "Trailing slash, forbidden", inURI: "/admin/", expectedResponseCode: http.StatusForbidden},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, r := createMockCheckWR(&http.Cookie{Name: accessTokenCookieName, Value: sessionToken})
+			r.Header.Set(xForwardedURIHeader, tc.inURI)
+
+			mRepo := &mockRepository{}
+			mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).Return(repository.Session{}, nil).Once()
+
+			mHandler := NewHandler(config.Config{}, nil, nil, nil, sessions, nil, policies, mRepo)
+
+			// Invoke the method to test.
+			mHandler.Check(w, r)
+
+			mRepo.AssertExpectations(t)
+			require.Equal(t, tc.expectedResponseCode, w.Code)
+		})
+	}
+}
+
+func TestHandler_ExtAuthz_Policy(t *testing.T) {
+	sessions := newMockSessions(t, "https://application.com")
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com"}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	policies, err := policy.NewEngine(config.Policies{Rules: []config.PolicyRule{
+		{Name: "admin", Paths: []string{"/admin/*"}, EmailDomains: []string{"example.com"}},
+	}})
+	require.NoError(t, err, "Failed to create policy engine")
+
+	mRepo := &mockRepository{}
+	mRepo.On("GetSession", mock.Anything, sessionClaims.SessionID).Return(repository.Session{}, nil).Once()
+
+	mHandler := NewHandler(config.Config{}, nil, nil, nil, sessions, nil, policies, mRepo)
+
+	// The path is evaluated without the query, and cleaned.
+	request := createMockCheckRequest(map[string]string{"authorization": "Bearer " + sessionToken})
+	request.Attributes.Request.Http.Path = "//%61dmin/./users?page=2"
+
+	// Invoke the method to test.
+	response, err := mHandler.ExtAuthz().Check(context.Background(), request)
+	require.NoError(t, err, "Expected no error in Check")
+
+	mRepo.AssertExpectations(t)
+	require.Equal(t, int32(code.Code_PERMISSION_DENIED), response.GetStatus().GetCode(), "Unexpected status code")
+	require.Equal(t, http.StatusForbidden, int(response.GetDeniedResponse().GetStatus().GetCode()),
+		"Unexpected HTTP status")
+}
+
+func TestHandler_ForwardedClaims_Policy(t *testing.T) {
+	policies, err := policy.NewEngine(config.Policies{RolesClaim: "app_roles",
+		Rules: []config.PolicyRule{{Name: "admin", Roles: []string{"admin"}}}})
+	require.NoError(t, err, "Failed to create policy engine")
+
+	// The claims of the policies are forwarded, even if they are not mapped to any header.
+	mHandler := &Handler{policies: policies}
+	extra := map[string]any{"groups": []any{"admins"}, "app_roles": "admin", "tid": "mockTenantID"}
+	require.Equal(t, map[string]any{"groups": []any{"admins"}, "app_roles": "admin"},
+		mHandler.forwardedClaims(extra))
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shivanshkc/authorizer/internal/statestore"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+// stateCookiePrefix prefixes the state key in the name of the cookie that holds a sealed state.
+//
+// Every flow gets its own cookie, so that the flows started in multiple tabs of a browser do not overwrite each other.
+const stateCookiePrefix = "oauth_state_"
+
+// stateCookiePath limits the state cookies to the auth routes, which include the callback.
+const stateCookiePath = "/api/auth/"
+
+// putState persists the state of an OAuth flow. With state cookies, it is sealed into a cookie on the response.
+// Otherwise, it is put in the state store.
+func (h *Handler) putState(ctx context.Context, w http.ResponseWriter, provider oauth.Provider, key string,
+	value statestore.Value,
+) error {
+	if h.stateCookies == nil {
+		return h.states.Put(ctx, key, value)
+	}
+
+	sealed, err := h.stateCookies.Seal(key, value)
+	if err != nil {
+		return fmt.Errorf("error in stateCookies.Seal call: %w", err)
+	}
+
+	http.SetCookie(w, h.stateCookie(provider, key, sealed, int(h.stateCookies.TTL().Seconds())))
+	return nil
+}
+
+// takeState returns and deletes the state of an OAuth flow. With state cookies, it is opened from the request's
+// cookie, and the cookie is cleared on the response. Otherwise, it is taken from the state store.
+//
+// The provider is nil if it is unknown. It returns statestore.ErrNotFound if the state does not exist or has expired.
+func (h *Handler) takeState(w http.ResponseWriter, r *http.Request, provider oauth.Provider, key string,
+) (statestore.Value, error) {
+	if h.stateCookies == nil {
+		return h.states.Take(r.Context(), key)
+	}
+
+	// The cookie is absent if the flow was started in another browser.
+	cookie, err := r.Cookie(stateCookiePrefix + key)
+	if err != nil {
+		return statestore.Value{}, statestore.ErrNotFound
+	}
+
+	// A sealed state can not be taken, so it is cleared to prevent replays.
+	http.SetCookie(w, h.stateCookie(provider, key, "", -1))
+	return h.stateCookies.Open(key, cookie.Value)
+}
+
+// stateCookie returns the cookie that holds the given sealed state of a flow with the given provider.
+func (h *Handler) stateCookie(provider oauth.Provider, key, sealed string, maxAge int) *http.Cookie {
+	secure := strings.HasPrefix(h.config.Application.BaseURL, "https://")
+	return &http.Cookie{
+		Name:     stateCookiePrefix + key,
+		Value:    sealed,
+		Path:     stateCookiePath,
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: flowSameSite(provider, secure),
+	}
+}
+
+// flowSameSite returns the SameSite mode of the cookies that must reach the callback of a flow with the given
+// provider.
+//
+// Lax cookies are sent upon the provider's redirect back to Authorizer. Providers that call back with a POST, like
+// Apple, need the cookies to be sent cross-site, which browsers allow only for secure cookies.
+func flowSameSite(provider oauth.Provider, secure bool) http.SameSite {
+	if fp, ok := provider.(oauth.FormPoster); ok && fp.FormPost() && secure {
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/statestore"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+func TestHandler_StateCookies(t *testing.T) {
+	const allowedRedirectURL = "https://allowed.com"
+
+	mConfig := config.Config{AllowedRedirectURLs: []string{allowedRedirectURL}}
+	mConfig.Application.BaseURL = "https://authorizer.com"
+
+	w, r := createMockAuthWR("google", allowedRedirectURL)
+
+	// Setup mock provider. The state key is captured to look up the cookie.
+	var stateKey string
+	mProvider := &mockProvider{}
+	mProvider.On("Name").Return("google").Once()
+	mProvider.On("Issuers").Return([]string{}).Once()
+	mProvider.On("GetAuthURL", r.Context(), mock.Anything, mock.Anything, mock.Anything).Return("https://auth.google.com").Once().
+		Run(func(args mock.Arguments) { stateKey = args.String(1) })
+
+	// No state store is required with state cookies.
+	stateCookies := statestore.NewCookieStore(newMockAEAD(t), time.Minute)
+	mHandler := NewHandler(mConfig, []oauth.Provider{mProvider}, nil, stateCookies, nil, nil, nil, nil)
+	mHandler.Auth(w, r)
+	require.Equal(t, http.StatusFound, w.Code)
+
+	// The state must be sealed into a cookie of its own.
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1, "Expected exactly one cookie")
+	cookie := cookies[0]
+	require.Equal(t, stateCookiePrefix+stateKey, cookie.Name, "Unexpected cookie name")
+	require.Equal(t, stateCookiePath, cookie.Path, "Unexpected cookie path")
+	require.Equal(t, 60, cookie.MaxAge, "Expected cookie to expire with the state")
+	require.True(t, cookie.HttpOnly, "Expected HTTP only cookie")
+	require.True(t, cookie.Secure, "Expected secure cookie over HTTPS")
+	require.Equal(t, http.SameSiteLaxMode, cookie.SameSite, "Expected Lax cookie for a GET callback")
+
+	t.Run("Cookie present, state expected", func(t *testing.T) {
+		w, r := createMockCallbackWR("google", stateKey, "anything", "")
+		r.AddCookie(cookie)
+
+		value, err := mHandler.takeState(w, r, mProvider, stateKey)
+		require.NoError(t, err, "Expected no error in takeState")
+		require.Equal(t, allowedRedirectURL, value.ClientCallbackURL, "CCU does not match")
+		require.NotEmpty(t, value.CodeVerifier, "Code verifier is empty")
+
+		// The cookie must be cleared.
+		cleared := w.Result().Cookies()
+		require.Len(t, cleared, 1, "Expected the cookie to be cleared")
+		require.Equal(t, cookie.Name, cleared[0].Name, "Unexpected cookie name")
+		require.Negative(t, cleared[0].MaxAge, "Expected the cookie to be cleared")
+	})
+
+	t.Run("Cookie absent, as in another browser, ErrNotFound expected", func(t *testing.T) {
+		w, r := createMockCallbackWR("google", stateKey, "anything", "")
+
+		_, err := mHandler.takeState(w, r, mProvider, stateKey)
+		require.ErrorIs(t, err, statestore.ErrNotFound, "Expected ErrNotFound")
+	})
+
+	t.Run("Cookie of another state, ErrNotFound expected", func(t *testing.T) {
+		const otherStateKey = "00000000-0000-0000-0000-000000000000"
+		w, r := createMockCallbackWR("google", otherStateKey, "anything", "")
+		r.AddCookie(&http.Cookie{Name: stateCookiePrefix + otherStateKey, Value: cookie.Value})
+
+		_, err := mHandler.takeState(w, r, mProvider, otherStateKey)
+		require.ErrorIs(t, err, statestore.ErrNotFound, "Expected ErrNotFound")
+	})
+
+	mProvider.AssertExpectations(t)
+}
+
+func TestHandler_StateCookie_SameSite(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inBaseURL  string
+		inProvider oauth.Provider
+		// Expectations.
+		expectedSecure   bool
+		expectedSameSite http.SameSite
+	}{
+		{
+			name:             "GET callback over HTTPS, Lax expected",
+			inBaseURL:        "https://authorizer.com",
+			inProvider:       &mockProvider{},
+			expectedSecure:   true,
+			expectedSameSite: http.SameSiteLaxMode,
+		},
+		{
+			name:             "POST callback over HTTPS, None expected",
+			inBaseURL:        "https://authorizer.com",
+			inProvider:       &mockFormPostProvider{},
+			expectedSecure:   true,
+			expectedSameSite: http.SameSiteNoneMode,
+		},
+		{
+			// Browsers reject cookies with SameSite=None unless they are secure.
+			name:             "POST callback over HTTP, Lax expected",
+			inBaseURL:        "http://localhost:8080",
+			inProvider:       &mockFormPostProvider{},
+			expectedSecure:   false,
+			expectedSameSite: http.SameSiteLaxMode,
+		},
+		{
+			name:             "Unknown provider, Lax expected",
+			inBaseURL:        "https://authorizer.com",
+			expectedSecure:   true,
+			expectedSameSite: http.SameSiteLaxMode,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mHandler := &Handler{config: config.Config{}}
+			mHandler.config.Application.BaseURL = tc.inBaseURL
+
+			cookie := mHandler.stateCookie(tc.inProvider, "mockKey", "mockSealed", 60)
+			require.Equal(t, tc.expectedSecure, cookie.Secure, "Secure flag does not match")
+			require.Equal(t, tc.expectedSameSite, cookie.SameSite, "SameSite mode does not match")
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/internal/utils/cryptoutils"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+func TestNewHandler_ProviderRegistry(t *testing.T) {
+	// Mock providers with distinct names and issuers.
+	mGoogle, mKeycloak := &mockProvider{}, &mockProvider{}
+
+	mGoogle.On("Name").Return("google").Once()
+	mGoogle.On("Issuers").Return([]string{"accounts.google.com", "https://accounts.google.com"}).Once()
+
+	mKeycloak.On("Name").Return("keycloak").Once()
+	mKeycloak.On("Issuers").Return([]string{"https://keycloak.com/realms/mock"}).Once()
+
+	// Create the handler with both providers.
+	mHandler := NewHandler(config.Config{}, []oauth.Provider{mGoogle, mKeycloak}, nil, nil, nil, nil, nil, nil)
+
+	// Lookup by name.
+	require.Same(t, mGoogle, mHandler.providerByName("google"))
+	require.Same(t, mKeycloak, mHandler.providerByName("keycloak"))
+	require.Nil(t, mHandler.providerByName("unknown"), "Expected nil for unknown provider name")
+
+	// Lookup by issuer.
+	require.Same(t, mGoogle, mHandler.providerByIssuer("accounts.google.com"))
+	require.Same(t, mGoogle, mHandler.providerByIssuer("https://accounts.google.com"))
+	require.Same(t, mKeycloak, mHandler.providerByIssuer("https://keycloak.com/realms/mock"))
+	require.Nil(t, mHandler.providerByIssuer("https://unknown.com"), "Expected nil for unknown issuer")
+
+	mGoogle.AssertExpectations(t)
+	mKeycloak.AssertExpectations(t)
+}
+
+func TestNewHandler_IssuerMatchers(t *testing.T) {
+	// Mock providers with a static issuer and a templated one.
+	mGoogle, mMicrosoft := &mockProvider{}, &mockMatcherProvider{}
+
+	mGoogle.On("Name").Return("google").Once()
+	mGoogle.On("Issuers").Return([]string{"https://accounts.google.com"}).Once()
+
+	mMicrosoft.On("Name").Return("microsoft").Once()
+	mMicrosoft.On("Issuers").Return([]string(nil)).Once()
+	mMicrosoft.On("MatchIssuer", "https://login.microsoftonline.com/mock-tenant/v2.0").Return(true).Once()
+	mMicrosoft.On("MatchIssuer", "https://unknown.com").Return(false).Once()
+
+	// Create the handler with both providers.
+	mHandler := NewHandler(config.Config{}, []oauth.Provider{mGoogle, mMicrosoft}, nil, nil, nil, nil, nil, nil)
+
+	// Static issuers must be resolved without consulting the matchers.
+	require.Same(t, mGoogle, mHandler.providerByIssuer("https://accounts.google.com"))
+
+	// Templated issuers are resolved by the matchers.
+	require.Same(t, mMicrosoft, mHandler.providerByIssuer("https://login.microsoftonline.com/mock-tenant/v2.0"))
+	require.Nil(t, mHandler.providerByIssuer("https://unknown.com"), "Expected nil for unknown issuer")
+
+	mGoogle.AssertExpectations(t)
+	mMicrosoft.AssertExpectations(t)
+}
+
+// newMockSessions returns a session manager with the given issuer, backed by an ephemeral key.
+func newMockSessions(t *testing.T, issuer string) *session.Manager {
+	return session.NewManager(issuer, time.Hour, 0, newMockKeyring(t))
+}
+
+// newMockKeyring returns a keyring with an ephemeral key that is never refreshed.
+func newMockKeyring(t *testing.T) *session.Keyring {
+	source, err := session.NewEphemeralKeySource()
+	require.NoError(t, err, "Failed to create ephemeral key source")
+
+	keyring, err := session.NewKeyring(context.Background(), source, 0)
+	require.NoError(t, err, "Failed to create keyring")
+	return keyring
+}
+
+// newMockAEAD returns a cipher with a fixed key.
+func newMockAEAD(t *testing.T) *cryptoutils.AEAD {
+	aead, err := cryptoutils.NewAEAD([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err, "Failed to create AEAD")
+	return aead
+}
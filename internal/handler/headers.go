@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+// Names of the claims that are taken from the session itself. Any other claim is forwarded from the provider.
+const (
+	claimUserID     = "user_id"
+	claimEmail      = "email"
+	claimGivenName  = "given_name"
+	claimFamilyName = "family_name"
+	claimName       = "name"
+	claimPicture    = "picture"
+	claimProvider   = "provider"
+	claimUserRoles  = "user_roles"
+	claimOrgID      = "org_id"
+	claimOrgRole    = "org_role"
+)
+
+// claimUsername is the name of the claim that holds the user's handle on the provider, for the providers that have
+// one. Like the claims of the ID token, it is forwarded from the provider.
+const claimUsername = "username"
+
+// defaultHeaderMappings are the headers of the check response if none are configured.
+var defaultHeaderMappings = []config.HeaderMapping{
+	{Header: xAuthUserIDHeader, Claim: claimUserID},
+	{Header: xAuthEmailHeader, Claim: claimEmail},
+	{Header: xAuthNameHeader, Claim: claimName},
+	{Header: xAuthPictureHeader, Claim: claimPicture},
+	{Header: xAuthRolesHeader, Claim: claimUserRoles},
+	{Header: xAuthOrgIDHeader, Claim: claimOrgID},
+	{Header: xAuthOrgRoleHeader, Claim: claimOrgRole},
+}
+
+// headerMappings returns the configured header mappings, or the default ones if there's none.
+func (h *Handler) headerMappings() []config.HeaderMapping {
+	if len(h.config.Check.Headers) == 0 {
+		return defaultHeaderMappings
+	}
+	return h.config.Check.Headers
+}
+
+// authHeaders returns the headers of the check response for the given claims, as per the header mappings.
+func (h *Handler) authHeaders(claims session.Claims) map[string]string {
+	headers := map[string]string{}
+	for _, mapping := range h.headerMappings() {
+		if mapping.Header == "" || mapping.Claim == "" {
+			continue
+		}
+		headers[h.config.Check.HeaderPrefix+mapping.Header] = claimValue(claims, mapping.Claim)
+	}
+	return headers
+}
+
+// providerExtra returns the claims of the provider that may be forwarded with the session. These are the extra claims
+// of its ID token, along with the username for the providers that have one.
+func providerExtra(claims oauth.Claims) map[string]any {
+	if claims.Username == "" {
+		return claims.Extra
+	}
+
+	// The provider's claims must not be modified.
+	extra := make(map[string]any, len(claims.Extra)+1)
+	maps.Copy(extra, claims.Extra)
+	extra[claimUsername] = claims.Username
+	return extra
+}
+
+// forwardedClaims returns the provider's claims, out of the given ones, that are mapped to headers or needed by the
+// policies. Only these are kept in the session, so that the session token does not grow with the claims that are
+// never used.
+func (h *Handler) forwardedClaims(extra map[string]any) map[string]any {
+	names := make([]string, 0, len(h.headerMappings()))
+	for _, mapping := range h.headerMappings() {
+		names = append(names, mapping.Claim)
+	}
+	if h.policies != nil {
+		names = append(names, h.policies.Claims()...)
+	}
+
+	var forwarded map[string]any
+	for _, name := range names {
+		value, exists := extra[name]
+		if !exists {
+			continue
+		}
+		if forwarded == nil {
+			forwarded = map[string]any{}
+		}
+		forwarded[name] = value
+	}
+	return forwarded
+}
+
+// claimValue returns the value of the claim with the given name as a header value, or empty if it is absent.
+func claimValue(claims session.Claims, name string) string {
+	switch name {
+	case claimUserID:
+		// The user ID is unknown for identities that never signed in here.
+		if claims.UserID == 0 {
+			return ""
+		}
+		return strconv.Itoa(claims.UserID)
+	case claimEmail:
+		return claims.Email
+	case claimGivenName:
+		return claims.GivenName
+	case claimFamilyName:
+		return claims.FamilyName
+	case claimName:
+		return strings.TrimSpace(claims.GivenName + " " + claims.FamilyName)
+	case claimPicture:
+		return claims.Picture
+	case claimProvider:
+		return claims.Provider
+	case claimUserRoles:
+		return strings.Join(claims.Roles, ",")
+	case claimOrgID:
+		return claims.OrgID
+	case claimOrgRole:
+		return claims.OrgRole
+	default:
+		return formatClaim(claims.Extra[name])
+	}
+}
+
+// formatClaim formats the given claim value as a header value. Multi-valued claims are comma-joined.
+func formatClaim(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, element := range value {
+			values = append(values, formatClaim(element))
+		}
+		return strings.Join(values, ",")
+	default:
+		// Objects are sent as JSON.
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+}
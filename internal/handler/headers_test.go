@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+func TestHandler_AuthHeaders(t *testing.T) {
+	claims := session.Claims{UserID: 7, Email: "mock@mock.com", GivenName: "Mock", FamilyName: "User",
+		Picture: "mockPicture", Provider: "google", Roles: []string{"admin", "auditor"},
+		OrgID: "acme", OrgRole: "owner", Extra: map[string]any{"groups": []any{"admins", "devs"}}}
+
+	for _, tc := range []struct {
+		name            string
+		headerPrefix    string
+		headers         []config.HeaderMapping
+		expectedHeaders map[string]string
+	}{
+		{
+			name: "No mappings, default headers",
+			expectedHeaders: map[string]string{
+				xAuthUserIDHeader:  "7",
+				xAuthEmailHeader:   claims.Email,
+				xAuthNameHeader:    "Mock User",
+				xAuthPictureHeader: claims.Picture,
+				xAuthRolesHeader:   "admin,auditor",
+				xAuthOrgIDHeader:   "acme",
+				xAuthOrgRoleHeader: "owner",
+			},
+		},
+		{
+			name: "Configured mappings, multi-valued claim is comma-joined",
+			headers: []config.HeaderMapping{
+				{Header: "X-Forwarded-User", Claim: "email"},
+				{Header: "X-Forwarded-Groups", Claim: "groups"},
+				{Header: "X-Forwarded-Roles", Claim: "user_roles"},
+			},
+			expectedHeaders: map[string]string{
+				"X-Forwarded-User":   claims.Email,
+				"X-Forwarded-Groups": "admins,devs",
+				"X-Forwarded-Roles":  "admin,auditor",
+			},
+		},
+		{
+			name:         "Configured mappings with prefix, absent claim is empty",
+			headerPrefix: "X-Forwarded-",
+			headers: []config.HeaderMapping{
+				{Header: "User", Claim: "email"},
+				{Header: "Provider", Claim: "provider"},
+				{Header: "Roles", Claim: "roles"},
+			},
+			expectedHeaders: map[string]string{
+				"X-Forwarded-User":     claims.Email,
+				"X-Forwarded-Provider": claims.Provider,
+				"X-Forwarded-Roles":    "",
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mHandler := &Handler{}
+			mHandler.config.Check.HeaderPrefix = tc.headerPrefix
+			mHandler.config.Check.Headers = tc.headers
+
+			require.Equal(t, tc.expectedHeaders, mHandler.authHeaders(claims), "Headers do not match")
+		})
+	}
+}
+
+func TestHandler_ForwardedClaims(t *testing.T) {
+	mHandler := &Handler{}
+	mHandler.config.Check.Headers = []config.HeaderMapping{
+		{Header: "X-Forwarded-User", Claim: "email"},
+		{Header: "X-Forwarded-Groups", Claim: "groups"},
+	}
+
+	// Only the mapped claims are forwarded.
+	extra := map[string]any{"groups": []any{"admins"}, "tid": "mockTenantID"}
+	require.Equal(t, map[string]any{"groups": []any{"admins"}}, mHandler.forwardedClaims(extra))
+
+	// Nothing is forwarded if none of the claims are mapped.
+	require.Nil(t, mHandler.forwardedClaims(map[string]any{"tid": "mockTenantID"}))
+}
+
+func TestProviderExtra(t *testing.T) {
+	// The username is forwarded like any other claim of the provider.
+	claims := oauth.Claims{Username: "octocat", Extra: map[string]any{"groups": []any{"admins"}}}
+	require.Equal(t, map[string]any{"groups": []any{"admins"}, "username": "octocat"}, providerExtra(claims))
+	require.NotContains(t, claims.Extra, "username", "Expected the provider's claims to be unmodified")
+
+	// Providers without a username.
+	require.Nil(t, providerExtra(oauth.Claims{}))
+}
+
+func TestFormatClaim(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{name: "Absent claim", value: nil, expected: ""},
+		{name: "String claim", value: "admin", expected: "admin"},
+		{name: "Boolean claim", value: true, expected: "true"},
+		{name: "Numeric claim", value: float64(1234567), expected: "1234567"},
+		{name: "Multi-valued claim", value: []any{"admins", "devs", float64(3)}, expected: "admins,devs,3"},
+		{name: "Object claim", value: map[string]any{"a": "b"}, expected: `{"a":"b"}`},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, formatClaim(tc.value))
+		})
+	}
+}
+
+func TestHandler_Check_HeaderMapping(t *testing.T) {
+	// The session forwards the groups of the provider.
+	sessions := newMockSessions(t, "https://application.com")
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com",
+		Extra: map[string]any{"groups": []any{"admins", "devs"}}}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	w, r := createMockCheckWR(&http.Cookie{Name: accessTokenCookieName, Value: sessionToken})
+
+	mRepo := &mockRepository{}
+	mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).
+		Return(repository.Session{ID: sessionClaims.SessionID}, nil).Once()
+
+	mHandler := &Handler{sessions: sessions, repo: mRepo}
+	mHandler.config.Check.Headers = []config.HeaderMapping{
+		{Header: "X-Forwarded-User", Claim: "email"},
+		{Header: "X-Forwarded-Groups", Claim: "groups"},
+	}
+
+	// Invoke the method to be tested.
+	mHandler.Check(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code, "Wrong response code")
+	require.Equal(t, sessionClaims.Email, w.Header().Get("X-Forwarded-User"))
+	require.Equal(t, "admins,devs", w.Header().Get("X-Forwarded-Groups"))
+	require.Empty(t, w.Header().Get(xAuthEmailHeader), "Expected no default headers")
+	mRepo.AssertExpectations(t)
+}
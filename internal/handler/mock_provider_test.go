@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"net/url"
 
 	"github.com/stretchr/testify/mock"
 
@@ -23,8 +24,8 @@ func (m *mockProvider) Issuers() []string {
 	return args.Get(0).([]string)
 }
 
-func (m *mockProvider) GetAuthURL(c context.Context, state, codeChallenge string) string {
-	args := m.Called(c, state, codeChallenge)
+func (m *mockProvider) GetAuthURL(c context.Context, state, codeChallenge, nonce string) string {
+	args := m.Called(c, state, codeChallenge, nonce)
 	return args.String(0)
 }
 
@@ -33,7 +34,51 @@ func (m *mockProvider) TokenFromCode(c context.Context, code, codeVerifier strin
 	return args.String(0), args.Error(1)
 }
 
-func (m *mockProvider) DecodeToken(c context.Context, s string) (oauth.Claims, error) {
-	args := m.Called(c, s)
+func (m *mockProvider) DecodeToken(c context.Context, s, nonce string) (oauth.Claims, error) {
+	args := m.Called(c, s, nonce)
 	return args.Get(0).(oauth.Claims), args.Error(1)
 }
+
+// mockMatcherProvider is a mock implementation of the oauth.Provider and oauth.IssuerMatcher interfaces.
+type mockMatcherProvider struct {
+	mockProvider
+}
+
+func (m *mockMatcherProvider) MatchIssuer(issuer string) bool {
+	args := m.Called(issuer)
+	return args.Bool(0)
+}
+
+// mockCallbackClaimsProvider is a mock implementation of the oauth.Provider and oauth.CallbackClaimsProvider interfaces.
+type mockCallbackClaimsProvider struct {
+	mockProvider
+}
+
+func (m *mockCallbackClaimsProvider) ClaimsFromCallback(claims oauth.Claims, form url.Values) oauth.Claims {
+	args := m.Called(claims, form)
+	return args.Get(0).(oauth.Claims)
+}
+
+// mockRefresherProvider is a mock implementation of the oauth.Provider and oauth.Refresher interfaces.
+type mockRefresherProvider struct {
+	mockProvider
+}
+
+func (m *mockRefresherProvider) TokensFromCode(c context.Context, code, codeVerifier string) (oauth.Tokens, error) {
+	args := m.Called(c, code, codeVerifier)
+	return args.Get(0).(oauth.Tokens), args.Error(1)
+}
+
+func (m *mockRefresherProvider) Refresh(c context.Context, refreshToken string) (oauth.Tokens, error) {
+	args := m.Called(c, refreshToken)
+	return args.Get(0).(oauth.Tokens), args.Error(1)
+}
+
+// mockFormPostProvider is a mock implementation of the oauth.Provider and oauth.FormPoster interfaces.
+type mockFormPostProvider struct {
+	mockProvider
+}
+
+func (m *mockFormPostProvider) FormPost() bool {
+	return true
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 
@@ -13,7 +14,156 @@ type mockRepository struct {
 	mock.Mock
 }
 
-func (m *mockRepository) UpsertUser(ctx context.Context, user repository.User) error {
-	args := m.Called(ctx, user)
+func (m *mockRepository) UpsertUserByIdentity(ctx context.Context, identity repository.Identity,
+) (repository.User, error) {
+	args := m.Called(ctx, identity)
+	return args.Get(0).(repository.User), args.Error(1)
+}
+
+func (m *mockRepository) LinkIdentity(ctx context.Context, identity repository.Identity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
+func (m *mockRepository) GetIdentityUserID(ctx context.Context, provider, subject string) (int, error) {
+	args := m.Called(ctx, provider, subject)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockRepository) AssignRole(ctx context.Context, userID int, role string) error {
+	args := m.Called(ctx, userID, role)
+	return args.Error(0)
+}
+
+func (m *mockRepository) AssignRoleIfVacant(ctx context.Context, userID int, role string) (bool, error) {
+	args := m.Called(ctx, userID, role)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockRepository) RevokeRole(ctx context.Context, userID int, role string) error {
+	args := m.Called(ctx, userID, role)
+	return args.Error(0)
+}
+
+func (m *mockRepository) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	args := m.Called(ctx, userID)
+	roles, _ := args.Get(0).([]string)
+	return roles, args.Error(1)
+}
+
+func (m *mockRepository) GrantPermission(ctx context.Context, role, permission string) error {
+	args := m.Called(ctx, role, permission)
+	return args.Error(0)
+}
+
+func (m *mockRepository) RevokePermission(ctx context.Context, role, permission string) error {
+	args := m.Called(ctx, role, permission)
+	return args.Error(0)
+}
+
+func (m *mockRepository) GetUserPermissions(ctx context.Context, userID int) ([]string, error) {
+	args := m.Called(ctx, userID)
+	permissions, _ := args.Get(0).([]string)
+	return permissions, args.Error(1)
+}
+
+func (m *mockRepository) CreateOrganization(ctx context.Context, org repository.Organization) error {
+	args := m.Called(ctx, org)
+	return args.Error(0)
+}
+
+func (m *mockRepository) GetOrganization(ctx context.Context, id string) (repository.Organization, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(repository.Organization), args.Error(1)
+}
+
+func (m *mockRepository) DeleteOrganization(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockRepository) AddMember(ctx context.Context, membership repository.Membership) error {
+	args := m.Called(ctx, membership)
+	return args.Error(0)
+}
+
+func (m *mockRepository) RemoveMember(ctx context.Context, orgID string, userID int) error {
+	args := m.Called(ctx, orgID, userID)
+	return args.Error(0)
+}
+
+func (m *mockRepository) GetMembership(ctx context.Context, orgID string, userID int) (repository.Membership, error) {
+	args := m.Called(ctx, orgID, userID)
+	return args.Get(0).(repository.Membership), args.Error(1)
+}
+
+func (m *mockRepository) InviteMember(ctx context.Context, invitation repository.Invitation) error {
+	args := m.Called(ctx, invitation)
 	return args.Error(0)
 }
+
+func (m *mockRepository) AcceptInvitation(ctx context.Context, orgID string, userID int, email string,
+) (repository.Membership, error) {
+	args := m.Called(ctx, orgID, userID, email)
+	return args.Get(0).(repository.Membership), args.Error(1)
+}
+
+func (m *mockRepository) ListSigningKeys(ctx context.Context) ([]repository.SigningKey, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]repository.SigningKey), args.Error(1)
+}
+
+func (m *mockRepository) InsertSigningKey(ctx context.Context, key repository.SigningKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *mockRepository) DeleteSigningKey(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockRepository) InsertSession(ctx context.Context, session repository.Session) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *mockRepository) GetSession(ctx context.Context, id string) (repository.Session, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(repository.Session), args.Error(1)
+}
+
+func (m *mockRepository) UpdateSessionRefreshToken(ctx context.Context, id, refreshToken string) error {
+	args := m.Called(ctx, id, refreshToken)
+	return args.Error(0)
+}
+
+func (m *mockRepository) DeleteSession(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockRepository) DeleteUserSessions(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *mockRepository) DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockRepository) InsertOAuthState(ctx context.Context, state repository.OAuthState, maxStates int) error {
+	args := m.Called(ctx, state, maxStates)
+	return args.Error(0)
+}
+
+func (m *mockRepository) TakeOAuthState(ctx context.Context, key string) (repository.OAuthState, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(repository.OAuthState), args.Error(1)
+}
+
+func (m *mockRepository) DeleteExpiredOAuthStates(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/shivanshkc/authorizer/internal/statestore"
+)
+
+// mockStateStore is a mock implementation of statestore.StateStore.
+type mockStateStore struct {
+	mock.Mock
+}
+
+func (m *mockStateStore) Put(ctx context.Context, key string, value statestore.Value) error {
+	args := m.Called(ctx, key, value)
+	return args.Error(0)
+}
+
+func (m *mockStateStore) Take(ctx context.Context, key string) (statestore.Value, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(statestore.Value), args.Error(1)
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/internal/utils/errutils"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+var (
+	errUnknownOrg   = errutils.BadRequest().WithReasonStr("org does not exist")
+	errNotOrgMember = errutils.Forbidden().WithReasonStr("user is not a member of the org")
+)
+
+// checkOrg verifies that the organization with the given ID exists, before a sign-in to it starts.
+func (h *Handler) checkOrg(ctx context.Context, orgID string) error {
+	if err := validateOrg(orgID); err != nil {
+		return errutils.BadRequest().WithReasonErr(err)
+	}
+
+	if _, err := h.repo.GetOrganization(ctx, orgID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errUnknownOrg
+		}
+		return errutils.InternalServerError().WithReasonErr(fmt.Errorf("error in GetOrganization call: %w", err))
+	}
+
+	return nil
+}
+
+// orgMembership returns the membership of the given user, who just signed in, in the given organization.
+//
+// If the user is not a member yet, their pending invitation is accepted, if any. Invitations are sent to emails, so
+// they are accepted only if the provider verified the email of the claims.
+func (h *Handler) orgMembership(ctx context.Context, orgID string, userID int, claims oauth.Claims,
+) (repository.Membership, error) {
+	membership, err := h.repo.GetMembership(ctx, orgID, userID)
+	if err == nil {
+		return membership, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return repository.Membership{}, fmt.Errorf("error in GetMembership call: %w", err)
+	}
+
+	if !claims.EmailVerified {
+		return repository.Membership{}, errNotOrgMember
+	}
+
+	membership, err = h.repo.AcceptInvitation(ctx, orgID, userID, claims.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return repository.Membership{}, errNotOrgMember
+		}
+		return repository.Membership{}, fmt.Errorf("error in AcceptInvitation call: %w", err)
+	}
+
+	return membership, nil
+}
+
+// checkMembership verifies that the user of the given session claims is still a member of their organization, and
+// returns the claims with their current role in it. Claims without an organization are returned as they are.
+//
+// Failures are returned as an errutils.HTTPError, as they are not caused by the token.
+func (h *Handler) checkMembership(ctx context.Context, claims session.Claims) (session.Claims, error) {
+	if claims.OrgID == "" {
+		return claims, nil
+	}
+
+	membership, err := h.repo.GetMembership(ctx, claims.OrgID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return session.Claims{}, errNotOrgMember
+		}
+		return session.Claims{}, errutils.InternalServerError().
+			WithReasonErr(fmt.Errorf("error in GetMembership call: %w", err))
+	}
+
+	claims.OrgRole = membership.Role
+	return claims, nil
+}
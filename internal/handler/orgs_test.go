@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/internal/session"
+	"github.com/shivanshkc/authorizer/internal/statestore"
+	"github.com/shivanshkc/authorizer/internal/utils/errutils"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+func TestHandler_Auth_Org(t *testing.T) {
+	const providerName = "google"
+	const mProviderAuthURL = "https://auth.google.com"
+	const allowedRedirectURL = "https://allowed.com"
+
+	// Common error for reuse.
+	errMock := errors.New("mock error")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		inOrg     string
+		errGetOrg error // Parameter to control if the GetOrganization method should fail.
+		// Expectations.
+		expectGetOrgCall     bool
+		expectedResponseCode int
+	}{
+		{
+			name:                 "Org exists, state holds the org",
+			inOrg:                "acme",
+			expectGetOrgCall:     true,
+			expectedResponseCode: http.StatusFound,
+		},
+		{
+			name:                 "Invalid org, error expected",
+			inOrg:                strings.Repeat("a", 101),
+			expectedResponseCode: http.StatusBadRequest,
+		},
+		{
+			name:                 "Unknown org, error expected",
+			inOrg:                "acme",
+			errGetOrg:            repository.ErrNotFound,
+			expectGetOrgCall:     true,
+			expectedResponseCode: http.StatusBadRequest,
+		},
+		{
+			name:                 "GetOrganization method returns error, error expected",
+			inOrg:                "acme",
+			errGetOrg:            errMock,
+			expectGetOrgCall:     true,
+			expectedResponseCode: http.StatusInternalServerError,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, r := createMockAuthWR(providerName, allowedRedirectURL)
+			query := r.URL.Query()
+			query.Set("org", tc.inOrg)
+			r.URL.RawQuery = query.Encode()
+
+			// Setup mocks. The state key is captured to verify the state.
+			var insertedStateKey string
+			mProvider, mRepo := &mockProvider{}, &mockRepository{}
+			mProvider.On("Name").Return(providerName).Once()
+			mProvider.On("Issuers").Return([]string{}).Once()
+			if tc.expectedResponseCode == http.StatusFound {
+				mProvider.On("GetAuthURL", r.Context(), mock.Anything, mock.Anything, mock.Anything).
+					Return(mProviderAuthURL).Once().
+					Run(func(args mock.Arguments) { insertedStateKey = args.String(1) })
+			}
+			if tc.expectGetOrgCall {
+				mRepo.On("GetOrganization", r.Context(), tc.inOrg).
+					Return(repository.Organization{ID: tc.inOrg}, tc.errGetOrg).Once()
+			}
+
+			// Create the mock handler.
+			mConfig := config.Config{AllowedRedirectURLs: []string{allowedRedirectURL}}
+			states := statestore.NewMemoryStore(context.Background(), time.Minute, 0)
+			mHandler := NewHandler(mConfig, []oauth.Provider{mProvider}, states, nil, nil, nil, nil, mRepo)
+
+			// Invoke the method to test.
+			mHandler.Auth(w, r)
+
+			require.Equal(t, tc.expectedResponseCode, w.Code, "Wrong response code")
+			mProvider.AssertExpectations(t)
+			mRepo.AssertExpectations(t)
+
+			if tc.expectedResponseCode != http.StatusFound {
+				return
+			}
+
+			insertedStateValue, err := states.Take(context.Background(), insertedStateKey)
+			require.NoError(t, err, "State was not inserted in the state store")
+			require.Equal(t, tc.inOrg, insertedStateValue.OrgID, "Org does not match")
+		})
+	}
+}
+
+func TestHandler_Callback_Org(t *testing.T) {
+	const sessionIssuer = "https://application.com"
+	const orgID, userID = "acme", 7
+
+	// Common error for reuse.
+	errMock := errors.New("mock error")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		emailVerified bool
+		errGetMember  error // Parameter to control if the GetMembership method should fail.
+		errAccept     error // Parameter to control if the AcceptInvitation method should fail.
+		// Expectations.
+		expectAcceptCall bool
+		expectedRole     string // Org role expected in the session, if it starts.
+		expectedErr      string // Error expected in the redirect URL, if any.
+	}{
+		{
+			name:         "Member, session holds the org",
+			expectedRole: "owner",
+		},
+		{
+			name:             "Invited user, invitation accepted",
+			emailVerified:    true,
+			errGetMember:     repository.ErrNotFound,
+			expectAcceptCall: true,
+			expectedRole:     "member",
+		},
+		{
+			name:         "Invited user with unverified email, rejected",
+			errGetMember: repository.ErrNotFound,
+			expectedErr:  errNotOrgMember.Error(),
+		},
+		{
+			name:             "Neither a member nor invited, rejected",
+			emailVerified:    true,
+			errGetMember:     repository.ErrNotFound,
+			errAccept:        repository.ErrNotFound,
+			expectAcceptCall: true,
+			expectedErr:      errNotOrgMember.Error(),
+		},
+		{
+			name:         "GetMembership method returns error, error expected",
+			errGetMember: errMock,
+			expectedErr:  errutils.InternalServerError().Error(),
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			// State key and value for the request.
+			stateKey := uuid.NewString()
+			stateVal := statestore.Value{CodeVerifier: "anything", ClientCallbackURL: "https://first.com",
+				Nonce: "mockNonce", OrgID: orgID}
+
+			const code, token = "c1a2b3.0.abc-def", "header.payload.signature"
+			claims := oauth.Claims{Iss: "mockIssuer", Exp: time.Now().Add(time.Hour), Sub: "mockSubject",
+				Email: "mock@mock.com", EmailVerified: tc.emailVerified}
+			user := repository.User{ID: userID, Email: claims.Email}
+
+			w, r := createMockCallbackWR("google", stateKey, code, "")
+			ctx := r.Context()
+
+			// Setup mocks.
+			mProvider, mRepo := &mockProvider{}, &mockRepository{}
+			mProvider.On("TokenFromCode", ctx, code, stateVal.CodeVerifier).Return(token, nil).Once()
+			mProvider.On("DecodeToken", ctx, token, stateVal.Nonce).Return(claims, nil).Once()
+
+			mRepo.On("UpsertUserByIdentity", ctx, mock.Anything).Return(user, nil).Once()
+			mRepo.On("GetUserRoles", ctx, userID).Return([]string{}, nil).Once()
+			mRepo.On("GetMembership", ctx, orgID, userID).
+				Return(repository.Membership{OrgID: orgID, UserID: userID, Role: "owner"}, tc.errGetMember).Once()
+			if tc.expectAcceptCall {
+				mRepo.On("AcceptInvitation", ctx, orgID, userID, claims.Email).
+					Return(repository.Membership{OrgID: orgID, UserID: userID, Role: "member"}, tc.errAccept).Once()
+			}
+			if tc.expectedErr == "" {
+				mRepo.On("InsertSession", ctx, mock.Anything).Return(nil).Once()
+			}
+
+			mHandler := &Handler{
+				config:    config.Config{AllowedRedirectURLs: []string{stateVal.ClientCallbackURL}},
+				states:    statestore.NewMemoryStore(context.Background(), time.Minute, 0),
+				providers: map[string]oauth.Provider{"google": mProvider},
+				sessions:  newMockSessions(t, sessionIssuer),
+				repo:      mRepo,
+			}
+			require.NoError(t, mHandler.states.Put(context.Background(), stateKey, stateVal))
+
+			// Invoke the method to test.
+			mHandler.Callback(w, r)
+
+			mProvider.AssertExpectations(t)
+			mRepo.AssertExpectations(t)
+
+			require.Equal(t, http.StatusFound, w.Code)
+			parsed, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err, "Expected Location header to be a valid URL")
+
+			if tc.expectedErr != "" {
+				require.Equal(t, tc.expectedErr, parsed.Query().Get("error"), "Error does not match")
+				require.Empty(t, w.Result().Cookies(), "Expected no cookie")
+				return
+			}
+
+			// The session must hold the org and the role of the user in it.
+			cookies := w.Result().Cookies()
+			require.Len(t, cookies, 1, "Expected the session cookie")
+			sessionClaims, err := mHandler.sessions.Verify(cookies[0].Value)
+			require.NoError(t, err, "Expected the session token to be valid")
+			require.Equal(t, orgID, sessionClaims.OrgID, "Org does not match")
+			require.Equal(t, tc.expectedRole, sessionClaims.OrgRole, "Org role does not match")
+		})
+	}
+}
+
+func TestHandler_Check_Org(t *testing.T) {
+	const sessionIssuer = "https://application.com"
+
+	// Common error for reuse.
+	errMock := errors.New("mock error")
+
+	// The role in the token is stale, and must be refreshed from the repository.
+	sessions := newMockSessions(t, sessionIssuer)
+	sessionClaims := session.Claims{UserID: 7, SessionID: "mockSessionID", Email: "se@ssion.com",
+		Provider: "github", OrgID: "acme", OrgRole: "member"}
+	sessionToken, _, err := sessions.Issue(sessionClaims)
+	require.NoError(t, err, "Failed to issue session token")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		errGetMember error // Parameter to control if the GetMembership method should fail.
+		// Expectations.
+		expectedResponseCode int
+	}{
+		{
+			name:                 "Member, org headers set",
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Member removed from the org, error expected",
+			errGetMember:         repository.ErrNotFound,
+			expectedResponseCode: http.StatusForbidden,
+		},
+		{
+			name:                 "GetMembership method returns error, error expected",
+			errGetMember:         errMock,
+			expectedResponseCode: http.StatusInternalServerError,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, r := createMockCheckWR(&http.Cookie{Name: accessTokenCookieName, Value: sessionToken})
+
+			mRepo := &mockRepository{}
+			mRepo.On("GetSession", r.Context(), sessionClaims.SessionID).
+				Return(repository.Session{ID: sessionClaims.SessionID}, nil).Once()
+			mRepo.On("GetMembership", r.Context(), sessionClaims.OrgID, sessionClaims.UserID).
+				Return(repository.Membership{OrgID: sessionClaims.OrgID, UserID: 7, Role: "admin"}, tc.errGetMember).
+				Once()
+
+			mHandler := &Handler{sessions: sessions, repo: mRepo}
+
+			// Invoke the method to test.
+			mHandler.Check(w, r)
+			mRepo.AssertExpectations(t)
+
+			require.Equal(t, tc.expectedResponseCode, w.Code, "Wrong response code")
+			if tc.expectedResponseCode != http.StatusOK {
+				require.Empty(t, w.Header().Get(xAuthOrgIDHeader), "Expected no org header")
+				return
+			}
+
+			require.Equal(t, sessionClaims.OrgID, w.Header().Get(xAuthOrgIDHeader), "Org does not match")
+			require.Equal(t, "admin", w.Header().Get(xAuthOrgRoleHeader), "Org role does not match")
+		})
+	}
+}
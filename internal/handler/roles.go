@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+// defaultAdminRole is the name of the role granted to the bootstrap admin if none is configured.
+const defaultAdminRole = "admin"
+
+// userRoles returns the roles of the given user, who just signed in with the given claims.
+//
+// The bootstrap admin is granted the admin role first, as long as no user has it. Anyone could claim an unverified
+// email, so the provider must have verified it. A failure to grant the role is only logged, so that the sign-in goes
+// on without it.
+func (h *Handler) userRoles(ctx context.Context, user repository.User, claims oauth.Claims) ([]string, error) {
+	bootstrap := h.config.RBAC.Bootstrap
+	if bootstrap.AdminEmail != "" && claims.EmailVerified && strings.EqualFold(bootstrap.AdminEmail, claims.Email) {
+		adminRole := bootstrap.AdminRole
+		if adminRole == "" {
+			adminRole = defaultAdminRole
+		}
+
+		if assigned, err := h.repo.AssignRoleIfVacant(ctx, user.ID, adminRole); err != nil {
+			slog.ErrorContext(ctx, "failed to assign the bootstrap admin role", "user_id", user.ID, "error", err)
+		} else if assigned {
+			slog.InfoContext(ctx, "bootstrap admin role assigned", "user_id", user.ID, "role", adminRole)
+		}
+	}
+
+	roles, err := h.repo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error in GetUserRoles call: %w", err)
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+func TestHandler_UserRoles(t *testing.T) {
+	// Common error for reuse.
+	errMock := errors.New("mock error")
+
+	for _, tc := range []struct {
+		name string
+		// Mock inputs.
+		adminEmail string // Email of the bootstrap admin.
+		adminRole  string // Configured admin role.
+		userEmail  string
+		unverified bool  // Parameter to control if the provider did not verify the user's email.
+		errAssign  error // Parameter to control if the AssignRoleIfVacant method should fail.
+		errRoles   error // Parameter to control if the GetUserRoles method should fail.
+		// Expectations.
+		expectedAssignedRole string // Role expected to be assigned, if any.
+		expectErr            bool
+	}{
+		{
+			name:      "No bootstrap admin, roles returned",
+			userEmail: "mock@mock.com",
+		},
+		{
+			name:       "Another user, no role assigned",
+			adminEmail: "admin@mock.com",
+			userEmail:  "mock@mock.com",
+		},
+		{
+			name:                 "Bootstrap admin, default role assigned",
+			adminEmail:           "Admin@Mock.com",
+			userEmail:            "admin@mock.com",
+			expectedAssignedRole: defaultAdminRole,
+		},
+		{
+			name:       "Bootstrap admin with unverified email, no role assigned",
+			adminEmail: "admin@mock.com",
+			userEmail:  "admin@mock.com",
+			unverified: true,
+		},
+		{
+			name:                 "Bootstrap admin, configured role assigned",
+			adminEmail:           "admin@mock.com",
+			adminRole:            "owner",
+			userEmail:            "admin@mock.com",
+			expectedAssignedRole: "owner",
+		},
+		{
+			name:                 "Assignment fails, sign-in goes on",
+			adminEmail:           "admin@mock.com",
+			userEmail:            "admin@mock.com",
+			errAssign:            errMock,
+			expectedAssignedRole: defaultAdminRole,
+		},
+		{
+			name:      "GetUserRoles method returns error",
+			userEmail: "mock@mock.com",
+			errRoles:  errMock,
+			expectErr: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			user := repository.User{ID: 42, Email: tc.userEmail}
+
+			mRepo := &mockRepository{}
+			mHandler := &Handler{repo: mRepo}
+			mHandler.config.RBAC.Bootstrap.AdminEmail = tc.adminEmail
+			mHandler.config.RBAC.Bootstrap.AdminRole = tc.adminRole
+
+			if tc.expectedAssignedRole != "" {
+				mRepo.On("AssignRoleIfVacant", ctx, user.ID, tc.expectedAssignedRole).
+					Return(tc.errAssign == nil, tc.errAssign).Once()
+			}
+			mRepo.On("GetUserRoles", ctx, user.ID).Return([]string{"admin"}, tc.errRoles).Once()
+
+			// Invoke the method to test.
+			claims := oauth.Claims{Email: tc.userEmail, EmailVerified: !tc.unverified}
+			roles, err := mHandler.userRoles(ctx, user, claims)
+			mRepo.AssertExpectations(t)
+
+			if tc.expectErr {
+				require.Error(t, err, "Expected error in userRoles")
+				return
+			}
+
+			require.NoError(t, err, "Expected no error in userRoles")
+			require.Equal(t, []string{"admin"}, roles, "Roles do not match")
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/shivanshkc/authorizer/internal/utils/errutils"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+// hostedDomainClaim is the claim of Google's identity tokens that holds the user's Google Workspace domain.
+const hostedDomainClaim = "hd"
+
+// googleProviderName is the name of the Google provider, the only one whose hosted domain claim is trusted.
+const googleProviderName = "google"
+
+var (
+	errEmailNotVerified = errutils.Forbidden().WithReasonStr("email is not verified")
+	errSignInNotAllowed = errutils.Forbidden().WithReasonStr("email is not allowed to sign in")
+)
+
+// checkSignIn tells whether the user of the given claims, issued by the provider of the given name, may sign in, as per
+// the sign-in configs.
+//
+// The denied emails are checked first, so that they can not be allowed by their domain. The allowlists match only the
+// verified emails, as some providers return emails that the users merely typed in.
+func (h *Handler) checkSignIn(providerName string, claims oauth.Claims) error {
+	rules := h.config.SignIn
+
+	if containsFold(rules.DeniedEmails, claims.Email) {
+		return errSignInNotAllowed
+	}
+
+	if rules.RequireVerifiedEmail && !claims.EmailVerified {
+		return errEmailNotVerified
+	}
+
+	// Without any allowlist, everyone else may sign in.
+	if len(rules.AllowedDomains) == 0 && len(rules.AllowedEmails) == 0 {
+		return nil
+	}
+
+	if !claims.EmailVerified {
+		return errEmailNotVerified
+	}
+
+	if containsFold(rules.AllowedEmails, claims.Email) {
+		return nil
+	}
+
+	_, domain, _ := strings.Cut(claims.Email, "@")
+	if containsFold(rules.AllowedDomains, domain) {
+		return nil
+	}
+
+	// The Workspace domain covers the users whose email is of a secondary domain of the Workspace. Other providers
+	// may send a claim of the same name, which means nothing.
+	if providerName == googleProviderName {
+		if hostedDomain, _ := claims.Extra[hostedDomainClaim].(string); containsFold(rules.AllowedDomains, hostedDomain) {
+			return nil
+		}
+	}
+
+	return errSignInNotAllowed
+}
+
+// containsFold tells whether the given list contains the given value, case-insensitively. An empty value is never
+// contained.
+func containsFold(list []string, value string) bool {
+	return value != "" && slices.ContainsFunc(list, func(element string) bool {
+		return strings.EqualFold(element, value)
+	})
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/statestore"
+	"github.com/shivanshkc/authorizer/pkg/oauth"
+)
+
+func TestHandler_CheckSignIn(t *testing.T) {
+	mHandler := &Handler{}
+	mHandler.config.SignIn.RequireVerifiedEmail = true
+	mHandler.config.SignIn.AllowedDomains = []string{"example.com"}
+	mHandler.config.SignIn.AllowedEmails = []string{"Guest@Other.com"}
+	mHandler.config.SignIn.DeniedEmails = []string{"fired@example.com"}
+
+	for _, tc := range []struct {
+		name         string
+		providerName string // Defaults to google.
+		claims       oauth.Claims
+		expectedErr  error
+	}{
+		{
+			name:   "Allowed domain, allowed",
+			claims: oauth.Claims{Email: "staff@Example.com", EmailVerified: true},
+		},
+		{
+			name:   "Allowed email of another domain, allowed",
+			claims: oauth.Claims{Email: "guest@other.com", EmailVerified: true},
+		},
+		{
+			name: "Workspace domain, allowed",
+			claims: oauth.Claims{Email: "staff@example.org", EmailVerified: true,
+				Extra: map[string]any{hostedDomainClaim: "example.com"}},
+		},
+		{
+			name:         "Hosted domain claim of another provider, rejected",
+			providerName: "oidc",
+			claims: oauth.Claims{Email: "staff@example.org", EmailVerified: true,
+				Extra: map[string]any{hostedDomainClaim: "example.com"}},
+			expectedErr: errSignInNotAllowed,
+		},
+		{
+			name:        "Another domain, rejected",
+			claims:      oauth.Claims{Email: "someone@other.com", EmailVerified: true},
+			expectedErr: errSignInNotAllowed,
+		},
+		{
+			name:        "Subdomain of the allowed domain, rejected",
+			claims:      oauth.Claims{Email: "staff@evil.example.com", EmailVerified: true},
+			expectedErr: errSignInNotAllowed,
+		},
+		{
+			name:        "Denied email of the allowed domain, rejected",
+			claims:      oauth.Claims{Email: "Fired@example.com", EmailVerified: true},
+			expectedErr: errSignInNotAllowed,
+		},
+		{
+			name:        "Unverified email, rejected",
+			claims:      oauth.Claims{Email: "staff@example.com"},
+			expectedErr: errEmailNotVerified,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			providerName := tc.providerName
+			if providerName == "" {
+				providerName = googleProviderName
+			}
+			require.Equal(t, tc.expectedErr, mHandler.checkSignIn(providerName, tc.claims), "Error does not match")
+		})
+	}
+
+	// Without any rules, everyone may sign in.
+	require.NoError(t, (&Handler{}).checkSignIn("google", oauth.Claims{Email: "someone@other.com"}),
+		"Expected no error")
+}
+
+func TestHandler_CheckSignIn_UnverifiedAllowlist(t *testing.T) {
+	// The allowlists match only the verified emails, even if verification is not required otherwise.
+	mHandler := &Handler{}
+	mHandler.config.SignIn.AllowedDomains = []string{"example.com"}
+	mHandler.config.SignIn.AllowedEmails = []string{"guest@other.com"}
+
+	for _, claims := range []oauth.Claims{
+		{Email: "staff@example.com"},
+		{Email: "guest@other.com"},
+		{Email: "staff@example.org", Extra: map[string]any{hostedDomainClaim: "example.com"}},
+	} {
+		require.Equal(t, errEmailNotVerified, mHandler.checkSignIn(googleProviderName, claims),
+			"Expected unverified email %s to be rejected", claims.Email)
+	}
+
+	// Verified ones are still allowed.
+	require.NoError(t, mHandler.checkSignIn(googleProviderName,
+		oauth.Claims{Email: "staff@example.com", EmailVerified: true}), "Expected no error")
+}
+
+func TestHandler_Callback_SignInRejected(t *testing.T) {
+	// State key and value for the request.
+	var stateKey = uuid.NewString()
+	var stateVal = statestore.Value{CodeVerifier: "anything", ClientCallbackURL: "https://first.com",
+		Nonce: "mockNonce"}
+
+	const code, token = "c1a2b3.0.abc-def", "header.payload.signature"
+	claims := oauth.Claims{Iss: "mockIssuer", Exp: time.Now().Add(time.Hour), Sub: "mockSubject",
+		Email: "someone@other.com", EmailVerified: true}
+
+	w, r := createMockCallbackWR("google", stateKey, code, "")
+
+	// Setup mocks. The user must not be stored.
+	mProvider, mRepo := &mockProvider{}, &mockRepository{}
+	mProvider.On("TokenFromCode", r.Context(), code, stateVal.CodeVerifier).Return(token, nil).Once()
+	mProvider.On("DecodeToken", r.Context(), token, stateVal.Nonce).Return(claims, nil).Once()
+
+	mConfig := config.Config{AllowedRedirectURLs: []string{stateVal.ClientCallbackURL}}
+	mConfig.SignIn.AllowedDomains = []string{"example.com"}
+
+	mHandler := &Handler{
+		config:    mConfig,
+		states:    statestore.NewMemoryStore(context.Background(), time.Minute, 0),
+		providers: map[string]oauth.Provider{"google": mProvider},
+		sessions:  newMockSessions(t, "https://application.com"),
+		repo:      mRepo,
+	}
+	require.NoError(t, mHandler.states.Put(context.Background(), stateKey, stateVal))
+
+	// Invoke the method to test.
+	mHandler.Callback(w, r)
+
+	mProvider.AssertExpectations(t)
+	mRepo.AssertExpectations(t)
+
+	// The user is redirected with the reason, and without a session.
+	require.Equal(t, http.StatusFound, w.Code)
+	parsed, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err, "Expected Location header to be a valid URL")
+	require.Equal(t, errSignInNotAllowed.Error(), parsed.Query().Get("error"), "Error does not match")
+	require.Empty(t, w.Result().Cookies(), "Expected no cookie")
+}
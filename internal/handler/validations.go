@@ -13,11 +13,12 @@ var (
 	errInvalidCCU      = errors.New("redirect_url must be present, must be upto 200 characters and a valid url")
 	errInvalidState    = errors.New("state is malformed")
 	errInvalidCode     = errors.New("code is malformed")
+	errInvalidOrg      = errors.New("org must be upto 100 characters and must include only a-z, 0-9, - and _")
 )
 
 var (
 	providerRegex = regexp.MustCompile(`^[a-z0-9_-]+$`)
-	authCodeRegex = regexp.MustCompile(`^[a-zA-Z0-9/_-]+$`)
+	authCodeRegex = regexp.MustCompile(`^[a-zA-Z0-9/._~-]+$`)
 )
 
 // validateProvider validates the provider name parameter when received from an external user.
@@ -33,6 +34,20 @@ func validateProvider(p string) error {
 	return nil
 }
 
+// validateOrg validates the organization ID parameter when received from an external user.
+func validateOrg(o string) error {
+	if len(o) == 0 || len(o) > 100 {
+		return errInvalidOrg
+	}
+
+	// Organization IDs are of the same charset as the provider names.
+	if !providerRegex.MatchString(o) {
+		return errInvalidOrg
+	}
+
+	return nil
+}
+
 // validateClientCallbackURL validates the client callback URL param (accepted as a query parameter named redirect_url).
 func validateClientCallbackURL(u string) error {
 	if len(u) == 0 || len(u) > 200 {
@@ -56,8 +71,10 @@ func validateState(s string) error {
 }
 
 // validateAuthCode validates the "code" parameter returned by the oauth.Provider.
+//
+// Codes are opaque and their length is not standardized. Microsoft's codes, for example, often exceed 1000 characters.
 func validateAuthCode(code string) error {
-	if len(code) == 0 || len(code) > 200 {
+	if len(code) == 0 || len(code) > 2048 {
 		return errInvalidCode
 	}
 
@@ -72,12 +72,19 @@ func (s *Server) handler() http.Handler {
 	router.HandleFunc("/api", s.Handler.Health).Methods(http.MethodGet)
 	router.HandleFunc("/api/health", s.Handler.Health).Methods(http.MethodGet)
 
+	// Public keys of the session tokens.
+	router.HandleFunc("/.well-known/jwks.json", s.Handler.JWKS).Methods(http.MethodGet)
+
 	// Endpoint to check if a request is authenticated.
 	router.HandleFunc("/api/check", s.Handler.Check).Methods(http.MethodGet)
+	// Endpoint to end the session. With ?all=true, all sessions of the user are ended.
+	router.HandleFunc("/api/logout", s.Handler.Logout).Methods(http.MethodPost)
 	// Endpoint to initiate the OAuth flow.
 	router.HandleFunc("/api/auth/{provider}", s.Handler.Auth).Methods(http.MethodGet)
-	// Callback endpoint for a provider.
-	router.HandleFunc("/api/auth/{provider}/callback", s.Handler.Callback).Methods(http.MethodGet)
+	// Endpoint to link a provider's identity to the signed-in user.
+	router.HandleFunc("/api/link/{provider}", s.Handler.Link).Methods(http.MethodGet)
+	// Callback endpoint for a provider. Some providers, like Apple, call back with a POST form.
+	router.HandleFunc("/api/auth/{provider}/callback", s.Handler.Callback).Methods(http.MethodGet, http.MethodPost)
 
 	// All remaining routes result in 404.
 	router.PathPrefix("/").HandlerFunc(s.Handler.NotFound)
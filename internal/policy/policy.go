@@ -0,0 +1,223 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/session"
+)
+
+// Defaults of the claims that hold the user's groups and roles.
+const (
+	DefaultGroupsClaim = "groups"
+	DefaultRolesClaim  = "roles"
+)
+
+// Default decisions of the requests that match no rule.
+const (
+	defaultAllow = "allow"
+	defaultDeny  = "deny"
+)
+
+// Request is the request being authorized.
+type Request struct {
+	Host   string
+	Path   string
+	Method string
+}
+
+// Decision is the outcome of the evaluation of a request.
+type Decision struct {
+	// Allowed tells whether the request is allowed.
+	Allowed bool
+	// Rule is the name of the rule that decided. It is empty if the request matched no rule.
+	Rule string
+	// DryRun tells whether the decision must only be logged, and not enforced.
+	DryRun bool
+}
+
+// Engine evaluates the requests against the policies.
+//
+// The policies can be replaced at any time with Update, which does not affect the evaluations in progress.
+type Engine struct {
+	policies atomic.Pointer[config.Policies]
+}
+
+// NewEngine creates a new Engine with the given policies.
+func NewEngine(policies config.Policies) (*Engine, error) {
+	engine := &Engine{}
+	if err := engine.Update(policies); err != nil {
+		return nil, fmt.Errorf("error in Update call: %w", err)
+	}
+	return engine, nil
+}
+
+// Update validates the given policies and replaces the current ones with them. Upon failure, the current policies
+// are kept.
+func (e *Engine) Update(policies config.Policies) error {
+	if err := validate(policies); err != nil {
+		return fmt.Errorf("error in validate call: %w", err)
+	}
+
+	if policies.GroupsClaim == "" {
+		policies.GroupsClaim = DefaultGroupsClaim
+	}
+	if policies.RolesClaim == "" {
+		policies.RolesClaim = DefaultRolesClaim
+	}
+
+	e.policies.Store(&policies)
+	return nil
+}
+
+// Claims returns the names of the provider's claims that the policies need, which must be kept in the session.
+// It is empty if there are no rules.
+func (e *Engine) Claims() []string {
+	policies := e.policies.Load()
+	if len(policies.Rules) == 0 {
+		return nil
+	}
+	return []string{policies.GroupsClaim, policies.RolesClaim}
+}
+
+// Evaluate decides whether the user of the given claims may make the given request.
+func (e *Engine) Evaluate(request Request, claims session.Claims) Decision {
+	policies := e.policies.Load()
+
+	for _, rule := range policies.Rules {
+		if !matchRequest(rule, request) {
+			continue
+		}
+		return Decision{Allowed: allows(rule, policies, claims), Rule: rule.Name, DryRun: policies.DryRun}
+	}
+
+	return Decision{Allowed: policies.Default != defaultDeny, DryRun: policies.DryRun}
+}
+
+// validate validates the given policies.
+func validate(policies config.Policies) error {
+	if policies.Default != "" && policies.Default != defaultAllow && policies.Default != defaultDeny {
+		return fmt.Errorf("unknown default: %q", policies.Default)
+	}
+
+	for i, rule := range policies.Rules {
+		for _, path := range rule.Paths {
+			if !strings.HasPrefix(path, "/") && path != "*" {
+				return fmt.Errorf("path of rule %d (%s) must start with a slash: %q", i, rule.Name, path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchRequest tells whether the given rule matches the given request.
+func matchRequest(rule config.PolicyRule, request Request) bool {
+	if len(rule.Hosts) > 0 && !slices.ContainsFunc(rule.Hosts, func(host string) bool {
+		return matchHost(host, request.Host)
+	}) {
+		return false
+	}
+
+	if len(rule.Paths) > 0 && !slices.ContainsFunc(rule.Paths, func(path string) bool {
+		return matchPath(path, request.Path)
+	}) {
+		return false
+	}
+
+	if len(rule.Methods) > 0 && !slices.ContainsFunc(rule.Methods, func(method string) bool {
+		return strings.EqualFold(method, request.Method)
+	}) {
+		return false
+	}
+
+	return true
+}
+
+// matchHost tells whether the given host, with an optional port, matches the given pattern. A pattern that starts
+// with "*." matches the subdomains, but not the domain itself.
+func matchHost(pattern, host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host, pattern = strings.ToLower(host), strings.ToLower(pattern)
+
+	if suffix, isWildcard := strings.CutPrefix(pattern, "*"); isWildcard {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+// matchPath tells whether the given path matches the given pattern, case-insensitively, as some upstreams are. A
+// pattern that ends with "*" matches all paths with that prefix.
+func matchPath(pattern, path string) bool {
+	path, pattern = strings.ToLower(path), strings.ToLower(pattern)
+
+	if prefix, isWildcard := strings.CutSuffix(pattern, "*"); isWildcard {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == pattern
+}
+
+// allows tells whether the user of the given claims satisfies any of the conditions of the given rule.
+func allows(rule config.PolicyRule, policies *config.Policies, claims session.Claims) bool {
+	// A rule without conditions allows all authenticated users.
+	if len(rule.EmailDomains) == 0 && len(rule.Users) == 0 && len(rule.Groups) == 0 && len(rule.Roles) == 0 {
+		return true
+	}
+
+	// Only a verified email tells who the user is. An unverified one may have been typed in by anyone.
+	hasEmail := claims.Email != "" && claims.EmailVerified
+
+	if hasEmail {
+		_, domain, _ := strings.Cut(claims.Email, "@")
+		if slices.ContainsFunc(rule.EmailDomains, func(allowed string) bool {
+			return strings.EqualFold(allowed, domain)
+		}) {
+			return true
+		}
+	}
+
+	if slices.ContainsFunc(rule.Users, func(user string) bool {
+		return (hasEmail && strings.EqualFold(user, claims.Email)) ||
+			(claims.UserID != 0 && user == strconv.Itoa(claims.UserID))
+	}) {
+		return true
+	}
+
+	if containsAny(rule.Groups, claimValues(claims, policies.GroupsClaim)) {
+		return true
+	}
+
+	// The roles assigned in Authorizer count along with the provider's.
+	return containsAny(rule.Roles, claimValues(claims, policies.RolesClaim)) || containsAny(rule.Roles, claims.Roles)
+}
+
+// claimValues returns the values of the provider's claim with the given name. A single value is returned as a list
+// of one.
+func claimValues(claims session.Claims, name string) []string {
+	switch value := claims.Extra[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, element := range value {
+			if element, ok := element.(string); ok {
+				values = append(values, element)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// containsAny tells whether any of the given values is allowed.
+func containsAny(allowed, values []string) bool {
+	return slices.ContainsFunc(values, func(value string) bool { return slices.Contains(allowed, value) })
+}
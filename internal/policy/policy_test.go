@@ -0,0 +1,164 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/config"
+	"github.com/shivanshkc/authorizer/internal/session"
+)
+
+func TestEngine_Evaluate(t *testing.T) {
+	policies := config.Policies{
+		Default:    "deny",
+		RolesClaim: "app_roles",
+		Rules: []config.PolicyRule{
+			{Name: "public", Hosts: []string{"*.example.com"}, Paths: []string{"/public/*"}},
+			{Name: "admin", Hosts: []string{"admin.example.com"}, Methods: []string{"POST", "DELETE"},
+				Groups: []string{"admins"}, Users: []string{"boss@other.com", "42"}},
+			{Name: "staff", Hosts: []string{"admin.example.com"}, EmailDomains: []string{"example.com"},
+				Roles: []string{"auditor"}},
+		},
+	}
+
+	engine, err := NewEngine(policies)
+	require.NoError(t, err, "Expected no error in NewEngine")
+
+	for _, tc := range []struct {
+		name    string
+		request Request
+		claims  session.Claims
+		// Expectations.
+		expectedAllowed bool
+		expectedRule    string
+	}{
+		{
+			name:            "Public path of a subdomain, allowed for all",
+			request:         Request{Host: "app.example.com:443", Path: "/public/index.html", Method: "GET"},
+			expectedAllowed: true,
+			expectedRule:    "public",
+		},
+		{
+			name:            "Wildcard host does not match the domain itself, denied by default",
+			request:         Request{Host: "example.com", Path: "/public/index.html", Method: "GET"},
+			expectedAllowed: false,
+		},
+		{
+			name:            "Member of the group, allowed",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "post"},
+			claims:          session.Claims{Email: "a@b.com", Extra: map[string]any{"groups": []any{"devs", "admins"}}},
+			expectedAllowed: true,
+			expectedRule:    "admin",
+		},
+		{
+			name:            "Allowed user by email, allowed",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "DELETE"},
+			claims:          session.Claims{Email: "Boss@Other.com", EmailVerified: true},
+			expectedAllowed: true,
+			expectedRule:    "admin",
+		},
+		{
+			name:            "Unverified email of the allowed user, denied",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "DELETE"},
+			claims:          session.Claims{Email: "boss@other.com"},
+			expectedAllowed: false,
+			expectedRule:    "admin",
+		},
+		{
+			name:            "Allowed user by ID, allowed",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "DELETE"},
+			claims:          session.Claims{UserID: 42},
+			expectedAllowed: true,
+			expectedRule:    "admin",
+		},
+		{
+			name:            "First matching rule decides, denied",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "POST"},
+			claims:          session.Claims{Email: "staff@example.com"},
+			expectedAllowed: false,
+			expectedRule:    "admin",
+		},
+		{
+			name:            "Email domain, allowed",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "GET"},
+			claims:          session.Claims{Email: "staff@example.com", EmailVerified: true},
+			expectedAllowed: true,
+			expectedRule:    "staff",
+		},
+		{
+			name:            "Unverified email of the domain, denied",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "GET"},
+			claims:          session.Claims{Email: "staff@example.com"},
+			expectedAllowed: false,
+			expectedRule:    "staff",
+		},
+		{
+			name:            "Email of a subdomain does not match the domain, denied",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "GET"},
+			claims:          session.Claims{Email: "staff@evil.example.com", EmailVerified: true},
+			expectedAllowed: false,
+			expectedRule:    "staff",
+		},
+		{
+			name:            "Role in the configured claim, allowed",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "GET"},
+			claims:          session.Claims{Extra: map[string]any{"app_roles": "auditor"}},
+			expectedAllowed: true,
+			expectedRule:    "staff",
+		},
+		{
+			name:            "Role assigned in Authorizer, allowed",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "GET"},
+			claims:          session.Claims{Roles: []string{"auditor"}},
+			expectedAllowed: true,
+			expectedRule:    "staff",
+		},
+		{
+			name:            "Public path in another case, allowed for all",
+			request:         Request{Host: "App.Example.com", Path: "/Public/index.html", Method: "GET"},
+			expectedAllowed: true,
+			expectedRule:    "public",
+		},
+		{
+			name:            "Role in the default claim is ignored, denied",
+			request:         Request{Host: "admin.example.com", Path: "/users", Method: "GET"},
+			claims:          session.Claims{Extra: map[string]any{"roles": []any{"auditor"}}},
+			expectedAllowed: false,
+			expectedRule:    "staff",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			decision := engine.Evaluate(tc.request, tc.claims)
+			require.Equal(t, tc.expectedAllowed, decision.Allowed, "Allowed does not match")
+			require.Equal(t, tc.expectedRule, decision.Rule, "Rule does not match")
+			require.False(t, decision.DryRun, "Expected no dry-run")
+		})
+	}
+}
+
+func TestEngine_Update(t *testing.T) {
+	// Without any policies, everything is allowed.
+	engine, err := NewEngine(config.Policies{})
+	require.NoError(t, err, "Expected no error in NewEngine")
+	require.Empty(t, engine.Claims(), "Expected no claims without rules")
+	require.True(t, engine.Evaluate(Request{}, session.Claims{}).Allowed, "Expected allowed without policies")
+
+	// Invalid policies are rejected, and the current ones stay.
+	for _, policies := range []config.Policies{
+		{Default: "maybe"},
+		{Rules: []config.PolicyRule{{Name: "relative", Paths: []string{"admin/*"}}}},
+	} {
+		require.Error(t, engine.Update(policies), "Expected error for invalid policies")
+		require.True(t, engine.Evaluate(Request{}, session.Claims{}).Allowed, "Expected the current policies to stay")
+	}
+
+	// Valid policies replace the current ones.
+	err = engine.Update(config.Policies{DryRun: true, Rules: []config.PolicyRule{{Name: "nobody", Users: []string{"0"}}}})
+	require.NoError(t, err, "Expected no error in Update")
+	require.Equal(t, []string{DefaultGroupsClaim, DefaultRolesClaim}, engine.Claims(), "Claims do not match")
+
+	decision := engine.Evaluate(Request{Path: "/"}, session.Claims{UserID: 1})
+	require.Equal(t, Decision{Allowed: false, Rule: "nobody", DryRun: true}, decision, "Decision does not match")
+}
@@ -1,9 +1,224 @@
 package repository
 
-func upsertUserQuery(u User) (string, []any) {
-	return `INSERT INTO users (email, given_name, family_name, picture_url) VALUES ($1, $2, $3, $4)
-ON CONFLICT (email) DO UPDATE SET
-	given_name = EXCLUDED.given_name,
-	family_name = EXCLUDED.family_name,
-	picture_url = EXCLUDED.picture_url`, []any{u.Email, u.GivenName, u.FamilyName, u.PictureURL}
+import (
+	"time"
+)
+
+// getIdentityUserIDQuery returns the ID of the user that the identity is linked to.
+func getIdentityUserIDQuery(provider, subject string) (string, []any) {
+	return `SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`, []any{provider, subject}
+}
+
+// upsertUserByEmailQuery inserts the user or, if the email is verified, fills the empty fields of the verified user
+// with the same email, and returns the stored user.
+//
+// Stored values are never overwritten, so that the user's details do not flip between their linked identities.
+// Filling the empty ones is still required because some providers send certain fields only sometimes.
+// For example, Apple sends the user's name only upon the first sign-in.
+//
+// Only the verified emails are unique, so an unverified one can not squat the email of its real owner. A user with an
+// unverified email is still not inserted if a verified user has the same email, in which case no row is returned.
+func upsertUserByEmailQuery(u User, emailVerified bool) (string, []any) {
+	return `INSERT INTO users (email, given_name, family_name, picture_url, email_verified)
+SELECT $1, $2, $3, $4, $5
+WHERE $5 OR NOT EXISTS (SELECT 1 FROM users WHERE email = $1 AND email_verified)
+ON CONFLICT (email) WHERE email_verified DO UPDATE SET
+	given_name = COALESCE(NULLIF(users.given_name, ''), EXCLUDED.given_name),
+	family_name = COALESCE(NULLIF(users.family_name, ''), EXCLUDED.family_name),
+	picture_url = COALESCE(NULLIF(users.picture_url, ''), EXCLUDED.picture_url)
+RETURNING id, email, given_name, family_name, COALESCE(picture_url, ''), email_verified, created_at, updated_at`,
+		[]any{u.Email, u.GivenName, u.FamilyName, u.PictureURL, emailVerified}
+}
+
+// claimUserQuery verifies the email of the unverified user with the given email that has no linked identities, fills
+// its empty fields, and returns it. No row is returned if there's none, or if a verified user has the same email.
+//
+// Such a user can only be left by the sign-ins that predate the identities, so it is claimed by the first verified
+// identity with its email.
+func claimUserQuery(u User) (string, []any) {
+	return `UPDATE users SET
+	email_verified = TRUE,
+	given_name = COALESCE(NULLIF(given_name, ''), $2),
+	family_name = COALESCE(NULLIF(family_name, ''), $3),
+	picture_url = COALESCE(NULLIF(picture_url, ''), $4)
+WHERE id = (
+	SELECT id FROM users WHERE email = $1 AND NOT email_verified
+	AND NOT EXISTS (SELECT 1 FROM user_identities WHERE user_identities.user_id = users.id)
+	ORDER BY id LIMIT 1
+) AND NOT EXISTS (SELECT 1 FROM users WHERE email = $1 AND email_verified)
+RETURNING id, email, given_name, family_name, COALESCE(picture_url, ''), email_verified, created_at, updated_at`,
+		[]any{u.Email, u.GivenName, u.FamilyName, u.PictureURL}
+}
+
+// fillUserQuery fills the empty fields of the user with the given ID, and returns the stored user.
+//
+// The user's email becomes verified if the given one is the same and verified, unless another user has it verified.
+func fillUserQuery(id int, u User, emailVerified bool) (string, []any) {
+	return `UPDATE users SET
+	given_name = COALESCE(NULLIF(given_name, ''), $2),
+	family_name = COALESCE(NULLIF(family_name, ''), $3),
+	picture_url = COALESCE(NULLIF(picture_url, ''), $4),
+	email_verified = email_verified OR ($6 AND email = $5
+		AND NOT EXISTS (SELECT 1 FROM users AS others WHERE others.email = $5 AND others.email_verified))
+WHERE id = $1
+RETURNING id, email, given_name, family_name, COALESCE(picture_url, ''), email_verified, created_at, updated_at`,
+		[]any{id, u.GivenName, u.FamilyName, u.PictureURL, u.Email, emailVerified}
+}
+
+// upsertIdentityQuery inserts the identity or updates the existing one, but only if it is linked to the same user.
+// So, no row is affected if the identity is linked to another user.
+func upsertIdentityQuery(i Identity) (string, []any) {
+	return `INSERT INTO user_identities (provider, subject, user_id, email, given_name, family_name, picture_url)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (provider, subject) DO UPDATE SET
+	email = EXCLUDED.email,
+	given_name = COALESCE(NULLIF(EXCLUDED.given_name, ''), user_identities.given_name),
+	family_name = COALESCE(NULLIF(EXCLUDED.family_name, ''), user_identities.family_name),
+	picture_url = COALESCE(NULLIF(EXCLUDED.picture_url, ''), user_identities.picture_url)
+WHERE user_identities.user_id = EXCLUDED.user_id`,
+		[]any{i.Provider, i.Subject, i.UserID, i.Email, i.GivenName, i.FamilyName, i.PictureURL}
+}
+
+// insertRoleQuery creates the role if it does not exist.
+func insertRoleQuery(role string) (string, []any) {
+	return `INSERT INTO roles (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, []any{role}
+}
+
+func insertUserRoleQuery(userID int, role string) (string, []any) {
+	return `INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT (user_id, role) DO NOTHING`,
+		[]any{userID, role}
+}
+
+// insertVacantUserRoleQuery assigns the role only if no user has it. So, no row is affected if another user has it.
+func insertVacantUserRoleQuery(userID int, role string) (string, []any) {
+	return `INSERT INTO user_roles (user_id, role) SELECT $1, $2
+WHERE NOT EXISTS (SELECT 1 FROM user_roles WHERE role = $2)
+ON CONFLICT (user_id, role) DO NOTHING`, []any{userID, role}
+}
+
+func deleteUserRoleQuery(userID int, role string) (string, []any) {
+	return `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, []any{userID, role}
+}
+
+func getUserRolesQuery(userID int) (string, []any) {
+	return `SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`, []any{userID}
+}
+
+func insertPermissionQuery(role, permission string) (string, []any) {
+	return `INSERT INTO permissions (role, name) VALUES ($1, $2) ON CONFLICT (role, name) DO NOTHING`,
+		[]any{role, permission}
+}
+
+func deletePermissionQuery(role, permission string) (string, []any) {
+	return `DELETE FROM permissions WHERE role = $1 AND name = $2`, []any{role, permission}
+}
+
+// getUserPermissionsQuery returns the permissions of all roles of the user, without duplicates.
+func getUserPermissionsQuery(userID int) (string, []any) {
+	return `SELECT DISTINCT permissions.name FROM permissions
+JOIN user_roles ON user_roles.role = permissions.role
+WHERE user_roles.user_id = $1 ORDER BY permissions.name`, []any{userID}
+}
+
+func insertOrganizationQuery(o Organization) (string, []any) {
+	return `INSERT INTO organizations (id, name) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`, []any{o.ID, o.Name}
+}
+
+func getOrganizationQuery(id string) (string, []any) {
+	return `SELECT id, name, created_at FROM organizations WHERE id = $1`, []any{id}
+}
+
+func deleteOrganizationQuery(id string) (string, []any) {
+	return `DELETE FROM organizations WHERE id = $1`, []any{id}
+}
+
+// upsertMembershipQuery inserts the membership or updates the role of the existing one, and returns its creation time.
+func upsertMembershipQuery(m Membership) (string, []any) {
+	return `INSERT INTO org_memberships (org_id, user_id, role) VALUES ($1, $2, $3)
+ON CONFLICT (org_id, user_id) DO UPDATE SET role = EXCLUDED.role
+RETURNING created_at`, []any{m.OrgID, m.UserID, m.Role}
+}
+
+func deleteMembershipQuery(orgID string, userID int) (string, []any) {
+	return `DELETE FROM org_memberships WHERE org_id = $1 AND user_id = $2`, []any{orgID, userID}
+}
+
+func getMembershipQuery(orgID string, userID int) (string, []any) {
+	return `SELECT org_id, user_id, role, created_at FROM org_memberships WHERE org_id = $1 AND user_id = $2`,
+		[]any{orgID, userID}
+}
+
+// upsertInvitationQuery inserts the invitation or replaces the pending one of the same email. Emails are stored in
+// lowercase, so that they match irrespective of their case.
+func upsertInvitationQuery(i Invitation) (string, []any) {
+	return `INSERT INTO org_invitations (org_id, email, role, expires_at) VALUES ($1, LOWER($2), $3, $4)
+ON CONFLICT (org_id, email) DO UPDATE SET
+	role = EXCLUDED.role,
+	created_at = CURRENT_TIMESTAMP,
+	expires_at = EXCLUDED.expires_at`, []any{i.OrgID, i.Email, i.Role, i.ExpiresAt}
+}
+
+// takeInvitationQuery deletes and returns the role of the unexpired invitation in one statement, so an invitation can
+// never be accepted twice.
+func takeInvitationQuery(orgID, email string) (string, []any) {
+	return `DELETE FROM org_invitations WHERE org_id = $1 AND email = LOWER($2) AND expires_at > CURRENT_TIMESTAMP
+RETURNING role`, []any{orgID, email}
+}
+
+func listSigningKeysQuery() (string, []any) {
+	return `SELECT id, private_key, created_at FROM signing_keys ORDER BY created_at DESC`, nil
+}
+
+func insertSigningKeyQuery(k SigningKey) (string, []any) {
+	return `INSERT INTO signing_keys (id, private_key, created_at) VALUES ($1, $2, $3)`,
+		[]any{k.ID, k.PrivateKey, k.CreatedAt}
+}
+
+func deleteSigningKeyQuery(id string) (string, []any) {
+	return `DELETE FROM signing_keys WHERE id = $1`, []any{id}
+}
+
+func insertSessionQuery(s Session) (string, []any) {
+	return `INSERT INTO sessions (id, user_id, provider, subject, refresh_token, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`, []any{s.ID, s.UserID, s.Provider, s.Subject, s.RefreshToken, s.CreatedAt,
+		s.ExpiresAt}
+}
+
+func getSessionQuery(id string) (string, []any) {
+	return `SELECT id, user_id, provider, subject, refresh_token, created_at, expires_at FROM sessions
+WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP`, []any{id}
+}
+
+func updateSessionRefreshTokenQuery(id, refreshToken string) (string, []any) {
+	return `UPDATE sessions SET refresh_token = $2 WHERE id = $1`, []any{id, refreshToken}
+}
+
+func deleteSessionQuery(id string) (string, []any) {
+	return `DELETE FROM sessions WHERE id = $1`, []any{id}
+}
+
+func deleteUserSessionsQuery(userID int) (string, []any) {
+	return `DELETE FROM sessions WHERE user_id = $1`, []any{userID}
+}
+
+func deleteExpiredSessionsQuery(before time.Time) (string, []any) {
+	return `DELETE FROM sessions WHERE expires_at < $1`, []any{before}
+}
+
+// insertOAuthStateQuery inserts the state only if there are fewer than maxStates unexpired ones, so that a flood of
+// sign-in attempts can not fill the table. Concurrent inserts may overshoot the limit slightly, which still bounds it.
+func insertOAuthStateQuery(s OAuthState, maxStates int) (string, []any) {
+	return `INSERT INTO oauth_states (key, value, expires_at)
+SELECT $1, $2::JSONB, $3::TIMESTAMPTZ
+WHERE $4::INTEGER <= 0 OR (SELECT COUNT(*) FROM oauth_states WHERE expires_at > CURRENT_TIMESTAMP) < $4::INTEGER`,
+		[]any{s.Key, s.Value, s.ExpiresAt, maxStates}
+}
+
+// takeOAuthStateQuery deletes and returns the state in one statement, so a state can never be taken twice.
+func takeOAuthStateQuery(key string) (string, []any) {
+	return `DELETE FROM oauth_states WHERE key = $1 RETURNING key, value, expires_at`, []any{key}
+}
+
+func deleteExpiredOAuthStatesQuery(before time.Time) (string, []any) {
+	return `DELETE FROM oauth_states WHERE expires_at <= $1`, []any{before}
 }
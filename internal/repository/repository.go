@@ -3,10 +3,22 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 )
 
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// ErrConflict is returned when a record conflicts with an existing one, for example, when an identity is already
+// linked to another user.
+var ErrConflict = errors.New("record conflicts with an existing one")
+
+// ErrLimitReached is returned when a record can not be inserted because there are too many of its kind.
+var ErrLimitReached = errors.New("limit of records reached")
+
 // User represents a single user in the database.
 type User struct {
 	ID         int    `json:"id"`
@@ -14,13 +26,175 @@ type User struct {
 	GivenName  string `json:"given_name"`
 	FamilyName string `json:"family_name"`
 	PictureURL string `json:"picture_url"`
-	CreatedAt  string `json:"created_at"`
-	UpdatedAt  string `json:"updated_at"`
+	// EmailVerified tells whether a provider verified the user's email.
+	EmailVerified bool   `json:"email_verified"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+// Identity represents a user's account on a provider, which is linked to a single user.
+//
+// A user can have identities on multiple providers, and they can sign in with any of them.
+type Identity struct {
+	// Provider is the name of the provider.
+	Provider string `json:"provider"`
+	// Subject is the user's ID on the provider, that is, the "sub" claim.
+	Subject string `json:"subject"`
+	UserID  int    `json:"user_id"`
+	// Email, GivenName, FamilyName and PictureURL are the user's details on the provider.
+	Email      string `json:"email"`
+	GivenName  string `json:"given_name"`
+	FamilyName string `json:"family_name"`
+	PictureURL string `json:"picture_url"`
+	// EmailVerified tells whether the provider verified the email. It is not stored, and only decides whether the
+	// identity may be linked to the user with the same email, and whether the user's email is verified.
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Organization represents a customer company served by Authorizer, whose users are its members.
+type Organization struct {
+	// ID is chosen upon creation. It is the "org" parameter of the sign-in, so it should be short and readable.
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Membership represents a user's membership of an organization.
+type Membership struct {
+	OrgID  string `json:"org_id"`
+	UserID int    `json:"user_id"`
+	// Role is the user's role in the organization. It is independent of their roles in Authorizer.
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Invitation represents an invitation of an email to an organization. It becomes a membership upon the sign-in of
+// the user with that email to the organization.
+type Invitation struct {
+	OrgID string `json:"org_id"`
+	Email string `json:"email"`
+	// Role is the role of the membership that the invitation becomes.
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SigningKey represents a private key that signs the session tokens.
+type SigningKey struct {
+	// ID is the "kid" of the key.
+	ID string `json:"id"`
+	// PrivateKey is the PEM encoded private key.
+	PrivateKey string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Session represents a server-side session of a user. A session token is valid only while its session exists.
+type Session struct {
+	// ID is the "sid" claim of the session token.
+	ID     string `json:"id"`
+	UserID int    `json:"user_id"`
+	// Provider is the name of the provider that the user signed in with.
+	Provider string `json:"provider"`
+	// Subject is the "sub" claim of the provider's identity that the user signed in with.
+	Subject string `json:"subject"`
+	// RefreshToken is the provider's refresh token, encrypted. It is empty if the provider did not issue one.
+	RefreshToken string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	// ExpiresAt is the absolute expiry of the session. Its tokens may expire earlier, but they are renewed.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OAuthState represents the state of an OAuth flow, between the redirect to the provider and its callback.
+type OAuthState struct {
+	Key string `json:"key"`
+	// Value is the JSON encoded contextual info of the flow.
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // Repository encapsulates all operations available on the database.
 type Repository interface {
-	UpsertUser(ctx context.Context, user User) error
+	// UpsertUserByIdentity returns the user that the given identity is linked to, and updates the identity.
+	//
+	// A new identity is linked to a new user, or to the user with the same email if both emails are verified. A new
+	// identity with a verified email also claims the unverified user with the same email that has no linked
+	// identities. It returns ErrConflict if an unverified email belongs to a verified user. The user's details are
+	// taken from the identity only where they are empty, and the user's email becomes verified once an identity
+	// verifies it.
+	UpsertUserByIdentity(ctx context.Context, identity Identity) (User, error)
+	// LinkIdentity links the given identity to its user ID. It returns ErrConflict if the identity is already linked
+	// to another user.
+	LinkIdentity(ctx context.Context, identity Identity) error
+	// GetIdentityUserID returns the ID of the user that the given identity is linked to. It returns ErrNotFound if
+	// the identity is not linked.
+	GetIdentityUserID(ctx context.Context, provider, subject string) (int, error)
+
+	// AssignRole assigns the given role to the given user. The role is created if it does not exist.
+	AssignRole(ctx context.Context, userID int, role string) error
+	// AssignRoleIfVacant assigns the given role to the given user only if no user has it, and tells whether it was
+	// assigned. The role is created if it does not exist.
+	AssignRoleIfVacant(ctx context.Context, userID int, role string) (bool, error)
+	// RevokeRole revokes the given role from the given user.
+	RevokeRole(ctx context.Context, userID int, role string) error
+	// GetUserRoles returns the names of the roles of the given user, sorted.
+	GetUserRoles(ctx context.Context, userID int) ([]string, error)
+	// GrantPermission grants the given permission to the given role. The role is created if it does not exist.
+	GrantPermission(ctx context.Context, role, permission string) error
+	// RevokePermission revokes the given permission from the given role.
+	RevokePermission(ctx context.Context, role, permission string) error
+	// GetUserPermissions returns the names of the permissions that the given user has through their roles, sorted.
+	GetUserPermissions(ctx context.Context, userID int) ([]string, error)
+
+	// CreateOrganization creates the given organization. It returns ErrConflict if one with the same ID exists.
+	CreateOrganization(ctx context.Context, org Organization) error
+	// GetOrganization returns the organization with the given ID. It returns ErrNotFound if there's none.
+	GetOrganization(ctx context.Context, id string) (Organization, error)
+	// DeleteOrganization deletes the organization with the given ID, along with its memberships and invitations.
+	DeleteOrganization(ctx context.Context, id string) error
+	// AddMember adds the user of the given membership to its organization, or updates the role of an existing member.
+	AddMember(ctx context.Context, membership Membership) error
+	// RemoveMember removes the given user from the given organization.
+	RemoveMember(ctx context.Context, orgID string, userID int) error
+	// GetMembership returns the membership of the given user in the given organization. It returns ErrNotFound if
+	// the user is not a member.
+	GetMembership(ctx context.Context, orgID string, userID int) (Membership, error)
+	// InviteMember invites the email of the given invitation to its organization, replacing any pending invitation of
+	// that email. Emails are case-insensitive.
+	InviteMember(ctx context.Context, invitation Invitation) error
+	// AcceptInvitation turns the unexpired invitation of the given email to the given organization into a membership
+	// of the given user, and returns it. It returns ErrNotFound if there's no such invitation.
+	AcceptInvitation(ctx context.Context, orgID string, userID int, email string) (Membership, error)
+
+	// ListSigningKeys lists all signing keys, newest first.
+	ListSigningKeys(ctx context.Context) ([]SigningKey, error)
+	// InsertSigningKey inserts a new signing key.
+	InsertSigningKey(ctx context.Context, key SigningKey) error
+	// DeleteSigningKey deletes the signing key with the given ID.
+	DeleteSigningKey(ctx context.Context, id string) error
+
+	// InsertSession inserts a new session.
+	InsertSession(ctx context.Context, session Session) error
+	// GetSession returns the unexpired session with the given ID. It returns ErrNotFound if there's none.
+	GetSession(ctx context.Context, id string) (Session, error)
+	// UpdateSessionRefreshToken replaces the refresh token of the session with the given ID.
+	UpdateSessionRefreshToken(ctx context.Context, id, refreshToken string) error
+	// DeleteSession deletes the session with the given ID.
+	DeleteSession(ctx context.Context, id string) error
+	// DeleteUserSessions deletes all sessions of the given user.
+	DeleteUserSessions(ctx context.Context, userID int) error
+	// DeleteExpiredSessions deletes the sessions that expired before the given time, and returns their count.
+	DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error)
+
+	// InsertOAuthState inserts a new OAuth state, as long as there are fewer than maxStates unexpired ones. It returns
+	// ErrLimitReached otherwise. A maxStates that is not positive removes the limit.
+	InsertOAuthState(ctx context.Context, state OAuthState, maxStates int) error
+	// TakeOAuthState atomically returns and deletes the OAuth state with the given key, irrespective of its expiry.
+	// It returns ErrNotFound if there's none.
+	TakeOAuthState(ctx context.Context, key string) (OAuthState, error)
+	// DeleteExpiredOAuthStates deletes the OAuth states that expired by the given time, and returns their count.
+	DeleteExpiredOAuthStates(ctx context.Context, before time.Time) (int64, error)
 }
 
 // repository implements Repository.
@@ -33,18 +207,521 @@ func NewRepository(database *sql.DB) Repository {
 	return &repository{database: database}
 }
 
-func (r *repository) UpsertUser(ctx context.Context, user User) error {
+func (r *repository) UpsertUserByIdentity(ctx context.Context, identity Identity) (User, error) {
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, fmt.Errorf("error in database.BeginTx call: %w", err)
+	}
+	// This is a no-op after commit.
+	defer func() { _ = tx.Rollback() }()
+
+	profile := User{Email: identity.Email, GivenName: identity.GivenName, FamilyName: identity.FamilyName,
+		PictureURL: identity.PictureURL}
+
+	// Find the user that the identity is linked to.
+	var userID int
+	var stored User
+	var found bool
+	query, args := getIdentityUserIDQuery(identity.Provider, identity.Subject)
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&userID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return User{}, fmt.Errorf("error in query execution: %w", err)
+		}
+
+		// A new identity with a verified email first claims the user that was left without identities, if any.
+		if identity.EmailVerified {
+			query, args = claimUserQuery(profile)
+			if found, err = scanUser(tx.QueryRowContext(ctx, query, args...), &stored); err != nil {
+				return User{}, fmt.Errorf("error in query execution: %w", err)
+			}
+		}
+
+		// Otherwise, it belongs to the user with the same email, if any, as long as both emails are verified.
+		query, args = upsertUserByEmailQuery(profile, identity.EmailVerified)
+	} else {
+		query, args = fillUserQuery(userID, profile, identity.EmailVerified)
+	}
+
+	// Scan the stored user, unless it is already claimed.
+	if !found {
+		if found, err = scanUser(tx.QueryRowContext(ctx, query, args...), &stored); err != nil {
+			return User{}, fmt.Errorf("error in query execution: %w", err)
+		}
+		// The email belongs to a user that the identity can not be linked to.
+		if !found {
+			return User{}, ErrConflict
+		}
+	}
+
+	// Link or update the identity.
+	identity.UserID = stored.ID
+	query, args = upsertIdentityQuery(identity)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return User{}, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return User{}, fmt.Errorf("error in tx.Commit call: %w", err)
+	}
+
+	slog.InfoContext(ctx, "user upserted successfully", "id", stored.ID, "provider", identity.Provider)
+	return stored, nil
+}
+
+// scanUser scans the user returned by the given row. It returns false if there's no row.
+func scanUser(row *sql.Row, user *User) (bool, error) {
+	if err := row.Scan(&user.ID, &user.Email, &user.GivenName, &user.FamilyName, &user.PictureURL, &user.EmailVerified,
+		&user.CreatedAt, &user.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *repository) LinkIdentity(ctx context.Context, identity Identity) error {
 	// Form and execute query.
-	query, args := upsertUserQuery(user)
+	query, args := upsertIdentityQuery(identity)
 	result, err := r.database.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("error in query execution: %w", err)
 	}
 
-	// Parameters for logging.
-	id, _ := result.LastInsertId()
-	af, _ := result.RowsAffected()
+	// No row is affected if the identity is linked to another user.
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrConflict
+	}
 
-	slog.InfoContext(ctx, "user upserted successfully", "id", id, "rows-affected", af)
+	slog.InfoContext(ctx, "identity linked successfully", "user_id", identity.UserID, "provider", identity.Provider)
 	return nil
 }
+
+func (r *repository) GetIdentityUserID(ctx context.Context, provider, subject string) (int, error) {
+	// Form and execute query.
+	query, args := getIdentityUserIDQuery(provider, subject)
+	row := r.database.QueryRowContext(ctx, query, args...)
+
+	var userID int
+	if err := row.Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	return userID, nil
+}
+
+func (r *repository) AssignRole(ctx context.Context, userID int, role string) error {
+	query, args := insertUserRoleQuery(userID, role)
+	if _, err := r.execWithRole(ctx, role, query, args); err != nil {
+		return fmt.Errorf("error in execWithRole call: %w", err)
+	}
+
+	slog.InfoContext(ctx, "role assigned successfully", "user_id", userID, "role", role)
+	return nil
+}
+
+func (r *repository) AssignRoleIfVacant(ctx context.Context, userID int, role string) (bool, error) {
+	query, args := insertVacantUserRoleQuery(userID, role)
+	count, err := r.execWithRole(ctx, role, query, args)
+	if err != nil {
+		return false, fmt.Errorf("error in execWithRole call: %w", err)
+	}
+
+	// No row is affected if another user has the role.
+	if count == 0 {
+		return false, nil
+	}
+
+	slog.InfoContext(ctx, "vacant role assigned successfully", "user_id", userID, "role", role)
+	return true, nil
+}
+
+func (r *repository) RevokeRole(ctx context.Context, userID int, role string) error {
+	// Form and execute query.
+	query, args := deleteUserRoleQuery(userID, role)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "role revoked successfully", "user_id", userID, "role", role)
+	return nil
+}
+
+func (r *repository) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	query, args := getUserRolesQuery(userID)
+	return r.queryNames(ctx, query, args)
+}
+
+func (r *repository) GrantPermission(ctx context.Context, role, permission string) error {
+	query, args := insertPermissionQuery(role, permission)
+	if _, err := r.execWithRole(ctx, role, query, args); err != nil {
+		return fmt.Errorf("error in execWithRole call: %w", err)
+	}
+
+	slog.InfoContext(ctx, "permission granted successfully", "role", role, "permission", permission)
+	return nil
+}
+
+func (r *repository) RevokePermission(ctx context.Context, role, permission string) error {
+	// Form and execute query.
+	query, args := deletePermissionQuery(role, permission)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "permission revoked successfully", "role", role, "permission", permission)
+	return nil
+}
+
+func (r *repository) GetUserPermissions(ctx context.Context, userID int) ([]string, error) {
+	query, args := getUserPermissionsQuery(userID)
+	return r.queryNames(ctx, query, args)
+}
+
+// execWithRole creates the given role if it does not exist, and executes the given query in the same transaction.
+// It returns the count of the rows affected by the query.
+func (r *repository) execWithRole(ctx context.Context, role, query string, args []any) (int64, error) {
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error in database.BeginTx call: %w", err)
+	}
+	// This is a no-op after commit.
+	defer func() { _ = tx.Rollback() }()
+
+	roleQuery, roleArgs := insertRoleQuery(role)
+	if _, err := tx.ExecContext(ctx, roleQuery, roleArgs...); err != nil {
+		return 0, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error in tx.Commit call: %w", err)
+	}
+
+	count, _ := result.RowsAffected()
+	return count, nil
+}
+
+// queryNames executes the given query that selects a single column of names, and returns them.
+func (r *repository) queryNames(ctx context.Context, query string, args []any) ([]string, error) {
+	rows, err := r.database.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error in query execution: %w", err)
+	}
+	// Close rows upon return.
+	defer func() { _ = rows.Close() }()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error in rows.Scan call: %w", err)
+		}
+		names = append(names, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in rows iteration: %w", err)
+	}
+
+	return names, nil
+}
+
+func (r *repository) CreateOrganization(ctx context.Context, org Organization) error {
+	// Form and execute query.
+	query, args := insertOrganizationQuery(org)
+	result, err := r.database.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	// No row is affected if the ID is taken.
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrConflict
+	}
+
+	slog.InfoContext(ctx, "organization created successfully", "id", org.ID)
+	return nil
+}
+
+func (r *repository) GetOrganization(ctx context.Context, id string) (Organization, error) {
+	// Form and execute query.
+	query, args := getOrganizationQuery(id)
+	row := r.database.QueryRowContext(ctx, query, args...)
+
+	var org Organization
+	if err := row.Scan(&org.ID, &org.Name, &org.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Organization{}, ErrNotFound
+		}
+		return Organization{}, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	return org, nil
+}
+
+func (r *repository) DeleteOrganization(ctx context.Context, id string) error {
+	// Form and execute query.
+	query, args := deleteOrganizationQuery(id)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "organization deleted successfully", "id", id)
+	return nil
+}
+
+func (r *repository) AddMember(ctx context.Context, membership Membership) error {
+	// Form and execute query.
+	query, args := upsertMembershipQuery(membership)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "member added successfully", "org_id", membership.OrgID, "user_id", membership.UserID,
+		"role", membership.Role)
+	return nil
+}
+
+func (r *repository) RemoveMember(ctx context.Context, orgID string, userID int) error {
+	// Form and execute query.
+	query, args := deleteMembershipQuery(orgID, userID)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "member removed successfully", "org_id", orgID, "user_id", userID)
+	return nil
+}
+
+func (r *repository) GetMembership(ctx context.Context, orgID string, userID int) (Membership, error) {
+	// Form and execute query.
+	query, args := getMembershipQuery(orgID, userID)
+	row := r.database.QueryRowContext(ctx, query, args...)
+
+	var membership Membership
+	if err := row.Scan(&membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Membership{}, ErrNotFound
+		}
+		return Membership{}, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	return membership, nil
+}
+
+func (r *repository) InviteMember(ctx context.Context, invitation Invitation) error {
+	// Form and execute query.
+	query, args := upsertInvitationQuery(invitation)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "member invited successfully", "org_id", invitation.OrgID, "role", invitation.Role)
+	return nil
+}
+
+func (r *repository) AcceptInvitation(ctx context.Context, orgID string, userID int, email string) (Membership, error) {
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return Membership{}, fmt.Errorf("error in database.BeginTx call: %w", err)
+	}
+	// This is a no-op after commit.
+	defer func() { _ = tx.Rollback() }()
+
+	// The invitation is taken, so that it can not be accepted twice.
+	membership := Membership{OrgID: orgID, UserID: userID}
+	query, args := takeInvitationQuery(orgID, email)
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&membership.Role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Membership{}, ErrNotFound
+		}
+		return Membership{}, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	query, args = upsertMembershipQuery(membership)
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&membership.CreatedAt); err != nil {
+		return Membership{}, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Membership{}, fmt.Errorf("error in tx.Commit call: %w", err)
+	}
+
+	slog.InfoContext(ctx, "invitation accepted successfully", "org_id", orgID, "user_id", userID)
+	return membership, nil
+}
+
+func (r *repository) ListSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	// Form and execute query.
+	query, args := listSigningKeysQuery()
+	rows, err := r.database.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error in query execution: %w", err)
+	}
+	// Close rows upon return.
+	defer func() { _ = rows.Close() }()
+
+	var keys []SigningKey
+	for rows.Next() {
+		var key SigningKey
+		if err := rows.Scan(&key.ID, &key.PrivateKey, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error in rows.Scan call: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in rows iteration: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (r *repository) InsertSigningKey(ctx context.Context, key SigningKey) error {
+	// Form and execute query.
+	query, args := insertSigningKeyQuery(key)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "signing key inserted successfully", "id", key.ID)
+	return nil
+}
+
+func (r *repository) DeleteSigningKey(ctx context.Context, id string) error {
+	// Form and execute query.
+	query, args := deleteSigningKeyQuery(id)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "signing key deleted successfully", "id", id)
+	return nil
+}
+
+func (r *repository) InsertSession(ctx context.Context, session Session) error {
+	// Form and execute query.
+	query, args := insertSessionQuery(session)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "session inserted successfully", "id", session.ID, "user_id", session.UserID)
+	return nil
+}
+
+func (r *repository) GetSession(ctx context.Context, id string) (Session, error) {
+	// Form and execute query.
+	query, args := getSessionQuery(id)
+	row := r.database.QueryRowContext(ctx, query, args...)
+
+	var session Session
+	if err := row.Scan(&session.ID, &session.UserID, &session.Provider, &session.Subject, &session.RefreshToken,
+		&session.CreatedAt, &session.ExpiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Session{}, ErrNotFound
+		}
+		return Session{}, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	return session, nil
+}
+
+func (r *repository) UpdateSessionRefreshToken(ctx context.Context, id, refreshToken string) error {
+	// Form and execute query.
+	query, args := updateSessionRefreshTokenQuery(id, refreshToken)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "session refresh token updated successfully", "id", id)
+	return nil
+}
+
+func (r *repository) DeleteSession(ctx context.Context, id string) error {
+	// Form and execute query.
+	query, args := deleteSessionQuery(id)
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	slog.InfoContext(ctx, "session deleted successfully", "id", id)
+	return nil
+}
+
+func (r *repository) DeleteUserSessions(ctx context.Context, userID int) error {
+	// Form and execute query.
+	query, args := deleteUserSessionsQuery(userID)
+	result, err := r.database.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	count, _ := result.RowsAffected()
+	slog.InfoContext(ctx, "user sessions deleted successfully", "user_id", userID, "count", count)
+	return nil
+}
+
+func (r *repository) DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	// Form and execute query.
+	query, args := deleteExpiredSessionsQuery(before)
+	result, err := r.database.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	count, _ := result.RowsAffected()
+	return count, nil
+}
+
+func (r *repository) InsertOAuthState(ctx context.Context, state OAuthState, maxStates int) error {
+	// Form and execute query.
+	query, args := insertOAuthStateQuery(state, maxStates)
+	result, err := r.database.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error in query execution: %w", err)
+	}
+
+	// No row is inserted if there are too many unexpired states.
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrLimitReached
+	}
+
+	return nil
+}
+
+func (r *repository) TakeOAuthState(ctx context.Context, key string) (OAuthState, error) {
+	// Form and execute query.
+	query, args := takeOAuthStateQuery(key)
+	row := r.database.QueryRowContext(ctx, query, args...)
+
+	var state OAuthState
+	if err := row.Scan(&state.Key, &state.Value, &state.ExpiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return OAuthState{}, ErrNotFound
+		}
+		return OAuthState{}, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	return state, nil
+}
+
+func (r *repository) DeleteExpiredOAuthStates(ctx context.Context, before time.Time) (int64, error) {
+	// Form and execute query.
+	query, args := deleteExpiredOAuthStatesQuery(before)
+	result, err := r.database.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error in query execution: %w", err)
+	}
+
+	count, _ := result.RowsAffected()
+	return count, nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/require"
@@ -21,31 +22,1665 @@ func TestNewRepository(t *testing.T) {
 	require.NotNil(t, repo, "Repository is nil")
 }
 
-func TestUpsertUser(t *testing.T) {
+func TestUpsertUserByIdentity(t *testing.T) {
 	// Common mock params for testing.
-	mUser := User{Email: "test@hey.com", GivenName: "John", FamilyName: "Doe", PictureURL: "https://hey.com/pic.jpg"}
-	mQuery, mArgs := upsertUserQuery(mUser)
+	mIdentity := Identity{Provider: "google", Subject: "mockSubject", Email: "test@hey.com", GivenName: "John",
+		FamilyName: "Doe", PictureURL: "https://hey.com/pic.jpg", EmailVerified: true}
+	mProfile := User{Email: mIdentity.Email, GivenName: mIdentity.GivenName, FamilyName: mIdentity.FamilyName,
+		PictureURL: mIdentity.PictureURL}
+
+	// The user as stored in the database.
+	mStored := mProfile
+	mStored.ID, mStored.CreatedAt, mStored.UpdatedAt = 1, "2025-01-01T00:00:00Z", "2025-01-02T00:00:00Z"
+	mStored.EmailVerified = true
+	// Columns returned by the user queries.
+	columns := []string{"id", "email", "given_name", "family_name", "picture_url", "email_verified", "created_at",
+		"updated_at"}
+	storedRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows(columns).AddRow(mStored.ID, mStored.Email, mStored.GivenName, mStored.FamilyName,
+			mStored.PictureURL, mStored.EmailVerified, mStored.CreatedAt, mStored.UpdatedAt)
+	}
+
+	// Queries in the order of their execution.
+	getQuery, getArgs := getIdentityUserIDQuery(mIdentity.Provider, mIdentity.Subject)
+	getQuery = regexp.QuoteMeta(getQuery)
+	claimQuery, claimArgs := claimUserQuery(mProfile)
+	claimQuery = regexp.QuoteMeta(claimQuery)
+	// The upsert arguments depend upon the verification of the email, so they are set by expectUpsert.
+	upsertQuery, _ := upsertUserByEmailQuery(mProfile, true)
+	upsertQuery = regexp.QuoteMeta(upsertQuery)
+	fillQuery, fillArgs := fillUserQuery(mStored.ID, mProfile, true)
+	fillQuery = regexp.QuoteMeta(fillQuery)
+	linkedIdentity := mIdentity
+	linkedIdentity.UserID = mStored.ID
+	identityQuery, identityArgs := upsertIdentityQuery(linkedIdentity)
+	identityQuery = regexp.QuoteMeta(identityQuery)
+
+	// expectIdentityLookup expects the identity to be looked up, and found linked to the given users.
+	expectIdentityLookup := func(mock sqlmock.Sqlmock, userIDs ...int) {
+		rows := sqlmock.NewRows([]string{"user_id"})
+		for _, userID := range userIDs {
+			rows.AddRow(userID)
+		}
+		mock.ExpectQuery(getQuery).WithArgs(getArgs[0], getArgs[1]).WillReturnRows(rows)
+	}
+	// expectClaim expects the user without identities to be claimed.
+	expectClaim := func(mock sqlmock.Sqlmock) *sqlmock.ExpectedQuery {
+		return mock.ExpectQuery(claimQuery).WithArgs(claimArgs[0], claimArgs[1], claimArgs[2], claimArgs[3])
+	}
+	// expectUpsert expects the user to be upserted by email, with the given verification of the email.
+	expectUpsert := func(mock sqlmock.Sqlmock, emailVerified bool) *sqlmock.ExpectedQuery {
+		return mock.ExpectQuery(upsertQuery).WithArgs(mProfile.Email, mProfile.GivenName, mProfile.FamilyName,
+			mProfile.PictureURL, emailVerified)
+	}
+	// expectIdentityUpsert expects the identity to be linked to the stored user.
+	expectIdentityUpsert := func(mock sqlmock.Sqlmock) *sqlmock.ExpectedExec {
+		return mock.ExpectExec(identityQuery).WithArgs(identityArgs[0], identityArgs[1], identityArgs[2],
+			identityArgs[3], identityArgs[4], identityArgs[5], identityArgs[6])
+	}
+
+	for _, tc := range []struct {
+		name     string
+		mockFunc func(mock sqlmock.Sqlmock)
+		// Parameter to control if the identity's email is unverified.
+		unverified   bool
+		expectedUser User
+		expectedErr  error
+		errExpected  bool
+	}{
+		{
+			name: "New identity, user upserted by email, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIdentityLookup(mock)
+				expectClaim(mock).WillReturnRows(sqlmock.NewRows(columns))
+				expectUpsert(mock, true).WillReturnRows(storedRow())
+				expectIdentityUpsert(mock).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedUser: mStored,
+			errExpected:  false,
+		},
+		{
+			name: "New identity, user without identities claimed, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIdentityLookup(mock)
+				expectClaim(mock).WillReturnRows(storedRow())
+				expectIdentityUpsert(mock).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedUser: mStored,
+			errExpected:  false,
+		},
+		{
+			name: "New identity with unverified email, separate user inserted, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIdentityLookup(mock)
+				expectUpsert(mock, false).WillReturnRows(storedRow())
+				expectIdentityUpsert(mock).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			unverified:   true,
+			expectedUser: mStored,
+			errExpected:  false,
+		},
+		{
+			name: "New identity with unverified email of a verified user, ErrConflict expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIdentityLookup(mock)
+				expectUpsert(mock, false).WillReturnRows(sqlmock.NewRows(columns))
+				mock.ExpectRollback()
+			},
+			unverified:  true,
+			expectedErr: ErrConflict,
+			errExpected: true,
+		},
+		{
+			name: "Known identity with verified email, user filled and verified, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIdentityLookup(mock, mStored.ID)
+				mock.ExpectQuery(fillQuery).
+					WithArgs(fillArgs[0], fillArgs[1], fillArgs[2], fillArgs[3], fillArgs[4], fillArgs[5]).
+					WillReturnRows(storedRow())
+				expectIdentityUpsert(mock).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedUser: mStored,
+			errExpected:  false,
+		},
+		{
+			name: "Identity lookup fails, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(getQuery).WithArgs(getArgs[0], getArgs[1]).WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			errExpected: true,
+		},
+		{
+			name: "User claim fails, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIdentityLookup(mock)
+				expectClaim(mock).WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			errExpected: true,
+		},
+		{
+			name: "User upsert fails, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIdentityLookup(mock)
+				expectClaim(mock).WillReturnRows(sqlmock.NewRows(columns))
+				expectUpsert(mock, true).WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			errExpected: true,
+		},
+		{
+			name: "Identity upsert fails, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIdentityLookup(mock)
+				expectClaim(mock).WillReturnRows(sqlmock.NewRows(columns))
+				expectUpsert(mock, true).WillReturnRows(storedRow())
+				expectIdentityUpsert(mock).WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			// Create a new mock database for each test.
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			// Set up the mock expectations.
+			tc.mockFunc(mock)
+			// Create a new repository with the mock DB.
+			repo := NewRepository(db)
+
+			// Execute the test.
+			identity := mIdentity
+			identity.EmailVerified = !tc.unverified
+			user, err := repo.UpsertUserByIdentity(context.Background(), identity)
+
+			// Check the results.
+			if tc.errExpected {
+				require.Error(t, err, "UpsertUserByIdentity should have returned an error")
+				if tc.expectedErr != nil {
+					require.ErrorIs(t, err, tc.expectedErr, "Error does not match")
+				}
+			} else {
+				require.NoError(t, err, "UpsertUserByIdentity should not have returned an error")
+				require.Equal(t, tc.expectedUser, user, "Returned user does not match")
+			}
+
+			// Ensure all expectations were met.
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err, "Expectations were not met")
+		})
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	mIdentity := Identity{Provider: "github", Subject: "1", UserID: 1, Email: "test@hey.com"}
+	mQuery, mArgs := upsertIdentityQuery(mIdentity)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		expectedErr error
+		errExpected bool
+	}{
+		{
+			name: "Identity linked, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3], mArgs[4], mArgs[5], mArgs[6]).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Identity linked to another user, ErrConflict expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3], mArgs[4], mArgs[5], mArgs[6]).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedErr: ErrConflict,
+			errExpected: true,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3], mArgs[4], mArgs[5], mArgs[6]).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).LinkIdentity(context.Background(), mIdentity)
+
+			if tc.errExpected {
+				require.ErrorIs(t, err, tc.expectedErr, "LinkIdentity returned an unexpected error")
+			} else {
+				require.NoError(t, err, "LinkIdentity should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestGetIdentityUserID(t *testing.T) {
+	const provider, subject, userID = "github", "1", 42
+	mQuery, mArgs := getIdentityUserIDQuery(provider, subject)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name           string
+		mockFunc       func(mock sqlmock.Sqlmock)
+		expectedUserID int
+		expectedErr    error
+		errExpected    bool
+	}{
+		{
+			name: "Identity found, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0], mArgs[1]).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
+			},
+			expectedUserID: userID,
+			errExpected:    false,
+		},
+		{
+			name: "Identity not found, ErrNotFound expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+			},
+			expectedErr: ErrNotFound,
+			errExpected: true,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			id, err := NewRepository(db).GetIdentityUserID(context.Background(), provider, subject)
+
+			if tc.errExpected {
+				require.ErrorIs(t, err, tc.expectedErr, "GetIdentityUserID returned an unexpected error")
+			} else {
+				require.NoError(t, err, "GetIdentityUserID should not have returned an error")
+				require.Equal(t, tc.expectedUserID, id, "Returned user ID does not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestListSigningKeys(t *testing.T) {
+	mQuery, _ := listSigningKeysQuery()
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	mKeys := []SigningKey{
+		{ID: "new", PrivateKey: "newPEM", CreatedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{ID: "old", PrivateKey: "oldPEM", CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	columns := []string{"id", "private_key", "created_at"}
+
+	for _, tc := range []struct {
+		name         string
+		mockFunc     func(mock sqlmock.Sqlmock)
+		expectedKeys []SigningKey
+		errExpected  bool
+	}{
+		{
+			name: "Keys listed, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(columns)
+				for _, k := range mKeys {
+					rows.AddRow(k.ID, k.PrivateKey, k.CreatedAt)
+				}
+				mock.ExpectQuery(mQuery).WillReturnRows(rows)
+			},
+			expectedKeys: mKeys,
+			errExpected:  false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			keys, err := NewRepository(db).ListSigningKeys(context.Background())
+
+			if tc.errExpected {
+				require.Error(t, err, "ListSigningKeys should have returned an error")
+			} else {
+				require.NoError(t, err, "ListSigningKeys should not have returned an error")
+				require.Equal(t, tc.expectedKeys, keys, "Returned keys do not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestInsertSigningKey(t *testing.T) {
+	mKey := SigningKey{ID: "mockKeyID", PrivateKey: "mockPEM", CreatedAt: time.Now()}
+	mQuery, mArgs := insertSigningKeyQuery(mKey)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Successful insert, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2]).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2]).
+					WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).InsertSigningKey(context.Background(), mKey)
+
+			if tc.errExpected {
+				require.Error(t, err, "InsertSigningKey should have returned an error")
+			} else {
+				require.NoError(t, err, "InsertSigningKey should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestDeleteSigningKey(t *testing.T) {
+	mQuery, mArgs := deleteSigningKeyQuery("mockKeyID")
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Successful delete, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).DeleteSigningKey(context.Background(), "mockKeyID")
+
+			if tc.errExpected {
+				require.Error(t, err, "DeleteSigningKey should have returned an error")
+			} else {
+				require.NoError(t, err, "DeleteSigningKey should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestInsertSession(t *testing.T) {
+	mSession := Session{ID: "mockSessionID", UserID: 1, Provider: "google", Subject: "mockSubject",
+		RefreshToken: "mockSealedToken", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	mQuery, mArgs := insertSessionQuery(mSession)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Successful insert, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3], mArgs[4], mArgs[5], mArgs[6]).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3], mArgs[4], mArgs[5], mArgs[6]).
+					WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).InsertSession(context.Background(), mSession)
+
+			if tc.errExpected {
+				require.Error(t, err, "InsertSession should have returned an error")
+			} else {
+				require.NoError(t, err, "InsertSession should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestGetSession(t *testing.T) {
+	mSession := Session{ID: "mockSessionID", UserID: 1, Provider: "google", Subject: "mockSubject",
+		RefreshToken: "mockSealedToken", CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)}
+	mQuery, mArgs := getSessionQuery(mSession.ID)
+	mQuery = regexp.QuoteMeta(mQuery)
+	columns := []string{"id", "user_id", "provider", "subject", "refresh_token", "created_at", "expires_at"}
+
+	for _, tc := range []struct {
+		name            string
+		mockFunc        func(mock sqlmock.Sqlmock)
+		expectedSession Session
+		expectedErr     error
+		errExpected     bool
+	}{
+		{
+			name: "Session found, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(mSession.ID, mSession.UserID, mSession.Provider,
+						mSession.Subject, mSession.RefreshToken, mSession.CreatedAt, mSession.ExpiresAt))
+			},
+			expectedSession: mSession,
+			errExpected:     false,
+		},
+		{
+			name: "Session not found, ErrNotFound expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).WillReturnRows(sqlmock.NewRows(columns))
+			},
+			expectedErr: ErrNotFound,
+			errExpected: true,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			session, err := NewRepository(db).GetSession(context.Background(), mSession.ID)
+
+			if tc.errExpected {
+				require.ErrorIs(t, err, tc.expectedErr, "GetSession returned an unexpected error")
+			} else {
+				require.NoError(t, err, "GetSession should not have returned an error")
+				require.Equal(t, tc.expectedSession, session, "Returned session does not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestUpdateSessionRefreshToken(t *testing.T) {
+	mQuery, mArgs := updateSessionRefreshTokenQuery("mockSessionID", "mockSealedToken")
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Successful update, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).UpdateSessionRefreshToken(context.Background(), "mockSessionID", "mockSealedToken")
+
+			if tc.errExpected {
+				require.Error(t, err, "UpdateSessionRefreshToken should have returned an error")
+			} else {
+				require.NoError(t, err, "UpdateSessionRefreshToken should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	mQuery, mArgs := deleteSessionQuery("mockSessionID")
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Successful delete, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).DeleteSession(context.Background(), "mockSessionID")
+
+			if tc.errExpected {
+				require.Error(t, err, "DeleteSession should have returned an error")
+			} else {
+				require.NoError(t, err, "DeleteSession should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestDeleteUserSessions(t *testing.T) {
+	mQuery, mArgs := deleteUserSessionsQuery(1)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Successful delete, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).DeleteUserSessions(context.Background(), 1)
+
+			if tc.errExpected {
+				require.Error(t, err, "DeleteUserSessions should have returned an error")
+			} else {
+				require.NoError(t, err, "DeleteUserSessions should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestDeleteExpiredSessions(t *testing.T) {
+	before := time.Now()
+	mQuery, mArgs := deleteExpiredSessionsQuery(before)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name          string
+		mockFunc      func(mock sqlmock.Sqlmock)
+		expectedCount int64
+		errExpected   bool
+	}{
+		{
+			name: "Successful delete, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			expectedCount: 3,
+			errExpected:   false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			count, err := NewRepository(db).DeleteExpiredSessions(context.Background(), before)
+
+			if tc.errExpected {
+				require.Error(t, err, "DeleteExpiredSessions should have returned an error")
+			} else {
+				require.NoError(t, err, "DeleteExpiredSessions should not have returned an error")
+				require.Equal(t, tc.expectedCount, count, "Deleted count does not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestInsertOAuthState(t *testing.T) {
+	mState := OAuthState{Key: "mockStateKey", Value: `{"code_verifier":"mockVerifier"}`,
+		ExpiresAt: time.Now().Add(time.Minute)}
+	const maxStates = 100
+	mQuery, mArgs := insertOAuthStateQuery(mState, maxStates)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		expectedErr error
+		errExpected bool
+	}{
+		{
+			name: "Successful insert, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3]).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Too many unexpired states, ErrLimitReached expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3]).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedErr: ErrLimitReached,
+			errExpected: true,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).InsertOAuthState(context.Background(), mState, maxStates)
+
+			if tc.errExpected {
+				require.Error(t, err, "InsertOAuthState should have returned an error")
+				if tc.expectedErr != nil {
+					require.ErrorIs(t, err, tc.expectedErr, "Error does not match")
+				}
+			} else {
+				require.NoError(t, err, "InsertOAuthState should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestTakeOAuthState(t *testing.T) {
+	mState := OAuthState{Key: "mockStateKey", Value: `{"code_verifier":"mockVerifier"}`,
+		ExpiresAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mQuery, mArgs := takeOAuthStateQuery(mState.Key)
+	mQuery = regexp.QuoteMeta(mQuery)
+	columns := []string{"key", "value", "expires_at"}
+
+	for _, tc := range []struct {
+		name          string
+		mockFunc      func(mock sqlmock.Sqlmock)
+		expectedState OAuthState
+		expectedErr   error
+		errExpected   bool
+	}{
+		{
+			name: "State found, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(mState.Key, mState.Value, mState.ExpiresAt))
+			},
+			expectedState: mState,
+			errExpected:   false,
+		},
+		{
+			name: "State not found, ErrNotFound expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).WillReturnRows(sqlmock.NewRows(columns))
+			},
+			expectedErr: ErrNotFound,
+			errExpected: true,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			state, err := NewRepository(db).TakeOAuthState(context.Background(), mState.Key)
+
+			if tc.errExpected {
+				require.ErrorIs(t, err, tc.expectedErr, "TakeOAuthState returned an unexpected error")
+			} else {
+				require.NoError(t, err, "TakeOAuthState should not have returned an error")
+				require.Equal(t, tc.expectedState, state, "Returned state does not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestDeleteExpiredOAuthStates(t *testing.T) {
+	before := time.Now()
+	mQuery, mArgs := deleteExpiredOAuthStatesQuery(before)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name          string
+		mockFunc      func(mock sqlmock.Sqlmock)
+		expectedCount int64
+		errExpected   bool
+	}{
+		{
+			name: "Successful delete, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			expectedCount: 3,
+			errExpected:   false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			count, err := NewRepository(db).DeleteExpiredOAuthStates(context.Background(), before)
+
+			if tc.errExpected {
+				require.Error(t, err, "DeleteExpiredOAuthStates should have returned an error")
+			} else {
+				require.NoError(t, err, "DeleteExpiredOAuthStates should not have returned an error")
+				require.Equal(t, tc.expectedCount, count, "Deleted count does not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestAssignRole(t *testing.T) {
+	const userID, role = 42, "admin"
+	roleQuery, roleArgs := insertRoleQuery(role)
+	roleQuery = regexp.QuoteMeta(roleQuery)
+	mQuery, mArgs := insertUserRoleQuery(userID, role)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Role created and assigned, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(roleQuery).WithArgs(roleArgs[0]).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			errExpected: false,
+		},
+		{
+			name: "Role creation fails, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(roleQuery).WithArgs(roleArgs[0]).WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			errExpected: true,
+		},
+		{
+			name: "Assignment fails, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(roleQuery).WithArgs(roleArgs[0]).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).AssignRole(context.Background(), userID, role)
+
+			if tc.errExpected {
+				require.Error(t, err, "AssignRole should have returned an error")
+			} else {
+				require.NoError(t, err, "AssignRole should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestAssignRoleIfVacant(t *testing.T) {
+	const userID, role = 42, "admin"
+	roleQuery, roleArgs := insertRoleQuery(role)
+	roleQuery = regexp.QuoteMeta(roleQuery)
+	mQuery, mArgs := insertVacantUserRoleQuery(userID, role)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name             string
+		mockFunc         func(mock sqlmock.Sqlmock)
+		expectedAssigned bool
+		errExpected      bool
+	}{
+		{
+			name: "Vacant role assigned, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(roleQuery).WithArgs(roleArgs[0]).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedAssigned: true,
+			errExpected:      false,
+		},
+		{
+			name: "Role held by another user, not assigned.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(roleQuery).WithArgs(roleArgs[0]).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			expectedAssigned: false,
+			errExpected:      false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin().WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			assigned, err := NewRepository(db).AssignRoleIfVacant(context.Background(), userID, role)
+
+			if tc.errExpected {
+				require.Error(t, err, "AssignRoleIfVacant should have returned an error")
+			} else {
+				require.NoError(t, err, "AssignRoleIfVacant should not have returned an error")
+				require.Equal(t, tc.expectedAssigned, assigned, "Assigned does not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestRevokeRole(t *testing.T) {
+	const userID, role = 42, "admin"
+	mQuery, mArgs := deleteUserRoleQuery(userID, role)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Role revoked, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).RevokeRole(context.Background(), userID, role)
+
+			if tc.errExpected {
+				require.Error(t, err, "RevokeRole should have returned an error")
+			} else {
+				require.NoError(t, err, "RevokeRole should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestGetUserRoles(t *testing.T) {
+	const userID = 42
+	mQuery, mArgs := getUserRolesQuery(userID)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name          string
+		mockFunc      func(mock sqlmock.Sqlmock)
+		expectedRoles []string
+		errExpected   bool
+	}{
+		{
+			name: "Roles listed, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).
+					WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("admin").AddRow("editor"))
+			},
+			expectedRoles: []string{"admin", "editor"},
+			errExpected:   false,
+		},
+		{
+			name: "No roles, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).WillReturnRows(sqlmock.NewRows([]string{"role"}))
+			},
+			expectedRoles: nil,
+			errExpected:   false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			roles, err := NewRepository(db).GetUserRoles(context.Background(), userID)
+
+			if tc.errExpected {
+				require.Error(t, err, "GetUserRoles should have returned an error")
+			} else {
+				require.NoError(t, err, "GetUserRoles should not have returned an error")
+				require.Equal(t, tc.expectedRoles, roles, "Returned roles do not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestGrantPermission(t *testing.T) {
+	const role, permission = "admin", "users:write"
+	roleQuery, roleArgs := insertRoleQuery(role)
+	roleQuery = regexp.QuoteMeta(roleQuery)
+	mQuery, mArgs := insertPermissionQuery(role, permission)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Permission granted, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(roleQuery).WithArgs(roleArgs[0]).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			errExpected: false,
+		},
+		{
+			name: "Commit fails, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(roleQuery).WithArgs(roleArgs[0]).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit().WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).GrantPermission(context.Background(), role, permission)
+
+			if tc.errExpected {
+				require.Error(t, err, "GrantPermission should have returned an error")
+			} else {
+				require.NoError(t, err, "GrantPermission should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestRevokePermission(t *testing.T) {
+	const role, permission = "admin", "users:write"
+	mQuery, mArgs := deletePermissionQuery(role, permission)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Permission revoked, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).RevokePermission(context.Background(), role, permission)
+
+			if tc.errExpected {
+				require.Error(t, err, "RevokePermission should have returned an error")
+			} else {
+				require.NoError(t, err, "RevokePermission should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestGetUserPermissions(t *testing.T) {
+	const userID = 42
+	mQuery, mArgs := getUserPermissionsQuery(userID)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name                string
+		mockFunc            func(mock sqlmock.Sqlmock)
+		expectedPermissions []string
+		errExpected         bool
+	}{
+		{
+			name: "Permissions listed, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).
+					WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("users:read").AddRow("users:write"))
+			},
+			expectedPermissions: []string{"users:read", "users:write"},
+			errExpected:         false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			permissions, err := NewRepository(db).GetUserPermissions(context.Background(), userID)
+
+			if tc.errExpected {
+				require.Error(t, err, "GetUserPermissions should have returned an error")
+			} else {
+				require.NoError(t, err, "GetUserPermissions should not have returned an error")
+				require.Equal(t, tc.expectedPermissions, permissions, "Returned permissions do not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestCreateOrganization(t *testing.T) {
+	mOrg := Organization{ID: "acme", Name: "Acme Corporation"}
+	mQuery, mArgs := insertOrganizationQuery(mOrg)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		expectedErr error
+		errExpected bool
+	}{
+		{
+			name: "Organization created, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "ID is taken, ErrConflict expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedErr: ErrConflict,
+			errExpected: true,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).CreateOrganization(context.Background(), mOrg)
+
+			if tc.errExpected {
+				require.ErrorIs(t, err, tc.expectedErr, "CreateOrganization returned an unexpected error")
+			} else {
+				require.NoError(t, err, "CreateOrganization should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestGetOrganization(t *testing.T) {
+	mOrg := Organization{ID: "acme", Name: "Acme Corporation", CreatedAt: time.Now().Truncate(time.Second)}
+	mQuery, mArgs := getOrganizationQuery(mOrg.ID)
 	mQuery = regexp.QuoteMeta(mQuery)
+	columns := []string{"id", "name", "created_at"}
 
 	for _, tc := range []struct {
 		name        string
 		mockFunc    func(mock sqlmock.Sqlmock)
+		expectedErr error
 		errExpected bool
 	}{
 		{
-			name: "Successful insert, no errors.",
+			name: "Organization found, no errors.",
 			mockFunc: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec(mQuery).
-					WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3]).
-					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(mOrg.ID, mOrg.Name, mOrg.CreatedAt))
 			},
 			errExpected: false,
 		},
 		{
-			name: "Successful update, no errors.",
+			name: "Organization not found, ErrNotFound expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).WillReturnRows(sqlmock.NewRows(columns))
+			},
+			expectedErr: ErrNotFound,
+			errExpected: true,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			org, err := NewRepository(db).GetOrganization(context.Background(), mOrg.ID)
+
+			if tc.errExpected {
+				require.ErrorIs(t, err, tc.expectedErr, "GetOrganization returned an unexpected error")
+			} else {
+				require.NoError(t, err, "GetOrganization should not have returned an error")
+				require.Equal(t, mOrg, org, "Returned organization does not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestDeleteOrganization(t *testing.T) {
+	const id = "acme"
+	mQuery, mArgs := deleteOrganizationQuery(id)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Organization deleted, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).DeleteOrganization(context.Background(), id)
+
+			if tc.errExpected {
+				require.Error(t, err, "DeleteOrganization should have returned an error")
+			} else {
+				require.NoError(t, err, "DeleteOrganization should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestAddMember(t *testing.T) {
+	mMembership := Membership{OrgID: "acme", UserID: 42, Role: "admin"}
+	mQuery, mArgs := upsertMembershipQuery(mMembership)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Member added, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2]).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).AddMember(context.Background(), mMembership)
+
+			if tc.errExpected {
+				require.Error(t, err, "AddMember should have returned an error")
+			} else {
+				require.NoError(t, err, "AddMember should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	const orgID, userID = "acme", 42
+	mQuery, mArgs := deleteMembershipQuery(orgID, userID)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Member removed, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnError(sql.ErrConnDone)
+			},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			err = NewRepository(db).RemoveMember(context.Background(), orgID, userID)
+
+			if tc.errExpected {
+				require.Error(t, err, "RemoveMember should have returned an error")
+			} else {
+				require.NoError(t, err, "RemoveMember should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestGetMembership(t *testing.T) {
+	mMembership := Membership{OrgID: "acme", UserID: 42, Role: "admin", CreatedAt: time.Now().Truncate(time.Second)}
+	mQuery, mArgs := getMembershipQuery(mMembership.OrgID, mMembership.UserID)
+	mQuery = regexp.QuoteMeta(mQuery)
+	columns := []string{"org_id", "user_id", "role", "created_at"}
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		expectedErr error
+		errExpected bool
+	}{
+		{
+			name: "Membership found, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(mMembership.OrgID, mMembership.UserID, mMembership.Role, mMembership.CreatedAt))
+			},
+			errExpected: false,
+		},
+		{
+			name: "Not a member, ErrNotFound expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnRows(sqlmock.NewRows(columns))
+			},
+			expectedErr: ErrNotFound,
+			errExpected: true,
+		},
+		{
+			name: "Database returns error, error expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(mQuery).WithArgs(mArgs[0], mArgs[1]).WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			membership, err := NewRepository(db).GetMembership(context.Background(), mMembership.OrgID,
+				mMembership.UserID)
+
+			if tc.errExpected {
+				require.ErrorIs(t, err, tc.expectedErr, "GetMembership returned an unexpected error")
+			} else {
+				require.NoError(t, err, "GetMembership should not have returned an error")
+				require.Equal(t, mMembership, membership, "Returned membership does not match")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestInviteMember(t *testing.T) {
+	mInvitation := Invitation{OrgID: "acme", Email: "New@Acme.com", Role: "member", ExpiresAt: time.Now().Add(time.Hour)}
+	mQuery, mArgs := upsertInvitationQuery(mInvitation)
+	mQuery = regexp.QuoteMeta(mQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		errExpected bool
+	}{
+		{
+			name: "Member invited, no errors.",
 			mockFunc: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec(mQuery).
-					WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3]).
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3]).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 			errExpected: false,
@@ -53,8 +1688,7 @@ func TestUpsertUser(t *testing.T) {
 		{
 			name: "Database returns error, error expected.",
 			mockFunc: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec(mQuery).
-					WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3]).
+				mock.ExpectExec(mQuery).WithArgs(mArgs[0], mArgs[1], mArgs[2], mArgs[3]).
 					WillReturnError(sql.ErrConnDone)
 			},
 			errExpected: true,
@@ -62,30 +1696,96 @@ func TestUpsertUser(t *testing.T) {
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			// Create a new mock database for each test.
 			db, mock, err := sqlmock.New()
 			require.NoError(t, err, "Failed to create mock DB")
 			// Close upon return.
 			defer func() { _ = db.Close() }()
 
-			// Set up the mock expectations.
 			tc.mockFunc(mock)
-			// Create a new repository with the mock DB.
-			repo := NewRepository(db)
+			err = NewRepository(db).InviteMember(context.Background(), mInvitation)
 
-			// Execute the test.
-			err = repo.UpsertUser(context.Background(), mUser)
+			if tc.errExpected {
+				require.Error(t, err, "InviteMember should have returned an error")
+			} else {
+				require.NoError(t, err, "InviteMember should not have returned an error")
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	const orgID, userID, email, role = "acme", 42, "new@acme.com", "member"
+	createdAt := time.Now().Truncate(time.Second)
+
+	takeQuery, takeArgs := takeInvitationQuery(orgID, email)
+	takeQuery = regexp.QuoteMeta(takeQuery)
+	memberQuery, memberArgs := upsertMembershipQuery(Membership{OrgID: orgID, UserID: userID, Role: role})
+	memberQuery = regexp.QuoteMeta(memberQuery)
+
+	for _, tc := range []struct {
+		name        string
+		mockFunc    func(mock sqlmock.Sqlmock)
+		expectedErr error
+		errExpected bool
+	}{
+		{
+			name: "Invitation accepted, no errors.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(takeQuery).WithArgs(takeArgs[0], takeArgs[1]).
+					WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(role))
+				mock.ExpectQuery(memberQuery).WithArgs(memberArgs[0], memberArgs[1], memberArgs[2]).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+				mock.ExpectCommit()
+			},
+			errExpected: false,
+		},
+		{
+			name: "No unexpired invitation, ErrNotFound expected.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(takeQuery).WithArgs(takeArgs[0], takeArgs[1]).
+					WillReturnRows(sqlmock.NewRows([]string{"role"}))
+				mock.ExpectRollback()
+			},
+			expectedErr: ErrNotFound,
+			errExpected: true,
+		},
+		{
+			name: "Membership insertion fails, rolled back.",
+			mockFunc: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(takeQuery).WithArgs(takeArgs[0], takeArgs[1]).
+					WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(role))
+				mock.ExpectQuery(memberQuery).WithArgs(memberArgs[0], memberArgs[1], memberArgs[2]).
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			expectedErr: sql.ErrConnDone,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err, "Failed to create mock DB")
+			// Close upon return.
+			defer func() { _ = db.Close() }()
+
+			tc.mockFunc(mock)
+			membership, err := NewRepository(db).AcceptInvitation(context.Background(), orgID, userID, email)
 
-			// Check the results.
 			if tc.errExpected {
-				require.Error(t, err, "UpsertUser should have returned an error")
+				require.ErrorIs(t, err, tc.expectedErr, "AcceptInvitation returned an unexpected error")
 			} else {
-				require.NoError(t, err, "UpsertUser should not have returned an error")
+				require.NoError(t, err, "AcceptInvitation should not have returned an error")
+				require.Equal(t, Membership{OrgID: orgID, UserID: userID, Role: role, CreatedAt: createdAt}, membership,
+					"Returned membership does not match")
 			}
 
-			// Ensure all expectations were met.
-			err = mock.ExpectationsWereMet()
-			require.NoError(t, err, "Expectations were not met")
+			require.NoError(t, mock.ExpectationsWereMet(), "Expectations were not met")
 		})
 	}
 }
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+// DefaultAssertionTTL is the lifetime of an identity assertion if none is configured.
+const DefaultAssertionTTL = time.Minute
+
+// IssueAssertion issues a short-lived token that asserts the identity of the given claims to the given audience.
+//
+// It is signed by the same keys as the session tokens, so the upstream services can verify it with the published
+// JWKS. It carries no session ID, and its audience must differ from the issuer, so that it can never pass as a session
+// token. A non-positive ttl means the DefaultAssertionTTL.
+func (m *Manager) IssueAssertion(claims Claims, audience string, ttl time.Duration) (string, error) {
+	if audience == "" || audience == m.issuer {
+		return "", fmt.Errorf("invalid assertion audience: %q", audience)
+	}
+	if ttl <= 0 {
+		ttl = DefaultAssertionTTL
+	}
+
+	now := time.Now()
+	builder := jwt.NewBuilder().
+		Issuer(m.issuer).
+		Audience([]string{audience}).
+		IssuedAt(now).
+		NotBefore(now).
+		Expiration(now.Add(ttl)).
+		Claim(claimEmail, claims.Email).
+		Claim(claimGivenName, claims.GivenName).
+		Claim(claimFamilyName, claims.FamilyName).
+		Claim(claimPicture, claims.Picture).
+		Claim(claimProvider, claims.Provider)
+
+	// The user ID is unknown for the identities that never signed in here.
+	if claims.UserID != 0 {
+		builder = builder.Subject(strconv.Itoa(claims.UserID))
+	}
+	if !claims.AuthTime.IsZero() {
+		builder = builder.Claim(claimAuthTime, claims.AuthTime.Unix())
+	}
+	if len(claims.Roles) > 0 {
+		builder = builder.Claim(claimRoles, claims.Roles)
+	}
+	if claims.OrgID != "" {
+		builder = builder.Claim(claimOrgID, claims.OrgID).Claim(claimOrgRole, claims.OrgRole)
+	}
+	if len(claims.Extra) > 0 {
+		builder = builder.Claim(claimExtra, claims.Extra)
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		return "", fmt.Errorf("error in builder.Build call: %w", err)
+	}
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.ES256(), m.keyring.SigningKey()))
+	if err != nil {
+		return "", fmt.Errorf("error in jwt.Sign call: %w", err)
+	}
+
+	return string(signed), nil
+}
@@ -0,0 +1,62 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_IssueAssertion(t *testing.T) {
+	manager := NewManager(mockIssuer, time.Hour, 0, newMockKeyring(t))
+	const audience = "https://upstream.com"
+
+	claims := Claims{UserID: 42, SessionID: "mockSessionID", Email: "mock@mock.com", GivenName: "Mock",
+		Provider: "google", AuthTime: time.Now(), Roles: []string{"admin"}, OrgID: "acme", OrgRole: "member",
+		Extra: map[string]any{"groups": []any{"admins"}}}
+
+	assertion, err := manager.IssueAssertion(claims, audience, 0)
+	require.NoError(t, err, "Expected no error in IssueAssertion")
+
+	// The assertion must be verifiable with the published keys, by the audience.
+	parsed, err := jwt.Parse([]byte(assertion), jwt.WithKeySet(manager.PublicKeys()), jwt.WithValidate(true),
+		jwt.WithIssuer(mockIssuer), jwt.WithAudience(audience))
+	require.NoError(t, err, "Expected assertion to be valid")
+
+	subject, _ := parsed.Subject()
+	require.Equal(t, "42", subject, "Subject does not match")
+	expiry, _ := parsed.Expiration()
+	require.WithinDuration(t, time.Now().Add(DefaultAssertionTTL), expiry, time.Second, "Unexpected expiry")
+
+	var email string
+	require.NoError(t, parsed.Get(claimEmail, &email), "Failed to decode email claim")
+	require.Equal(t, claims.Email, email, "Email does not match")
+
+	var roles []any
+	require.NoError(t, parsed.Get(claimRoles, &roles), "Failed to decode roles claim")
+	require.Equal(t, []any{"admin"}, roles, "Roles do not match")
+
+	var orgID string
+	require.NoError(t, parsed.Get(claimOrgID, &orgID), "Failed to decode org_id claim")
+	require.Equal(t, claims.OrgID, orgID, "Organization ID does not match")
+
+	var extra map[string]any
+	require.NoError(t, parsed.Get(claimExtra, &extra), "Failed to decode extra claims")
+	require.Equal(t, claims.Extra, extra, "Extra claims do not match")
+
+	// The assertion carries no session, so it can not pass as a session token.
+	require.False(t, parsed.Has(claimSessionID), "Expected no session ID")
+	_, err = manager.Verify(assertion)
+	require.Error(t, err, "Expected assertion to not be a valid session token")
+}
+
+func TestManager_IssueAssertion_Audience(t *testing.T) {
+	manager := NewManager(mockIssuer, time.Hour, 0, newMockKeyring(t))
+
+	// The audience must be set, and must not be Authorizer itself.
+	for _, audience := range []string{"", mockIssuer} {
+		_, err := manager.IssueAssertion(Claims{UserID: 1}, audience, time.Minute)
+		require.Error(t, err, "Expected error for audience %q", audience)
+	}
+}
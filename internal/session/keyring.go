@@ -0,0 +1,170 @@
+package session
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// KeySource provides the keys of a Keyring.
+type KeySource interface {
+	// Keys returns the current private keys. The first one signs the tokens, and all of them verify the tokens.
+	Keys(ctx context.Context) ([]jwk.Key, error)
+}
+
+// Keyring holds the key that signs the session tokens and the keys that verify them.
+//
+// The keys are periodically reloaded from the KeySource, which allows the source to rotate them. A retired key should
+// be returned by the source for as long as the tokens signed by it are valid.
+type Keyring struct {
+	source KeySource
+
+	// mutex guards the keys, as they are replaced upon every refresh.
+	mutex *sync.RWMutex
+	// signingKey is the private key that signs the tokens.
+	signingKey jwk.Key
+	// publicKeys is the set of public keys that verify the tokens. It is published as the JWKS.
+	publicKeys jwk.Set
+}
+
+// NewKeyring loads the keys from the given source, and keeps refreshing them at the given interval.
+//
+// It accepts a context because it periodically refreshes the keys and the context can be used to cancel the
+// underlying refreshing goroutine. A non-positive interval disables the refreshing.
+func NewKeyring(ctx context.Context, source KeySource, refreshInterval time.Duration) (*Keyring, error) {
+	keyring := &Keyring{source: source, mutex: &sync.RWMutex{}}
+	if err := keyring.Refresh(ctx); err != nil {
+		return nil, fmt.Errorf("error in keyring.Refresh call: %w", err)
+	}
+
+	if refreshInterval > 0 {
+		go keyring.refreshPeriodically(ctx, refreshInterval)
+	}
+
+	return keyring, nil
+}
+
+// Refresh reloads the keys from the source.
+func (k *Keyring) Refresh(ctx context.Context) error {
+	keys, err := k.source.Keys(ctx)
+	if err != nil {
+		return fmt.Errorf("error in source.Keys call: %w", err)
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("key source returned no keys")
+	}
+
+	// Derive the public keys.
+	publicKeys := jwk.NewSet()
+	for _, key := range keys {
+		publicKey, err := key.PublicKey()
+		if err != nil {
+			return fmt.Errorf("error in key.PublicKey call: %w", err)
+		}
+		if err := publicKeys.AddKey(publicKey); err != nil {
+			return fmt.Errorf("error in set.AddKey call: %w", err)
+		}
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.signingKey, k.publicKeys = keys[0], publicKeys
+	return nil
+}
+
+// SigningKey returns the private key that signs the tokens.
+func (k *Keyring) SigningKey() jwk.Key {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.signingKey
+}
+
+// PublicKeys returns the set of public keys that verify the tokens.
+func (k *Keyring) PublicKeys() jwk.Set {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.publicKeys
+}
+
+// refreshPeriodically refreshes the keys at the given interval until the context is cancelled.
+func (k *Keyring) refreshPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Upon failure, the previous keys remain in use.
+			if err := k.Refresh(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to refresh session keys", "error", err)
+			}
+		}
+	}
+}
+
+// prepareKey assigns the key ID, algorithm and usage to the given key, so that it can sign the tokens, and its public
+// counterpart can be published.
+func prepareKey(key jwk.Key, keyID string) error {
+	if keyID == "" {
+		if err := jwk.AssignKeyID(key); err != nil {
+			return fmt.Errorf("error in jwk.AssignKeyID call: %w", err)
+		}
+	} else if err := key.Set(jwk.KeyIDKey, keyID); err != nil {
+		return fmt.Errorf("error in key.Set call: %w", err)
+	}
+
+	if err := key.Set(jwk.AlgorithmKey, jwa.ES256()); err != nil {
+		return fmt.Errorf("error in key.Set call: %w", err)
+	}
+	if err := key.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return fmt.Errorf("error in key.Set call: %w", err)
+	}
+
+	return nil
+}
+
+// parsePrivateKey parses the given PEM encoded private key, which must be suitable for ES256.
+func parsePrivateKey(privateKeyPEM []byte) (jwk.Key, error) {
+	key, err := jwk.ParseKey(privateKeyPEM, jwk.WithPEM(true))
+	if err != nil {
+		return nil, fmt.Errorf("error in jwk.ParseKey call: %w", err)
+	}
+
+	// ES256 needs a P-256 EC private key.
+	ecKey, ok := key.(jwk.ECDSAPrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key must be an EC private key, got %s", key.KeyType())
+	}
+	if curve, _ := ecKey.Crv(); curve != jwa.P256() {
+		return nil, fmt.Errorf("private key must use the P-256 curve, got %s", curve)
+	}
+
+	return key, nil
+}
+
+// generatePrivateKey generates a new private key suitable for ES256.
+func generatePrivateKey() (jwk.Key, error) {
+	raw, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error in ecdsa.GenerateKey call: %w", err)
+	}
+
+	key, err := jwk.Import(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error in jwk.Import call: %w", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,112 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/stretchr/testify/require"
+)
+
+// funcKeySource is a KeySource backed by a function, for testing purposes.
+type funcKeySource func(ctx context.Context) ([]jwk.Key, error)
+
+func (f funcKeySource) Keys(ctx context.Context) ([]jwk.Key, error) {
+	return f(ctx)
+}
+
+func TestNewKeyring(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		source      funcKeySource
+		errExpected bool
+	}{
+		{
+			name:        "Source returns error, error expected",
+			source:      func(context.Context) ([]jwk.Key, error) { return nil, errors.New("mock error") },
+			errExpected: true,
+		},
+		{
+			name:        "Source returns no keys, error expected",
+			source:      func(context.Context) ([]jwk.Key, error) { return nil, nil },
+			errExpected: true,
+		},
+		{
+			name:        "Source returns keys, no errors",
+			source:      func(context.Context) ([]jwk.Key, error) { return newMockKeys(t, 2), nil },
+			errExpected: false,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			keyring, err := NewKeyring(context.Background(), tc.source, 0)
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				return
+			}
+
+			require.NoError(t, err, "Expected no error but got one")
+			require.NotNil(t, keyring.SigningKey(), "Expected a signing key")
+			require.Equal(t, 2, keyring.PublicKeys().Len(), "Expected all keys to be published")
+		})
+	}
+}
+
+func TestKeyring_Refresh(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	// The keys to return, and the error to return, upon the next call.
+	mutex := &sync.Mutex{}
+	keys, errSource := newMockKeys(t, 1), error(nil)
+
+	source := funcKeySource(func(context.Context) ([]jwk.Key, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return keys, errSource
+	})
+
+	// Refresh frequently to verify the periodic refresh.
+	keyring, err := NewKeyring(ctx, source, time.Millisecond*10)
+	require.NoError(t, err, "Failed to create keyring")
+	firstKeyID, _ := keyring.SigningKey().KeyID()
+
+	// Rotate the keys in the source.
+	mutex.Lock()
+	keys = append(newMockKeys(t, 1), keys...)
+	newKeyID, _ := keys[0].KeyID()
+	mutex.Unlock()
+
+	// The keyring must pick up the new signing key, while still publishing the old one.
+	require.Eventually(t, func() bool {
+		keyID, _ := keyring.SigningKey().KeyID()
+		return keyID == newKeyID
+	}, time.Second, time.Millisecond*10, "Expected keyring to pick up the new key")
+	_, found := keyring.PublicKeys().LookupKeyID(firstKeyID)
+	require.True(t, found, "Expected old key to be still published")
+
+	// Upon failure, the keys must remain unchanged.
+	mutex.Lock()
+	errSource = errors.New("mock error")
+	mutex.Unlock()
+
+	require.Error(t, keyring.Refresh(ctx), "Expected error in Refresh")
+	keyID, _ := keyring.SigningKey().KeyID()
+	require.Equal(t, newKeyID, keyID, "Expected signing key to be unchanged")
+	require.Equal(t, 2, keyring.PublicKeys().Len(), "Expected public keys to be unchanged")
+}
+
+// newMockKeys generates the given number of prepared private keys.
+func newMockKeys(t *testing.T, count int) []jwk.Key {
+	keys := make([]jwk.Key, 0, count)
+	for i := 0; i < count; i++ {
+		key, err := generatePrivateKey()
+		require.NoError(t, err, "Failed to generate key")
+		require.NoError(t, prepareKey(key, ""), "Failed to prepare key")
+		keys = append(keys, key)
+	}
+	return keys
+}
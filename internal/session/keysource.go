@@ -0,0 +1,219 @@
+package session
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+)
+
+// EphemeralKeySource is a KeySource that generates a single key upon creation.
+//
+// Since the key is lost upon restart, and differs between replicas, it is suitable only for development.
+type EphemeralKeySource struct {
+	key jwk.Key
+}
+
+// NewEphemeralKeySource creates a new EphemeralKeySource with a freshly generated key.
+func NewEphemeralKeySource() (*EphemeralKeySource, error) {
+	key, err := generatePrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("error in generatePrivateKey call: %w", err)
+	}
+
+	if err := prepareKey(key, ""); err != nil {
+		return nil, fmt.Errorf("error in prepareKey call: %w", err)
+	}
+
+	return &EphemeralKeySource{key: key}, nil
+}
+
+func (e *EphemeralKeySource) Keys(ctx context.Context) ([]jwk.Key, error) {
+	return []jwk.Key{e.key}, nil
+}
+
+// FileKeySource is a KeySource that reads PEM encoded EC (P-256) private keys from files.
+//
+// The first file holds the signing key, and the others hold the retired keys that are kept only for verification.
+// The files are read upon every refresh, so the keys can be rotated by updating the files, without a restart.
+type FileKeySource struct {
+	paths []string
+}
+
+// NewFileKeySource creates a new FileKeySource for the given file paths.
+func NewFileKeySource(paths ...string) *FileKeySource {
+	return &FileKeySource{paths: paths}
+}
+
+func (f *FileKeySource) Keys(ctx context.Context) ([]jwk.Key, error) {
+	keys := make([]jwk.Key, 0, len(f.paths))
+	for _, path := range f.paths {
+		privateKeyPEM, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file %s: %w", path, err)
+		}
+
+		key, err := parsePrivateKey(privateKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+		}
+
+		// The key ID is the thumbprint, so it is stable across restarts and replicas.
+		if err := prepareKey(key, ""); err != nil {
+			return nil, fmt.Errorf("error in prepareKey call: %w", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// KeyStore is the persistent storage of the signing keys. It is implemented by repository.Repository.
+type KeyStore interface {
+	// ListSigningKeys lists all keys, newest first.
+	ListSigningKeys(ctx context.Context) ([]repository.SigningKey, error)
+	// InsertSigningKey inserts a new key.
+	InsertSigningKey(ctx context.Context, key repository.SigningKey) error
+	// DeleteSigningKey deletes the key with the given ID.
+	DeleteSigningKey(ctx context.Context, id string) error
+}
+
+// DatabaseKeySource is a KeySource that stores the keys in the database, and rotates them on a schedule.
+//
+// A new key is generated when the newest one is older than the rotation interval. The new key is published right
+// away, but it starts signing only after the activation delay, so that all replicas have learned about it before any
+// token signed by it reaches them. A key is retired when its successor starts signing, and it is deleted once it has
+// been retired for longer than the grace period.
+type DatabaseKeySource struct {
+	store KeyStore
+
+	rotationInterval time.Duration
+	activationDelay  time.Duration
+	gracePeriod      time.Duration
+
+	// now is a field only for testing purposes.
+	now func() time.Time
+}
+
+// NewDatabaseKeySource creates a new DatabaseKeySource.
+//
+// The activation delay should be at least the refresh interval of the Keyring, and the grace period should be at
+// least the lifetime of the sessions.
+func NewDatabaseKeySource(store KeyStore, rotationInterval, activationDelay, gracePeriod time.Duration,
+) *DatabaseKeySource {
+	return &DatabaseKeySource{
+		store:            store,
+		rotationInterval: rotationInterval,
+		activationDelay:  activationDelay,
+		gracePeriod:      gracePeriod,
+		now:              time.Now,
+	}
+}
+
+func (d *DatabaseKeySource) Keys(ctx context.Context) ([]jwk.Key, error) {
+	now := d.now()
+
+	// Newest first.
+	records, err := d.store.ListSigningKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error in store.ListSigningKeys call: %w", err)
+	}
+
+	// Rotate if the newest key is too old, or if there's no key at all.
+	if len(records) == 0 || now.Sub(records[0].CreatedAt) >= d.rotationInterval {
+		record, err := generateSigningKeyRecord(now)
+		if err != nil {
+			return nil, fmt.Errorf("error in generateSigningKeyRecord call: %w", err)
+		}
+
+		if err := d.store.InsertSigningKey(ctx, record); err != nil {
+			return nil, fmt.Errorf("error in store.InsertSigningKey call: %w", err)
+		}
+
+		slog.InfoContext(ctx, "generated new session signing key", "kid", record.ID)
+		records = append([]repository.SigningKey{record}, records...)
+	}
+
+	// The signing key is the newest active key. If no key is active yet, which is the case upon the very first start,
+	// the newest key is used.
+	signingIndex := 0
+	for i, record := range records {
+		if now.Sub(record.CreatedAt) >= d.activationDelay {
+			signingIndex = i
+			break
+		}
+	}
+
+	// Keys newer than the signing key are being activated, and follow it for verification.
+	keys := make([]jwk.Key, 0, len(records))
+	for i, record := range records {
+		// A key retires when its successor activates. Keys past their grace period are deleted.
+		if i > signingIndex {
+			retiredAt := records[i-1].CreatedAt.Add(d.activationDelay)
+			if now.Sub(retiredAt) > d.gracePeriod {
+				if err := d.store.DeleteSigningKey(ctx, record.ID); err != nil {
+					slog.ErrorContext(ctx, "failed to delete retired signing key", "kid", record.ID, "error", err)
+				}
+				continue
+			}
+		}
+
+		key, err := parsePrivateKey([]byte(record.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key %s: %w", record.ID, err)
+		}
+
+		if err := prepareKey(key, record.ID); err != nil {
+			return nil, fmt.Errorf("error in prepareKey call: %w", err)
+		}
+
+		// The signing key goes first.
+		if i == signingIndex {
+			keys = append([]jwk.Key{key}, keys...)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// generateSigningKeyRecord generates a new private key in its storable form.
+func generateSigningKeyRecord(now time.Time) (repository.SigningKey, error) {
+	raw, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return repository.SigningKey{}, fmt.Errorf("error in ecdsa.GenerateKey call: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(raw)
+	if err != nil {
+		return repository.SigningKey{}, fmt.Errorf("error in x509.MarshalPKCS8PrivateKey call: %w", err)
+	}
+
+	// The thumbprint is a stable and unique key ID.
+	key, err := jwk.Import(raw)
+	if err != nil {
+		return repository.SigningKey{}, fmt.Errorf("error in jwk.Import call: %w", err)
+	}
+	if err := jwk.AssignKeyID(key); err != nil {
+		return repository.SigningKey{}, fmt.Errorf("error in jwk.AssignKeyID call: %w", err)
+	}
+	keyID, _ := key.KeyID()
+
+	return repository.SigningKey{
+		ID:         keyID,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  now,
+	}, nil
+}
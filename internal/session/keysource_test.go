@@ -0,0 +1,166 @@
+package session
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+)
+
+func TestFileKeySource_Keys(t *testing.T) {
+	dir := t.TempDir()
+
+	// Write all kinds of keys to files.
+	newKeyPath := writeKeyFile(t, dir, "new.pem", newECKeyPEM(t, elliptic.P256()))
+	oldKeyPath := writeKeyFile(t, dir, "old.pem", newECKeyPEM(t, elliptic.P256()))
+	p384KeyPath := writeKeyFile(t, dir, "p384.pem", newECKeyPEM(t, elliptic.P384()))
+	rsaKeyPath := writeKeyFile(t, dir, "rsa.pem", newRSAKeyPEM(t))
+	invalidKeyPath := writeKeyFile(t, dir, "invalid.pem", []byte("invalid"))
+
+	for _, tc := range []struct {
+		name        string
+		paths       []string
+		errExpected bool
+	}{
+		{name: "Signing and retired keys, no errors", paths: []string{newKeyPath, oldKeyPath}},
+		{name: "Missing file, error expected", paths: []string{filepath.Join(dir, "missing.pem")}, errExpected: true},
+		{name: "Invalid PEM, error expected", paths: []string{invalidKeyPath}, errExpected: true},
+		{name: "P-384 key, error expected", paths: []string{newKeyPath, p384KeyPath}, errExpected: true},
+		{name: "RSA key, error expected", paths: []string{rsaKeyPath}, errExpected: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			keys, err := NewFileKeySource(tc.paths...).Keys(context.Background())
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				return
+			}
+
+			require.NoError(t, err, "Expected no error but got one")
+			require.Len(t, keys, len(tc.paths), "Expected one key per file")
+
+			// Reading again must yield the same key IDs, in the same order.
+			again, err := NewFileKeySource(tc.paths...).Keys(context.Background())
+			require.NoError(t, err, "Expected no error but got one")
+			for i := range keys {
+				keyID, _ := keys[i].KeyID()
+				againKeyID, _ := again[i].KeyID()
+				require.NotEmpty(t, keyID, "Expected key ID to be assigned")
+				require.Equal(t, keyID, againKeyID, "Expected stable key IDs")
+			}
+		})
+	}
+}
+
+func TestDatabaseKeySource_Keys(t *testing.T) {
+	ctx := context.Background()
+	store := &mockKeyStore{}
+
+	start := time.Now()
+	now := start
+
+	rotation, activation, grace := time.Hour*24, time.Minute, time.Hour
+	source := NewDatabaseKeySource(store, rotation, activation, grace)
+	source.now = func() time.Time { return now }
+
+	// keyIDs returns the IDs of the keys returned by the source.
+	keyIDs := func() []string {
+		keys, err := source.Keys(ctx)
+		require.NoError(t, err, "Expected no error in Keys")
+
+		ids := make([]string, 0, len(keys))
+		for _, key := range keys {
+			id, _ := key.KeyID()
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	// Upon the first call, a key is generated and used right away.
+	ids := keyIDs()
+	require.Len(t, ids, 1, "Expected one key")
+	require.Len(t, store.keys, 1, "Expected key to be stored")
+	first := ids[0]
+
+	// No rotation before the interval.
+	now = start.Add(rotation - time.Second)
+	require.Equal(t, []string{first}, keyIDs(), "Expected no rotation")
+
+	// Upon rotation, the new key is published but the old one keeps signing.
+	now = start.Add(rotation)
+	ids = keyIDs()
+	require.Len(t, ids, 2, "Expected two keys")
+	require.Equal(t, first, ids[0], "Expected old key to keep signing")
+	second := ids[1]
+
+	// After the activation delay, the new key signs and the old one is retired.
+	now = start.Add(rotation + activation)
+	require.Equal(t, []string{second, first}, keyIDs(), "Expected new key to sign")
+
+	// The retired key stays until the grace period is over.
+	now = start.Add(rotation + activation + grace)
+	require.Equal(t, []string{second, first}, keyIDs(), "Expected retired key to stay")
+
+	now = start.Add(rotation + activation + grace + time.Second)
+	require.Equal(t, []string{second}, keyIDs(), "Expected retired key to be removed")
+	require.Len(t, store.keys, 1, "Expected retired key to be deleted")
+}
+
+// mockKeyStore is an in-memory KeyStore.
+type mockKeyStore struct {
+	keys []repository.SigningKey
+}
+
+func (m *mockKeyStore) ListSigningKeys(ctx context.Context) ([]repository.SigningKey, error) {
+	return append([]repository.SigningKey(nil), m.keys...), nil
+}
+
+func (m *mockKeyStore) InsertSigningKey(ctx context.Context, key repository.SigningKey) error {
+	m.keys = append([]repository.SigningKey{key}, m.keys...)
+	return nil
+}
+
+func (m *mockKeyStore) DeleteSigningKey(ctx context.Context, id string) error {
+	for i, key := range m.keys {
+		if key.ID == id {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// newECKeyPEM generates a PEM encoded EC private key on the given curve.
+func newECKeyPEM(t *testing.T, curve elliptic.Curve) []byte {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err, "Failed to generate EC key")
+
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err, "Failed to marshal EC key")
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// newRSAKeyPEM generates a PEM encoded RSA private key.
+func newRSAKeyPEM(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Failed to generate RSA key")
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// writeKeyFile writes the given content to a file in the given directory and returns its path.
+func writeKeyFile(t *testing.T, dir, name string, content []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, content, 0o600), "Failed to write key file")
+	return path
+}
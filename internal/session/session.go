@@ -0,0 +1,257 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+const (
+	// DefaultIdleTimeout is the idle timeout of a session if none is configured.
+	DefaultIdleTimeout = time.Hour * 24
+	// DefaultAbsoluteTimeout is the absolute timeout of a session if none is configured.
+	DefaultAbsoluteTimeout = time.Hour * 24 * 7
+)
+
+// Custom claims of a session token, in addition to the registered ones.
+const (
+	claimSessionID     = "sid"
+	claimAuthTime      = "auth_time"
+	claimEmail         = "email"
+	claimEmailVerified = "email_verified"
+	claimGivenName     = "given_name"
+	claimFamilyName    = "family_name"
+	claimPicture       = "picture"
+	claimProvider      = "provider"
+	claimRoles         = "roles"
+	claimOrgID         = "org_id"
+	claimOrgRole       = "org_role"
+	claimExtra         = "ext"
+)
+
+// Claims are the claims of an Authorizer-issued session token.
+type Claims struct {
+	// UserID is the ID of the user in the users table. It is the "sub" claim of the token.
+	UserID int
+	// SessionID is the ID of the server-side session, which allows the token to be revoked. It is the "sid" claim.
+	SessionID string
+	// Email, GivenName, FamilyName and Picture are the user's details at the time of sign-in.
+	Email      string
+	GivenName  string
+	FamilyName string
+	Picture    string
+	// EmailVerified tells whether a provider verified the email. The rules that match the email require it.
+	EmailVerified bool
+	// Provider is the name of the provider that the user signed in with.
+	Provider string
+	// Roles are the names of the roles assigned to the user in Authorizer, as of the sign-in or the last renewal.
+	Roles []string
+	// OrgID is the ID of the organization that the user signed in to. It is empty if they signed in to none.
+	OrgID string
+	// OrgRole is the user's role in the organization.
+	OrgRole string
+	// Extra holds the claims of the provider's identity token that are forwarded with the session, like groups.
+	Extra map[string]any
+	// AuthTime is the time of the sign-in. The session can not be renewed beyond the absolute timeout after it.
+	AuthTime time.Time
+	// Exp is the expiry of the session token.
+	Exp time.Time
+}
+
+// Manager issues and verifies session tokens.
+//
+// Session tokens are JWTs signed by Authorizer's own keys. Unlike the provider tokens, they can be verified locally,
+// and their lifetime is independent of the provider.
+//
+// A session token expires after the idle timeout, but it can be renewed before that, up to the absolute timeout
+// after the sign-in. So, a session ends when it is not used for the idle timeout, or when it reaches the absolute
+// timeout, whichever comes first.
+type Manager struct {
+	// issuer is the "iss" claim of the issued tokens. It is the base URL of the application.
+	issuer string
+	// idleTimeout is the lifetime of the issued tokens.
+	idleTimeout time.Duration
+	// absoluteTimeout is the max lifetime of a session, renewals included.
+	absoluteTimeout time.Duration
+	// keyring holds the signing and verification keys.
+	keyring *Keyring
+}
+
+// NewManager creates a new Manager that issues tokens with the given issuer and timeouts, signed by the keyring.
+func NewManager(issuer string, idleTimeout, absoluteTimeout time.Duration, keyring *Keyring) *Manager {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	if absoluteTimeout <= 0 {
+		absoluteTimeout = DefaultAbsoluteTimeout
+	}
+	return &Manager{issuer: issuer, idleTimeout: idleTimeout, absoluteTimeout: absoluteTimeout, keyring: keyring}
+}
+
+// Issuer returns the "iss" claim of the tokens issued by this Manager.
+func (m *Manager) Issuer() string {
+	return m.issuer
+}
+
+// SessionExpiry returns the time at which a session that started at the given time reaches the absolute timeout.
+func (m *Manager) SessionExpiry(authTime time.Time) time.Time {
+	return authTime.Add(m.absoluteTimeout)
+}
+
+// ShouldRenew tells whether the token of the given claims is near its expiry, and can be renewed, that is, the session
+// has not reached the absolute timeout. A token is near its expiry in the second half of its lifetime.
+func (m *Manager) ShouldRenew(claims Claims) bool {
+	return time.Until(claims.Exp) < m.idleTimeout/2 && claims.Exp.Before(m.SessionExpiry(claims.AuthTime))
+}
+
+// Issue issues a new session token for the given claims. The expiry in the claims is ignored, and the token expires
+// after the idle timeout, but not beyond the absolute timeout. It returns the token along with its expiry.
+//
+// The auth time in the claims is retained upon renewal. If it is zero, that is, upon sign-in, it is set to now.
+func (m *Manager) Issue(claims Claims) (string, time.Time, error) {
+	now := time.Now()
+	if claims.AuthTime.IsZero() {
+		claims.AuthTime = now
+	}
+
+	// The token can not outlive the session.
+	expiry := now.Add(m.idleTimeout)
+	if sessionExpiry := m.SessionExpiry(claims.AuthTime); sessionExpiry.Before(expiry) {
+		expiry = sessionExpiry
+	}
+	if !expiry.After(now) {
+		return "", time.Time{}, fmt.Errorf("session has reached the absolute timeout")
+	}
+
+	builder := jwt.NewBuilder().
+		Issuer(m.issuer).
+		Audience([]string{m.issuer}).
+		Subject(strconv.Itoa(claims.UserID)).
+		IssuedAt(now).
+		NotBefore(now).
+		Expiration(expiry).
+		Claim(claimSessionID, claims.SessionID).
+		Claim(claimAuthTime, claims.AuthTime.Unix()).
+		Claim(claimEmail, claims.Email).
+		Claim(claimEmailVerified, claims.EmailVerified).
+		Claim(claimGivenName, claims.GivenName).
+		Claim(claimFamilyName, claims.FamilyName).
+		Claim(claimPicture, claims.Picture).
+		Claim(claimProvider, claims.Provider)
+
+	if len(claims.Roles) > 0 {
+		builder = builder.Claim(claimRoles, claims.Roles)
+	}
+	if claims.OrgID != "" {
+		builder = builder.Claim(claimOrgID, claims.OrgID).Claim(claimOrgRole, claims.OrgRole)
+	}
+	// The forwarded claims are optional, and kept in a claim of their own, so that they can not collide with others.
+	if len(claims.Extra) > 0 {
+		builder = builder.Claim(claimExtra, claims.Extra)
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error in builder.Build call: %w", err)
+	}
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.ES256(), m.keyring.SigningKey()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error in jwt.Sign call: %w", err)
+	}
+
+	return string(signed), expiry, nil
+}
+
+// PublicKeys returns the set of public keys that verify the session tokens, to be published as the JWKS.
+func (m *Manager) PublicKeys() jwk.Set {
+	return m.keyring.PublicKeys()
+}
+
+// Verify verifies the given session token and returns its claims.
+//
+// It does not know whether the session has been revoked. That must be checked against the server-side session.
+func (m *Manager) Verify(token string) (Claims, error) {
+	parsed, err := jwt.Parse([]byte(token), jwt.WithKeySet(m.keyring.PublicKeys()), jwt.WithValidate(true),
+		jwt.WithIssuer(m.issuer), jwt.WithAudience(m.issuer))
+	if err != nil {
+		return Claims{}, fmt.Errorf("error in jwt.Parse call: %w", err)
+	}
+
+	// The subject is the user ID.
+	subject, _ := parsed.Subject()
+	userID, err := strconv.Atoi(subject)
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid sub claim: %w", err)
+	}
+
+	claims := Claims{UserID: userID}
+	claims.Exp, _ = parsed.Expiration()
+
+	// The auth time is a numeric date, like the registered time claims.
+	var authTime float64
+	if err := parsed.Get(claimAuthTime, &authTime); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode %s claim: %w", claimAuthTime, err)
+	}
+	claims.AuthTime = time.Unix(int64(authTime), 0)
+
+	for name, dst := range map[string]*string{
+		claimSessionID:  &claims.SessionID,
+		claimEmail:      &claims.Email,
+		claimGivenName:  &claims.GivenName,
+		claimFamilyName: &claims.FamilyName,
+		claimPicture:    &claims.Picture,
+		claimProvider:   &claims.Provider,
+	} {
+		if err := parsed.Get(name, dst); err != nil {
+			return Claims{}, fmt.Errorf("failed to decode %s claim: %w", name, err)
+		}
+	}
+
+	// The tokens issued before the claim existed are taken as unverified.
+	if parsed.Has(claimEmailVerified) {
+		if err := parsed.Get(claimEmailVerified, &claims.EmailVerified); err != nil {
+			return Claims{}, fmt.Errorf("failed to decode %s claim: %w", claimEmailVerified, err)
+		}
+	}
+
+	// The roles are decoded as a list of any type, like all JSON arrays.
+	if parsed.Has(claimRoles) {
+		var roles []any
+		if err := parsed.Get(claimRoles, &roles); err != nil {
+			return Claims{}, fmt.Errorf("failed to decode %s claim: %w", claimRoles, err)
+		}
+		for _, role := range roles {
+			roleName, ok := role.(string)
+			if !ok {
+				return Claims{}, fmt.Errorf("invalid %s claim: non-string role", claimRoles)
+			}
+			claims.Roles = append(claims.Roles, roleName)
+		}
+	}
+	// The organization claims are absent if the user signed in to none.
+	for name, dst := range map[string]*string{claimOrgID: &claims.OrgID, claimOrgRole: &claims.OrgRole} {
+		if !parsed.Has(name) {
+			continue
+		}
+		if err := parsed.Get(name, dst); err != nil {
+			return Claims{}, fmt.Errorf("failed to decode %s claim: %w", name, err)
+		}
+	}
+	if parsed.Has(claimExtra) {
+		if err := parsed.Get(claimExtra, &claims.Extra); err != nil {
+			return Claims{}, fmt.Errorf("failed to decode %s claim: %w", claimExtra, err)
+		}
+	}
+
+	// A token without a session can not be revoked.
+	if claims.SessionID == "" {
+		return Claims{}, fmt.Errorf("empty sid claim")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,165 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+const mockIssuer = "https://authorizer.com"
+
+func TestNewManager(t *testing.T) {
+	manager := NewManager(mockIssuer, 0, 0, newMockKeyring(t))
+	require.Equal(t, DefaultIdleTimeout, manager.idleTimeout, "Expected default idle timeout")
+	require.Equal(t, DefaultAbsoluteTimeout, manager.absoluteTimeout, "Expected default absolute timeout")
+	require.Equal(t, mockIssuer, manager.Issuer(), "Issuer does not match")
+}
+
+func TestManager_IssueAndVerify(t *testing.T) {
+	manager := NewManager(mockIssuer, time.Hour, 0, newMockKeyring(t))
+
+	claims := Claims{UserID: 42, SessionID: "mockSessionID", Email: "mock@mock.com", EmailVerified: true,
+		GivenName: "Mock", FamilyName: "User", Picture: "mockPicture", Provider: "google",
+		Roles: []string{"admin", "editor"}, OrgID: "acme", OrgRole: "owner",
+		Extra: map[string]any{"groups": []any{"admins", "devs"}}}
+
+	// Issue a token and verify it.
+	token, expiry, err := manager.Issue(claims)
+	require.NoError(t, err, "Expected no error in Issue")
+	require.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Second, "Unexpected expiry")
+
+	verified, err := manager.Verify(token)
+	require.NoError(t, err, "Expected no error in Verify")
+	require.WithinDuration(t, expiry, verified.Exp, time.Second, "Unexpected expiry")
+
+	// The auth time is set upon sign-in.
+	require.WithinDuration(t, time.Now(), verified.AuthTime, time.Second, "Unexpected auth time")
+
+	verified.Exp, verified.AuthTime = time.Time{}, time.Time{}
+	require.Equal(t, claims, verified, "Claims do not match")
+
+	// The subject must be the user ID.
+	parsed, err := jwt.ParseInsecure([]byte(token))
+	require.NoError(t, err, "Failed to parse token")
+	subject, _ := parsed.Subject()
+	require.Equal(t, "42", subject, "Subject does not match")
+}
+
+func TestManager_Verify(t *testing.T) {
+	keyring := newMockKeyring(t)
+	manager := NewManager(mockIssuer, time.Hour, 0, keyring)
+
+	// Token of another manager with the same issuer, that is, signed by another key.
+	foreignToken, _, err := NewManager(mockIssuer, time.Hour, 0, newMockKeyring(t)).Issue(Claims{UserID: 1, SessionID: "mockSessionID"})
+	require.NoError(t, err, "Failed to issue foreign token")
+
+	// Token of another issuer.
+	otherIssuerToken, _, err := NewManager("https://other.com", time.Hour, 0, keyring).Issue(Claims{UserID: 1, SessionID: "mockSessionID"})
+	require.NoError(t, err, "Failed to issue other issuer token")
+
+	// Expired token.
+	expiredToken := signMockToken(t, keyring, jwt.NewBuilder().Issuer(mockIssuer).Audience([]string{mockIssuer}).
+		Subject("1").Expiration(time.Now().Add(-time.Hour)).Claim(claimSessionID, "mockSessionID").
+		Claim(claimAuthTime, time.Now().Add(-time.Hour*2).Unix()))
+
+	// Token with a non-numeric subject.
+	badSubjectToken := signMockToken(t, keyring, jwt.NewBuilder().Issuer(mockIssuer).Audience([]string{mockIssuer}).
+		Subject("abc").Expiration(time.Now().Add(time.Hour)))
+
+	// Token without the auth time.
+	noAuthTimeToken := signMockToken(t, keyring, jwt.NewBuilder().Issuer(mockIssuer).Audience([]string{mockIssuer}).
+		Subject("1").Expiration(time.Now().Add(time.Hour)).Claim(claimSessionID, "mockSessionID"))
+
+	// Token without a session ID.
+	noSessionToken, _, err := manager.Issue(Claims{UserID: 1})
+	require.NoError(t, err, "Failed to issue token without session ID")
+
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{name: "Token signed by another key", token: foreignToken},
+		{name: "Token of another issuer", token: otherIssuerToken},
+		{name: "Expired token", token: expiredToken},
+		{name: "Non-numeric subject", token: badSubjectToken},
+		{name: "Token without auth time", token: noAuthTimeToken},
+		{name: "Token without session ID", token: noSessionToken},
+		{name: "Malformed token", token: "header.payload.signature"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := manager.Verify(tc.token)
+			require.Error(t, err, "Expected error but got none")
+		})
+	}
+
+	// A token issued before the email verification claim existed carries an unverified email.
+	legacyToken := signMockToken(t, keyring, jwt.NewBuilder().Issuer(mockIssuer).Audience([]string{mockIssuer}).
+		Subject("1").Expiration(time.Now().Add(time.Hour)).Claim(claimSessionID, "mockSessionID").
+		Claim(claimAuthTime, time.Now().Unix()).Claim(claimEmail, "mock@mock.com").Claim(claimGivenName, "").
+		Claim(claimFamilyName, "").Claim(claimPicture, "").Claim(claimProvider, "google"))
+	claims, err := manager.Verify(legacyToken)
+	require.NoError(t, err, "Expected no error in Verify")
+	require.False(t, claims.EmailVerified, "Expected email to be unverified")
+}
+
+func TestManager_Timeouts(t *testing.T) {
+	manager := NewManager(mockIssuer, time.Hour, time.Hour*3, newMockKeyring(t))
+
+	// Upon sign-in, the token expires after the idle timeout.
+	token, expiry, err := manager.Issue(Claims{UserID: 1, SessionID: "mockSessionID"})
+	require.NoError(t, err, "Expected no error in Issue")
+	require.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Second, "Expected idle timeout expiry")
+
+	claims, err := manager.Verify(token)
+	require.NoError(t, err, "Expected no error in Verify")
+	require.WithinDuration(t, claims.AuthTime.Add(time.Hour*3), manager.SessionExpiry(claims.AuthTime), time.Second,
+		"Unexpected session expiry")
+
+	// A fresh token need not be renewed.
+	require.False(t, manager.ShouldRenew(claims), "Expected fresh token to not need renewal")
+
+	// A token in the second half of its lifetime needs renewal.
+	claims.Exp = time.Now().Add(time.Minute * 29)
+	require.True(t, manager.ShouldRenew(claims), "Expected old token to need renewal")
+
+	// Upon renewal near the absolute timeout, the token expires with the session.
+	claims.AuthTime = time.Now().Add(-time.Hour*2 - time.Minute*30)
+	_, expiry, err = manager.Issue(claims)
+	require.NoError(t, err, "Expected no error in Issue")
+	require.WithinDuration(t, manager.SessionExpiry(claims.AuthTime), expiry, time.Second,
+		"Expected absolute timeout expiry")
+
+	// A token that expires with the session can not be renewed.
+	claims.Exp = expiry
+	require.False(t, manager.ShouldRenew(claims), "Expected token at the absolute timeout to not need renewal")
+
+	// A session past the absolute timeout can not be renewed.
+	claims.AuthTime = time.Now().Add(-time.Hour * 4)
+	_, _, err = manager.Issue(claims)
+	require.Error(t, err, "Expected error for session past the absolute timeout")
+}
+
+// signMockToken builds and signs a token with the signing key of the given keyring.
+func signMockToken(t *testing.T, keyring *Keyring, builder *jwt.Builder) string {
+	token, err := builder.Build()
+	require.NoError(t, err, "Failed to build token")
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.ES256(), keyring.SigningKey()))
+	require.NoError(t, err, "Failed to sign token")
+	return string(signed)
+}
+
+// newMockKeyring returns a keyring with an ephemeral key that is never refreshed.
+func newMockKeyring(t *testing.T) *Keyring {
+	source, err := NewEphemeralKeySource()
+	require.NoError(t, err, "Failed to create ephemeral key source")
+
+	keyring, err := NewKeyring(context.Background(), source, 0)
+	require.NoError(t, err, "Failed to create keyring")
+	return keyring
+}
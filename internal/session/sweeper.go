@@ -0,0 +1,67 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// SessionStore is the persistent storage of the sessions. It is implemented by repository.Repository.
+type SessionStore interface {
+	// DeleteExpiredSessions deletes the sessions that expired before the given time, and returns their count.
+	DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Sweeper deletes the expired sessions from the database.
+//
+// An expired session can no longer be used, but its row stays unless the user logs out, so it is deleted
+// periodically. All replicas may sweep, as a sweep only deletes what is already expired.
+type Sweeper struct {
+	store SessionStore
+
+	// now is a field only for testing purposes.
+	now func() time.Time
+}
+
+// NewSweeper creates a new Sweeper that sweeps the expired sessions at the given interval.
+//
+// It accepts a context because it periodically sweeps the expired sessions and the context can be used to cancel the
+// underlying sweeping goroutine.
+func NewSweeper(ctx context.Context, store SessionStore, interval time.Duration) *Sweeper {
+	sweeper := &Sweeper{store: store, now: time.Now}
+	if interval > 0 {
+		go sweeper.sweepPeriodically(ctx, interval)
+	}
+	return sweeper
+}
+
+// sweep deletes the expired sessions.
+func (s *Sweeper) sweep(ctx context.Context) error {
+	count, err := s.store.DeleteExpiredSessions(ctx, s.now())
+	if err != nil {
+		return fmt.Errorf("error in store.DeleteExpiredSessions call: %w", err)
+	}
+
+	if count > 0 {
+		slog.InfoContext(ctx, "expired sessions swept", "count", count)
+	}
+	return nil
+}
+
+// sweepPeriodically sweeps the expired sessions at the given interval until the context is cancelled.
+func (s *Sweeper) sweepPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sweep(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to sweep expired sessions", "error", err)
+			}
+		}
+	}
+}
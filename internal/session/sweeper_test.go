@@ -0,0 +1,57 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+)
+
+func TestSweeper(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := &mockSessionStore{sessions: []repository.Session{
+		{ID: "expired", ExpiresAt: now.Add(-time.Second)},
+		{ID: "unexpired", ExpiresAt: now.Add(time.Second)},
+	}}
+
+	// A zero interval starts no sweeping goroutine.
+	sweeper := NewSweeper(ctx, store, 0)
+	sweeper.now = func() time.Time { return now }
+
+	// Only the expired session must be deleted.
+	require.NoError(t, sweeper.sweep(ctx), "Expected no error in sweep")
+	require.Len(t, store.sessions, 1, "Expected expired session to be deleted")
+	require.Equal(t, "unexpired", store.sessions[0].ID, "Expected unexpired session to be retained")
+
+	store.err = errors.New("mock error")
+	require.Error(t, sweeper.sweep(ctx), "Expected error in sweep")
+}
+
+// mockSessionStore is an in-memory SessionStore.
+type mockSessionStore struct {
+	sessions []repository.Session
+	err      error
+}
+
+func (m *mockSessionStore) DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	var count int64
+	retained := m.sessions[:0]
+	for _, session := range m.sessions {
+		if session.ExpiresAt.Before(before) {
+			count++
+			continue
+		}
+		retained = append(retained, session)
+	}
+	m.sessions = retained
+	return count, nil
+}
@@ -0,0 +1,75 @@
+package statestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shivanshkc/authorizer/internal/utils/cryptoutils"
+)
+
+// CookieStore seals the states into values that the browser keeps in a cookie, instead of storing them.
+//
+// Since no state is kept on the server, any replica can handle the provider's callback. And since the state lives in
+// the browser that started the flow, the flow can not be completed in another browser, which defends against login
+// CSRF. Unlike a StateStore, it can not prevent a sealed state from being replayed before it expires, so the cookie
+// must be cleared upon callback.
+type CookieStore struct {
+	aead *cryptoutils.AEAD
+	ttl  time.Duration
+
+	// now is a field only for testing purposes.
+	now func() time.Time
+}
+
+// sealedState is the plaintext of a sealed state.
+type sealedState struct {
+	Value     Value     `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewCookieStore creates a new CookieStore that seals the states with the given AEAD. They expire after the TTL.
+func NewCookieStore(aead *cryptoutils.AEAD, ttl time.Duration) *CookieStore {
+	return &CookieStore{aead: aead, ttl: ttl, now: time.Now}
+}
+
+// TTL returns the lifetime of the sealed states, which should also be the lifetime of their cookies.
+func (c *CookieStore) TTL() time.Duration {
+	return c.ttl
+}
+
+// Seal seals the value of the given state key.
+func (c *CookieStore) Seal(key string, value Value) (string, error) {
+	plaintext, err := json.Marshal(sealedState{Value: value, ExpiresAt: c.now().Add(c.ttl)})
+	if err != nil {
+		return "", fmt.Errorf("error in json.Marshal call: %w", err)
+	}
+
+	// The key is the additional data, so that a sealed value can not be used with another key.
+	sealed, err := c.aead.Seal(plaintext, []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("error in aead.Seal call: %w", err)
+	}
+
+	return sealed, nil
+}
+
+// Open opens a value sealed by Seal for the same state key.
+// It returns ErrNotFound if the value was sealed for another key, has been tampered with, or has expired.
+func (c *CookieStore) Open(key, sealed string) (Value, error) {
+	plaintext, err := c.aead.Open(sealed, []byte(key))
+	if err != nil {
+		return Value{}, fmt.Errorf("%w: error in aead.Open call: %w", ErrNotFound, err)
+	}
+
+	var state sealedState
+	if err := json.Unmarshal(plaintext, &state); err != nil {
+		return Value{}, fmt.Errorf("error in json.Unmarshal call: %w", err)
+	}
+
+	if !c.now().Before(state.ExpiresAt) {
+		return Value{}, ErrNotFound
+	}
+
+	return state.Value, nil
+}
@@ -0,0 +1,59 @@
+package statestore
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/utils/cryptoutils"
+)
+
+func TestCookieStore(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := NewCookieStore(newMockAEAD(t, 1), time.Minute)
+	store.now = func() time.Time { return now }
+
+	value := Value{CodeVerifier: "mockVerifier", ClientCallbackURL: "https://allowed.com"}
+	sealed, err := store.Seal("mockKey", value)
+	require.NoError(t, err, "Expected no error in Seal")
+	require.NotContains(t, sealed, value.CodeVerifier, "Expected code verifier to be encrypted")
+
+	opened, err := store.Open("mockKey", sealed)
+	require.NoError(t, err, "Expected no error in Open")
+	require.Equal(t, value, opened, "Opened value does not match")
+
+	// Sealed by another store, that is, with another key.
+	foreignSealed, err := NewCookieStore(newMockAEAD(t, 2), time.Minute).Seal("mockKey", value)
+	require.NoError(t, err, "Expected no error in Seal")
+
+	for _, tc := range []struct {
+		name   string
+		key    string
+		sealed string
+	}{
+		{name: "Sealed for another state key", key: "anotherMockKey", sealed: sealed},
+		{name: "Sealed with another encryption key", key: "mockKey", sealed: foreignSealed},
+		{name: "Malformed sealed value", key: "mockKey", sealed: "malformed"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := store.Open(tc.key, tc.sealed)
+			require.ErrorIs(t, err, ErrNotFound, "Expected ErrNotFound")
+		})
+	}
+
+	// Expired.
+	now = now.Add(time.Minute)
+	_, err = store.Open("mockKey", sealed)
+	require.ErrorIs(t, err, ErrNotFound, "Expected ErrNotFound for expired state")
+}
+
+// newMockAEAD returns an AEAD whose key is filled with the given byte.
+func newMockAEAD(t *testing.T, fill byte) *cryptoutils.AEAD {
+	aead, err := cryptoutils.NewAEAD(bytes.Repeat([]byte{fill}, 32))
+	require.NoError(t, err, "Failed to create AEAD")
+	return aead
+}
@@ -0,0 +1,118 @@
+package statestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+)
+
+// Repository is the persistent storage of the states. It is implemented by repository.Repository.
+type Repository interface {
+	// InsertOAuthState inserts a new state, as long as there are fewer than maxStates unexpired ones. It returns
+	// repository.ErrLimitReached otherwise.
+	InsertOAuthState(ctx context.Context, state repository.OAuthState, maxStates int) error
+	// TakeOAuthState atomically returns and deletes the state with the given key.
+	TakeOAuthState(ctx context.Context, key string) (repository.OAuthState, error)
+	// DeleteExpiredOAuthStates deletes the states that expired by the given time, and returns their count.
+	DeleteExpiredOAuthStates(ctx context.Context, before time.Time) (int64, error)
+}
+
+// DatabaseStore is a StateStore that keeps the states in the database.
+//
+// Since the states are shared by all replicas, the provider's callback may land on any of them. Expired states that
+// were never taken are deleted periodically.
+type DatabaseStore struct {
+	repo      Repository
+	ttl       time.Duration
+	maxStates int
+
+	// now is a field only for testing purposes.
+	now func() time.Time
+}
+
+// NewDatabaseStore creates a new DatabaseStore whose states expire after the given TTL. At most maxStates unexpired
+// states are kept across all replicas, and a maxStates that is not positive removes the cap.
+//
+// It accepts a context because it periodically sweeps the expired states and the context can be used to cancel the
+// underlying sweeping goroutine.
+func NewDatabaseStore(ctx context.Context, repo Repository, ttl time.Duration, maxStates int) *DatabaseStore {
+	store := &DatabaseStore{repo: repo, ttl: ttl, maxStates: maxStates, now: time.Now}
+	if ttl > 0 {
+		go store.sweepPeriodically(ctx, ttl)
+	}
+	return store
+}
+
+func (d *DatabaseStore) Put(ctx context.Context, key string, value Value) error {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal call: %w", err)
+	}
+
+	state := repository.OAuthState{Key: key, Value: string(valueJSON), ExpiresAt: d.now().Add(d.ttl)}
+	if err := d.repo.InsertOAuthState(ctx, state, d.maxStates); err != nil {
+		if errors.Is(err, repository.ErrLimitReached) {
+			return ErrTooManyStates
+		}
+		return fmt.Errorf("error in repo.InsertOAuthState call: %w", err)
+	}
+
+	return nil
+}
+
+func (d *DatabaseStore) Take(ctx context.Context, key string) (Value, error) {
+	state, err := d.repo.TakeOAuthState(ctx, key)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return Value{}, ErrNotFound
+		}
+		return Value{}, fmt.Errorf("error in repo.TakeOAuthState call: %w", err)
+	}
+
+	// The state may have expired but not yet been removed.
+	if !d.now().Before(state.ExpiresAt) {
+		return Value{}, ErrNotFound
+	}
+
+	var value Value
+	if err := json.Unmarshal([]byte(state.Value), &value); err != nil {
+		return Value{}, fmt.Errorf("error in json.Unmarshal call: %w", err)
+	}
+
+	return value, nil
+}
+
+// sweep deletes the expired states.
+func (d *DatabaseStore) sweep(ctx context.Context) error {
+	count, err := d.repo.DeleteExpiredOAuthStates(ctx, d.now())
+	if err != nil {
+		return fmt.Errorf("error in repo.DeleteExpiredOAuthStates call: %w", err)
+	}
+
+	if count > 0 {
+		slog.InfoContext(ctx, "expired states swept", "count", count)
+	}
+	return nil
+}
+
+// sweepPeriodically sweeps the expired states at the given interval until the context is cancelled.
+func (d *DatabaseStore) sweepPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.sweep(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to sweep expired states", "error", err)
+			}
+		}
+	}
+}
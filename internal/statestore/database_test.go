@@ -0,0 +1,129 @@
+package statestore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/repository"
+)
+
+func TestDatabaseStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	repo := &mockRepository{states: map[string]repository.OAuthState{}}
+	store := NewDatabaseStore(ctx, repo, time.Minute, 0)
+	store.now = func() time.Time { return now }
+
+	value := Value{CodeVerifier: "mockVerifier", ClientCallbackURL: "https://allowed.com", Nonce: "mockNonce"}
+	require.NoError(t, store.Put(ctx, "mockKey", value), "Expected no error in Put")
+
+	// The state is stored as JSON, along with its expiry.
+	require.JSONEq(t, `{"code_verifier":"mockVerifier","client_callback_url":"https://allowed.com","nonce":"mockNonce"}`,
+		repo.states["mockKey"].Value, "Stored value does not match")
+	require.Equal(t, now.Add(time.Minute), repo.states["mockKey"].ExpiresAt, "Stored expiry does not match")
+
+	// A state can be taken once.
+	taken, err := store.Take(ctx, "mockKey")
+	require.NoError(t, err, "Expected no error in Take")
+	require.Equal(t, value, taken, "Taken value does not match")
+
+	_, err = store.Take(ctx, "mockKey")
+	require.ErrorIs(t, err, ErrNotFound, "Expected ErrNotFound for a state taken twice")
+
+	// An expired state that is yet to be removed.
+	require.NoError(t, store.Put(ctx, "mockKey", value), "Expected no error in Put")
+	now = now.Add(time.Minute)
+	_, err = store.Take(ctx, "mockKey")
+	require.ErrorIs(t, err, ErrNotFound, "Expected ErrNotFound for expired state")
+
+	// Database errors are not mistaken for absence.
+	repo.err = errors.New("mock error")
+	_, err = store.Take(ctx, "mockKey")
+	require.Error(t, err, "Expected error in Take")
+	require.NotErrorIs(t, err, ErrNotFound, "Expected database error, not ErrNotFound")
+}
+
+func TestDatabaseStore_Sweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	repo := &mockRepository{states: map[string]repository.OAuthState{
+		"expired":   {Key: "expired", ExpiresAt: now.Add(-time.Second)},
+		"unexpired": {Key: "unexpired", ExpiresAt: now.Add(time.Second)},
+	}}
+	store := NewDatabaseStore(ctx, repo, time.Minute, 0)
+	store.now = func() time.Time { return now }
+
+	// Only the expired state must be deleted.
+	require.NoError(t, store.sweep(ctx), "Expected no error in sweep")
+	require.NotContains(t, repo.states, "expired", "Expected expired state to be deleted")
+	require.Contains(t, repo.states, "unexpired", "Expected unexpired state to be retained")
+
+	repo.err = errors.New("mock error")
+	require.Error(t, store.sweep(ctx), "Expected error in sweep")
+}
+
+func TestDatabaseStore_MaxStates(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &mockRepository{states: map[string]repository.OAuthState{}}
+	store := NewDatabaseStore(ctx, repo, time.Minute, 2)
+
+	require.NoError(t, store.Put(ctx, "key1", Value{}), "Expected no error in Put")
+	require.NoError(t, store.Put(ctx, "key2", Value{}), "Expected no error in Put")
+	require.ErrorIs(t, store.Put(ctx, "key3", Value{}), ErrTooManyStates, "Expected ErrTooManyStates at capacity")
+	require.NotContains(t, repo.states, "key3", "Expected the state beyond the cap not to be stored")
+
+	// Taking a state frees a slot.
+	_, err := store.Take(ctx, "key1")
+	require.NoError(t, err, "Expected no error in Take")
+	require.NoError(t, store.Put(ctx, "key3", Value{}), "Expected no error in Put after a state was taken")
+}
+
+// mockRepository is an in-memory implementation of Repository. All of its states count as unexpired for the cap.
+type mockRepository struct {
+	states map[string]repository.OAuthState
+	err    error
+}
+
+func (m *mockRepository) InsertOAuthState(ctx context.Context, state repository.OAuthState, maxStates int) error {
+	if m.err != nil {
+		return m.err
+	}
+	if maxStates > 0 && len(m.states) >= maxStates {
+		return repository.ErrLimitReached
+	}
+	m.states[state.Key] = state
+	return nil
+}
+
+func (m *mockRepository) TakeOAuthState(ctx context.Context, key string) (repository.OAuthState, error) {
+	if m.err != nil {
+		return repository.OAuthState{}, m.err
+	}
+	state, present := m.states[key]
+	if !present {
+		return repository.OAuthState{}, repository.ErrNotFound
+	}
+	delete(m.states, key)
+	return state, nil
+}
+
+func (m *mockRepository) DeleteExpiredOAuthStates(ctx context.Context, before time.Time) (int64, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	var count int64
+	for key, state := range m.states {
+		if !state.ExpiresAt.After(before) {
+			delete(m.states, key)
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,109 @@
+package statestore
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a StateStore that keeps the states in memory.
+//
+// Since the states are local to the process, it is suitable only for a single replica.
+//
+// Expired states are removed by a single sweeper goroutine, so the cost of a state does not depend on the traffic. To
+// bound the memory under a flood of sign-in attempts, the number of outstanding states can be capped.
+type MemoryStore struct {
+	ttl       time.Duration
+	maxStates int
+
+	mutex   *sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// memoryEntry is a state along with its expiry.
+type memoryEntry struct {
+	value     Value
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates a new MemoryStore whose states expire after the given TTL. A positive maxStates caps the
+// number of outstanding states.
+//
+// It accepts a context because it periodically sweeps the expired states and the context can be used to cancel the
+// underlying sweeping goroutine.
+func NewMemoryStore(ctx context.Context, ttl time.Duration, maxStates int) *MemoryStore {
+	store := &MemoryStore{ttl: ttl, maxStates: maxStates, mutex: &sync.Mutex{}, entries: map[string]memoryEntry{}}
+	if ttl > 0 {
+		go store.sweepPeriodically(ctx, ttl)
+	}
+	return store
+}
+
+func (m *MemoryStore) Put(ctx context.Context, key string, value Value) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	if m.maxStates > 0 && len(m.entries) >= m.maxStates {
+		// Some states may have expired since the last sweep.
+		if m.sweep(now); len(m.entries) >= m.maxStates {
+			return ErrTooManyStates
+		}
+	}
+
+	m.entries[key] = memoryEntry{value: value, expiresAt: now.Add(m.ttl)}
+	return nil
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string) (Value, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, present := m.entries[key]
+	if !present {
+		return Value{}, ErrNotFound
+	}
+
+	delete(m.entries, key)
+	// The state may have expired but not yet been swept.
+	if !time.Now().Before(entry.expiresAt) {
+		return Value{}, ErrNotFound
+	}
+
+	return entry.value, nil
+}
+
+// sweepPeriodically sweeps the expired states at the given interval until the context is cancelled.
+func (m *MemoryStore) sweepPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mutex.Lock()
+			swept := m.sweep(time.Now())
+			m.mutex.Unlock()
+
+			if swept > 0 {
+				slog.InfoContext(ctx, "expired states swept", "count", swept)
+			}
+		}
+	}
+}
+
+// sweep deletes the states that have expired by the given time, and returns their count.
+// The caller must hold the mutex.
+func (m *MemoryStore) sweep(now time.Time) int {
+	var swept int
+	for key, entry := range m.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(m.entries, key)
+			swept++
+		}
+	}
+	return swept
+}
@@ -0,0 +1,132 @@
+package statestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	// The context stops the sweeper upon return.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMemoryStore(ctx, time.Minute, 0)
+	value := Value{CodeVerifier: "mockVerifier", ClientCallbackURL: "https://allowed.com"}
+
+	// Unknown key.
+	_, err := store.Take(ctx, "unknown")
+	require.ErrorIs(t, err, ErrNotFound, "Expected ErrNotFound for unknown key")
+
+	// A state can be taken once.
+	require.NoError(t, store.Put(ctx, "mockKey", value), "Expected no error in Put")
+	taken, err := store.Take(ctx, "mockKey")
+	require.NoError(t, err, "Expected no error in Take")
+	require.Equal(t, value, taken, "Taken value does not match")
+
+	_, err = store.Take(ctx, "mockKey")
+	require.ErrorIs(t, err, ErrNotFound, "Expected ErrNotFound for a state taken twice")
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Short TTL so the test doesn't take too long.
+	store := NewMemoryStore(ctx, time.Second, 0)
+
+	require.NoError(t, store.Put(ctx, "mockKey", Value{}), "Expected no error in Put")
+	require.NoError(t, store.Put(ctx, "anotherMockKey", Value{}), "Expected no error in Put")
+
+	// Expired states must be swept, even if they are never taken.
+	require.Eventually(t, func() bool { return store.len() == 0 }, time.Second*3, time.Millisecond*100,
+		"Expired states were not swept")
+
+	_, err := store.Take(ctx, "mockKey")
+	require.ErrorIs(t, err, ErrNotFound, "Expected ErrNotFound for expired state")
+}
+
+func TestMemoryStore_MaxStates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The TTL is longer than the test, so that only the cap is in effect.
+	store := NewMemoryStore(ctx, time.Minute, 2)
+
+	require.NoError(t, store.Put(ctx, "key1", Value{}), "Expected no error in Put")
+	require.NoError(t, store.Put(ctx, "key2", Value{}), "Expected no error in Put")
+	require.ErrorIs(t, store.Put(ctx, "key3", Value{}), ErrTooManyStates, "Expected ErrTooManyStates at capacity")
+
+	// Taking a state frees a slot.
+	_, err := store.Take(ctx, "key1")
+	require.NoError(t, err, "Expected no error in Take")
+	require.NoError(t, store.Put(ctx, "key3", Value{}), "Expected no error in Put after a state was taken")
+
+	// Expired states free their slots even before the sweeper runs.
+	store.mutex.Lock()
+	for key, entry := range store.entries {
+		entry.expiresAt = time.Now()
+		store.entries[key] = entry
+	}
+	store.mutex.Unlock()
+	require.NoError(t, store.Put(ctx, "key4", Value{}), "Expected no error in Put after states expired")
+	require.Equal(t, 1, store.len(), "Expected expired states to be swept")
+}
+
+func TestMemoryStore_Load(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const maxStates, attempts = 1000, 5000
+
+	store := NewMemoryStore(ctx, time.Minute, maxStates)
+	goroutinesBefore := runtime.NumGoroutine()
+
+	// A burst of sign-in attempts, far beyond the cap.
+	var succeeded, rejected int
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := store.Put(ctx, fmt.Sprintf("key%d", i), Value{CodeVerifier: "mockVerifier"})
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if errors.Is(err, ErrTooManyStates) {
+				rejected++
+			} else if err == nil {
+				succeeded++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Exactly the cap is admitted, and the rest is rejected.
+	require.Equal(t, maxStates, succeeded, "Unexpected number of stored states")
+	require.Equal(t, attempts-maxStates, rejected, "Unexpected number of rejected states")
+	require.Equal(t, maxStates, store.len(), "Unexpected number of outstanding states")
+
+	// The states do not hold any goroutines. The ones that made the attempts may take a moment to exit. This is not
+	// polled with require.Eventually, as it runs the condition in a goroutine of its own.
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond * 10) {
+		if runtime.NumGoroutine() <= goroutinesBefore {
+			break
+		}
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), goroutinesBefore, "Expected no goroutines per state")
+}
+
+// len returns the number of states in the store, including the expired ones that are yet to be swept.
+func (m *MemoryStore) len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.entries)
+}
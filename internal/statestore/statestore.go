@@ -0,0 +1,43 @@
+package statestore
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when a state does not exist, or has expired.
+var ErrNotFound = errors.New("state not found or expired")
+
+// ErrTooManyStates is returned when a state can not be stored because the store is at its capacity.
+var ErrTooManyStates = errors.New("too many outstanding states")
+
+// Value holds all contextual info for an OAuth flow.
+type Value struct {
+	// CodeVerifier is for PKCE (Proof Key for Code Exchange).
+	CodeVerifier string `json:"code_verifier"`
+	// ClientCallbackURL is the URL where the OAuth flow is supposed to end.
+	ClientCallbackURL string `json:"client_callback_url"`
+	// Nonce is sent to the provider, which embeds it in the identity token, and it must match upon callback.
+	Nonce string `json:"nonce"`
+	// LinkUserID is the ID of the signed-in user that the provider's identity is to be linked to. It is zero when
+	// the flow signs in.
+	LinkUserID int `json:"link_user_id,omitempty"`
+	// LinkBinding is also held by a cookie of the browser that started a link flow, so that the flow can not be
+	// completed by another browser. It is empty when the flow signs in.
+	LinkBinding string `json:"link_binding,omitempty"`
+	// OrgID is the ID of the organization that the user signs in to. It is empty if they sign in to none.
+	OrgID string `json:"org_id,omitempty"`
+}
+
+// StateStore persists the states of the OAuth flows, between the redirect to the provider and its callback.
+//
+// Its role is to defend against CSRF attacks as well as persist an OAuth flow's contextual info. A state expires if
+// the provider does not call back in time, and it can be taken only once.
+type StateStore interface {
+	// Put stores the value under the given key. It expires after the store's TTL.
+	// It returns ErrTooManyStates if the store is at its capacity.
+	Put(ctx context.Context, key string, value Value) error
+	// Take atomically returns and deletes the value of the given key.
+	// It returns ErrNotFound if the key does not exist, or has expired.
+	Take(ctx context.Context, key string) (Value, error)
+}
@@ -0,0 +1,74 @@
+package cryptoutils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// AEAD encrypts and authenticates data with AES-GCM.
+//
+// The sealed values are base64 (URL) encoded, so they can be stored as text or used in cookies.
+type AEAD struct {
+	aead cipher.AEAD
+}
+
+// NewAEAD creates a new AEAD with the given key, which must be 16, 24 or 32 bytes long.
+func NewAEAD(key []byte) (*AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error in aes.NewCipher call: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error in cipher.NewGCM call: %w", err)
+	}
+
+	return &AEAD{aead: aead}, nil
+}
+
+// NewAEADFromBase64 is like NewAEAD, but it accepts a base64 (standard) encoded key, as found in the configs.
+func NewAEADFromBase64(encodedKey string) (*AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key: %w", err)
+	}
+	return NewAEAD(key)
+}
+
+// Seal encrypts the plaintext. The additional data is not encrypted, but it must be the same upon opening, which
+// binds the sealed value to its context, for example, the ID of the record that holds it.
+func (a *AEAD) Seal(plaintext, additionalData []byte) (string, error) {
+	// A random nonce is safe with GCM as long as a key does not seal billions of values.
+	nonce := make([]byte, a.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error in rand.Read call: %w", err)
+	}
+
+	// The nonce is prepended to the ciphertext.
+	sealed := a.aead.Seal(nonce, nonce, plaintext, additionalData)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts and authenticates a value sealed by Seal with the same additional data.
+func (a *AEAD) Open(sealed string, additionalData []byte) ([]byte, error) {
+	sealedBytes, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sealed value: %w", err)
+	}
+
+	nonceSize := a.aead.NonceSize()
+	if len(sealedBytes) < nonceSize {
+		return nil, fmt.Errorf("sealed value is too short")
+	}
+
+	plaintext, err := a.aead.Open(nil, sealedBytes[:nonceSize], sealedBytes[nonceSize:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("error in aead.Open call: %w", err)
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,81 @@
+package cryptoutils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAEADFromBase64(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		key         string
+		errExpected bool
+	}{
+		{name: "32 byte key, no errors", key: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))},
+		{name: "16 byte key, no errors", key: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 16))},
+		{name: "Invalid key length, error expected", key: base64.StdEncoding.EncodeToString([]byte{1}), errExpected: true},
+		{name: "Invalid base64, error expected", key: "invalid base64", errExpected: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAEADFromBase64(tc.key)
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+			} else {
+				require.NoError(t, err, "Expected no error but got one")
+			}
+		})
+	}
+}
+
+func TestAEAD_SealOpen(t *testing.T) {
+	aead, err := NewAEAD(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err, "Failed to create AEAD")
+
+	plaintext, additionalData := []byte("mockPlaintext"), []byte("mockAdditionalData")
+
+	sealed, err := aead.Seal(plaintext, additionalData)
+	require.NoError(t, err, "Expected no error in Seal")
+	require.NotContains(t, sealed, string(plaintext), "Expected plaintext to be encrypted")
+
+	// Sealing the same value again must yield a different result, thanks to the random nonce.
+	sealedAgain, err := aead.Seal(plaintext, additionalData)
+	require.NoError(t, err, "Expected no error in Seal")
+	require.NotEqual(t, sealed, sealedAgain, "Expected different sealed values")
+
+	opened, err := aead.Open(sealed, additionalData)
+	require.NoError(t, err, "Expected no error in Open")
+	require.Equal(t, plaintext, opened, "Opened value does not match")
+
+	// Tamper with the first character, which belongs to the nonce.
+	tampered := "A" + sealed[1:]
+	if sealed[0] == 'A' {
+		tampered = "B" + sealed[1:]
+	}
+
+	// Another key.
+	otherAEAD, err := NewAEAD(bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err, "Failed to create AEAD")
+
+	for _, tc := range []struct {
+		name           string
+		aead           *AEAD
+		sealed         string
+		additionalData []byte
+	}{
+		{name: "Wrong additional data", aead: aead, sealed: sealed, additionalData: []byte("other")},
+		{name: "Wrong key", aead: otherAEAD, sealed: sealed, additionalData: additionalData},
+		{name: "Tampered value", aead: aead, sealed: tampered, additionalData: additionalData},
+		{name: "Too short", aead: aead, sealed: "AAAA", additionalData: additionalData},
+		{name: "Invalid base64", aead: aead, sealed: "invalid base64", additionalData: additionalData},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.aead.Open(tc.sealed, tc.additionalData)
+			require.Error(t, err, "Expected error but got none")
+		})
+	}
+}
@@ -2,6 +2,7 @@ package oauth
 
 import (
 	"context"
+	"net/url"
 	"time"
 )
 
@@ -11,6 +12,8 @@ type Provider interface {
 	Name() string
 
 	// Issuers returns the list of valid "iss" claim values for the tokens of this Provider.
+	//
+	// Providers that can not list their issuers upfront should also implement the IssuerMatcher interface.
 	Issuers() []string
 
 	// GetAuthURL returns the URL to the auth page of the provider.
@@ -20,7 +23,10 @@ type Provider interface {
 	//
 	// The "codeChallenge" parameter is for PKCE (Proof Key for Code Exchange).
 	// This method only supports the "S256" code challenge method.
-	GetAuthURL(ctx context.Context, state, codeChallenge string) string
+	//
+	// The "nonce" parameter is embedded by the provider in the identity token, which binds the token to this
+	// redirect. Providers that do not issue identity tokens, like GitHub, ignore it.
+	GetAuthURL(ctx context.Context, state, codeChallenge, nonce string) string
 
 	// TokenFromCode converts the auth code to the identity token.
 	//
@@ -28,16 +34,70 @@ type Provider interface {
 	TokenFromCode(ctx context.Context, code, codeVerifier string) (string, error)
 
 	// DecodeToken validates the token claims and signature, and returns the claims.
-	DecodeToken(ctx context.Context, token string) (Claims, error)
+	//
+	// If the "nonce" parameter is not empty, the token's nonce claim must match it. It should be the one passed to
+	// GetAuthURL. It is empty for the tokens that were not obtained through the auth page, like the refreshed ones.
+	DecodeToken(ctx context.Context, token, nonce string) (Claims, error)
+}
+
+// IssuerMatcher is implemented by providers whose valid issuers can not be listed upfront,
+// for example, because the issuer is templated per tenant.
+type IssuerMatcher interface {
+	// MatchIssuer tells whether the given "iss" claim value belongs to this provider.
+	MatchIssuer(issuer string) bool
+}
+
+// CallbackClaimsProvider is implemented by providers that send some user data in the callback request itself,
+// instead of the token. For example, Apple sends the user's name in the callback form.
+type CallbackClaimsProvider interface {
+	// ClaimsFromCallback complements the given claims with the data in the callback request's form.
+	ClaimsFromCallback(claims Claims, form url.Values) Claims
+}
+
+// FormPoster is implemented by providers that call back with an HTTP POST (response_mode=form_post) instead of a
+// redirect. For example, Apple. Such a callback is a cross-site POST, so browsers send only the cookies with
+// SameSite=None along.
+type FormPoster interface {
+	// FormPost tells whether the provider calls back with an HTTP POST.
+	FormPost() bool
+}
+
+// Refresher is implemented by providers that issue refresh tokens, which allow the identity token to be renewed
+// without the user's interaction.
+type Refresher interface {
+	// TokensFromCode is like Provider.TokenFromCode, but it also returns the refresh token, if one was issued.
+	TokensFromCode(ctx context.Context, code, codeVerifier string) (Tokens, error)
+
+	// Refresh obtains a new identity token with the given refresh token. The returned refresh token is empty unless
+	// the provider rotated it.
+	Refresh(ctx context.Context, refreshToken string) (Tokens, error)
+}
+
+// Tokens are the tokens issued by a provider.
+type Tokens struct {
+	// IDToken is the identity token, which is accepted by Provider.DecodeToken.
+	IDToken string
+	// RefreshToken is the refresh token. It can be empty.
+	RefreshToken string
 }
 
 // Claims contain the user data retrieved from an OAuth provider.
 type Claims struct {
 	Iss string    `json:"iss"`
 	Exp time.Time `json:"exp"`
+	// Sub is the user's ID on the provider. Unlike the email, it never changes, so it identifies the user's account.
+	Sub string `json:"sub"`
+
+	Email string `json:"email"`
+	// EmailVerified tells whether the provider verified that the email belongs to the user.
+	EmailVerified bool   `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	// Username is the user's handle on the provider. Not all providers have one.
+	Username string `json:"username,omitempty"`
 
-	Email      string `json:"email"`
-	GivenName  string `json:"given_name"`
-	FamilyName string `json:"family_name"`
-	Picture    string `json:"picture"`
+	// Extra holds all claims of the identity token other than the registered ones, such as groups and roles.
+	// It is nil for the providers that do not issue identity tokens.
+	Extra map[string]any `json:"-"`
 }
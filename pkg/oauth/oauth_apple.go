@@ -0,0 +1,302 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/httprc/v3"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+const (
+	// Source: https://developer.apple.com/documentation/sign_in_with_apple/request_an_authorization_to_the_sign_in_with_apple_server
+	appleAuthURL = "https://appleid.apple.com/auth/authorize"
+	// Source: https://developer.apple.com/documentation/sign_in_with_apple/generate_and_validate_tokens
+	appleTokenURL = "https://appleid.apple.com/auth/token"
+	// Source: https://developer.apple.com/documentation/sign_in_with_apple/fetch_apple_s_public_key_for_verifying_token_signature
+	appleJWKURL = "https://appleid.apple.com/auth/keys"
+	// appleIssuer is the "iss" claim of Apple's ID tokens, and the "aud" claim of the client secrets.
+	appleIssuer = "https://appleid.apple.com"
+
+	// appleClientSecretTTL is the lifetime of a generated client secret. Apple allows up to 6 months.
+	appleClientSecretTTL = time.Hour
+	// appleClientSecretLeeway is the remaining lifetime below which the client secret is regenerated, so that a
+	// secret never expires midway through a request.
+	appleClientSecretLeeway = time.Minute * 5
+)
+
+// parsedAppleAuthURL mitigates the need to repeatedly parse the auth URL.
+var parsedAppleAuthURL = mustParseURL(appleAuthURL)
+
+// Apple implements the Provider interface for Sign in with Apple.
+//
+// Apple differs from the other providers in three ways:
+//  1. It calls back with an HTTP POST (response_mode=form_post) whenever the name or email scope is requested.
+//  2. Its client secret is not static. It is an ES256 JWT signed with the private key (.p8) issued by Apple.
+//  3. The user's name is never in the ID token. It is sent in the callback form, and only upon the first sign-in.
+//
+// Read documentation here: https://developer.apple.com/documentation/sign_in_with_apple/sign_in_with_apple_rest_api
+type Apple struct {
+	// clientID is the Services ID of your application.
+	clientID string
+	// teamID is the ID of your Apple developer team. It is the issuer of the client secret.
+	teamID string
+	// keyID is the ID of the private key.
+	keyID string
+	// privateKey signs the client secrets.
+	privateKey jwk.Key
+	// callbackURL is URL that Apple will hit after the user has authenticated.
+	callbackURL string
+	// scopes for the request. Most basic scope: name email
+	scopes string
+
+	// clientSecret is the currently valid client secret, and clientSecretExpiry is its expiry.
+	clientSecret       string
+	clientSecretExpiry time.Time
+	// clientSecretMutex guards the client secret and its expiry.
+	clientSecretMutex *sync.Mutex
+
+	// tokenURL is a field, instead of a constant, only for testing purposes.
+	tokenURL string
+
+	httpClient *http.Client
+	jwkCache   *jwk.Cache
+}
+
+// appleCallbackUser is the schema of the "user" form field in Apple's callback.
+//
+// See this: https://developer.apple.com/documentation/sign_in_with_apple/request_an_authorization_to_the_sign_in_with_apple_server#3862805
+type appleCallbackUser struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+}
+
+// NewApple instantiates a new Apple provider instance.
+//
+// The privateKeyPEM is the content of the .p8 file that Apple issues for Sign in with Apple.
+//
+// It accepts a context because it periodically fetches Apple's JSON Web Keys and the context can be used to cancel
+// the underlying fetching goroutine.
+func NewApple(ctx context.Context, clientID, teamID, keyID string, privateKeyPEM []byte,
+	callbackURL, scopes string,
+) (*Apple, error) {
+	privateKey, err := parseApplePrivateKey(keyID, privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("error in parseApplePrivateKey call: %w", err)
+	}
+
+	// This allows auto-refresh of the JWK as Apple keeps rotating them.
+	jwkCache, err := jwk.NewCache(ctx, httprc.NewClient())
+	if err != nil {
+		return nil, fmt.Errorf("error in jwk.NewCache call: %w", err)
+	}
+
+	// Register Apple's JWK fetch URL.
+	if err := jwkCache.Register(ctx, appleJWKURL); err != nil {
+		return nil, fmt.Errorf("error in jwkCache.Register call: %w", err)
+	}
+
+	return &Apple{
+		clientID:          clientID,
+		teamID:            teamID,
+		keyID:             keyID,
+		privateKey:        privateKey,
+		callbackURL:       callbackURL,
+		scopes:            scopes,
+		clientSecretMutex: &sync.Mutex{},
+		tokenURL:          appleTokenURL,
+		httpClient:        &http.Client{},
+		jwkCache:          jwkCache,
+	}, nil
+}
+
+func (a *Apple) Name() string {
+	return "apple"
+}
+
+func (a *Apple) Issuers() []string {
+	return []string{appleIssuer}
+}
+
+// GetAuthURL returns the URL to Apple's auth page.
+//
+// Apple does not document PKCE support, so the code challenge is not sent. The state parameter still protects the
+// flow against CSRF, and the client secret authenticates the code exchange.
+func (a *Apple) GetAuthURL(ctx context.Context, state, codeChallenge, nonce string) string {
+	var u = &url.URL{}
+	// Copy the auth URL value into local pointer. This must not modify the original URL variable.
+	*u = *parsedAppleAuthURL
+
+	// Add all query parameters.
+	q := u.Query()
+	q.Set("client_id", a.clientID)
+	q.Set("scope", a.scopes)
+	q.Set("response_type", "code")
+	// Apple requires form_post if any scopes are requested.
+	q.Set("response_mode", "form_post")
+	q.Set("redirect_uri", a.callbackURL)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// FormPost returns true, as Apple requires form_post if any scopes are requested.
+func (a *Apple) FormPost() bool {
+	return true
+}
+
+func (a *Apple) TokenFromCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	clientSecret, err := a.getClientSecret(time.Now())
+	if err != nil {
+		return "", fmt.Errorf("error in getClientSecret call: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("code", code)
+	form.Set("client_id", a.clientID)
+	form.Set("client_secret", clientSecret)
+	form.Set("redirect_uri", a.callbackURL)
+	form.Set("grant_type", "authorization_code")
+
+	response, err := exchangeCode(ctx, a.httpClient, a.tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("error in exchangeCode call: %w", err)
+	}
+
+	// Without the ID token, the user cannot be identified.
+	if response.IDToken == "" {
+		return "", fmt.Errorf("token response does not contain an id_token")
+	}
+
+	return response.IDToken, nil
+}
+
+func (a *Apple) DecodeToken(ctx context.Context, token, nonce string) (Claims, error) {
+	// Apple's documentation for ID token verification:
+	// https://developer.apple.com/documentation/sign_in_with_apple/sign_in_with_apple_rest_api/verifying_a_user
+
+	// Obtain Apple's key set.
+	set, err := a.jwkCache.Lookup(ctx, appleJWKURL)
+	if err != nil {
+		return Claims{}, fmt.Errorf("error in jwkCache.Lookup call: %w", err)
+	}
+
+	// Parse and validate the token with the obtained key set.
+	parsed, err := jwt.Parse([]byte(token), jwt.WithKeySet(set), jwt.WithValidate(true),
+		jwt.WithAudience(a.clientID), jwt.WithIssuer(appleIssuer))
+	if err != nil {
+		return Claims{}, fmt.Errorf("error in jwt.Parse call: %w", err)
+	}
+
+	// The nonce binds the token to the redirect that started the flow, so it can not be replayed.
+	if err := verifyNonce(parsed, nonce); err != nil {
+		return Claims{}, fmt.Errorf("error in verifyNonce call: %w", err)
+	}
+
+	// Claims to return.
+	var claims Claims
+
+	if err := parsed.Get("iss", &claims.Iss); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode iss claim: %w", err)
+	}
+	if err := parsed.Get("exp", &claims.Exp); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode exp claim: %w", err)
+	}
+	if err := parsed.Get("sub", &claims.Sub); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode sub claim: %w", err)
+	}
+	if err := parsed.Get("email", &claims.Email); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode email claim: %w", err)
+	}
+
+	// Apple sends email_verified as a string in some tokens and as a boolean in others.
+	if claims.EmailVerified = emailVerified(parsed); !claims.EmailVerified {
+		return Claims{}, fmt.Errorf("email %s is not verified", claims.Email)
+	}
+
+	claims.Extra = extraClaims(parsed)
+	return claims, nil
+}
+
+// ClaimsFromCallback adds the user's name to the claims, if Apple sent it in the callback form.
+//
+// Apple sends the name only upon the first sign-in of the user, so it's expected to be absent most of the time.
+func (a *Apple) ClaimsFromCallback(claims Claims, form url.Values) Claims {
+	userJSON := form.Get("user")
+	if userJSON == "" {
+		return claims
+	}
+
+	// A malformed value is ignored, as the name is not essential for authentication.
+	var user appleCallbackUser
+	if err := json.Unmarshal([]byte(userJSON), &user); err != nil {
+		return claims
+	}
+
+	claims.GivenName, claims.FamilyName = user.Name.FirstName, user.Name.LastName
+	return claims
+}
+
+// getClientSecret returns the cached client secret, or generates a new one if it's about to expire.
+//
+// See this: https://developer.apple.com/documentation/accountorganizationaldatasharing/creating-a-client-secret
+func (a *Apple) getClientSecret(now time.Time) (string, error) {
+	a.clientSecretMutex.Lock()
+	defer a.clientSecretMutex.Unlock()
+
+	// Reuse the existing secret if it's valid long enough.
+	if a.clientSecret != "" && now.Add(appleClientSecretLeeway).Before(a.clientSecretExpiry) {
+		return a.clientSecret, nil
+	}
+
+	expiry := now.Add(appleClientSecretTTL)
+	token, err := jwt.NewBuilder().
+		Issuer(a.teamID).
+		IssuedAt(now).
+		Expiration(expiry).
+		Audience([]string{appleIssuer}).
+		Subject(a.clientID).
+		Build()
+	if err != nil {
+		return "", fmt.Errorf("error in builder.Build call: %w", err)
+	}
+
+	// The key ID of the private key is added to the header by the signing process.
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.ES256(), a.privateKey))
+	if err != nil {
+		return "", fmt.Errorf("error in jwt.Sign call: %w", err)
+	}
+
+	a.clientSecret, a.clientSecretExpiry = string(signed), expiry
+	return a.clientSecret, nil
+}
+
+// parseApplePrivateKey parses the PEM encoded .p8 private key and attaches the given key ID to it.
+func parseApplePrivateKey(keyID string, privateKeyPEM []byte) (jwk.Key, error) {
+	key, err := jwk.ParseKey(privateKeyPEM, jwk.WithPEM(true))
+	if err != nil {
+		return nil, fmt.Errorf("error in jwk.ParseKey call: %w", err)
+	}
+
+	// Client secrets must be signed with ES256, which needs a P-256 EC key.
+	if key.KeyType() != jwa.EC() {
+		return nil, fmt.Errorf("private key must be an EC key, got %s", key.KeyType())
+	}
+
+	if err := key.Set(jwk.KeyIDKey, keyID); err != nil {
+		return nil, fmt.Errorf("error in key.Set call: %w", err)
+	}
+
+	return key, nil
+}
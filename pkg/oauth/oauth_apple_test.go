@@ -0,0 +1,349 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/httprc/v3"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/utils/httputils"
+)
+
+func TestApple_Name(t *testing.T) {
+	require.Equal(t, "apple", (&Apple{}).Name())
+}
+
+func TestApple_FormPost(t *testing.T) {
+	require.True(t, (&Apple{}).FormPost())
+}
+
+func TestApple_GetAuthURL(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	apple, _, err := newMockApple(ctx)
+	require.NoError(t, err, "Failed to create Apple instance")
+
+	// Method to test.
+	authURL := apple.GetAuthURL(ctx, "mockState", "mockCodeChallenge", "mockNonce")
+
+	// Verify that the returned URL is valid.
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err, "Expected URL parsing to succeed")
+
+	// Returned URL must be the Apple Auth URL.
+	require.Equal(t, appleAuthURL, parsed.Scheme+"://"+parsed.Host+parsed.Path)
+
+	// Match query params.
+	require.Equal(t, apple.clientID, parsed.Query().Get("client_id"), "Incorrect Client ID")
+	require.Equal(t, apple.scopes, parsed.Query().Get("scope"), "Incorrect Scope")
+	require.Equal(t, "code", parsed.Query().Get("response_type"), "Incorrect Response Type")
+	require.Equal(t, "form_post", parsed.Query().Get("response_mode"), "Incorrect Response Mode")
+	require.Equal(t, apple.callbackURL, parsed.Query().Get("redirect_uri"), "Incorrect Redirect URI")
+	require.Equal(t, "mockState", parsed.Query().Get("state"), "Incorrect state")
+	require.Equal(t, "mockNonce", parsed.Query().Get("nonce"), "Incorrect nonce")
+	require.Empty(t, parsed.Query().Get("code_challenge"), "Code challenge must not be sent")
+}
+
+func TestApple_TokenFromCode(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	for _, tc := range []struct {
+		name        string
+		status      int
+		response    tokenResponse
+		errExpected bool
+	}{
+		{
+			name:     "Everything good, no errors",
+			status:   http.StatusOK,
+			response: tokenResponse{AccessToken: "mockAccessToken", IDToken: "mockIDToken"},
+		},
+		{
+			name:        "Response without ID token, error expected",
+			status:      http.StatusOK,
+			response:    tokenResponse{AccessToken: "mockAccessToken"},
+			errExpected: true,
+		},
+		{
+			name:        "Request returns non 2xx status code, error expected",
+			status:      http.StatusBadRequest,
+			response:    tokenResponse{Error: "invalid_client"},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			apple, privateKey, err := newMockApple(ctx)
+			require.NoError(t, err, "Failed to create Apple instance")
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Verify request details.
+				require.Equal(t, http.MethodPost, r.Method)
+				require.NoError(t, r.ParseForm(), "Expected body to be a valid form")
+
+				// Verify request body.
+				require.Equal(t, "mockCode", r.PostForm.Get("code"))
+				require.Equal(t, "mockClientID", r.PostForm.Get("client_id"))
+				require.Equal(t, "mockCallbackURL", r.PostForm.Get("redirect_uri"))
+				require.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+				require.Empty(t, r.PostForm.Get("code_verifier"), "Code verifier must not be sent")
+
+				// The client secret must be a JWT signed by the private key.
+				publicKey, err := privateKey.PublicKey()
+				require.NoError(t, err, "Failed to get public key")
+				secret, err := jwt.Parse([]byte(r.PostForm.Get("client_secret")),
+					jwt.WithKey(jwa.ES256(), publicKey), jwt.WithValidate(true),
+					jwt.WithIssuer("mockTeamID"), jwt.WithAudience(appleIssuer), jwt.WithSubject("mockClientID"))
+				require.NoError(t, err, "Expected client secret to be valid")
+				require.NotNil(t, secret)
+
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(tc.response)
+			}))
+			defer server.Close()
+
+			apple.tokenURL = server.URL
+			token, err := apple.TokenFromCode(ctx, "mockCode", "mockCodeVerifier")
+
+			// Verify based on error expectation.
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				require.Equal(t, "", token, "Expected token to be empty")
+			} else {
+				require.NoError(t, err, "Expected no error but got one")
+				require.Equal(t, tc.response.IDToken, token, "ID token does not match")
+			}
+		})
+	}
+}
+
+func TestApple_getClientSecret(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	apple, _, err := newMockApple(ctx)
+	require.NoError(t, err, "Failed to create Apple instance")
+
+	now := time.Now()
+	first, err := apple.getClientSecret(now)
+	require.NoError(t, err, "Expected no error but got one")
+
+	// The secret must carry the key ID.
+	message, err := jws.Parse([]byte(first))
+	require.NoError(t, err, "Expected client secret to be a JWS")
+	keyID, _ := message.Signatures()[0].ProtectedHeaders().KeyID()
+	require.Equal(t, "mockKeyID", keyID, "Key ID does not match")
+
+	// The secret must be reused while it's valid.
+	second, err := apple.getClientSecret(now.Add(time.Minute))
+	require.NoError(t, err, "Expected no error but got one")
+	require.Equal(t, first, second, "Expected client secret to be reused")
+
+	// The secret must be rotated when it's about to expire.
+	third, err := apple.getClientSecret(now.Add(appleClientSecretTTL - appleClientSecretLeeway))
+	require.NoError(t, err, "Expected no error but got one")
+	require.NotEqual(t, first, third, "Expected client secret to be rotated")
+}
+
+func TestApple_DecodeToken(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	apple, _, err := newMockApple(ctx)
+	require.NoError(t, err, "Failed to create Apple instance")
+
+	// Get the key set to generate tokens for testing.
+	keySet, err := apple.jwkCache.Lookup(ctx, appleJWKURL)
+	require.NoError(t, err, "Failed to lookup JWK")
+
+	expiresAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+
+	// Inputs required to create a valid token. Apple sends email_verified as a string.
+	tokenInput := generateTokenInput{
+		keySet:      keySet,
+		audience:    apple.clientID,
+		issuer:      appleIssuer,
+		expiry:      expiresAt,
+		claims:      Claims{Sub: "mockSubject", Email: "mock@privaterelay.appleid.com"},
+		extraClaims: map[string]any{"email_verified": "true"},
+	}
+
+	// Valid token for the happy path.
+	validToken, err := generateToken(tokenInput)
+	require.NoError(t, err, "Failed to generate valid token")
+
+	// Token with boolean email_verified claim.
+	var boolVerifiedInput = tokenInput
+	boolVerifiedInput.extraClaims = map[string]any{"email_verified": true}
+	boolVerifiedToken, err := generateToken(boolVerifiedInput)
+	require.NoError(t, err, "Failed to generate token with boolean email_verified")
+
+	// Unverified email.
+	var unverifiedInput = tokenInput
+	unverifiedInput.extraClaims = map[string]any{"email_verified": "false"}
+	unverifiedToken, err := generateToken(unverifiedInput)
+	require.NoError(t, err, "Failed to generate unverified token")
+
+	// Bad issuer token.
+	var badIssuerInput = tokenInput
+	badIssuerInput.issuer = appleIssuer + "Random"
+	badIssuerToken, err := generateToken(badIssuerInput)
+	require.NoError(t, err, "Failed to generate bad issuer token")
+
+	// The email_verified claim is modeled, so it is not a part of the extra claims.
+	expectedClaims := Claims{Iss: appleIssuer, Exp: expiresAt, Sub: "mockSubject", Email: "mock@privaterelay.appleid.com",
+		EmailVerified: true}
+
+	for _, tc := range []struct {
+		name           string
+		token          string
+		expectedClaims Claims
+		errSubstring   string
+	}{
+		{
+			name:           "Valid token, no errors",
+			token:          validToken,
+			expectedClaims: expectedClaims,
+		},
+		{
+			name:           "Valid token with boolean email_verified, no errors",
+			token:          boolVerifiedToken,
+			expectedClaims: expectedClaims,
+		},
+		{
+			name:         "Unverified email, error expected",
+			token:        unverifiedToken,
+			errSubstring: "is not verified",
+		},
+		{
+			name:         "Bad issuer token, error expected",
+			token:        badIssuerToken,
+			errSubstring: `"iss" not satisfied`,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := apple.DecodeToken(ctx, tc.token, "")
+			if tc.errSubstring != "" {
+				require.Error(t, err, "Expected error but got none")
+				require.Contains(t, err.Error(), tc.errSubstring)
+			} else {
+				require.NoError(t, err, "Expected no error but got one")
+				require.Equal(t, tc.expectedClaims, claims, "Claims are not as expected")
+			}
+		})
+	}
+}
+
+func TestApple_ClaimsFromCallback(t *testing.T) {
+	claims := Claims{Iss: appleIssuer, Email: "mock@privaterelay.appleid.com"}
+
+	for _, tc := range []struct {
+		name           string
+		user           string
+		expectedClaims Claims
+	}{
+		{
+			name: "First sign-in, name is present",
+			user: `{"name":{"firstName":"John","lastName":"Doe"},"email":"mock@privaterelay.appleid.com"}`,
+			expectedClaims: Claims{Iss: appleIssuer, Email: "mock@privaterelay.appleid.com",
+				GivenName: "John", FamilyName: "Doe"},
+		},
+		{
+			name:           "Subsequent sign-in, name is absent",
+			user:           "",
+			expectedClaims: claims,
+		},
+		{
+			name:           "Malformed user, claims are unchanged",
+			user:           "{",
+			expectedClaims: claims,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Set("user", tc.user)
+			require.Equal(t, tc.expectedClaims, (&Apple{}).ClaimsFromCallback(claims, form))
+		})
+	}
+}
+
+// newMockApple returns a new mock Apple instance along with its private key.
+//
+// It mocks all parameters including the JWK cache (with a mock HTTP RC client).
+func newMockApple(ctx context.Context) (*Apple, jwk.Key, error) {
+	// Generate a private key, just like the .p8 file issued by Apple.
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	privateKey, err := parseApplePrivateKey("mockKeyID", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	// Transport for the mock HTTP client that will be passed to the HTTP RC client.
+	transport := httputils.RoundTripFunc(func(_ *http.Request) *http.Response {
+		body := io.NopCloser(strings.NewReader(customKeySet))
+		return &http.Response{StatusCode: http.StatusOK, Body: body}
+	})
+
+	// Mock HTTP RC client.
+	httpRCClient := httprc.NewClient(httprc.WithHTTPClient(&http.Client{Transport: transport}))
+
+	// Create JWK cache object with mock HTTP client.
+	cache, err := jwk.NewCache(ctx, httpRCClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create JWK cache: %w", err)
+	}
+
+	// Register Apple's JWK URL.
+	if err := cache.Register(ctx, appleJWKURL); err != nil {
+		return nil, nil, fmt.Errorf("failed to register Apple JWK URL: %w", err)
+	}
+
+	return &Apple{
+		clientID:          "mockClientID",
+		teamID:            "mockTeamID",
+		keyID:             "mockKeyID",
+		privateKey:        privateKey,
+		callbackURL:       "mockCallbackURL",
+		scopes:            "name email",
+		clientSecretMutex: &sync.Mutex{},
+		tokenURL:          appleTokenURL,
+		httpClient:        &http.Client{},
+		jwkCache:          cache,
+	}, privateKey, nil
+}
@@ -0,0 +1,194 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Source: https://discord.com/developers/docs/topics/oauth2#shared-resources-oauth2-urls
+	discordAuthURL = "https://discord.com/oauth2/authorize"
+	discordAPIURL  = "https://discord.com/api/v10"
+	// Source: https://discord.com/developers/docs/reference#image-formatting
+	discordCDNURL = "https://cdn.discordapp.com"
+
+	// discordIssuer is used as the "iss" claim value for Discord users. Discord's access tokens are not JWTs, so it's
+	// not an actual issuer, but it keeps the claims consistent with the other providers.
+	discordIssuer = "https://discord.com"
+)
+
+// parsedDiscordAuthURL mitigates the need to repeatedly parse the auth URL.
+var parsedDiscordAuthURL = mustParseURL(discordAuthURL)
+
+// Discord implements the Provider interface for Discord.
+//
+// Like GitHub, Discord's tokens are opaque access tokens. They are "decoded" by calling Discord's APIs, which also
+// serves as their verification.
+//
+// Read documentation here: https://discord.com/developers/docs/topics/oauth2#authorization-code-grant
+type Discord struct {
+	// clientID of your application.
+	clientID string
+	// clientSecret for your application.
+	clientSecret string
+	// callbackURL is URL that Discord will hit after the user has authenticated.
+	callbackURL string
+	// scopes for the request. Most basic scope: identify email
+	scopes string
+
+	// apiURL and cdnURL are fields, instead of constants, only for testing purposes.
+	apiURL string
+	cdnURL string
+
+	httpClient *http.Client
+}
+
+// discordUser is the body schema of the response returned by Discord's current user API.
+//
+// See this: https://discord.com/developers/docs/resources/user#user-object
+type discordUser struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+	GlobalName    string `json:"global_name"`
+	Avatar        string `json:"avatar"`
+	Email         string `json:"email"`
+	Verified      bool   `json:"verified"`
+}
+
+// discordAuthorization is the body schema of the response returned by Discord's current authorization API.
+//
+// See this: https://discord.com/developers/docs/topics/oauth2#get-current-authorization-information
+type discordAuthorization struct {
+	Expires time.Time `json:"expires"`
+}
+
+// NewDiscord instantiates a new Discord provider instance.
+func NewDiscord(clientID, clientSecret, callbackURL, scopes string) *Discord {
+	return &Discord{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		callbackURL:  callbackURL,
+		scopes:       scopes,
+		apiURL:       discordAPIURL,
+		cdnURL:       discordCDNURL,
+		httpClient:   &http.Client{},
+	}
+}
+
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+func (d *Discord) Issuers() []string {
+	return []string{discordIssuer}
+}
+
+func (d *Discord) GetAuthURL(ctx context.Context, state, codeChallenge, nonce string) string {
+	var u = &url.URL{}
+	// Copy the auth URL value into local pointer. This must not modify the original URL variable.
+	*u = *parsedDiscordAuthURL
+
+	// Add all query parameters.
+	q := u.Query()
+	q.Set("client_id", d.clientID)
+	q.Set("scope", d.scopes)
+	q.Set("response_type", "code")
+	q.Set("redirect_uri", d.callbackURL)
+	q.Set("state", state)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (d *Discord) TokenFromCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("code", code)
+	form.Set("client_id", d.clientID)
+	form.Set("client_secret", d.clientSecret)
+	form.Set("redirect_uri", d.callbackURL)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code_verifier", codeVerifier)
+
+	response, err := exchangeCode(ctx, d.httpClient, d.apiURL+"/oauth2/token", form)
+	if err != nil {
+		return "", fmt.Errorf("error in exchangeCode call: %w", err)
+	}
+
+	if response.AccessToken == "" {
+		return "", fmt.Errorf("token response does not contain an access_token")
+	}
+
+	return response.AccessToken, nil
+}
+
+func (d *Discord) DecodeToken(ctx context.Context, token, nonce string) (Claims, error) {
+	// The token is an access token, which has no nonce. The flow is protected by the state and PKCE instead.
+
+	// Fetch the token's authorization info for its expiry. This fails if the token is invalid or revoked.
+	var authorization discordAuthorization
+	if err := getJSON(ctx, d.httpClient, d.apiURL+"/oauth2/@me", token, &authorization); err != nil {
+		return Claims{}, fmt.Errorf("failed to get authorization info: %w", err)
+	}
+
+	// Fetch the user's profile.
+	var user discordUser
+	if err := getJSON(ctx, d.httpClient, d.apiURL+"/users/@me", token, &user); err != nil {
+		return Claims{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// The email is present only with the "email" scope, and could be unverified.
+	if user.Email == "" || !user.Verified {
+		return Claims{}, fmt.Errorf("user %s does not have a verified email", user.Username)
+	}
+
+	// Global name is the display name of the user. It is absent if the user never set one.
+	name := user.GlobalName
+	if name == "" {
+		name = user.Username
+	}
+
+	return Claims{
+		Iss:           discordIssuer,
+		Exp:           authorization.Expires,
+		Sub:           user.ID,
+		Email:         user.Email,
+		EmailVerified: true,
+		GivenName:     name,
+		Picture:       d.avatarURL(user),
+		Username:      user.Username,
+	}, nil
+}
+
+// avatarURL returns the CDN URL of the given user's avatar, or of their default avatar if they haven't set any.
+//
+// See this: https://discord.com/developers/docs/reference#image-formatting-cdn-endpoints
+func (d *Discord) avatarURL(user discordUser) string {
+	if user.Avatar != "" {
+		// Animated avatars have the "a_" prefix.
+		extension := "png"
+		if strings.HasPrefix(user.Avatar, "a_") {
+			extension = "gif"
+		}
+		return fmt.Sprintf("%s/avatars/%s/%s.%s", d.cdnURL, user.ID, user.Avatar, extension)
+	}
+
+	// The default avatar index depends upon whether the user has migrated to the new username system.
+	var index uint64
+	if user.Discriminator == "" || user.Discriminator == "0" {
+		id, _ := strconv.ParseUint(user.ID, 10, 64)
+		index = (id >> 22) % 6
+	} else {
+		discriminator, _ := strconv.ParseUint(user.Discriminator, 10, 64)
+		index = discriminator % 5
+	}
+
+	return fmt.Sprintf("%s/embed/avatars/%d.png", d.cdnURL, index)
+}
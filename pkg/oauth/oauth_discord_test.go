@@ -0,0 +1,208 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscord_Name(t *testing.T) {
+	require.Equal(t, "discord", (&Discord{}).Name())
+}
+
+func TestDiscord_GetAuthURL(t *testing.T) {
+	discord := NewDiscord("mockClientID", "mockClientSecret", "mockCallbackURL", "identify email")
+
+	// Method to test.
+	authURL := discord.GetAuthURL(context.Background(), "mockState", "mockCodeChallenge", "mockNonce")
+
+	// Verify that the returned URL is valid.
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err, "Expected URL parsing to succeed")
+
+	// Returned URL must be the Discord Auth URL.
+	require.Equal(t, discordAuthURL, parsed.Scheme+"://"+parsed.Host+parsed.Path)
+
+	// Match query params.
+	require.Equal(t, discord.clientID, parsed.Query().Get("client_id"), "Incorrect Client ID")
+	require.Equal(t, discord.scopes, parsed.Query().Get("scope"), "Incorrect Scope")
+	require.Equal(t, "code", parsed.Query().Get("response_type"), "Incorrect Response Type")
+	require.Equal(t, discord.callbackURL, parsed.Query().Get("redirect_uri"), "Incorrect Redirect URI")
+	require.Equal(t, "mockState", parsed.Query().Get("state"), "Incorrect state")
+	// Without identity tokens, the nonce is of no use.
+	require.False(t, parsed.Query().Has("nonce"), "Expected no nonce")
+	require.Equal(t, "mockCodeChallenge", parsed.Query().Get("code_challenge"), "Incorrect code challenge")
+	require.Equal(t, "S256", parsed.Query().Get("code_challenge_method"), "Incorrect code challenge method")
+}
+
+func TestDiscord_TokenFromCode(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		status      int
+		response    tokenResponse
+		errExpected bool
+	}{
+		{
+			name:        "Everything good, no errors",
+			status:      http.StatusOK,
+			response:    tokenResponse{AccessToken: "mockAccessToken", TokenType: "Bearer", ExpiresIn: 604800},
+			errExpected: false,
+		},
+		{
+			name:        "Request returns non 2xx status code, error expected",
+			status:      http.StatusBadRequest,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Verify request details.
+				require.Equal(t, http.MethodPost, r.Method)
+				require.Equal(t, "/oauth2/token", r.URL.Path)
+				require.NoError(t, r.ParseForm(), "Expected body to be a valid form")
+
+				// Verify request body.
+				require.Equal(t, "mockCode", r.PostForm.Get("code"))
+				require.Equal(t, "mockClientID", r.PostForm.Get("client_id"))
+				require.Equal(t, "mockClientSecret", r.PostForm.Get("client_secret"))
+				require.Equal(t, "mockCallbackURL", r.PostForm.Get("redirect_uri"))
+				require.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+				require.Equal(t, "mockCodeVerifier", r.PostForm.Get("code_verifier"))
+
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(tc.response)
+			}))
+			defer server.Close()
+
+			discord := NewDiscord("mockClientID", "mockClientSecret", "mockCallbackURL", "identify email")
+			discord.apiURL = server.URL
+
+			token, err := discord.TokenFromCode(context.Background(), "mockCode", "mockCodeVerifier")
+
+			// Verify based on error expectation.
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				require.Equal(t, "", token, "Expected access token to be empty")
+			} else {
+				require.NoError(t, err, "Expected no error but got one")
+				require.Equal(t, tc.response.AccessToken, token, "Access token does not match")
+			}
+		})
+	}
+}
+
+func TestDiscord_DecodeToken(t *testing.T) {
+	const mockToken = "mockAccessToken"
+	// Expiry of the mock token.
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	for _, tc := range []struct {
+		name string
+		// Mock API responses.
+		authStatus int
+		user       discordUser
+		// Expectations.
+		expectedClaims Claims
+		errExpected    bool
+	}{
+		{
+			name:       "User with global name and avatar, no errors",
+			authStatus: http.StatusOK,
+			user: discordUser{ID: "80351110224678912", Username: "nelly", GlobalName: "Nelly",
+				Avatar: "8342729096ea3675442027381ff50dfe", Email: "nelly@discord.com", Verified: true},
+			expectedClaims: Claims{
+				Iss:           discordIssuer,
+				Sub:           "80351110224678912",
+				Exp:           expires,
+				Email:         "nelly@discord.com",
+				EmailVerified: true,
+				GivenName:     "Nelly",
+				Picture:       "CDN/avatars/80351110224678912/8342729096ea3675442027381ff50dfe.png",
+				Username:      "nelly",
+			},
+		},
+		{
+			name:       "User with animated avatar, no errors",
+			authStatus: http.StatusOK,
+			user: discordUser{ID: "80351110224678912", Username: "nelly", GlobalName: "Nelly",
+				Avatar: "a_8342729096ea3675442027381ff50dfe", Email: "nelly@discord.com", Verified: true},
+			expectedClaims: Claims{
+				Iss:           discordIssuer,
+				Sub:           "80351110224678912",
+				Exp:           expires,
+				Email:         "nelly@discord.com",
+				EmailVerified: true,
+				GivenName:     "Nelly",
+				Picture:       "CDN/avatars/80351110224678912/a_8342729096ea3675442027381ff50dfe.gif",
+				Username:      "nelly",
+			},
+		},
+		{
+			name:       "User without global name and avatar, defaults are used",
+			authStatus: http.StatusOK,
+			user: discordUser{ID: "80351110224678912", Username: "nelly", Discriminator: "0",
+				Email: "nelly@discord.com", Verified: true},
+			expectedClaims: Claims{
+				Iss:           discordIssuer,
+				Sub:           "80351110224678912",
+				Exp:           expires,
+				Email:         "nelly@discord.com",
+				EmailVerified: true,
+				GivenName:     "nelly",
+				// (80351110224678912 >> 22) % 6 = 5
+				Picture:  "CDN/embed/avatars/5.png",
+				Username: "nelly",
+			},
+		},
+		{
+			name:        "Invalid token, error expected",
+			authStatus:  http.StatusUnauthorized,
+			errExpected: true,
+		},
+		{
+			name:        "Unverified email, error expected",
+			authStatus:  http.StatusOK,
+			user:        discordUser{ID: "80351110224678912", Username: "nelly", Email: "nelly@discord.com"},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/oauth2/@me", func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "Bearer "+mockToken, r.Header.Get("Authorization"))
+				w.WriteHeader(tc.authStatus)
+				_ = json.NewEncoder(w).Encode(discordAuthorization{Expires: expires})
+			})
+			mux.HandleFunc("/users/@me", func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "Bearer "+mockToken, r.Header.Get("Authorization"))
+				_ = json.NewEncoder(w).Encode(tc.user)
+			})
+
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			discord := NewDiscord("mockClientID", "mockClientSecret", "mockCallbackURL", "identify email")
+			discord.apiURL, discord.cdnURL = server.URL, "CDN"
+
+			claims, err := discord.DecodeToken(context.Background(), mockToken, "")
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				return
+			}
+
+			require.NoError(t, err, "Expected no error but got one")
+			require.True(t, tc.expectedClaims.Exp.Equal(claims.Exp), "Expiry is not as expected")
+
+			claims.Exp = tc.expectedClaims.Exp
+			require.Equal(t, tc.expectedClaims, claims, "Claims are not as expected")
+		})
+	}
+}
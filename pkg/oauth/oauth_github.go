@@ -0,0 +1,178 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// Source: https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/authorizing-oauth-apps#web-application-flow
+	githubAuthURL  = "https://github.com/login/oauth/authorize"
+	githubTokenURL = "https://github.com/login/oauth/access_token"
+	// Source: https://docs.github.com/en/rest/users/users#get-the-authenticated-user
+	githubAPIURL = "https://api.github.com"
+
+	// githubIssuer is used as the "iss" claim value for GitHub users. GitHub does not issue ID tokens, so it's not
+	// an actual issuer, but it keeps the claims consistent with the other providers.
+	githubIssuer = "https://github.com"
+	// githubTokenLifetime is the lifetime assumed for GitHub access tokens. OAuth App tokens do not expire at all,
+	// so this is the same as the lifetime of the expiring user tokens of GitHub Apps.
+	githubTokenLifetime = 8 * time.Hour
+)
+
+// parsedGitHubAuthURL mitigates the need to repeatedly parse the auth URL.
+var parsedGitHubAuthURL = mustParseURL(githubAuthURL)
+
+// GitHub implements the Provider interface for GitHub.
+//
+// GitHub does not support OpenID Connect, so its tokens are opaque access tokens and not JWTs. They are "decoded" by
+// calling GitHub's user and emails APIs, which also serves as their verification.
+//
+// Read documentation here: https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/authorizing-oauth-apps
+type GitHub struct {
+	// clientID of your application.
+	clientID string
+	// clientSecret for your application.
+	clientSecret string
+	// callbackURL is URL that GitHub will hit after the user has authenticated.
+	callbackURL string
+	// scopes for the request. Most basic scope: read:user user:email
+	scopes string
+
+	// tokenURL and apiURL are fields, instead of constants, only for testing purposes.
+	tokenURL string
+	apiURL   string
+
+	httpClient *http.Client
+}
+
+// githubUser is the body schema of the response returned by GitHub's user API.
+//
+// See this: https://docs.github.com/en/rest/users/users#get-the-authenticated-user
+type githubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// githubEmail is a single element of the response returned by GitHub's emails API.
+//
+// See this: https://docs.github.com/en/rest/users/emails#list-email-addresses-for-the-authenticated-user
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// NewGitHub instantiates a new GitHub provider instance.
+func NewGitHub(clientID, clientSecret, callbackURL, scopes string) *GitHub {
+	return &GitHub{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		callbackURL:  callbackURL,
+		scopes:       scopes,
+		tokenURL:     githubTokenURL,
+		apiURL:       githubAPIURL,
+		httpClient:   &http.Client{},
+	}
+}
+
+func (g *GitHub) Name() string {
+	return "github"
+}
+
+func (g *GitHub) Issuers() []string {
+	return []string{githubIssuer}
+}
+
+func (g *GitHub) GetAuthURL(ctx context.Context, state, codeChallenge, nonce string) string {
+	var u = &url.URL{}
+	// Copy the auth URL value into local pointer. This must not modify the original URL variable.
+	*u = *parsedGitHubAuthURL
+
+	// Add all query parameters.
+	q := u.Query()
+	q.Set("client_id", g.clientID)
+	q.Set("scope", g.scopes)
+	q.Set("redirect_uri", g.callbackURL)
+	q.Set("state", state)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (g *GitHub) TokenFromCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("code", code)
+	form.Set("client_id", g.clientID)
+	form.Set("client_secret", g.clientSecret)
+	form.Set("redirect_uri", g.callbackURL)
+	form.Set("code_verifier", codeVerifier)
+
+	response, err := exchangeCode(ctx, g.httpClient, g.tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("error in exchangeCode call: %w", err)
+	}
+
+	if response.AccessToken == "" {
+		return "", fmt.Errorf("token response does not contain an access_token")
+	}
+
+	return response.AccessToken, nil
+}
+
+func (g *GitHub) DecodeToken(ctx context.Context, token, nonce string) (Claims, error) {
+	// The token is an access token, which has no nonce. The flow is protected by the state and PKCE instead.
+
+	// Fetch the user's profile. This fails if the token is invalid or revoked.
+	var user githubUser
+	if err := getJSON(ctx, g.httpClient, g.apiURL+"/user", token, &user); err != nil {
+		return Claims{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// The email in the profile is only the public one, and may be absent or unverified.
+	// So, the primary verified email is obtained from the emails API.
+	var emails []githubEmail
+	if err := getJSON(ctx, g.httpClient, g.apiURL+"/user/emails", token, &emails); err != nil {
+		return Claims{}, fmt.Errorf("failed to get user emails: %w", err)
+	}
+
+	var primaryEmail string
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			primaryEmail = email.Email
+			break
+		}
+	}
+
+	if primaryEmail == "" {
+		return Claims{}, fmt.Errorf("user %s does not have a primary verified email", user.Login)
+	}
+
+	// Not all GitHub users have a name, but all of them have a login.
+	name := user.Name
+	if name == "" {
+		name = user.Login
+	}
+
+	givenName, familyName := splitName(name)
+
+	return Claims{
+		Iss:           githubIssuer,
+		Exp:           time.Now().Add(githubTokenLifetime),
+		Sub:           strconv.FormatInt(user.ID, 10),
+		Email:         primaryEmail,
+		EmailVerified: true,
+		GivenName:     givenName,
+		FamilyName:    familyName,
+		Picture:       user.AvatarURL,
+		Username:      user.Login,
+	}, nil
+}
@@ -0,0 +1,197 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitHub_Name(t *testing.T) {
+	require.Equal(t, "github", (&GitHub{}).Name())
+}
+
+func TestGitHub_GetAuthURL(t *testing.T) {
+	github := NewGitHub("mockClientID", "mockClientSecret", "mockCallbackURL", "read:user user:email")
+
+	// Method to test.
+	authURL := github.GetAuthURL(context.Background(), "mockState", "mockCodeChallenge", "mockNonce")
+
+	// Verify that the returned URL is valid.
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err, "Expected URL parsing to succeed")
+
+	// Returned URL must be the GitHub Auth URL.
+	require.Equal(t, githubAuthURL, parsed.Scheme+"://"+parsed.Host+parsed.Path)
+
+	// Match query params.
+	require.Equal(t, github.clientID, parsed.Query().Get("client_id"), "Incorrect Client ID")
+	require.Equal(t, github.scopes, parsed.Query().Get("scope"), "Incorrect Scope")
+	require.Equal(t, github.callbackURL, parsed.Query().Get("redirect_uri"), "Incorrect Redirect URI")
+	require.Equal(t, "mockState", parsed.Query().Get("state"), "Incorrect state")
+	// Without identity tokens, the nonce is of no use.
+	require.False(t, parsed.Query().Has("nonce"), "Expected no nonce")
+	require.Equal(t, "mockCodeChallenge", parsed.Query().Get("code_challenge"), "Incorrect code challenge")
+	require.Equal(t, "S256", parsed.Query().Get("code_challenge_method"), "Incorrect code challenge method")
+}
+
+func TestGitHub_TokenFromCode(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		status      int
+		response    tokenResponse
+		errExpected bool
+	}{
+		{
+			name:        "Everything good, no errors",
+			status:      http.StatusOK,
+			response:    tokenResponse{AccessToken: "mockAccessToken", TokenType: "bearer"},
+			errExpected: false,
+		},
+		{
+			name:        "Request returns non 2xx status code, error expected",
+			status:      http.StatusBadRequest,
+			errExpected: true,
+		},
+		{
+			name:        "Error returned with 200 status code, error expected",
+			status:      http.StatusOK,
+			response:    tokenResponse{Error: "bad_verification_code"},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Verify request details.
+				require.Equal(t, http.MethodPost, r.Method)
+				require.Equal(t, "application/json", r.Header.Get("Accept"))
+				require.NoError(t, r.ParseForm(), "Expected body to be a valid form")
+
+				// Verify request body.
+				require.Equal(t, "mockCode", r.PostForm.Get("code"))
+				require.Equal(t, "mockClientID", r.PostForm.Get("client_id"))
+				require.Equal(t, "mockClientSecret", r.PostForm.Get("client_secret"))
+				require.Equal(t, "mockCodeVerifier", r.PostForm.Get("code_verifier"))
+
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(tc.response)
+			}))
+			defer server.Close()
+
+			github := NewGitHub("mockClientID", "mockClientSecret", "mockCallbackURL", "read:user user:email")
+			github.tokenURL = server.URL
+
+			token, err := github.TokenFromCode(context.Background(), "mockCode", "mockCodeVerifier")
+
+			// Verify based on error expectation.
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				require.Equal(t, "", token, "Expected access token to be empty")
+			} else {
+				require.NoError(t, err, "Expected no error but got one")
+				require.Equal(t, tc.response.AccessToken, token, "Access token does not match")
+			}
+		})
+	}
+}
+
+func TestGitHub_DecodeToken(t *testing.T) {
+	const mockToken = "gho_mockToken"
+
+	for _, tc := range []struct {
+		name string
+		// Mock API responses.
+		user       githubUser
+		userStatus int
+		emails     []githubEmail
+		// Expectations.
+		expectedClaims Claims
+		errExpected    bool
+	}{
+		{
+			name:       "Everything good, no errors",
+			user:       githubUser{ID: 1, Login: "octocat", Name: "Mona Lisa Octocat", AvatarURL: "mockAvatar"},
+			userStatus: http.StatusOK,
+			emails: []githubEmail{
+				{Email: "secondary@github.com", Primary: false, Verified: true},
+				{Email: "primary@github.com", Primary: true, Verified: true},
+			},
+			expectedClaims: Claims{
+				Iss:           githubIssuer,
+				Sub:           "1",
+				Email:         "primary@github.com",
+				EmailVerified: true,
+				GivenName:     "Mona",
+				FamilyName:    "Lisa Octocat",
+				Picture:       "mockAvatar",
+				Username:      "octocat",
+			},
+		},
+		{
+			name:       "User without a name, login is used instead",
+			user:       githubUser{ID: 1, Login: "octocat", AvatarURL: "mockAvatar"},
+			userStatus: http.StatusOK,
+			emails:     []githubEmail{{Email: "primary@github.com", Primary: true, Verified: true}},
+			expectedClaims: Claims{
+				Iss:           githubIssuer,
+				Sub:           "1",
+				Email:         "primary@github.com",
+				EmailVerified: true,
+				GivenName:     "octocat",
+				Picture:       "mockAvatar",
+				Username:      "octocat",
+			},
+		},
+		{
+			name:        "Invalid token, error expected",
+			userStatus:  http.StatusUnauthorized,
+			errExpected: true,
+		},
+		{
+			name:        "Primary email is not verified, error expected",
+			user:        githubUser{ID: 1, Login: "octocat"},
+			userStatus:  http.StatusOK,
+			emails:      []githubEmail{{Email: "primary@github.com", Primary: true, Verified: false}},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "Bearer "+mockToken, r.Header.Get("Authorization"))
+				w.WriteHeader(tc.userStatus)
+				_ = json.NewEncoder(w).Encode(tc.user)
+			})
+			mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "Bearer "+mockToken, r.Header.Get("Authorization"))
+				_ = json.NewEncoder(w).Encode(tc.emails)
+			})
+
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			github := NewGitHub("mockClientID", "mockClientSecret", "mockCallbackURL", "read:user user:email")
+			github.apiURL = server.URL
+
+			claims, err := github.DecodeToken(context.Background(), mockToken, "")
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				return
+			}
+
+			require.NoError(t, err, "Expected no error but got one")
+			// Expiry is relative to the current time, so it's verified separately.
+			require.WithinDuration(t, time.Now().Add(githubTokenLifetime), claims.Exp, time.Minute)
+
+			claims.Exp = time.Time{}
+			require.Equal(t, tc.expectedClaims, claims, "Claims are not as expected")
+		})
+	}
+}
@@ -44,6 +44,8 @@ type Google struct {
 	// scopes for the request. Most basic scope:
 	// https://www.googleapis.com/auth/userinfo.email https://www.googleapis.com/auth/userinfo.profile
 	scopes string
+	// offlineAccess asks Google for a refresh token, which is only useful if it will be stored.
+	offlineAccess bool
 
 	httpClient *http.Client
 	jwkCache   *jwk.Cache
@@ -65,7 +67,10 @@ type googleTokenResponse struct {
 //
 // It accepts a context because it periodically fetches Google's JSON Web Keys and the context can be used to cancel
 // the underlying fetching goroutine.
-func NewGoogle(ctx context.Context, clientID, clientSecret, callbackURL, scopes string) (*Google, error) {
+//
+// The offlineAccess flag makes it ask for offline access, so that the token response includes a refresh token.
+func NewGoogle(ctx context.Context, clientID, clientSecret, callbackURL, scopes string, offlineAccess bool,
+) (*Google, error) {
 	// This allows auto-refresh of the JWK as Google keeps rotating them.
 	// See the documentation here:
 	// https://github.com/lestrrat-go/jwx/tree/develop/v3/jwk#auto-refresh-a-key-during-a-long-running-process
@@ -80,12 +85,13 @@ func NewGoogle(ctx context.Context, clientID, clientSecret, callbackURL, scopes
 	}
 
 	return &Google{
-		clientID:     clientID,
-		clientSecret: clientSecret,
-		callbackURL:  callbackURL,
-		scopes:       scopes,
-		httpClient:   &http.Client{},
-		jwkCache:     jwkCache,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		callbackURL:   callbackURL,
+		scopes:        scopes,
+		offlineAccess: offlineAccess,
+		httpClient:    &http.Client{},
+		jwkCache:      jwkCache,
 	}, nil
 }
 
@@ -97,7 +103,7 @@ func (g *Google) Issuers() []string {
 	return googleIssuers
 }
 
-func (g *Google) GetAuthURL(ctx context.Context, state, codeChallenge string) string {
+func (g *Google) GetAuthURL(ctx context.Context, state, codeChallenge, nonce string) string {
 	var u = &url.URL{}
 	// Copy the auth URL value into local pointer. This must not modify the original URL variable.
 	*u = *parsedGoogleAuthURL
@@ -109,7 +115,13 @@ func (g *Google) GetAuthURL(ctx context.Context, state, codeChallenge string) st
 	q.Set("response_type", "code")
 	q.Set("redirect_uri", g.callbackURL)
 	q.Set("include_granted_scopes", "true")
+	// Offline access is required for a refresh token. Google issues it only upon consent, hence the prompt.
+	if g.offlineAccess {
+		q.Set("access_type", "offline")
+		q.Set("prompt", "consent")
+	}
 	q.Set("state", state)
+	q.Set("nonce", nonce)
 	q.Set("code_challenge", codeChallenge)
 	q.Set("code_challenge_method", "S256")
 
@@ -118,6 +130,14 @@ func (g *Google) GetAuthURL(ctx context.Context, state, codeChallenge string) st
 }
 
 func (g *Google) TokenFromCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	tokens, err := g.TokensFromCode(ctx, code, codeVerifier)
+	if err != nil {
+		return "", err
+	}
+	return tokens.IDToken, nil
+}
+
+func (g *Google) TokensFromCode(ctx context.Context, code, codeVerifier string) (Tokens, error) {
 	// Request body.
 	body := map[string]any{
 		"code":          code,
@@ -128,47 +148,34 @@ func (g *Google) TokenFromCode(ctx context.Context, code, codeVerifier string) (
 		"code_verifier": codeVerifier,
 	}
 
-	// Marshal body to use as an io.Reader.
-	bodyBytes, err := json.Marshal(body)
-	if err != nil {
-		return "", fmt.Errorf("error in json.Marshal call: %w", err)
-	}
-
-	// Form the HTTP request.
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleTokenURL, bytes.NewReader(bodyBytes))
+	tokenResponse, err := g.requestToken(ctx, body)
 	if err != nil {
-		return "", fmt.Errorf("error in http.NewRequestWithContext call: %w", err)
+		return Tokens{}, fmt.Errorf("error in requestToken call: %w", err)
 	}
 
-	// Execute request.
-	res, err := g.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error in httpClient.Do call: %w", err)
-	}
-	// Close response body upon return.
-	defer func() { _ = res.Body.Close() }()
+	return Tokens{IDToken: tokenResponse.IDToken, RefreshToken: tokenResponse.RefreshToken}, nil
+}
 
-	// Check if the request failed.
-	if res.StatusCode/100 != 2 {
-		// Decode response body for logging.
-		resBody, err := io.ReadAll(res.Body)
-		if err != nil {
-			resBody = []byte("error in io.ReadAll call: " + err.Error())
-		}
-		slog.ErrorContext(ctx, "request failed", "code", res.StatusCode, "body", string(resBody))
-		return "", fmt.Errorf("request failed with status code: %d", res.StatusCode)
+func (g *Google) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	// Request body.
+	// See this: https://developers.google.com/identity/protocols/oauth2/web-server#offline
+	body := map[string]any{
+		"refresh_token": refreshToken,
+		"client_id":     g.clientID,
+		"client_secret": g.clientSecret,
+		"grant_type":    "refresh_token",
 	}
 
-	// Decode the success response.
-	tokenResponse := &googleTokenResponse{}
-	if err := json.NewDecoder(res.Body).Decode(tokenResponse); err != nil {
-		return "", fmt.Errorf("error in json Decode call: %w", err)
+	tokenResponse, err := g.requestToken(ctx, body)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("error in requestToken call: %w", err)
 	}
 
-	return tokenResponse.IDToken, nil
+	// Google does not rotate refresh tokens, so the response usually does not contain one.
+	return Tokens{IDToken: tokenResponse.IDToken, RefreshToken: tokenResponse.RefreshToken}, nil
 }
 
-func (g *Google) DecodeToken(ctx context.Context, token string) (Claims, error) {
+func (g *Google) DecodeToken(ctx context.Context, token, nonce string) (Claims, error) {
 	// Google's documentation for ID token verification:
 	// https://developers.google.com/identity/gsi/web/guides/verify-google-id-token
 
@@ -184,6 +191,11 @@ func (g *Google) DecodeToken(ctx context.Context, token string) (Claims, error)
 		return Claims{}, fmt.Errorf("error in jwt.Parse call: %w", err)
 	}
 
+	// The nonce binds the token to the redirect that started the flow, so it can not be replayed.
+	if err := verifyNonce(parsed, nonce); err != nil {
+		return Claims{}, fmt.Errorf("error in verifyNonce call: %w", err)
+	}
+
 	// Validate issuer. This could not be done with jwt.WithIssuer because there are two allowed values.
 	if iss, _ := parsed.Issuer(); !slices.Contains(googleIssuers, iss) {
 		return Claims{}, fmt.Errorf("jwt has unknown issuer: %s", iss)
@@ -198,6 +210,9 @@ func (g *Google) DecodeToken(ctx context.Context, token string) (Claims, error)
 	if err := parsed.Get("exp", &claims.Exp); err != nil {
 		return Claims{}, fmt.Errorf("failed to decode exp claim: %w", err)
 	}
+	if err := parsed.Get("sub", &claims.Sub); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode sub claim: %w", err)
+	}
 	if err := parsed.Get("email", &claims.Email); err != nil {
 		return Claims{}, fmt.Errorf("failed to decode email claim: %w", err)
 	}
@@ -211,5 +226,49 @@ func (g *Google) DecodeToken(ctx context.Context, token string) (Claims, error)
 		return Claims{}, fmt.Errorf("failed to decode picture claim: %w", err)
 	}
 
+	claims.EmailVerified = emailVerified(parsed)
+	claims.Extra = extraClaims(parsed)
 	return claims, nil
 }
+
+// requestToken sends the given body to Google's token endpoint and decodes the response.
+func (g *Google) requestToken(ctx context.Context, body map[string]any) (googleTokenResponse, error) {
+	// Marshal body to use as an io.Reader.
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return googleTokenResponse{}, fmt.Errorf("error in json.Marshal call: %w", err)
+	}
+
+	// Form the HTTP request.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleTokenURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return googleTokenResponse{}, fmt.Errorf("error in http.NewRequestWithContext call: %w", err)
+	}
+
+	// Execute request.
+	res, err := g.httpClient.Do(req)
+	if err != nil {
+		return googleTokenResponse{}, fmt.Errorf("error in httpClient.Do call: %w", err)
+	}
+	// Close response body upon return.
+	defer func() { _ = res.Body.Close() }()
+
+	// Check if the request failed.
+	if res.StatusCode/100 != 2 {
+		// Decode response body for logging.
+		resBody, err := io.ReadAll(res.Body)
+		if err != nil {
+			resBody = []byte("error in io.ReadAll call: " + err.Error())
+		}
+		slog.ErrorContext(ctx, "request failed", "code", res.StatusCode, "body", string(resBody))
+		return googleTokenResponse{}, fmt.Errorf("request failed with status code: %d", res.StatusCode)
+	}
+
+	// Decode the success response.
+	var tokenResponse googleTokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&tokenResponse); err != nil {
+		return googleTokenResponse{}, fmt.Errorf("error in json Decode call: %w", err)
+	}
+
+	return tokenResponse, nil
+}
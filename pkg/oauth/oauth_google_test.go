@@ -33,7 +33,7 @@ func TestNewGoogle(t *testing.T) {
 	defer cancelFunc()
 
 	google, err := NewGoogle(ctx, "mockClientID", "mockClientSecret",
-		"mockCallbackURL", "mockScope1 mockScope2")
+		"mockCallbackURL", "mockScope1 mockScope2", true)
 
 	require.NoError(t, err, "Expected no error in NewGoogle")
 	require.NotNil(t, google, "Expected Google instance to be non-nil")
@@ -56,7 +56,7 @@ func TestGoogle_GetAuthURL(t *testing.T) {
 	require.NoError(t, err, "Failed to create Google instance")
 
 	// Method to test.
-	authURL := google.GetAuthURL(ctx, mockState, mockCodeChallenge)
+	authURL := google.GetAuthURL(ctx, mockState, mockCodeChallenge, "mockNonce")
 
 	// Verify that the returned URL is valid.
 	parsed, err := url.Parse(authURL)
@@ -78,10 +78,23 @@ func TestGoogle_GetAuthURL(t *testing.T) {
 		"Incorrect 'Include Granted Scopes'")
 	require.Equal(t, mockState, parsed.Query().Get("state"),
 		"Incorrect state")
+	require.Equal(t, "mockNonce", parsed.Query().Get("nonce"),
+		"Incorrect nonce")
 	require.Equal(t, mockCodeChallenge, parsed.Query().Get("code_challenge"),
 		"Incorrect code challenge")
 	require.Equal(t, "S256", parsed.Query().Get("code_challenge_method"),
 		"Incorrect code challenge method")
+	// Offline access is not asked for unless enabled.
+	require.Empty(t, parsed.Query().Get("access_type"), "Expected no access type")
+	require.Empty(t, parsed.Query().Get("prompt"), "Expected no prompt")
+
+	google.offlineAccess = true
+	parsed, err = url.Parse(google.GetAuthURL(ctx, mockState, mockCodeChallenge, "mockNonce"))
+	require.NoError(t, err, "Expected URL parsing to succeed")
+	require.Equal(t, "offline", parsed.Query().Get("access_type"),
+		"Incorrect access type")
+	require.Equal(t, "consent", parsed.Query().Get("prompt"),
+		"Incorrect prompt")
 }
 
 func TestGoogle_TokenFromCode(t *testing.T) {
@@ -177,6 +190,74 @@ func TestGoogle_TokenFromCode(t *testing.T) {
 	}
 }
 
+func TestGoogle_Refresh(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	// Mock client.
+	google, err := newMockGoogle(ctx, nil)
+	require.NoError(t, err, "Failed to create Google instance")
+
+	// Google does not send a refresh token upon refresh.
+	validResponseJSON, err := json.Marshal(googleTokenResponse{AccessToken: "mockAccessToken", IDToken: "mockIDToken"})
+	require.NoError(t, err, "Failed to marshal success response")
+
+	for _, tc := range []struct {
+		name         string
+		mockResponse *http.Response
+		errExpected  bool
+	}{
+		{
+			name: "Everything good, no errors",
+			mockResponse: &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader(validResponseJSON)),
+			},
+			errExpected: false,
+		},
+		{
+			name:         "Request returns non 2xx status code, error expected",
+			mockResponse: &http.Response{StatusCode: http.StatusBadRequest},
+			errExpected:  true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			// The method being tested must send the request with this body.
+			expectedRequestBody := map[string]any{
+				"refresh_token": "mockRefreshToken",
+				"client_id":     google.clientID,
+				"client_secret": google.clientSecret,
+				"grant_type":    "refresh_token",
+			}
+
+			// Transport to mock the HTTP request.
+			transport := httputils.RoundTripFunc(func(req *http.Request) *http.Response {
+				require.Equal(t, googleTokenURL, req.URL.String())
+
+				var body map[string]any
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&body), "Expected body to be valid JSON")
+				require.Equal(t, expectedRequestBody, body, "Request body is not as expected")
+				return tc.mockResponse
+			})
+
+			// Attach mock HTTP client.
+			google.httpClient = &http.Client{Transport: transport}
+			tokens, err := google.Refresh(ctx, "mockRefreshToken")
+
+			// Verify based on error expectation.
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				return
+			}
+
+			require.NoError(t, err, "Expected no error but got one")
+			require.Equal(t, Tokens{IDToken: "mockIDToken"}, tokens, "Tokens do not match")
+		})
+	}
+}
+
 func TestGoogle_DecodeToken(t *testing.T) {
 	// Use cancellable context to clean up JWK fetching goroutine upon return.
 	ctx, cancelFunc := context.WithCancel(context.Background())
@@ -202,19 +283,28 @@ func TestGoogle_DecodeToken(t *testing.T) {
 		issuer:   googleIssuers[0],
 		expiry:   expiresAt,
 		claims: Claims{
-			Iss:        googleIssuers[0],
-			Exp:        expiresAt,
-			Email:      "mockEmail",
-			GivenName:  "mockGivenName",
-			FamilyName: "mockFamilyName",
-			Picture:    "mockPictureURL",
+			Iss:           googleIssuers[0],
+			Exp:           expiresAt,
+			Sub:           "mockSubject",
+			Email:         "mockEmail",
+			EmailVerified: true,
+			GivenName:     "mockGivenName",
+			FamilyName:    "mockFamilyName",
+			Picture:       "mockPictureURL",
 		},
+		nonce: "mockNonce",
 	}
 
 	// Valid token for the happy path.
 	validToken, err := generateToken(tokenInput)
 	require.NoError(t, err, "Failed to generate valid token")
 
+	// Token without a nonce.
+	var noNonceInput = tokenInput
+	noNonceInput.nonce = ""
+	noNonceToken, err := generateToken(noNonceInput)
+	require.NoError(t, err, "Failed to generate token without nonce")
+
 	// Expired token.
 	var expiredTokenInput = tokenInput
 	expiredTokenInput.expiry = time.Now().Add(-time.Hour)
@@ -236,15 +326,38 @@ func TestGoogle_DecodeToken(t *testing.T) {
 	for _, tc := range []struct {
 		name           string
 		token          string
+		nonce          string
 		expectedClaims Claims
 		errSubstring   string
 	}{
 		{
 			name:           "Valid token, no errors",
 			token:          validToken,
+			nonce:          "mockNonce",
+			expectedClaims: tokenInput.claims,
+			errSubstring:   "",
+		},
+		{
+			name:           "Valid token without nonce verification, no errors",
+			token:          validToken,
+			nonce:          "",
 			expectedClaims: tokenInput.claims,
 			errSubstring:   "",
 		},
+		{
+			name:           "Token with another nonce, error expected",
+			token:          validToken,
+			nonce:          "anotherMockNonce",
+			expectedClaims: Claims{},
+			errSubstring:   "nonce claim does not match",
+		},
+		{
+			name:           "Token without nonce, error expected",
+			token:          noNonceToken,
+			nonce:          "mockNonce",
+			expectedClaims: Claims{},
+			errSubstring:   "failed to decode nonce claim",
+		},
 		{
 			name:           "Expired token, error expected",
 			token:          expiredToken,
@@ -266,7 +379,7 @@ func TestGoogle_DecodeToken(t *testing.T) {
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			claims, err := google.DecodeToken(ctx, tc.token)
+			claims, err := google.DecodeToken(ctx, tc.token, tc.nonce)
 			if tc.errSubstring != "" {
 				require.Error(t, err, "Expected error but got none")
 				require.Contains(t, err.Error(), tc.errSubstring)
@@ -286,16 +399,30 @@ type generateTokenInput struct {
 	issuer   string
 	expiry   time.Time
 	claims   Claims
+	// extraClaims are added to the token as they are, for provider specific claims.
+	extraClaims map[string]any
+	// nonce is added to the token if it is not empty.
+	nonce string
 }
 
 func generateToken(input generateTokenInput) (string, error) {
 	// Add basic claims to the token.
-	builder := jwt.NewBuilder().Expiration(input.expiry).Audience([]string{input.audience}).Issuer(input.issuer)
+	builder := jwt.NewBuilder().Expiration(input.expiry).Audience([]string{input.audience}).Issuer(input.issuer).
+		Subject(input.claims.Sub)
 	// Add custom claims.
 	builder.Claim("email", input.claims.Email)
+	if input.claims.EmailVerified {
+		builder.Claim("email_verified", true)
+	}
 	builder.Claim("given_name", input.claims.GivenName)
 	builder.Claim("family_name", input.claims.FamilyName)
 	builder.Claim("picture", input.claims.Picture)
+	for name, value := range input.extraClaims {
+		builder.Claim(name, value)
+	}
+	if input.nonce != "" {
+		builder.Claim("nonce", input.nonce)
+	}
 
 	// Build the token. Note that this is not the JWT string yet, it requires signing.
 	token, err := builder.Build()
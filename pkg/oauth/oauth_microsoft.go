@@ -0,0 +1,283 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/lestrrat-go/httprc/v3"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+const (
+	// Source: https://learn.microsoft.com/en-us/entra/identity-platform/v2-protocols-oidc#find-your-apps-openid-configuration-document-uri
+	microsoftLoginURL = "https://login.microsoftonline.com"
+	// microsoftIssuerTemplate is the issuer of Microsoft's v2.0 ID tokens. The "{tenantid}" is replaced by the ID of
+	// the tenant (the "tid" claim) that the user belongs to.
+	microsoftIssuerTemplate = microsoftLoginURL + "/{tenantid}/v2.0"
+
+	// MicrosoftCommon allows users from any work, school or personal Microsoft account.
+	MicrosoftCommon = "common"
+	// MicrosoftOrganizations allows users from any work or school account, but not personal Microsoft accounts.
+	MicrosoftOrganizations = "organizations"
+
+	// microsoftConsumersTenantID is the tenant ID of all personal Microsoft accounts.
+	microsoftConsumersTenantID = "9188040d-6c67-4c5b-b112-36a304b66dad"
+)
+
+// Microsoft implements the Provider interface for Microsoft Entra ID (formerly Azure AD).
+//
+// It supports the "common" and "organizations" multi-tenant authorities, as well as single-tenant authorities where
+// the tenant is given by its ID. The tokens of multi-tenant authorities are issued by the user's own tenant, so their
+// issuers can not be listed upfront, and are matched against a template instead.
+//
+// Read documentation here: https://learn.microsoft.com/en-us/entra/identity-platform/v2-oauth2-auth-code-flow
+type Microsoft struct {
+	// tenant is the authority of the application. One of "common", "organizations", or a tenant ID.
+	tenant string
+	// allowedTenants restricts sign-ins to these tenant IDs. If empty, all tenants of the authority are allowed.
+	allowedTenants []string
+
+	// clientID of your application.
+	clientID string
+	// clientSecret for your application.
+	clientSecret string
+	// callbackURL is URL that Microsoft will hit after the user has authenticated.
+	callbackURL string
+	// scopes for the request. Most basic scope: openid email profile
+	scopes string
+
+	// authURL is the parsed authorization endpoint of the tenant.
+	authURL *url.URL
+	// tokenURL is the token endpoint of the tenant.
+	tokenURL string
+	// jwkURL is the key set endpoint of the tenant.
+	jwkURL string
+
+	httpClient *http.Client
+	jwkCache   *jwk.Cache
+}
+
+// NewMicrosoft instantiates a new Microsoft provider instance.
+//
+// The tenant should be "common", "organizations", or a tenant ID. The allowedTenants, if not empty, further restrict
+// the tenants whose users can sign in.
+//
+// It accepts a context because it periodically fetches Microsoft's JSON Web Keys and the context can be used to
+// cancel the underlying fetching goroutine.
+func NewMicrosoft(ctx context.Context, tenant string, allowedTenants []string,
+	clientID, clientSecret, callbackURL, scopes string,
+) (*Microsoft, error) {
+	if tenant == "" {
+		tenant = MicrosoftCommon
+	}
+
+	// Personal accounts can not be restricted by tenant, so it is not supported as an authority.
+	if tenant == "consumers" {
+		return nil, fmt.Errorf("the consumers tenant is not supported")
+	}
+
+	// Tenant specific endpoints.
+	authURL := fmt.Sprintf("%s/%s/oauth2/v2.0/authorize", microsoftLoginURL, tenant)
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", microsoftLoginURL, tenant)
+	jwkURL := fmt.Sprintf("%s/%s/discovery/v2.0/keys", microsoftLoginURL, tenant)
+
+	parsedAuthURL, err := url.Parse(authURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant %q: %w", tenant, err)
+	}
+
+	// This allows auto-refresh of the JWK as Microsoft keeps rotating them.
+	jwkCache, err := jwk.NewCache(ctx, httprc.NewClient())
+	if err != nil {
+		return nil, fmt.Errorf("error in jwk.NewCache call: %w", err)
+	}
+
+	// Register Microsoft's JWK fetch URL.
+	if err := jwkCache.Register(ctx, jwkURL); err != nil {
+		return nil, fmt.Errorf("error in jwkCache.Register call: %w", err)
+	}
+
+	return &Microsoft{
+		tenant:         tenant,
+		allowedTenants: allowedTenants,
+		clientID:       clientID,
+		clientSecret:   clientSecret,
+		callbackURL:    callbackURL,
+		scopes:         scopes,
+		authURL:        parsedAuthURL,
+		tokenURL:       tokenURL,
+		jwkURL:         jwkURL,
+		httpClient:     &http.Client{},
+		jwkCache:       jwkCache,
+	}, nil
+}
+
+func (m *Microsoft) Name() string {
+	return "microsoft"
+}
+
+// Issuers returns nil, as the issuers depend upon the tenant of the user. See MatchIssuer.
+func (m *Microsoft) Issuers() []string {
+	return nil
+}
+
+// MatchIssuer tells whether the given issuer belongs to a tenant that is allowed to sign in.
+func (m *Microsoft) MatchIssuer(issuer string) bool {
+	// Extract the tenant ID from the issuer.
+	prefix, suffix, _ := strings.Cut(microsoftIssuerTemplate, "{tenantid}")
+	if !strings.HasPrefix(issuer, prefix) || !strings.HasSuffix(issuer, suffix) {
+		return false
+	}
+
+	tenantID := strings.TrimSuffix(strings.TrimPrefix(issuer, prefix), suffix)
+	return m.isTenantAllowed(tenantID)
+}
+
+func (m *Microsoft) GetAuthURL(ctx context.Context, state, codeChallenge, nonce string) string {
+	var u = &url.URL{}
+	// Copy the auth URL value into local pointer. This must not modify the original URL variable.
+	*u = *m.authURL
+
+	// Add all query parameters.
+	q := u.Query()
+	q.Set("client_id", m.clientID)
+	q.Set("scope", m.scopes)
+	q.Set("response_type", "code")
+	q.Set("response_mode", "query")
+	q.Set("redirect_uri", m.callbackURL)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (m *Microsoft) TokenFromCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("code", code)
+	form.Set("client_id", m.clientID)
+	form.Set("client_secret", m.clientSecret)
+	form.Set("redirect_uri", m.callbackURL)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code_verifier", codeVerifier)
+	form.Set("scope", m.scopes)
+
+	response, err := exchangeCode(ctx, m.httpClient, m.tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("error in exchangeCode call: %w", err)
+	}
+
+	// Without the ID token, the user cannot be identified.
+	if response.IDToken == "" {
+		return "", fmt.Errorf("token response does not contain an id_token")
+	}
+
+	return response.IDToken, nil
+}
+
+func (m *Microsoft) DecodeToken(ctx context.Context, token, nonce string) (Claims, error) {
+	// Microsoft's documentation for ID token validation:
+	// https://learn.microsoft.com/en-us/entra/identity-platform/id-tokens#validate-tokens
+
+	// Obtain Microsoft's key set.
+	set, err := m.jwkCache.Lookup(ctx, m.jwkURL)
+	if err != nil {
+		return Claims{}, fmt.Errorf("error in jwkCache.Lookup call: %w", err)
+	}
+
+	// Parse and validate the token with the obtained key set.
+	parsed, err := jwt.Parse([]byte(token), jwt.WithKeySet(set), jwt.WithValidate(true), jwt.WithAudience(m.clientID))
+	if err != nil {
+		return Claims{}, fmt.Errorf("error in jwt.Parse call: %w", err)
+	}
+
+	// The nonce binds the token to the redirect that started the flow, so it can not be replayed.
+	if err := verifyNonce(parsed, nonce); err != nil {
+		return Claims{}, fmt.Errorf("error in verifyNonce call: %w", err)
+	}
+
+	// The issuer must be the user's own tenant, and the tenant must be allowed.
+	var tenantID string
+	if err := parsed.Get("tid", &tenantID); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode tid claim: %w", err)
+	}
+
+	expectedIssuer := strings.Replace(microsoftIssuerTemplate, "{tenantid}", tenantID, 1)
+	if iss, _ := parsed.Issuer(); iss != expectedIssuer {
+		return Claims{}, fmt.Errorf("jwt has unknown issuer: %s", iss)
+	}
+
+	if !m.isTenantAllowed(tenantID) {
+		return Claims{}, fmt.Errorf("tenant is not allowed: %s", tenantID)
+	}
+
+	// Claims to return.
+	var claims Claims
+
+	if err := parsed.Get("iss", &claims.Iss); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode iss claim: %w", err)
+	}
+	if err := parsed.Get("exp", &claims.Exp); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode exp claim: %w", err)
+	}
+	if err := parsed.Get("sub", &claims.Sub); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode sub claim: %w", err)
+	}
+
+	// The email claim is optional, and needs configuration in Entra ID. The preferred username is not a substitute,
+	// as it is mutable by the users and the admins of any tenant, and not necessarily an email. It is kept in Extra.
+	var name string
+	if err := decodeOptionalClaims(parsed, map[string]*string{
+		"email":       &claims.Email,
+		"name":        &name,
+		"given_name":  &claims.GivenName,
+		"family_name": &claims.FamilyName,
+	}); err != nil {
+		return Claims{}, fmt.Errorf("error in decodeOptionalClaims call: %w", err)
+	}
+
+	if claims.Email == "" {
+		return Claims{}, fmt.Errorf("jwt has no email claim")
+	}
+
+	// Given and family names are optional claims that need configuration in Entra ID. The name is present by default.
+	if claims.GivenName == "" && claims.FamilyName == "" {
+		claims.GivenName, claims.FamilyName = splitName(name)
+	}
+
+	claims.EmailVerified = emailVerified(parsed)
+	claims.Extra = extraClaims(parsed)
+	return claims, nil
+}
+
+// isTenantAllowed tells whether users of the given tenant can sign in, as per the authority and the allowed tenants.
+func (m *Microsoft) isTenantAllowed(tenantID string) bool {
+	if tenantID == "" {
+		return false
+	}
+
+	switch m.tenant {
+	case MicrosoftCommon:
+	case MicrosoftOrganizations:
+		// The organizations authority does not allow personal accounts.
+		if tenantID == microsoftConsumersTenantID {
+			return false
+		}
+	default:
+		// Single-tenant authority.
+		if !strings.EqualFold(tenantID, m.tenant) {
+			return false
+		}
+	}
+
+	return len(m.allowedTenants) == 0 || slices.ContainsFunc(m.allowedTenants, func(allowed string) bool {
+		return strings.EqualFold(allowed, tenantID)
+	})
+}
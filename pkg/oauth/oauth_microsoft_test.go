@@ -0,0 +1,344 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/httprc/v3"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shivanshkc/authorizer/internal/utils/httputils"
+)
+
+const (
+	mockTenantID      = "72f988bf-86f1-41af-91ab-2d7cd011db47"
+	mockOtherTenantID = "f8cdef31-a31e-4b4a-93e4-5f571e91255a"
+)
+
+func TestNewMicrosoft(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	// The consumers tenant is not supported.
+	_, err := NewMicrosoft(ctx, "consumers", nil, "mockClientID", "mockClientSecret", "mockCallbackURL", "openid")
+	require.Error(t, err, "Expected error for consumers tenant")
+}
+
+func TestMicrosoft_Name(t *testing.T) {
+	require.Equal(t, "microsoft", (&Microsoft{}).Name())
+}
+
+func TestMicrosoft_MatchIssuer(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		tenant         string
+		allowedTenants []string
+		issuer         string
+		expected       bool
+	}{
+		{
+			name:     "Common authority, any tenant matches",
+			tenant:   MicrosoftCommon,
+			issuer:   "https://login.microsoftonline.com/" + mockTenantID + "/v2.0",
+			expected: true,
+		},
+		{
+			name:     "Common authority, personal accounts match",
+			tenant:   MicrosoftCommon,
+			issuer:   "https://login.microsoftonline.com/" + microsoftConsumersTenantID + "/v2.0",
+			expected: true,
+		},
+		{
+			name:     "Organizations authority, personal accounts do not match",
+			tenant:   MicrosoftOrganizations,
+			issuer:   "https://login.microsoftonline.com/" + microsoftConsumersTenantID + "/v2.0",
+			expected: false,
+		},
+		{
+			name:     "Single tenant authority, same tenant matches",
+			tenant:   mockTenantID,
+			issuer:   "https://login.microsoftonline.com/" + mockTenantID + "/v2.0",
+			expected: true,
+		},
+		{
+			name:     "Single tenant authority, other tenant does not match",
+			tenant:   mockTenantID,
+			issuer:   "https://login.microsoftonline.com/" + mockOtherTenantID + "/v2.0",
+			expected: false,
+		},
+		{
+			name:           "Allowed tenants, unlisted tenant does not match",
+			tenant:         MicrosoftCommon,
+			allowedTenants: []string{mockTenantID},
+			issuer:         "https://login.microsoftonline.com/" + mockOtherTenantID + "/v2.0",
+			expected:       false,
+		},
+		{
+			name:     "Issuer of another provider does not match",
+			tenant:   MicrosoftCommon,
+			issuer:   "https://accounts.google.com",
+			expected: false,
+		},
+		{
+			name:     "Issuer without tenant does not match",
+			tenant:   MicrosoftCommon,
+			issuer:   "https://login.microsoftonline.com//v2.0",
+			expected: false,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			microsoft := &Microsoft{tenant: tc.tenant, allowedTenants: tc.allowedTenants}
+			require.Equal(t, tc.expected, microsoft.MatchIssuer(tc.issuer))
+		})
+	}
+}
+
+func TestMicrosoft_GetAuthURL(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	microsoft, err := newMockMicrosoft(ctx, MicrosoftOrganizations, nil)
+	require.NoError(t, err, "Failed to create Microsoft instance")
+
+	// Method to test.
+	authURL := microsoft.GetAuthURL(ctx, "mockState", "mockCodeChallenge", "mockNonce")
+
+	// Verify that the returned URL is valid.
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err, "Expected URL parsing to succeed")
+
+	// Returned URL must be the tenant's auth URL.
+	require.Equal(t, "https://login.microsoftonline.com/organizations/oauth2/v2.0/authorize",
+		parsed.Scheme+"://"+parsed.Host+parsed.Path)
+
+	// Match query params.
+	require.Equal(t, microsoft.clientID, parsed.Query().Get("client_id"), "Incorrect Client ID")
+	require.Equal(t, microsoft.scopes, parsed.Query().Get("scope"), "Incorrect Scope")
+	require.Equal(t, "code", parsed.Query().Get("response_type"), "Incorrect Response Type")
+	require.Equal(t, "query", parsed.Query().Get("response_mode"), "Incorrect Response Mode")
+	require.Equal(t, microsoft.callbackURL, parsed.Query().Get("redirect_uri"), "Incorrect Redirect URI")
+	require.Equal(t, "mockState", parsed.Query().Get("state"), "Incorrect state")
+	require.Equal(t, "mockNonce", parsed.Query().Get("nonce"), "Incorrect nonce")
+	require.Equal(t, "mockCodeChallenge", parsed.Query().Get("code_challenge"), "Incorrect code challenge")
+	require.Equal(t, "S256", parsed.Query().Get("code_challenge_method"), "Incorrect code challenge method")
+}
+
+func TestMicrosoft_TokenFromCode(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	for _, tc := range []struct {
+		name        string
+		status      int
+		response    tokenResponse
+		errExpected bool
+	}{
+		{
+			name:     "Everything good, no errors",
+			status:   http.StatusOK,
+			response: tokenResponse{AccessToken: "mockAccessToken", IDToken: "mockIDToken"},
+		},
+		{
+			name:        "Response without ID token, error expected",
+			status:      http.StatusOK,
+			response:    tokenResponse{AccessToken: "mockAccessToken"},
+			errExpected: true,
+		},
+		{
+			name:        "Request returns non 2xx status code, error expected",
+			status:      http.StatusBadRequest,
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Verify request details.
+				require.Equal(t, http.MethodPost, r.Method)
+				require.NoError(t, r.ParseForm(), "Expected body to be a valid form")
+
+				// Verify request body.
+				require.Equal(t, "mockCode", r.PostForm.Get("code"))
+				require.Equal(t, "mockClientID", r.PostForm.Get("client_id"))
+				require.Equal(t, "mockClientSecret", r.PostForm.Get("client_secret"))
+				require.Equal(t, "mockCallbackURL", r.PostForm.Get("redirect_uri"))
+				require.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+				require.Equal(t, "mockCodeVerifier", r.PostForm.Get("code_verifier"))
+
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(tc.response)
+			}))
+			defer server.Close()
+
+			microsoft, err := newMockMicrosoft(ctx, MicrosoftCommon, nil)
+			require.NoError(t, err, "Failed to create Microsoft instance")
+			microsoft.tokenURL = server.URL
+
+			token, err := microsoft.TokenFromCode(ctx, "mockCode", "mockCodeVerifier")
+
+			// Verify based on error expectation.
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				require.Equal(t, "", token, "Expected token to be empty")
+			} else {
+				require.NoError(t, err, "Expected no error but got one")
+				require.Equal(t, tc.response.IDToken, token, "ID token does not match")
+			}
+		})
+	}
+}
+
+func TestMicrosoft_DecodeToken(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	// Mock Microsoft client that allows only the mock tenant.
+	microsoft, err := newMockMicrosoft(ctx, MicrosoftOrganizations, []string{mockTenantID})
+	require.NoError(t, err, "Failed to create Microsoft instance")
+
+	// Get the key set to generate tokens for testing.
+	keySet, err := microsoft.jwkCache.Lookup(ctx, microsoft.jwkURL)
+	require.NoError(t, err, "Failed to lookup JWK")
+
+	expiresAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	issuer := "https://login.microsoftonline.com/" + mockTenantID + "/v2.0"
+
+	// Inputs required to create a valid token. Entra ID does not send given and family names by default.
+	tokenInput := generateTokenInput{
+		keySet:      keySet,
+		audience:    microsoft.clientID,
+		issuer:      issuer,
+		expiry:      expiresAt,
+		claims:      Claims{Sub: "mockSubject", Email: "mock@contoso.com"},
+		extraClaims: map[string]any{"tid": mockTenantID, "name": "Mock User", "roles": []any{"admin", "reader"}},
+	}
+
+	// Valid token for the happy path.
+	validToken, err := generateToken(tokenInput)
+	require.NoError(t, err, "Failed to generate valid token")
+
+	// Token without the email claim.
+	var noEmailInput = tokenInput
+	noEmailInput.claims = Claims{Sub: "mockSubject"}
+	noEmailInput.extraClaims = map[string]any{"tid": mockTenantID, "preferred_username": "mock@contoso.com"}
+	noEmailToken, err := generateToken(noEmailInput)
+	require.NoError(t, err, "Failed to generate token without email")
+
+	// Issuer does not match the tenant.
+	var badIssuerInput = tokenInput
+	badIssuerInput.issuer = "https://login.microsoftonline.com/" + mockOtherTenantID + "/v2.0"
+	badIssuerToken, err := generateToken(badIssuerInput)
+	require.NoError(t, err, "Failed to generate bad issuer token")
+
+	// Tenant is not allowed.
+	var badTenantInput = tokenInput
+	badTenantInput.issuer = "https://login.microsoftonline.com/" + mockOtherTenantID + "/v2.0"
+	badTenantInput.extraClaims = map[string]any{"tid": mockOtherTenantID}
+	badTenantToken, err := generateToken(badTenantInput)
+	require.NoError(t, err, "Failed to generate bad tenant token")
+
+	// Bad audience token.
+	var badAudienceInput = tokenInput
+	badAudienceInput.audience = microsoft.clientID + "Random"
+	badAudienceToken, err := generateToken(badAudienceInput)
+	require.NoError(t, err, "Failed to generate bad audience token")
+
+	for _, tc := range []struct {
+		name           string
+		token          string
+		expectedClaims Claims
+		errSubstring   string
+	}{
+		{
+			name:  "Valid token, no errors",
+			token: validToken,
+			expectedClaims: Claims{Iss: issuer, Exp: expiresAt, Sub: "mockSubject", Email: "mock@contoso.com",
+				GivenName: "Mock", FamilyName: "User", Extra: tokenInput.extraClaims},
+		},
+		{
+			name:         "Token without email, preferred username is not used, error expected",
+			token:        noEmailToken,
+			errSubstring: "jwt has no email claim",
+		},
+		{
+			name:         "Issuer does not match tenant, error expected",
+			token:        badIssuerToken,
+			errSubstring: "jwt has unknown issuer",
+		},
+		{
+			name:         "Tenant is not allowed, error expected",
+			token:        badTenantToken,
+			errSubstring: "tenant is not allowed",
+		},
+		{
+			name:         "Bad audience token, error expected",
+			token:        badAudienceToken,
+			errSubstring: `"aud" not satisfied`,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := microsoft.DecodeToken(ctx, tc.token, "")
+			if tc.errSubstring != "" {
+				require.Error(t, err, "Expected error but got none")
+				require.Contains(t, err.Error(), tc.errSubstring)
+			} else {
+				require.NoError(t, err, "Expected no error but got one")
+				require.Equal(t, tc.expectedClaims, claims, "Claims are not as expected")
+			}
+		})
+	}
+}
+
+// newMockMicrosoft returns a new mock Microsoft instance for the given tenant.
+//
+// It mocks the JWK cache (with a mock HTTP RC client).
+func newMockMicrosoft(ctx context.Context, tenant string, allowedTenants []string) (*Microsoft, error) {
+	// Transport for the mock HTTP client that will be passed to the HTTP RC client.
+	transport := httputils.RoundTripFunc(func(_ *http.Request) *http.Response {
+		body := io.NopCloser(strings.NewReader(customKeySet))
+		return &http.Response{StatusCode: http.StatusOK, Body: body}
+	})
+
+	// Mock HTTP RC client.
+	httpRCClient := httprc.NewClient(httprc.WithHTTPClient(&http.Client{Transport: transport}))
+
+	// Create JWK cache object with mock HTTP client.
+	cache, err := jwk.NewCache(ctx, httpRCClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWK cache: %w", err)
+	}
+
+	jwkURL := fmt.Sprintf("%s/%s/discovery/v2.0/keys", microsoftLoginURL, tenant)
+	if err := cache.Register(ctx, jwkURL); err != nil {
+		return nil, fmt.Errorf("failed to register Microsoft JWK URL: %w", err)
+	}
+
+	return &Microsoft{
+		tenant:         tenant,
+		allowedTenants: allowedTenants,
+		clientID:       "mockClientID",
+		clientSecret:   "mockClientSecret",
+		callbackURL:    "mockCallbackURL",
+		scopes:         "openid email profile",
+		authURL:        mustParseURL(fmt.Sprintf("%s/%s/oauth2/v2.0/authorize", microsoftLoginURL, tenant)),
+		tokenURL:       fmt.Sprintf("%s/%s/oauth2/v2.0/token", microsoftLoginURL, tenant),
+		jwkURL:         jwkURL,
+		httpClient:     &http.Client{},
+		jwkCache:       cache,
+	}, nil
+}
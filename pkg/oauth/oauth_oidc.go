@@ -0,0 +1,243 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/lestrrat-go/httprc/v3"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+// oidcDiscoveryPath is appended to the issuer URL to obtain the discovery document.
+//
+// Source: https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig
+const oidcDiscoveryPath = "/.well-known/openid-configuration"
+
+// OIDC implements the Provider interface for any OpenID Connect compliant identity provider,
+// like Keycloak, Okta and Authentik.
+//
+// Unlike the other providers, it does not hardcode any endpoints. They are all obtained from the discovery document
+// published by the issuer. Read the specification here: https://openid.net/specs/openid-connect-discovery-1_0.html
+type OIDC struct {
+	// name of the provider. It is used in the auth and callback routes.
+	name string
+	// clientID of your application.
+	clientID string
+	// clientSecret for your application.
+	clientSecret string
+	// callbackURL is URL that the provider will hit after the user has authenticated.
+	callbackURL string
+	// scopes for the request. Most basic scope: openid email profile
+	scopes string
+
+	// discovery is the provider's discovery document.
+	discovery oidcDiscovery
+	// authURL is the parsed authorization endpoint, to avoid parsing it repeatedly.
+	authURL *url.URL
+
+	httpClient *http.Client
+	jwkCache   *jwk.Cache
+}
+
+// oidcDiscovery contains the fields of the discovery document that are required by the OIDC provider.
+//
+// See this: https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDC instantiates a new OIDC provider instance by fetching the discovery document of the given issuer.
+//
+// It accepts a context because it periodically fetches the issuer's JSON Web Keys and the context can be used to
+// cancel the underlying fetching goroutine.
+func NewOIDC(ctx context.Context, name, issuerURL, clientID, clientSecret, callbackURL, scopes string) (*OIDC, error) {
+	httpClient := &http.Client{}
+
+	// Fetch the endpoints of the provider.
+	discovery, err := fetchOIDCDiscovery(ctx, httpClient, issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("error in fetchOIDCDiscovery call: %w", err)
+	}
+
+	// Validate the authorization endpoint before accepting any requests.
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization_endpoint in discovery document: %w", err)
+	}
+
+	// This allows auto-refresh of the JWK as providers keep rotating them.
+	jwkCache, err := jwk.NewCache(ctx, httprc.NewClient())
+	if err != nil {
+		return nil, fmt.Errorf("error in jwk.NewCache call: %w", err)
+	}
+
+	// Register the provider's JWK fetch URL.
+	if err := jwkCache.Register(ctx, discovery.JWKSURI); err != nil {
+		return nil, fmt.Errorf("error in jwkCache.Register call: %w", err)
+	}
+
+	return &OIDC{
+		name:         name,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		callbackURL:  callbackURL,
+		scopes:       scopes,
+		discovery:    discovery,
+		authURL:      authURL,
+		httpClient:   httpClient,
+		jwkCache:     jwkCache,
+	}, nil
+}
+
+func (o *OIDC) Name() string {
+	return o.name
+}
+
+func (o *OIDC) Issuers() []string {
+	return []string{o.discovery.Issuer}
+}
+
+func (o *OIDC) GetAuthURL(ctx context.Context, state, codeChallenge, nonce string) string {
+	var u = &url.URL{}
+	// Copy the auth URL value into local pointer. This must not modify the original URL variable.
+	*u = *o.authURL
+
+	// Add all query parameters.
+	q := u.Query()
+	q.Set("client_id", o.clientID)
+	q.Set("scope", o.scopes)
+	q.Set("response_type", "code")
+	q.Set("redirect_uri", o.callbackURL)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (o *OIDC) TokenFromCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("code", code)
+	form.Set("client_id", o.clientID)
+	form.Set("client_secret", o.clientSecret)
+	form.Set("redirect_uri", o.callbackURL)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code_verifier", codeVerifier)
+
+	response, err := exchangeCode(ctx, o.httpClient, o.discovery.TokenEndpoint, form)
+	if err != nil {
+		return "", fmt.Errorf("error in exchangeCode call: %w", err)
+	}
+
+	// Without the ID token, the user cannot be identified.
+	if response.IDToken == "" {
+		return "", fmt.Errorf("token response does not contain an id_token")
+	}
+
+	return response.IDToken, nil
+}
+
+func (o *OIDC) DecodeToken(ctx context.Context, token, nonce string) (Claims, error) {
+	// Obtain the provider's key set.
+	set, err := o.jwkCache.Lookup(ctx, o.discovery.JWKSURI)
+	if err != nil {
+		return Claims{}, fmt.Errorf("error in jwkCache.Lookup call: %w", err)
+	}
+
+	// Parse and validate the token with the obtained key set.
+	parsed, err := jwt.Parse([]byte(token), jwt.WithKeySet(set), jwt.WithValidate(true),
+		jwt.WithAudience(o.clientID), jwt.WithIssuer(o.discovery.Issuer))
+	if err != nil {
+		return Claims{}, fmt.Errorf("error in jwt.Parse call: %w", err)
+	}
+
+	// The nonce binds the token to the redirect that started the flow, so it can not be replayed.
+	if err := verifyNonce(parsed, nonce); err != nil {
+		return Claims{}, fmt.Errorf("error in verifyNonce call: %w", err)
+	}
+
+	// Claims to return.
+	var claims Claims
+
+	if err := parsed.Get("iss", &claims.Iss); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode iss claim: %w", err)
+	}
+	if err := parsed.Get("exp", &claims.Exp); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode exp claim: %w", err)
+	}
+	if err := parsed.Get("sub", &claims.Sub); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode sub claim: %w", err)
+	}
+	if err := parsed.Get("email", &claims.Email); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode email claim: %w", err)
+	}
+
+	// Profile claims are optional in OIDC. They depend upon the requested scopes and the provider's configuration.
+	if err := decodeOptionalClaims(parsed, map[string]*string{
+		"given_name":  &claims.GivenName,
+		"family_name": &claims.FamilyName,
+		"picture":     &claims.Picture,
+	}); err != nil {
+		return Claims{}, fmt.Errorf("error in decodeOptionalClaims call: %w", err)
+	}
+
+	claims.EmailVerified = emailVerified(parsed)
+	claims.Extra = extraClaims(parsed)
+	return claims, nil
+}
+
+// fetchOIDCDiscovery fetches and validates the discovery document of the given issuer.
+func fetchOIDCDiscovery(ctx context.Context, client *http.Client, issuerURL string) (oidcDiscovery, error) {
+	discoveryURL := strings.TrimSuffix(issuerURL, "/") + oidcDiscoveryPath
+
+	// Form the HTTP request.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return oidcDiscovery{}, fmt.Errorf("error in http.NewRequestWithContext call: %w", err)
+	}
+
+	// Execute request.
+	res, err := client.Do(req)
+	if err != nil {
+		return oidcDiscovery{}, fmt.Errorf("error in httpClient.Do call: %w", err)
+	}
+	// Close response body upon return.
+	defer func() { _ = res.Body.Close() }()
+
+	// Check if the request failed.
+	if res.StatusCode/100 != 2 {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return oidcDiscovery{}, fmt.Errorf("request failed with status code: %d", res.StatusCode)
+	}
+
+	// Decode the success response.
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(res.Body).Decode(&discovery); err != nil {
+		return oidcDiscovery{}, fmt.Errorf("error in json Decode call: %w", err)
+	}
+
+	// The issuer in the document must exactly match the one that was used to fetch it.
+	// See this: https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(issuerURL, "/") {
+		return oidcDiscovery{}, fmt.Errorf("discovery document issuer %q does not match %q",
+			discovery.Issuer, issuerURL)
+	}
+
+	// All endpoints are required for the authorization code flow.
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return oidcDiscovery{}, fmt.Errorf("discovery document is missing required endpoints")
+	}
+
+	return discovery, nil
+}
@@ -0,0 +1,314 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOIDC(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	for _, tc := range []struct {
+		name string
+		// discoveryFunc alters the discovery document served by the mock issuer.
+		discoveryFunc func(issuer string, doc map[string]string)
+		// discoveryStatus is the status code of the discovery endpoint.
+		discoveryStatus int
+		errExpected     bool
+	}{
+		{
+			name:            "Everything good, no errors",
+			discoveryFunc:   func(string, map[string]string) {},
+			discoveryStatus: http.StatusOK,
+			errExpected:     false,
+		},
+		{
+			name:            "Discovery endpoint fails, error expected",
+			discoveryFunc:   func(string, map[string]string) {},
+			discoveryStatus: http.StatusNotFound,
+			errExpected:     true,
+		},
+		{
+			name:            "Issuer mismatch, error expected",
+			discoveryFunc:   func(issuer string, doc map[string]string) { doc["issuer"] = issuer + "/random" },
+			discoveryStatus: http.StatusOK,
+			errExpected:     true,
+		},
+		{
+			name:            "Token endpoint absent, error expected",
+			discoveryFunc:   func(_ string, doc map[string]string) { delete(doc, "token_endpoint") },
+			discoveryStatus: http.StatusOK,
+			errExpected:     true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			server := newMockOIDCServer(t, tc.discoveryStatus, tc.discoveryFunc, nil)
+			defer server.Close()
+
+			oidc, err := NewOIDC(ctx, "mockName", server.URL, "mockClientID", "mockClientSecret",
+				"mockCallbackURL", "openid email profile")
+
+			if tc.errExpected {
+				require.Error(t, err, "Expected error in NewOIDC")
+				require.Nil(t, oidc, "Expected OIDC instance to be nil")
+				return
+			}
+
+			require.NoError(t, err, "Expected no error in NewOIDC")
+			require.Equal(t, "mockName", oidc.Name())
+			require.Equal(t, []string{server.URL}, oidc.Issuers())
+		})
+	}
+}
+
+func TestOIDC_GetAuthURL(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	server := newMockOIDCServer(t, http.StatusOK, nil, nil)
+	defer server.Close()
+
+	oidc, err := NewOIDC(ctx, "mockName", server.URL, "mockClientID", "mockClientSecret",
+		"mockCallbackURL", "openid email profile")
+	require.NoError(t, err, "Failed to create OIDC instance")
+
+	// Method to test.
+	authURL := oidc.GetAuthURL(ctx, "mockState", "mockCodeChallenge", "mockNonce")
+
+	// Verify that the returned URL is valid.
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err, "Expected URL parsing to succeed")
+
+	// Returned URL must be the discovered authorization endpoint.
+	require.Equal(t, server.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+
+	// Match query params.
+	require.Equal(t, oidc.clientID, parsed.Query().Get("client_id"), "Incorrect Client ID")
+	require.Equal(t, oidc.scopes, parsed.Query().Get("scope"), "Incorrect Scope")
+	require.Equal(t, "code", parsed.Query().Get("response_type"), "Incorrect Response Type")
+	require.Equal(t, oidc.callbackURL, parsed.Query().Get("redirect_uri"), "Incorrect Redirect URI")
+	require.Equal(t, "mockState", parsed.Query().Get("state"), "Incorrect state")
+	require.Equal(t, "mockNonce", parsed.Query().Get("nonce"), "Incorrect nonce")
+	require.Equal(t, "mockCodeChallenge", parsed.Query().Get("code_challenge"), "Incorrect code challenge")
+	require.Equal(t, "S256", parsed.Query().Get("code_challenge_method"), "Incorrect code challenge method")
+}
+
+func TestOIDC_TokenFromCode(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	for _, tc := range []struct {
+		name        string
+		status      int
+		response    tokenResponse
+		errExpected bool
+	}{
+		{
+			name:        "Everything good, no errors",
+			status:      http.StatusOK,
+			response:    tokenResponse{AccessToken: "mockAccessToken", IDToken: "mockIDToken"},
+			errExpected: false,
+		},
+		{
+			name:        "Request returns non 2xx status code, error expected",
+			status:      http.StatusBadRequest,
+			errExpected: true,
+		},
+		{
+			name:        "Response does not contain an ID token, error expected",
+			status:      http.StatusOK,
+			response:    tokenResponse{AccessToken: "mockAccessToken"},
+			errExpected: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tokenHandler := func(w http.ResponseWriter, r *http.Request) {
+				// Verify request details.
+				require.Equal(t, http.MethodPost, r.Method)
+				require.NoError(t, r.ParseForm(), "Expected body to be a valid form")
+
+				// Verify request body.
+				require.Equal(t, "mockCode", r.PostForm.Get("code"))
+				require.Equal(t, "mockClientID", r.PostForm.Get("client_id"))
+				require.Equal(t, "mockClientSecret", r.PostForm.Get("client_secret"))
+				require.Equal(t, "mockCallbackURL", r.PostForm.Get("redirect_uri"))
+				require.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+				require.Equal(t, "mockCodeVerifier", r.PostForm.Get("code_verifier"))
+
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(tc.response)
+			}
+
+			server := newMockOIDCServer(t, http.StatusOK, nil, tokenHandler)
+			defer server.Close()
+
+			oidc, err := NewOIDC(ctx, "mockName", server.URL, "mockClientID", "mockClientSecret",
+				"mockCallbackURL", "openid email profile")
+			require.NoError(t, err, "Failed to create OIDC instance")
+
+			token, err := oidc.TokenFromCode(ctx, "mockCode", "mockCodeVerifier")
+
+			// Verify based on error expectation.
+			if tc.errExpected {
+				require.Error(t, err, "Expected error but got none")
+				require.Equal(t, "", token, "Expected ID token to be empty")
+			} else {
+				require.NoError(t, err, "Expected no error but got one")
+				require.Equal(t, tc.response.IDToken, token, "ID token does not match")
+			}
+		})
+	}
+}
+
+func TestOIDC_DecodeToken(t *testing.T) {
+	// Use cancellable context to clean up JWK fetching goroutine upon return.
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	server := newMockOIDCServer(t, http.StatusOK, nil, nil)
+	defer server.Close()
+
+	oidc, err := NewOIDC(ctx, "mockName", server.URL, "mockClientID", "mockClientSecret",
+		"mockCallbackURL", "openid email profile")
+	require.NoError(t, err, "Failed to create OIDC instance")
+
+	// Get the key set to generate tokens for testing.
+	keySet, err := oidc.jwkCache.Lookup(ctx, oidc.discovery.JWKSURI)
+	require.NoError(t, err, "Failed to lookup JWK")
+
+	expiresAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+
+	// Inputs required to create a valid token.
+	tokenInput := generateTokenInput{
+		keySet:   keySet,
+		audience: oidc.clientID,
+		issuer:   server.URL,
+		expiry:   expiresAt,
+		claims: Claims{
+			Iss:        server.URL,
+			Exp:        expiresAt,
+			Sub:        "mockSubject",
+			Email:      "mockEmail",
+			GivenName:  "mockGivenName",
+			FamilyName: "mockFamilyName",
+			Picture:    "mockPictureURL",
+		},
+	}
+
+	// Valid token for the happy path.
+	validToken, err := generateToken(tokenInput)
+	require.NoError(t, err, "Failed to generate valid token")
+
+	// Expired token.
+	var expiredTokenInput = tokenInput
+	expiredTokenInput.expiry = time.Now().Add(-time.Hour)
+	expiredToken, err := generateToken(expiredTokenInput)
+	require.NoError(t, err, "Failed to generate expired token")
+
+	// Bad audience token.
+	var badAudienceInput = tokenInput
+	badAudienceInput.audience = oidc.clientID + "Random"
+	badAudienceToken, err := generateToken(badAudienceInput)
+	require.NoError(t, err, "Failed to generate bad audience token")
+
+	// Bad issuer token.
+	var badIssuerInput = tokenInput
+	badIssuerInput.issuer = server.URL + "Random"
+	badIssuerToken, err := generateToken(badIssuerInput)
+	require.NoError(t, err, "Failed to generate bad issuer token")
+
+	for _, tc := range []struct {
+		name           string
+		token          string
+		expectedClaims Claims
+		errSubstring   string
+	}{
+		{
+			name:           "Valid token, no errors",
+			token:          validToken,
+			expectedClaims: tokenInput.claims,
+			errSubstring:   "",
+		},
+		{
+			name:           "Expired token, error expected",
+			token:          expiredToken,
+			expectedClaims: Claims{},
+			errSubstring:   `"exp" not satisfied`,
+		},
+		{
+			name:           "Bad audience token, error expected",
+			token:          badAudienceToken,
+			expectedClaims: Claims{},
+			errSubstring:   `"aud" not satisfied`,
+		},
+		{
+			name:           "Bad issuer token, error expected",
+			token:          badIssuerToken,
+			expectedClaims: Claims{},
+			errSubstring:   `"iss" not satisfied`,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := oidc.DecodeToken(ctx, tc.token, "")
+			if tc.errSubstring != "" {
+				require.Error(t, err, "Expected error but got none")
+				require.Contains(t, err.Error(), tc.errSubstring)
+			} else {
+				require.NoError(t, err, "Expected no error but got one")
+				require.Equal(t, tc.expectedClaims, claims, "Claims are not as expected")
+			}
+		})
+	}
+}
+
+// newMockOIDCServer starts a local OIDC issuer that serves a discovery document and the test key set.
+//
+// The discoveryFunc, if not nil, can alter the discovery document before it is served.
+// The tokenHandler, if not nil, serves the token endpoint.
+func newMockOIDCServer(t *testing.T, discoveryStatus int, discoveryFunc func(string, map[string]string),
+	tokenHandler http.HandlerFunc,
+) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc(oidcDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		doc := map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		}
+		if discoveryFunc != nil {
+			discoveryFunc(server.URL, doc)
+		}
+
+		w.WriteHeader(discoveryStatus)
+		_ = json.NewEncoder(w).Encode(doc)
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(customKeySet))
+	})
+
+	if tokenHandler != nil {
+		mux.HandleFunc("/token", tokenHandler)
+	}
+
+	return server
+}
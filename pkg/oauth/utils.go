@@ -1,7 +1,17 @@
 package oauth
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"net/url"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v3/jwt"
 )
 
 // mustParseURL parses the given string as a URL. It panics upon error.
@@ -15,3 +25,180 @@ func mustParseURL(u string) *url.URL {
 	}
 	return parsed
 }
+
+// tokenResponse is the body schema of a standard OAuth 2.0 token endpoint response.
+//
+// See this: https://datatracker.ietf.org/doc/html/rfc6749#section-5.1
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	TokenType    string `json:"token_type"`
+
+	// Error is present if the exchange failed. Some providers, like GitHub, send it with a 200 status code.
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode posts the given form to the token endpoint and decodes the response.
+//
+// The form is sent as "application/x-www-form-urlencoded", as required by the OAuth 2.0 specification.
+func exchangeCode(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (tokenResponse, error) {
+	// Form the HTTP request.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("error in http.NewRequestWithContext call: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	// Execute request.
+	res, err := client.Do(req)
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("error in httpClient.Do call: %w", err)
+	}
+	// Close response body upon return.
+	defer func() { _ = res.Body.Close() }()
+
+	// Check if the request failed.
+	if res.StatusCode/100 != 2 {
+		// Decode response body for logging.
+		resBody, err := io.ReadAll(res.Body)
+		if err != nil {
+			resBody = []byte("error in io.ReadAll call: " + err.Error())
+		}
+		slog.ErrorContext(ctx, "request failed", "code", res.StatusCode, "body", string(resBody))
+		return tokenResponse{}, fmt.Errorf("request failed with status code: %d", res.StatusCode)
+	}
+
+	// Decode the success response.
+	var response tokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return tokenResponse{}, fmt.Errorf("error in json Decode call: %w", err)
+	}
+
+	// The status code alone can not be trusted to indicate success.
+	if response.Error != "" {
+		return tokenResponse{}, fmt.Errorf("token exchange failed: %s: %s", response.Error, response.ErrorDescription)
+	}
+
+	return response, nil
+}
+
+// getJSON sends a GET request to the given URL, authorized with the given access token, and decodes the JSON
+// response into dst.
+func getJSON(ctx context.Context, client *http.Client, targetURL, accessToken string, dst any) error {
+	// Form the HTTP request.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		return fmt.Errorf("error in http.NewRequestWithContext call: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	// Execute request.
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error in httpClient.Do call: %w", err)
+	}
+	// Close response body upon return.
+	defer func() { _ = res.Body.Close() }()
+
+	// Check if the request failed.
+	if res.StatusCode/100 != 2 {
+		// Decode response body for logging.
+		resBody, err := io.ReadAll(res.Body)
+		if err != nil {
+			resBody = []byte("error in io.ReadAll call: " + err.Error())
+		}
+		slog.ErrorContext(ctx, "request failed", "url", targetURL, "code", res.StatusCode, "body", string(resBody))
+		return fmt.Errorf("request failed with status code: %d", res.StatusCode)
+	}
+
+	// Decode the success response.
+	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return fmt.Errorf("error in json Decode call: %w", err)
+	}
+
+	return nil
+}
+
+// splitName splits a full name into the given name and the family name, at the first space.
+//
+// It is only a best effort for the providers that do not supply the two separately.
+func splitName(name string) (string, string) {
+	given, family, _ := strings.Cut(strings.TrimSpace(name), " ")
+	return given, strings.TrimSpace(family)
+}
+
+// decodeOptionalClaims decodes the given string claims of the token into their destinations.
+// Claims that are absent from the token are skipped.
+func decodeOptionalClaims(token jwt.Token, destinations map[string]*string) error {
+	for name, dst := range destinations {
+		if !token.Has(name) {
+			continue
+		}
+		if err := token.Get(name, dst); err != nil {
+			return fmt.Errorf("failed to decode %s claim: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// emailVerified tells whether the email_verified claim of the token is true. Some providers, like Apple, send it as a
+// string. An absent claim means that the email is not verified.
+func emailVerified(token jwt.Token) bool {
+	var verified any
+	if err := token.Get("email_verified", &verified); err != nil {
+		return false
+	}
+	return verified == true || verified == "true"
+}
+
+// verifyNonce verifies that the nonce claim of the token matches the given nonce. An empty nonce skips the verification.
+func verifyNonce(token jwt.Token, nonce string) error {
+	if nonce == "" {
+		return nil
+	}
+
+	var claimed string
+	if err := token.Get("nonce", &claimed); err != nil {
+		return fmt.Errorf("failed to decode nonce claim: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claimed), []byte(nonce)) != 1 {
+		return fmt.Errorf("nonce claim does not match")
+	}
+
+	return nil
+}
+
+// modeledClaims are the claims that are never a part of Claims.Extra. These are the ones registered by RFC 7519, the
+// ones modeled by Claims, and the nonce.
+var modeledClaims = map[string]bool{"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true,
+	"jti": true, "email": true, "email_verified": true, "given_name": true, "family_name": true, "picture": true, "nonce": true}
+
+// extraClaims returns all claims of the token other than the modeled ones, or nil if there's none.
+func extraClaims(token jwt.Token) map[string]any {
+	var extra map[string]any
+	for _, name := range token.Keys() {
+		if modeledClaims[name] {
+			continue
+		}
+
+		var value any
+		if err := token.Get(name, &value); err != nil {
+			continue
+		}
+
+		if extra == nil {
+			extra = map[string]any{}
+		}
+		extra[name] = value
+	}
+	return extra
+}